@@ -0,0 +1,38 @@
+package access_requests
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/access_requests/middleware"
+	"github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	"github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	rightsPostgres "github.com/rafaceo/go-test-auth/rights/repository/postgres"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
+	rolesMiddleware "github.com/rafaceo/go-test-auth/roles/middleware"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+	roleService "github.com/rafaceo/go-test-auth/roles/service"
+	userMiddleware "github.com/rafaceo/go-test-auth/user/middleware"
+	userPostgres "github.com/rafaceo/go-test-auth/user/repository/postgres"
+	userService "github.com/rafaceo/go-test-auth/user/service"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateAccessRequestService(logger log.Logger, postgresClient *sqlx.DB, tokens service.TokenVerifier) service.AccessRequestService {
+	recorder := audit.NewRecorder(logger, postgresClient)
+	rightsServ := rightsService.NewRightsService(rightsPostgres.NewPostgresRightsRepository(postgresClient))
+	userServ := userService.NewUserService(userPostgres.NewUserRepository(postgresClient), rightsServ)
+	userServ = userMiddleware.NewAuditMiddleware(recorder, userServ)
+	roleServ := roleService.NewRoleService(rolesPostgres.NewRoleRepository(postgresClient), rightsServ)
+	roleServ = rolesMiddleware.NewAuditMiddleware(recorder, roleServ)
+
+	accessServ := service.NewAccessRequestService(postgres.NewAccessRequestRepository(postgresClient), userServ, roleServ, rightsServ, tokens)
+	accessServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "access_requests"), accessServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("access_request_service")
+	accessServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, accessServ)
+
+	return accessServ
+}
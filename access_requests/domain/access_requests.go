@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"strings"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	// StatusFailed — заявка одобрена, но выдать доступ не удалось
+	StatusFailed = "failed"
+)
+
+// AccessRequest — заявка на роль или права с обоснованием
+type AccessRequest struct {
+	ID                uuid.UUID           `json:"id"`
+	UserID            uuid.UUID           `json:"user_id"`
+	RoleID            *int                `json:"role_id,omitempty"`
+	Rights            map[string][]string `json:"rights,omitempty"`
+	MerchantID        string              `json:"merchant_id,omitempty"`
+	Justification     string              `json:"justification"`
+	Status            string              `json:"status"`
+	RequiredApprovals int                 `json:"required_approvals"`
+	RequestedBy       string              `json:"requested_by"`
+	Error             string              `json:"error,omitempty"`
+	CreatedAt         time.Time           `json:"created_at"`
+	ResolvedAt        *time.Time          `json:"resolved_at,omitempty"`
+	Decisions         []Decision          `json:"decisions"`
+	rightsDomain.Validity
+}
+
+type Decision struct {
+	ApproverID uuid.UUID `json:"approver_id"`
+	Approved   bool      `json:"approved"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ApproverRule разрешает одобрять заявки владельцам роли или контекста мерчанта.
+// Правило с MerchantID действует только на заявки этого мерчанта.
+type ApproverRule struct {
+	ID         int    `json:"id"`
+	RoleID     *int   `json:"role_id,omitempty"`
+	MerchantID string `json:"merchant_id,omitempty"`
+}
+
+// SensitiveModule требует нескольких разных одобряющих для заявок, затрагивающих модуль
+type SensitiveModule struct {
+	Module            string `json:"module" db:"module"`
+	RequiredApprovals int    `json:"required_approvals" db:"required_approvals"`
+}
+
+// SensitiveRightsError — права чувствительных модулей выдаются только по одобренной заявке
+type SensitiveRightsError struct {
+	Modules []string `json:"modules"`
+}
+
+func (e *SensitiveRightsError) Error() string {
+	return fmt.Sprintf("modules %s are sensitive: request access through /api/v4/access-requests", strings.Join(e.Modules, ", "))
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.AccessRequestService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.AccessRequestService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateAccessRequest(ctx context.Context, accessToken string, req domain.AccessRequest) (created *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateAccessRequest"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateAccessRequest(ctx, accessToken, req)
+}
+
+func (s *instrumentingService) GetAccessRequest(ctx context.Context, id uuid.UUID) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetAccessRequest"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetAccessRequest(ctx, id)
+}
+
+func (s *instrumentingService) ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) (requests []domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListAccessRequests"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListAccessRequests(ctx, status, userID)
+}
+
+func (s *instrumentingService) ApproveAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ApproveAccessRequest"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ApproveAccessRequest(ctx, accessToken, id, comment)
+}
+
+func (s *instrumentingService) RejectAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "RejectAccessRequest"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.RejectAccessRequest(ctx, accessToken, id, comment)
+}
+
+func (s *instrumentingService) AddApproverRule(ctx context.Context, rule domain.ApproverRule) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "AddApproverRule"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.AddApproverRule(ctx, rule)
+}
+
+func (s *instrumentingService) GetApproverRules(ctx context.Context) (rules []domain.ApproverRule, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetApproverRules"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetApproverRules(ctx)
+}
+
+func (s *instrumentingService) DeleteApproverRule(ctx context.Context, id int) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteApproverRule"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteApproverRule(ctx, id)
+}
+
+func (s *instrumentingService) SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "SetSensitiveModule"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.SetSensitiveModule(ctx, module)
+}
+
+func (s *instrumentingService) GetSensitiveModules(ctx context.Context) (modules []domain.SensitiveModule, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetSensitiveModules"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetSensitiveModules(ctx)
+}
+
+func (s *instrumentingService) DeleteSensitiveModule(ctx context.Context, module string) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteSensitiveModule"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteSensitiveModule(ctx, module)
+}
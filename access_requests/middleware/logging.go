@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.AccessRequestService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.AccessRequestService) service.AccessRequestService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateAccessRequest(ctx context.Context, accessToken string, req domain.AccessRequest) (created *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateAccessRequest",
+			"took", time.Since(begin),
+			"userID", req.UserID,
+			"roleID", req.RoleID,
+			"rights", req.Rights,
+			"merchantID", req.MerchantID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateAccessRequest(ctx, accessToken, req)
+}
+
+func (l loggingService) GetAccessRequest(ctx context.Context, id uuid.UUID) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetAccessRequest",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetAccessRequest(ctx, id)
+}
+
+func (l loggingService) ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) (requests []domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListAccessRequests",
+			"took", time.Since(begin),
+			"status", status,
+			"userID", userID,
+			"count", len(requests),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListAccessRequests(ctx, status, userID)
+}
+
+func (l loggingService) ApproveAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ApproveAccessRequest",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ApproveAccessRequest(ctx, accessToken, id, comment)
+}
+
+func (l loggingService) RejectAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (req *domain.AccessRequest, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "RejectAccessRequest",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.RejectAccessRequest(ctx, accessToken, id, comment)
+}
+
+func (l loggingService) AddApproverRule(ctx context.Context, rule domain.ApproverRule) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "AddApproverRule",
+			"took", time.Since(begin),
+			"roleID", rule.RoleID,
+			"merchantID", rule.MerchantID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.AddApproverRule(ctx, rule)
+}
+
+func (l loggingService) GetApproverRules(ctx context.Context) (rules []domain.ApproverRule, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetApproverRules",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetApproverRules(ctx)
+}
+
+func (l loggingService) DeleteApproverRule(ctx context.Context, id int) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteApproverRule",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteApproverRule(ctx, id)
+}
+
+func (l loggingService) SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "SetSensitiveModule",
+			"took", time.Since(begin),
+			"module", module.Module,
+			"requiredApprovals", module.RequiredApprovals,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.SetSensitiveModule(ctx, module)
+}
+
+func (l loggingService) GetSensitiveModules(ctx context.Context) (modules []domain.SensitiveModule, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetSensitiveModules",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetSensitiveModules(ctx)
+}
+
+func (l loggingService) DeleteSensitiveModule(ctx context.Context, module string) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteSensitiveModule",
+			"took", time.Since(begin),
+			"module", module,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteSensitiveModule(ctx, module)
+}
@@ -0,0 +1,311 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/repository"
+	"time"
+)
+
+type accessRequestRepository struct {
+	db *sqlx.DB
+}
+
+func NewAccessRequestRepository(db *sqlx.DB) repository.AccessRequestRepository {
+	return &accessRequestRepository{db: db}
+}
+
+const selectAccessRequest = `SELECT id, user_id, role_id, rights, merchant_id, justification, status,
+	       required_approvals, requested_by, error, valid_from, valid_until, created_at, resolved_at
+	FROM access_requests`
+
+func (r *accessRequestRepository) CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	var rightsJSON []byte
+	if len(req.Rights) > 0 {
+		var err error
+		if rightsJSON, err = json.Marshal(req.Rights); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO access_requests (id, user_id, role_id, rights, merchant_id, justification, status,
+	                                       required_approvals, requested_by, valid_from, valid_until)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	          RETURNING created_at`
+
+	return r.db.QueryRowContext(ctx, query, req.ID, req.UserID, req.RoleID, rightsJSON, req.MerchantID,
+		req.Justification, req.Status, req.RequiredApprovals, req.RequestedBy, req.ValidFrom, req.ValidUntil,
+	).Scan(&req.CreatedAt)
+}
+
+func (r *accessRequestRepository) GetAccessRequest(ctx context.Context, id uuid.UUID) (*domain.AccessRequest, error) {
+	rows, err := r.db.QueryContext(ctx, selectAccessRequest+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := scanAccessRequests(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("access request not found")
+	}
+
+	req := requests[0]
+	query := `SELECT approver_id, approved, comment, created_at
+	          FROM access_request_decisions
+	          WHERE request_id = $1
+	          ORDER BY created_at`
+	drows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer drows.Close()
+
+	for drows.Next() {
+		var d domain.Decision
+		if err := drows.Scan(&d.ApproverID, &d.Approved, &d.Comment, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		req.Decisions = append(req.Decisions, d)
+	}
+
+	return &req, drows.Err()
+}
+
+func (r *accessRequestRepository) ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) ([]domain.AccessRequest, error) {
+	query := selectAccessRequest + `
+	WHERE ($1::text = '' OR status = $1::text)
+	  AND ($2 = '00000000-0000-0000-0000-000000000000'::uuid OR user_id = $2)
+	ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, status, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccessRequests(rows)
+}
+
+// AddDecision сохраняет решение одобряющего и возвращает число одобрений по заявке.
+// Заявка блокируется на время записи, поэтому одновременные решения не теряются.
+func (r *accessRequestRepository) AddDecision(ctx context.Context, id uuid.UUID, decision domain.Decision) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM access_requests WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("access request not found")
+		}
+		return 0, err
+	}
+	if status != domain.StatusPending {
+		return 0, errors.New("access request is already " + status)
+	}
+
+	query := `INSERT INTO access_request_decisions (request_id, approver_id, approved, comment)
+	          VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, id, decision.ApproverID, decision.Approved, decision.Comment); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return 0, errors.New("approver has already decided on this request")
+		}
+		return 0, err
+	}
+
+	var approvals int
+	query = `SELECT COUNT(*) FROM access_request_decisions WHERE request_id = $1 AND approved`
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&approvals); err != nil {
+		return 0, err
+	}
+
+	return approvals, tx.Commit()
+}
+
+// SetStatus переводит заявку из статуса from в to. false — заявку уже перевёл кто-то другой.
+func (r *accessRequestRepository) SetStatus(ctx context.Context, id uuid.UUID, from, to string, errMsg string) (bool, error) {
+	query := `UPDATE access_requests
+	          SET status = $3, error = $4, resolved_at = NOW()
+	          WHERE id = $1 AND status = $2`
+
+	res, err := r.db.ExecContext(ctx, query, id, from, to, errMsg)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// IsApprover проверяет, подходит ли пользователь хотя бы под одно правило одобряющих.
+// Правило с ролью требует действующего назначения роли у мерчанта заявки или его предка (назначения
+// без мерчанта и в глобальном контексте действуют везде). Правило с мерчантом действует на заявки
+// этого мерчанта и его потомков и требует контекста этого мерчанта, его предка или глобального.
+func (r *accessRequestRepository) IsApprover(ctx context.Context, approverID uuid.UUID, merchantID string, at time.Time) (bool, error) {
+	query := `SELECT EXISTS(
+	              SELECT 1 FROM access_approvers a
+	              WHERE (a.role_id IS NULL OR EXISTS(
+	                        SELECT 1 FROM users_roles ur
+	                        LEFT JOIN users_contexts rc ON rc.user_id = ur.user_id AND rc.merchant_id = ur.merchant_id
+	                        WHERE ur.user_id = $1 AND ur.role_id = a.role_id
+	                          AND (ur.merchant_id IS NULL OR rc.global OR ur.merchant_id IN (
+	                                  SELECT ancestor_id FROM merchant_access_paths WHERE merchant_id = $2))
+	                          AND (ur.valid_from IS NULL OR ur.valid_from <= $3)
+	                          AND (ur.valid_until IS NULL OR ur.valid_until > $3)))
+	                AND (a.merchant_id IS NULL OR (
+	                        a.merchant_id IN (SELECT ancestor_id FROM merchant_access_paths WHERE merchant_id = $2)
+	                        AND EXISTS(
+	                            SELECT 1 FROM users_contexts uc
+	                            WHERE uc.user_id = $1
+	                              AND (uc.global OR uc.merchant_id IN (
+	                                      SELECT ancestor_id FROM merchant_access_paths WHERE merchant_id = a.merchant_id))))))`
+
+	var ok bool
+	err := r.db.QueryRowContext(ctx, query, approverID, merchantID, at).Scan(&ok)
+	return ok, err
+}
+
+func (r *accessRequestRepository) GetRequiredApprovals(ctx context.Context, modules []string) (int, error) {
+	query := `SELECT COALESCE(MAX(required_approvals), 1) FROM sensitive_modules WHERE module = ANY($1)`
+
+	var required int
+	err := r.db.QueryRowContext(ctx, query, pq.Array(modules)).Scan(&required)
+	return required, err
+}
+
+// FilterSensitiveModules возвращает те из modules, что отмечены как чувствительные
+func (r *accessRequestRepository) FilterSensitiveModules(ctx context.Context, modules []string) ([]string, error) {
+	query := `SELECT module FROM sensitive_modules WHERE module = ANY($1) ORDER BY module`
+
+	sensitive := []string{}
+	err := r.db.SelectContext(ctx, &sensitive, query, pq.Array(modules))
+	return sensitive, err
+}
+
+func (r *accessRequestRepository) SensitiveRoleModules(ctx context.Context, roleNames []string) ([]string, error) {
+	query := `SELECT DISTINCT s.module
+	          FROM roles r
+	          CROSS JOIN LATERAL jsonb_object_keys(r.rights) AS m(module)
+	          JOIN sensitive_modules s ON s.module = m.module
+	          WHERE r.role_name = ANY($1)
+	          ORDER BY s.module`
+
+	sensitive := []string{}
+	err := r.db.SelectContext(ctx, &sensitive, query, pq.Array(roleNames))
+	return sensitive, err
+}
+
+func (r *accessRequestRepository) AddApproverRule(ctx context.Context, rule domain.ApproverRule) error {
+	var merchantID *string
+	if rule.MerchantID != "" {
+		merchantID = &rule.MerchantID
+	}
+
+	query := `INSERT INTO access_approvers (role_id, merchant_id) VALUES ($1, $2)`
+	_, err := r.db.ExecContext(ctx, query, rule.RoleID, merchantID)
+	return err
+}
+
+func (r *accessRequestRepository) GetApproverRules(ctx context.Context) ([]domain.ApproverRule, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, role_id, COALESCE(merchant_id, '') FROM access_approvers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []domain.ApproverRule{}
+	for rows.Next() {
+		var rule domain.ApproverRule
+		var roleID sql.NullInt64
+		if err := rows.Scan(&rule.ID, &roleID, &rule.MerchantID); err != nil {
+			return nil, err
+		}
+		if roleID.Valid {
+			id := int(roleID.Int64)
+			rule.RoleID = &id
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (r *accessRequestRepository) DeleteApproverRule(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM access_approvers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return errors.New("approver rule not found")
+	}
+	return nil
+}
+
+func (r *accessRequestRepository) SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) error {
+	query := `INSERT INTO sensitive_modules (module, required_approvals) VALUES ($1, $2)
+	          ON CONFLICT (module) DO UPDATE SET required_approvals = EXCLUDED.required_approvals`
+	_, err := r.db.ExecContext(ctx, query, module.Module, module.RequiredApprovals)
+	return err
+}
+
+func (r *accessRequestRepository) GetSensitiveModules(ctx context.Context) ([]domain.SensitiveModule, error) {
+	modules := []domain.SensitiveModule{}
+	query := `SELECT module, required_approvals FROM sensitive_modules ORDER BY module`
+	if err := r.db.SelectContext(ctx, &modules, query); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
+func (r *accessRequestRepository) DeleteSensitiveModule(ctx context.Context, module string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM sensitive_modules WHERE module = $1`, module)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return errors.New("sensitive module not found")
+	}
+	return nil
+}
+
+func scanAccessRequests(rows *sql.Rows) ([]domain.AccessRequest, error) {
+	defer rows.Close()
+
+	requests := []domain.AccessRequest{}
+	for rows.Next() {
+		var req domain.AccessRequest
+		var roleID sql.NullInt64
+		var rightsJSON []byte
+		err := rows.Scan(&req.ID, &req.UserID, &roleID, &rightsJSON, &req.MerchantID, &req.Justification,
+			&req.Status, &req.RequiredApprovals, &req.RequestedBy, &req.Error, &req.ValidFrom, &req.ValidUntil,
+			&req.CreatedAt, &req.ResolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if roleID.Valid {
+			id := int(roleID.Int64)
+			req.RoleID = &id
+		}
+		if len(rightsJSON) > 0 {
+			if err := json.Unmarshal(rightsJSON, &req.Rights); err != nil {
+				return nil, err
+			}
+		}
+		req.Decisions = []domain.Decision{}
+		requests = append(requests, req)
+	}
+
+	return requests, rows.Err()
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"time"
+)
+
+type AccessRequestRepository interface {
+	CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error
+	GetAccessRequest(ctx context.Context, id uuid.UUID) (*domain.AccessRequest, error)
+	ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) ([]domain.AccessRequest, error)
+	AddDecision(ctx context.Context, id uuid.UUID, decision domain.Decision) (approvals int, err error)
+	SetStatus(ctx context.Context, id uuid.UUID, from, to string, errMsg string) (bool, error)
+	IsApprover(ctx context.Context, approverID uuid.UUID, merchantID string, at time.Time) (bool, error)
+	GetRequiredApprovals(ctx context.Context, modules []string) (int, error)
+	AddApproverRule(ctx context.Context, rule domain.ApproverRule) error
+	GetApproverRules(ctx context.Context) ([]domain.ApproverRule, error)
+	DeleteApproverRule(ctx context.Context, id int) error
+	SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) error
+	GetSensitiveModules(ctx context.Context) ([]domain.SensitiveModule, error)
+	FilterSensitiveModules(ctx context.Context, modules []string) ([]string, error)
+	// SensitiveRoleModules возвращает чувствительные модули из прав ролей roleNames
+	SensitiveRoleModules(ctx context.Context, roleNames []string) ([]string, error)
+	DeleteSensitiveModule(ctx context.Context, module string) error
+}
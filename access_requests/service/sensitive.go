@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/repository"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+)
+
+// SensitiveGuard не пропускает права чувствительных модулей в обход заявок на доступ.
+// Им оборачиваются сервисы пользователей и ролей для прямой выдачи, его же вызывают SCIM,
+// импорт, вход через OIDC и SAML перед назначением ролей и применение манифеста перед изменением ролей.
+// Выдача по одобренной заявке идёт через сервисы без этой проверки.
+type SensitiveGuard struct {
+	repo repository.AccessRequestRepository
+}
+
+func NewSensitiveGuard(repo repository.AccessRequestRepository) *SensitiveGuard {
+	return &SensitiveGuard{repo: repo}
+}
+
+// CheckDirectGrant возвращает *domain.SensitiveRightsError, если среди rights есть чувствительные модули.
+// Имена сравниваются после NormalizeRights, так же как их сохранит сервис.
+func (g *SensitiveGuard) CheckDirectGrant(ctx context.Context, rights map[string][]string) error {
+	modules := make([]string, 0, len(rights))
+	for module := range rightsDomain.NormalizeRights(rights) {
+		modules = append(modules, module)
+	}
+
+	sensitive, err := g.repo.FilterSensitiveModules(ctx, modules)
+	if err != nil {
+		return err
+	}
+	if len(sensitive) > 0 {
+		return &domain.SensitiveRightsError{Modules: sensitive}
+	}
+	return nil
+}
+
+// CheckRoleGrant возвращает *domain.SensitiveRightsError, если среди прав ролей roleNames есть чувствительные модули
+func (g *SensitiveGuard) CheckRoleGrant(ctx context.Context, roleNames []string) error {
+	if len(roleNames) == 0 {
+		return nil
+	}
+
+	sensitive, err := g.repo.SensitiveRoleModules(ctx, roleNames)
+	if err != nil {
+		return err
+	}
+	if len(sensitive) > 0 {
+		return &domain.SensitiveRightsError{Modules: sensitive}
+	}
+	return nil
+}
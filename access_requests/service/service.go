@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/repository"
+	authDomain "github.com/rafaceo/go-test-auth/cmd/domain"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
+	roleService "github.com/rafaceo/go-test-auth/roles/service"
+	userService "github.com/rafaceo/go-test-auth/user/service"
+	"time"
+)
+
+type AccessRequestService interface {
+	CreateAccessRequest(ctx context.Context, accessToken string, req domain.AccessRequest) (*domain.AccessRequest, error)
+	GetAccessRequest(ctx context.Context, id uuid.UUID) (*domain.AccessRequest, error)
+	ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) ([]domain.AccessRequest, error)
+	ApproveAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (*domain.AccessRequest, error)
+	RejectAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (*domain.AccessRequest, error)
+	AddApproverRule(ctx context.Context, rule domain.ApproverRule) error
+	GetApproverRules(ctx context.Context) ([]domain.ApproverRule, error)
+	DeleteApproverRule(ctx context.Context, id int) error
+	SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) error
+	GetSensitiveModules(ctx context.Context) ([]domain.SensitiveModule, error)
+	DeleteSensitiveModule(ctx context.Context, module string) error
+}
+
+// TokenVerifier проверяет access_token и то, что его владелец в статусе active
+type TokenVerifier interface {
+	Authenticate(ctx context.Context, accessToken string) (*authDomain.Claims, error)
+}
+
+type accessRequestService struct {
+	repo   repository.AccessRequestRepository
+	users  userService.UserService
+	roles  roleService.RoleService
+	rights rightsService.RightsService
+	tokens TokenVerifier
+}
+
+// NewAccessRequestService создаёт сервис заявок на доступ. Выдача по одобренной заявке
+// идёт через сервисы пользователей и ролей, с их проверками. Заявитель и одобряющий
+// определяются по access_token.
+func NewAccessRequestService(repo repository.AccessRequestRepository, users userService.UserService, roles roleService.RoleService, rights rightsService.RightsService, tokens TokenVerifier) AccessRequestService {
+	return &accessRequestService{repo: repo, users: users, roles: roles, rights: rights, tokens: tokens}
+}
+
+func (s *accessRequestService) CreateAccessRequest(ctx context.Context, accessToken string, req domain.AccessRequest) (*domain.AccessRequest, error) {
+	requester, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserID == uuid.Nil {
+		req.UserID = requester
+	}
+	if req.Justification == "" {
+		return nil, errors.New("justification is required")
+	}
+	if (req.RoleID == nil) == (len(req.Rights) == 0) {
+		return nil, errors.New("either role_id or rights must be requested")
+	}
+	if err := req.Validity.Validate(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	modules := make([]string, 0, len(req.Rights))
+	if req.RoleID != nil {
+		roleRights, err := s.roles.GetRoleRights(ctx, *req.RoleID)
+		if err != nil {
+			return nil, err
+		}
+		for module := range roleRights {
+			modules = append(modules, module)
+		}
+	} else {
+		req.Rights = rightsDomain.NormalizeRights(req.Rights)
+		if err := s.rights.ValidateRights(ctx, req.Rights); err != nil {
+			return nil, err
+		}
+		for module := range req.Rights {
+			modules = append(modules, module)
+		}
+	}
+
+	required, err := s.repo.GetRequiredApprovals(ctx, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	req.ID = uuid.New()
+	req.Status = domain.StatusPending
+	req.RequiredApprovals = required
+	req.RequestedBy = requester.String()
+	req.Error = ""
+	req.ResolvedAt = nil
+	req.Decisions = []domain.Decision{}
+	if err := s.repo.CreateAccessRequest(ctx, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+func (s *accessRequestService) GetAccessRequest(ctx context.Context, id uuid.UUID) (*domain.AccessRequest, error) {
+	return s.repo.GetAccessRequest(ctx, id)
+}
+
+func (s *accessRequestService) ListAccessRequests(ctx context.Context, status string, userID uuid.UUID) ([]domain.AccessRequest, error) {
+	switch status {
+	case "", domain.StatusPending, domain.StatusApproved, domain.StatusRejected, domain.StatusFailed:
+	default:
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+	return s.repo.ListAccessRequests(ctx, status, userID)
+}
+
+// ApproveAccessRequest учитывает одобрение и, когда набрано нужное число разных одобряющих,
+// выдаёт доступ. Если выдать не удалось, заявка переходит в failed с текстом ошибки.
+func (s *accessRequestService) ApproveAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (*domain.AccessRequest, error) {
+	req, approver, err := s.authorizeDecision(ctx, accessToken, id)
+	if err != nil {
+		return nil, err
+	}
+	ctx = requestinfo.WithVerifiedActor(ctx, approver.String())
+
+	approvals, err := s.repo.AddDecision(ctx, id, domain.Decision{ApproverID: approver, Approved: true, Comment: comment})
+	if err != nil {
+		return nil, err
+	}
+	if approvals < req.RequiredApprovals {
+		return s.repo.GetAccessRequest(ctx, id)
+	}
+
+	won, err := s.repo.SetStatus(ctx, id, domain.StatusPending, domain.StatusApproved, "")
+	if err != nil {
+		return nil, err
+	}
+	if won {
+		if err := s.apply(ctx, req); err != nil {
+			if _, serr := s.repo.SetStatus(ctx, id, domain.StatusApproved, domain.StatusFailed, err.Error()); serr != nil {
+				return nil, serr
+			}
+			return nil, fmt.Errorf("access request approved but grant failed: %w", err)
+		}
+	}
+
+	return s.repo.GetAccessRequest(ctx, id)
+}
+
+func (s *accessRequestService) RejectAccessRequest(ctx context.Context, accessToken string, id uuid.UUID, comment string) (*domain.AccessRequest, error) {
+	_, approver, err := s.authorizeDecision(ctx, accessToken, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.AddDecision(ctx, id, domain.Decision{ApproverID: approver, Approved: false, Comment: comment}); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.SetStatus(ctx, id, domain.StatusPending, domain.StatusRejected, ""); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAccessRequest(ctx, id)
+}
+
+// authorizeDecision проверяет, что решение принимает настроенный одобряющий и не сам заявитель
+func (s *accessRequestService) authorizeDecision(ctx context.Context, accessToken string, id uuid.UUID) (*domain.AccessRequest, uuid.UUID, error) {
+	approver, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	req, err := s.repo.GetAccessRequest(ctx, id)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if req.Status != domain.StatusPending {
+		return nil, uuid.Nil, fmt.Errorf("access request is already %s", req.Status)
+	}
+	if approver == req.UserID || approver.String() == req.RequestedBy {
+		return nil, uuid.Nil, errors.New("requester cannot decide on own access request")
+	}
+
+	ok, err := s.repo.IsApprover(ctx, approver, req.MerchantID, time.Now().UTC())
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if !ok {
+		return nil, uuid.Nil, errors.New("user is not an approver for this access request")
+	}
+
+	return req, approver, nil
+}
+
+func (s *accessRequestService) authenticate(ctx context.Context, accessToken string) (uuid.UUID, error) {
+	claims, err := s.tokens.Authenticate(ctx, accessToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+func (s *accessRequestService) apply(ctx context.Context, req *domain.AccessRequest) error {
+	if req.RoleID != nil {
+		return s.roles.AssignRoleToUser(ctx, req.UserID, *req.RoleID, req.MerchantID, true, req.Validity)
+	}
+	return s.users.GrantRightsToUser(ctx, req.UserID, req.Rights, req.Validity)
+}
+
+func (s *accessRequestService) AddApproverRule(ctx context.Context, rule domain.ApproverRule) error {
+	if rule.RoleID == nil && rule.MerchantID == "" {
+		return errors.New("approver rule needs role_id or merchant_id")
+	}
+	return s.repo.AddApproverRule(ctx, rule)
+}
+
+func (s *accessRequestService) GetApproverRules(ctx context.Context) ([]domain.ApproverRule, error) {
+	return s.repo.GetApproverRules(ctx)
+}
+
+func (s *accessRequestService) DeleteApproverRule(ctx context.Context, id int) error {
+	return s.repo.DeleteApproverRule(ctx, id)
+}
+
+func (s *accessRequestService) SetSensitiveModule(ctx context.Context, module domain.SensitiveModule) error {
+	if module.Module == "" {
+		return errors.New("module is required")
+	}
+	if module.RequiredApprovals == 0 {
+		module.RequiredApprovals = 2
+	}
+	if module.RequiredApprovals < 2 {
+		return errors.New("sensitive module requires at least 2 approvals")
+	}
+	return s.repo.SetSensitiveModule(ctx, module)
+}
+
+func (s *accessRequestService) GetSensitiveModules(ctx context.Context) ([]domain.SensitiveModule, error) {
+	return s.repo.GetSensitiveModules(ctx)
+}
+
+func (s *accessRequestService) DeleteSensitiveModule(ctx context.Context, module string) error {
+	return s.repo.DeleteSensitiveModule(ctx, module)
+}
@@ -0,0 +1,423 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/access_requests/transport"
+	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func GetAccessRequestHandlers(serv service.AccessRequestService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+
+	createHandler := kithttp.NewServer(
+		MakeCreateAccessRequestEndpoint(serv),
+		DecodeCreateAccessRequestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetAccessRequestEndpoint(serv),
+		DecodeGetAccessRequestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listHandler := kithttp.NewServer(
+		MakeListAccessRequestsEndpoint(serv),
+		DecodeListAccessRequestsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	approveHandler := kithttp.NewServer(
+		MakeApproveAccessRequestEndpoint(serv),
+		DecodeDecideAccessRequestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	rejectHandler := kithttp.NewServer(
+		MakeRejectAccessRequestEndpoint(serv),
+		DecodeDecideAccessRequestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	addApproverHandler := kithttp.NewServer(
+		MakeAddApproverRuleEndpoint(serv),
+		DecodeAddApproverRuleRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getApproversHandler := kithttp.NewServer(
+		MakeGetApproverRulesEndpoint(serv),
+		DecodeGetApproverRulesRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteApproverHandler := kithttp.NewServer(
+		MakeDeleteApproverRuleEndpoint(serv),
+		DecodeDeleteApproverRuleRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	setSensitiveHandler := kithttp.NewServer(
+		MakeSetSensitiveModuleEndpoint(serv),
+		DecodeSetSensitiveModuleRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getSensitiveHandler := kithttp.NewServer(
+		MakeGetSensitiveModulesEndpoint(serv),
+		DecodeGetSensitiveModulesRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteSensitiveHandler := kithttp.NewServer(
+		MakeDeleteSensitiveModuleEndpoint(serv),
+		DecodeDeleteSensitiveModuleRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/access-requests",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/access-requests",
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/access-requests/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/access-requests/{id}/approve",
+			Handler: approveHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/access-requests/{id}/reject",
+			Handler: rejectHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/access-approvers",
+			Handler: addApproverHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/access-approvers",
+			Handler: getApproversHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/access-approvers/{id}",
+			Handler: deleteApproverHandler,
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    "/api/v4/sensitive-modules/{module}",
+			Handler: setSensitiveHandler,
+			Methods: []string{"PUT"},
+		},
+		{
+			Path:    "/api/v4/sensitive-modules",
+			Handler: getSensitiveHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/sensitive-modules/{module}",
+			Handler: deleteSensitiveHandler,
+			Methods: []string{"DELETE"},
+		},
+	}
+}
+
+// tokenError: недействительный access_token или неактивный владелец отдаются кодировщику ошибок (401 или 403)
+func tokenError(err error) bool {
+	var argErr *e.ArgError
+	return errors.As(err, &argErr)
+}
+
+func MakeCreateAccessRequestEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateAccessRequestRequest)
+
+		created, err := svc.CreateAccessRequest(ctx, req.AccessToken, domain.AccessRequest{
+			UserID:        req.UserID,
+			RoleID:        req.RoleID,
+			Rights:        req.Rights,
+			MerchantID:    req.MerchantID,
+			Justification: req.Justification,
+			Validity:      rightsDomain.Validity{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil},
+		})
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return transport.AccessRequestResponse{Error: err.Error(), UnknownRights: unknown}, nil
+		}
+		return transport.AccessRequestResponse{Request: created}, nil
+	}
+}
+
+func MakeGetAccessRequestEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.GetAccessRequestRequest)
+		accessRequest, err := svc.GetAccessRequest(ctx, req.ID)
+		if err != nil {
+			return transport.AccessRequestResponse{Error: err.Error()}, nil
+		}
+		return transport.AccessRequestResponse{Request: accessRequest}, nil
+	}
+}
+
+func MakeListAccessRequestsEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ListAccessRequestsRequest)
+		requests, err := svc.ListAccessRequests(ctx, req.Status, req.UserID)
+		if err != nil {
+			return transport.ListAccessRequestsResponse{Error: err.Error()}, nil
+		}
+		return transport.ListAccessRequestsResponse{Requests: requests}, nil
+	}
+}
+
+func MakeApproveAccessRequestEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DecideAccessRequestRequest)
+		accessRequest, err := svc.ApproveAccessRequest(ctx, req.AccessToken, req.ID, req.Comment)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.AccessRequestResponse{Error: err.Error()}, nil
+		}
+		return transport.AccessRequestResponse{Request: accessRequest}, nil
+	}
+}
+
+func MakeRejectAccessRequestEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DecideAccessRequestRequest)
+		accessRequest, err := svc.RejectAccessRequest(ctx, req.AccessToken, req.ID, req.Comment)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.AccessRequestResponse{Error: err.Error()}, nil
+		}
+		return transport.AccessRequestResponse{Request: accessRequest}, nil
+	}
+}
+
+func MakeAddApproverRuleEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.AddApproverRuleRequest)
+		err := svc.AddApproverRule(ctx, domain.ApproverRule{RoleID: req.RoleID, MerchantID: req.MerchantID})
+		if err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Правило одобряющих добавлено"}, nil
+	}
+}
+
+func MakeGetApproverRulesEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		rules, err := svc.GetApproverRules(ctx)
+		if err != nil {
+			return transport.GetApproverRulesResponse{Error: err.Error()}, nil
+		}
+		return transport.GetApproverRulesResponse{Rules: rules}, nil
+	}
+}
+
+func MakeDeleteApproverRuleEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DeleteApproverRuleRequest)
+		if err := svc.DeleteApproverRule(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Правило одобряющих удалено"}, nil
+	}
+}
+
+func MakeSetSensitiveModuleEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.SetSensitiveModuleRequest)
+		err := svc.SetSensitiveModule(ctx, domain.SensitiveModule{Module: req.Module, RequiredApprovals: req.RequiredApprovals})
+		if err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Модуль отмечен как чувствительный"}, nil
+	}
+}
+
+func MakeGetSensitiveModulesEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		modules, err := svc.GetSensitiveModules(ctx)
+		if err != nil {
+			return transport.GetSensitiveModulesResponse{Error: err.Error()}, nil
+		}
+		return transport.GetSensitiveModulesResponse{Modules: modules}, nil
+	}
+}
+
+func MakeDeleteSensitiveModuleEndpoint(svc service.AccessRequestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DeleteSensitiveModuleRequest)
+		if err := svc.DeleteSensitiveModule(ctx, req.Module); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Отметка чувствительного модуля снята"}, nil
+	}
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", e.InvalidTokenError
+	}
+	return strings.TrimPrefix(header, "Bearer "), nil
+}
+
+func DecodeCreateAccessRequestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var req transport.CreateAccessRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.AccessToken = token
+
+	return req, nil
+}
+
+func DecodeGetAccessRequestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid access request ID")
+	}
+	return transport.GetAccessRequestRequest{ID: id}, nil
+}
+
+func DecodeListAccessRequestsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	req := transport.ListAccessRequestsRequest{Status: query.Get("status")}
+	if userID := query.Get("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return nil, errors.New("invalid user ID")
+		}
+		req.UserID = id
+	}
+	return req, nil
+}
+
+func DecodeDecideAccessRequestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid access request ID")
+	}
+
+	var req transport.DecideAccessRequestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+	}
+	req.AccessToken = token
+	req.ID = id
+
+	return req, nil
+}
+
+func DecodeAddApproverRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.AddApproverRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeGetApproverRulesRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return transport.GetApproverRulesRequest{}, nil
+}
+
+func DecodeDeleteApproverRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid approver rule ID")
+	}
+	return transport.DeleteApproverRuleRequest{ID: id}, nil
+}
+
+func DecodeSetSensitiveModuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.SetSensitiveModuleRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+	}
+	req.Module = mux.Vars(r)["module"]
+	return req, nil
+}
+
+func DecodeGetSensitiveModulesRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return transport.GetSensitiveModulesRequest{}, nil
+}
+
+func DecodeDeleteSensitiveModuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.DeleteSensitiveModuleRequest{Module: mux.Vars(r)["module"]}, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
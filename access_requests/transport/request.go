@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// AccessToken заявителя и одобряющего берётся из заголовка Authorization: Bearer
+type CreateAccessRequestRequest struct {
+	AccessToken   string              `json:"-"`
+	UserID        uuid.UUID           `json:"user_id"`
+	RoleID        *int                `json:"role_id,omitempty"`
+	Rights        map[string][]string `json:"rights,omitempty"`
+	MerchantID    string              `json:"merchant_id"`
+	Justification string              `json:"justification"`
+	ValidFrom     *time.Time          `json:"valid_from,omitempty"`
+	ValidUntil    *time.Time          `json:"valid_until,omitempty"`
+}
+
+type GetAccessRequestRequest struct {
+	ID uuid.UUID `json:"-"`
+}
+
+type ListAccessRequestsRequest struct {
+	Status string    `json:"status"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type DecideAccessRequestRequest struct {
+	AccessToken string    `json:"-"`
+	ID          uuid.UUID `json:"-"`
+	Comment     string    `json:"comment"`
+}
+
+type AddApproverRuleRequest struct {
+	RoleID     *int   `json:"role_id,omitempty"`
+	MerchantID string `json:"merchant_id"`
+}
+
+type GetApproverRulesRequest struct {
+}
+
+type DeleteApproverRuleRequest struct {
+	ID int `json:"-"`
+}
+
+type SetSensitiveModuleRequest struct {
+	Module            string `json:"-"`
+	RequiredApprovals int    `json:"required_approvals"`
+}
+
+type GetSensitiveModulesRequest struct {
+}
+
+type DeleteSensitiveModuleRequest struct {
+	Module string `json:"-"`
+}
@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"github.com/rafaceo/go-test-auth/access_requests/domain"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+)
+
+type AccessRequestResponse struct {
+	Request       *domain.AccessRequest            `json:"request,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
+}
+
+type ListAccessRequestsResponse struct {
+	Requests []domain.AccessRequest `json:"requests"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+type GetApproverRulesResponse struct {
+	Rules []domain.ApproverRule `json:"rules"`
+	Error string                `json:"error,omitempty"`
+}
+
+type GetSensitiveModulesResponse struct {
+	Modules []domain.SensitiveModule `json:"modules"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
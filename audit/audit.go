@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit/middleware"
+	"github.com/rafaceo/go-test-auth/audit/repository/postgres"
+	"github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateAuditService(logger log.Logger, postgresClient *sqlx.DB) service.AuditService {
+	auditServ := service.NewAuditService(postgres.NewAuditRepository(postgresClient), nil)
+	auditServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "audit"), auditServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("audit_service")
+	auditServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, auditServ)
+
+	return auditServ
+}
+
+// NewRecorder создаёт сервис для записи событий из audit-middleware других сервисов.
+// Метрики не подключаются: подсистему можно зарегистрировать только один раз.
+func NewRecorder(logger log.Logger, postgresClient *sqlx.DB) service.AuditService {
+	auditServ := service.NewAuditService(postgres.NewAuditRepository(postgresClient), nil)
+	return middleware.NewLoggingMiddleware(log.With(logger, "component", "audit"), auditServ)
+}
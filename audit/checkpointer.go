@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit/middleware"
+	"github.com/rafaceo/go-test-auth/audit/repository/postgres"
+	"github.com/rafaceo/go-test-auth/audit/service"
+)
+
+// Checkpointer периодически подписывает хеш последнего события журнала аудита
+type Checkpointer struct {
+	service  service.AuditService
+	interval time.Duration
+}
+
+func (sf *ServiceFactory) CreateCheckpointer(logger log.Logger, postgresClient *sqlx.DB, interval time.Duration, key []byte) *Checkpointer {
+	auditServ := service.NewAuditService(postgres.NewAuditRepository(postgresClient), key)
+
+	return &Checkpointer{
+		service:  middleware.NewLoggingMiddleware(log.With(logger, "component", "audit_checkpointer"), auditServ),
+		interval: interval,
+	}
+}
+
+// Run блокируется до отмены ctx
+func (c *Checkpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = c.service.CreateCheckpoint(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	TargetUser         = "user"
+	TargetRole         = "role"
+	TargetRight        = "right"
+	TargetUserContext  = "user_context"
+	TargetMerchant     = "merchant"
+	TargetUserImport   = "user_import"
+	TargetScimToken    = "scim_token"
+	TargetIdProvider   = "identity_provider"
+	TargetSamlProvider = "saml_provider"
+)
+
+// Event — запись журнала аудита об одном административном изменении
+type Event struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	SourceIP   string          `json:"source_ip,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+}
+
+// NewEvent собирает событие; состояния до и после сериализуются в JSON, nil означает отсутствие состояния
+func NewEvent(action, targetType, targetID string, before, after interface{}) Event {
+	return Event{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     toRaw(before),
+		After:      toRaw(after),
+	}
+}
+
+func toRaw(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+type FieldChange struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Diff сравнивает верхнеуровневые поля двух JSON-объектов. Если хотя бы одна сторона
+// не объект, изменение записывается целиком под ключом "value".
+func Diff(before, after json.RawMessage) json.RawMessage {
+	var b, a interface{}
+	if len(before) > 0 {
+		_ = json.Unmarshal(before, &b)
+	}
+	if len(after) > 0 {
+		_ = json.Unmarshal(after, &a)
+	}
+
+	changes := make(map[string]FieldChange)
+	bm, bok := b.(map[string]interface{})
+	am, aok := a.(map[string]interface{})
+	if (bok || b == nil) && (aok || a == nil) {
+		keys := make(map[string]struct{})
+		for k := range bm {
+			keys[k] = struct{}{}
+		}
+		for k := range am {
+			keys[k] = struct{}{}
+		}
+		for k := range keys {
+			if !reflect.DeepEqual(bm[k], am[k]) {
+				changes[k] = FieldChange{From: bm[k], To: am[k]}
+			}
+		}
+	} else if !reflect.DeepEqual(b, a) {
+		changes["value"] = FieldChange{From: b, To: a}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return toRaw(changes)
+}
+
+// Filter — условия выборки журнала. Пустые поля не ограничивают выборку.
+type Filter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Cursor     string
+}
+
+type Page struct {
+	Events     []Event `json:"events"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor скрывает от клиента, что курсор — это ID последней выданной записи
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
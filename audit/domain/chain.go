@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checkpoint фиксирует хеш события на момент подписи. Подпись — HMAC-SHA256 ключом,
+// которого нет в базе, поэтому переписать цепочку целиком без ключа нельзя.
+type Checkpoint struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"event_id"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	BreakHash       = "hash_mismatch"
+	BreakPrevHash   = "prev_hash_mismatch"
+	BreakUnhashed   = "unhashed_event"
+	BreakCheckpoint = "checkpoint_mismatch"
+	BreakSignature  = "checkpoint_signature_invalid"
+)
+
+// BrokenLink — первое найденное нарушение цепочки
+type BrokenLink struct {
+	EventID      int64  `json:"event_id"`
+	CheckpointID int64  `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+	Expected     string `json:"expected,omitempty"`
+	Actual       string `json:"actual,omitempty"`
+}
+
+type VerifyReport struct {
+	EventsChecked      int         `json:"events_checked"`
+	CheckpointsChecked int         `json:"checkpoints_checked"`
+	LastEventID        int64       `json:"last_event_id"`
+	Broken             *BrokenLink `json:"broken,omitempty"`
+}
+
+func (r VerifyReport) OK() bool {
+	return r.Broken == nil
+}
+
+// ComputeHash считает SHA-256 от содержимого события и хеша предыдущего.
+// JSON приводится к каноническому виду, так как JSONB не сохраняет исходное форматирование.
+func (e Event) ComputeHash(prevHash string) string {
+	fields := []string{
+		strconv.FormatInt(e.ID, 10),
+		e.Actor,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		canonicalJSON(e.Before),
+		canonicalJSON(e.After),
+		canonicalJSON(e.Diff),
+		e.RequestID,
+		e.SourceIP,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		prevHash,
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		// Длина перед значением исключает совпадения при переносе символов между полями
+		h.Write([]byte(strconv.Itoa(len(field))))
+		h.Write([]byte{':'})
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func canonicalJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return string(raw)
+	}
+	return string(data)
+}
+
+// Sign считает подпись контрольной точки
+func (c Checkpoint) Sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{
+		strconv.FormatInt(c.EventID, 10),
+		c.Hash,
+		c.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c Checkpoint) ValidSignature(key []byte) bool {
+	expected, err := hex.DecodeString(c.Sign(key))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+	"github.com/rafaceo/go-test-auth/audit/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.AuditService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.AuditService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) Record(ctx context.Context, event domain.Event) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Record"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Record(ctx, event)
+}
+
+func (s *instrumentingService) QueryEvents(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "QueryEvents"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.QueryEvents(ctx, filter)
+}
+
+func (s *instrumentingService) CreateCheckpoint(ctx context.Context) (checkpoint *domain.Checkpoint, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateCheckpoint"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateCheckpoint(ctx)
+}
+
+func (s *instrumentingService) Verify(ctx context.Context) (report domain.VerifyReport, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Verify"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Verify(ctx)
+}
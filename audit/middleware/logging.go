@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+	"github.com/rafaceo/go-test-auth/audit/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.AuditService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.AuditService) service.AuditService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) Record(ctx context.Context, event domain.Event) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Record",
+			"took", time.Since(begin),
+			"action", event.Action,
+			"targetType", event.TargetType,
+			"targetID", event.TargetID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Record(ctx, event)
+}
+
+func (l loggingService) QueryEvents(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "QueryEvents",
+			"took", time.Since(begin),
+			"actor", filter.Actor,
+			"action", filter.Action,
+			"targetType", filter.TargetType,
+			"targetID", filter.TargetID,
+			"count", len(page.Events),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.QueryEvents(ctx, filter)
+}
+
+func (l loggingService) CreateCheckpoint(ctx context.Context) (checkpoint *domain.Checkpoint, err error) {
+	defer func(begin time.Time) {
+		var eventID int64
+		if checkpoint != nil {
+			eventID = checkpoint.EventID
+		}
+		_ = l.logger.Log(
+			"method", "CreateCheckpoint",
+			"took", time.Since(begin),
+			"eventID", eventID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateCheckpoint(ctx)
+}
+
+func (l loggingService) Verify(ctx context.Context) (report domain.VerifyReport, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Verify",
+			"took", time.Since(begin),
+			"eventsChecked", report.EventsChecked,
+			"ok", report.OK(),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Verify(ctx)
+}
@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+	"github.com/rafaceo/go-test-auth/audit/repository"
+	"time"
+)
+
+// chainLockKey — ключ advisory-блокировки, упорядочивающей запись звеньев цепочки
+const chainLockKey = 7_301_552_001
+
+const selectEvent = `SELECT id, actor, action, target_type, target_id, before, after, diff, request_id, source_ip,
+	       created_at, prev_hash, hash
+	FROM audit_events`
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) repository.AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// InsertEvent присваивает событию ID, связывает его с последним записанным событием и сохраняет.
+// Запись сериализуется блокировкой, иначе два события могли бы сослаться на одно и то же предыдущее.
+func (r *auditRepository) InsertEvent(ctx context.Context, event *domain.Event) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('audit_events', 'id'))`).Scan(&event.ID); err != nil {
+		return err
+	}
+
+	// TIMESTAMP хранит микросекунды — хеш считается от того же значения, что прочитает verify
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	event.PrevHash = prevHash
+	event.Hash = event.ComputeHash(prevHash)
+
+	query := `INSERT INTO audit_events (id, actor, action, target_type, target_id, before, after, diff,
+	                                    request_id, source_ip, created_at, prev_hash, hash)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	_, err = tx.ExecContext(ctx, query, event.ID, event.Actor, event.Action, event.TargetType, event.TargetID,
+		nullJSON(event.Before), nullJSON(event.After), nullJSON(event.Diff), event.RequestID, event.SourceIP,
+		event.CreatedAt, event.PrevHash, event.Hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// QueryEvents возвращает события от новых к старым; afterID > 0 продолжает выборку после курсора
+func (r *auditRepository) QueryEvents(ctx context.Context, filter domain.Filter, afterID int64) ([]domain.Event, error) {
+	query := selectEvent + `
+	WHERE ($1::text = '' OR actor = $1::text)
+	  AND ($2::text = '' OR action = $2::text)
+	  AND ($3::text = '' OR target_type = $3::text)
+	  AND ($4::text = '' OR target_id = $4::text)
+	  AND ($5::timestamp IS NULL OR created_at >= $5::timestamp)
+	  AND ($6::timestamp IS NULL OR created_at < $6::timestamp)
+	  AND ($7::bigint = 0 OR id < $7::bigint)
+	ORDER BY id DESC
+	LIMIT $8`
+
+	rows, err := r.db.QueryContext(ctx, query, filter.Actor, filter.Action, filter.TargetType, filter.TargetID,
+		filter.From, filter.To, afterID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// GetEventsAfter возвращает события в порядке записи, начиная со следующего за afterID
+func (r *auditRepository) GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	rows, err := r.db.QueryContext(ctx, selectEvent+` WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (r *auditRepository) GetLastEvent(ctx context.Context) (*domain.Event, error) {
+	rows, err := r.db.QueryContext(ctx, selectEvent+` ORDER BY id DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+func (r *auditRepository) InsertCheckpoint(ctx context.Context, checkpoint *domain.Checkpoint) error {
+	query := `INSERT INTO audit_checkpoints (event_id, hash, signature, created_at)
+	          VALUES ($1, $2, $3, $4)
+	          RETURNING id`
+	return r.db.QueryRowContext(ctx, query, checkpoint.EventID, checkpoint.Hash, checkpoint.Signature, checkpoint.CreatedAt).
+		Scan(&checkpoint.ID)
+}
+
+func (r *auditRepository) GetCheckpoints(ctx context.Context) ([]domain.Checkpoint, error) {
+	checkpoints := []domain.Checkpoint{}
+	query := `SELECT id, event_id, hash, signature, created_at FROM audit_checkpoints ORDER BY event_id, id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Checkpoint
+		if err := rows.Scan(&c.ID, &c.EventID, &c.Hash, &c.Signature, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
+
+func (r *auditRepository) GetLastCheckpoint(ctx context.Context) (*domain.Checkpoint, error) {
+	var c domain.Checkpoint
+	query := `SELECT id, event_id, hash, signature, created_at FROM audit_checkpoints ORDER BY id DESC LIMIT 1`
+	err := r.db.QueryRowContext(ctx, query).Scan(&c.ID, &c.EventID, &c.Hash, &c.Signature, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func scanEvents(rows *sql.Rows) ([]domain.Event, error) {
+	defer rows.Close()
+
+	events := []domain.Event{}
+	for rows.Next() {
+		var e domain.Event
+		var before, after, diff []byte
+		err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &diff,
+			&e.RequestID, &e.SourceIP, &e.CreatedAt, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		e.Before, e.After, e.Diff = before, after, diff
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+)
+
+type AuditRepository interface {
+	InsertEvent(ctx context.Context, event *domain.Event) error
+	QueryEvents(ctx context.Context, filter domain.Filter, afterID int64) ([]domain.Event, error)
+	GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error)
+	GetLastEvent(ctx context.Context) (*domain.Event, error)
+	InsertCheckpoint(ctx context.Context, checkpoint *domain.Checkpoint) error
+	GetCheckpoints(ctx context.Context) ([]domain.Checkpoint, error)
+	GetLastCheckpoint(ctx context.Context) (*domain.Checkpoint, error)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+	"github.com/rafaceo/go-test-auth/audit/repository"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"time"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+	verifyBatch  = 1000
+)
+
+type AuditService interface {
+	Record(ctx context.Context, event domain.Event) error
+	QueryEvents(ctx context.Context, filter domain.Filter) (domain.Page, error)
+	CreateCheckpoint(ctx context.Context) (*domain.Checkpoint, error)
+	Verify(ctx context.Context) (domain.VerifyReport, error)
+}
+
+type auditService struct {
+	repo          repository.AuditRepository
+	checkpointKey []byte
+}
+
+// NewAuditService создаёт сервис журнала аудита. checkpointKey подписывает контрольные точки;
+// без него точки не создаются, а verify проверяет только цепочку хешей.
+func NewAuditService(repo repository.AuditRepository, checkpointKey []byte) AuditService {
+	return &auditService{repo: repo, checkpointKey: checkpointKey}
+}
+
+// Record дополняет событие данными запроса из контекста и считает diff, если он не задан.
+// Автором записывается только подтверждённый инициатор: заголовок X-Owner клиент задаёт сам.
+func (s *auditService) Record(ctx context.Context, event domain.Event) error {
+	if event.Action == "" || event.TargetType == "" {
+		return errors.New("audit event requires action and target type")
+	}
+	if event.Actor == "" {
+		event.Actor = requestinfo.VerifiedActor(ctx)
+	}
+	if event.RequestID == "" {
+		event.RequestID = requestinfo.RequestID(ctx)
+	}
+	if event.SourceIP == "" {
+		event.SourceIP = requestinfo.SourceIP(ctx)
+	}
+	if event.Diff == nil {
+		event.Diff = domain.Diff(event.Before, event.After)
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	event.PrevHash, event.Hash = "", ""
+
+	return s.repo.InsertEvent(ctx, &event)
+}
+
+func (s *auditService) QueryEvents(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return domain.Page{}, errors.New("to must be after from")
+	}
+
+	afterID, err := domain.DecodeCursor(filter.Cursor)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	limit := filter.Limit
+	filter.Limit++
+	events, err := s.repo.QueryEvents(ctx, filter, afterID)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	page := domain.Page{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = domain.EncodeCursor(page.Events[limit-1].ID)
+	}
+	return page, nil
+}
+
+// CreateCheckpoint подписывает хеш последнего события. nil — новых событий с прошлой точки нет.
+func (s *auditService) CreateCheckpoint(ctx context.Context) (*domain.Checkpoint, error) {
+	if len(s.checkpointKey) == 0 {
+		return nil, errors.New("audit checkpoint key is not configured")
+	}
+
+	last, err := s.repo.GetLastEvent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil || last.Hash == "" {
+		return nil, nil
+	}
+
+	previous, err := s.repo.GetLastCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.EventID >= last.ID {
+		return nil, nil
+	}
+
+	checkpoint := domain.Checkpoint{
+		EventID:   last.ID,
+		Hash:      last.Hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = checkpoint.Sign(s.checkpointKey)
+	if err := s.repo.InsertCheckpoint(ctx, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Verify проходит цепочку от первого события и останавливается на первом нарушении.
+// События без хеша допустимы только в начале журнала — они записаны до включения цепочки.
+func (s *auditService) Verify(ctx context.Context) (domain.VerifyReport, error) {
+	var report domain.VerifyReport
+
+	checkpoints, err := s.repo.GetCheckpoints(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	var prevHash string
+	chained := false
+	next := 0
+
+	// checkpointsUpTo сверяет точки, относящиеся к событиям не дальше eventID;
+	// точка, событие которой так и не встретилось, означает удалённую запись
+	checkpointsUpTo := func(eventID int64, eventHash string, found bool) *domain.BrokenLink {
+		for next < len(checkpoints) && checkpoints[next].EventID <= eventID {
+			c := checkpoints[next]
+			next++
+			report.CheckpointsChecked++
+
+			if len(s.checkpointKey) > 0 && !c.ValidSignature(s.checkpointKey) {
+				return &domain.BrokenLink{EventID: c.EventID, CheckpointID: c.ID, Reason: domain.BreakSignature}
+			}
+			if !found || c.EventID != eventID || c.Hash != eventHash {
+				actual := ""
+				if found && c.EventID == eventID {
+					actual = eventHash
+				}
+				return &domain.BrokenLink{EventID: c.EventID, CheckpointID: c.ID, Reason: domain.BreakCheckpoint, Expected: c.Hash, Actual: actual}
+			}
+		}
+		return nil
+	}
+
+	var afterID int64
+	for {
+		events, err := s.repo.GetEventsAfter(ctx, afterID, verifyBatch)
+		if err != nil {
+			return report, err
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+			report.LastEventID = e.ID
+			report.EventsChecked++
+
+			if broken := checkpointsUpTo(e.ID-1, "", false); broken != nil {
+				report.Broken = broken
+				return report, nil
+			}
+
+			if e.Hash == "" {
+				if chained {
+					report.Broken = &domain.BrokenLink{EventID: e.ID, Reason: domain.BreakUnhashed}
+					return report, nil
+				}
+				continue
+			}
+			chained = true
+
+			if e.PrevHash != prevHash {
+				report.Broken = &domain.BrokenLink{EventID: e.ID, Reason: domain.BreakPrevHash, Expected: prevHash, Actual: e.PrevHash}
+				return report, nil
+			}
+			if computed := e.ComputeHash(e.PrevHash); computed != e.Hash {
+				report.Broken = &domain.BrokenLink{EventID: e.ID, Reason: domain.BreakHash, Expected: computed, Actual: e.Hash}
+				return report, nil
+			}
+			prevHash = e.Hash
+
+			if broken := checkpointsUpTo(e.ID, e.Hash, true); broken != nil {
+				report.Broken = broken
+				return report, nil
+			}
+		}
+
+		if len(events) < verifyBatch {
+			break
+		}
+	}
+
+	if next < len(checkpoints) {
+		report.Broken = checkpointsUpTo(checkpoints[len(checkpoints)-1].EventID, "", false)
+	}
+	return report, nil
+}
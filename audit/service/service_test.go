@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rafaceo/go-test-auth/audit/domain"
+)
+
+// memoryAudit сцепляет события так же, как postgres-репозиторий
+type memoryAudit struct {
+	events      []domain.Event
+	checkpoints []domain.Checkpoint
+}
+
+func (r *memoryAudit) InsertEvent(_ context.Context, event *domain.Event) error {
+	var prevHash string
+	if len(r.events) > 0 {
+		prevHash = r.events[len(r.events)-1].Hash
+		event.ID = r.events[len(r.events)-1].ID + 1
+	} else {
+		event.ID = 1
+	}
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	event.PrevHash = prevHash
+	event.Hash = event.ComputeHash(prevHash)
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *memoryAudit) QueryEvents(context.Context, domain.Filter, int64) ([]domain.Event, error) {
+	return nil, nil
+}
+
+func (r *memoryAudit) GetEventsAfter(_ context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	var events []domain.Event
+	for _, e := range r.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryAudit) GetLastEvent(context.Context) (*domain.Event, error) {
+	if len(r.events) == 0 {
+		return nil, nil
+	}
+	last := r.events[len(r.events)-1]
+	return &last, nil
+}
+
+func (r *memoryAudit) InsertCheckpoint(_ context.Context, checkpoint *domain.Checkpoint) error {
+	checkpoint.ID = int64(len(r.checkpoints) + 1)
+	r.checkpoints = append(r.checkpoints, *checkpoint)
+	return nil
+}
+
+func (r *memoryAudit) GetCheckpoints(context.Context) ([]domain.Checkpoint, error) {
+	return r.checkpoints, nil
+}
+
+func (r *memoryAudit) GetLastCheckpoint(context.Context) (*domain.Checkpoint, error) {
+	if len(r.checkpoints) == 0 {
+		return nil, nil
+	}
+	last := r.checkpoints[len(r.checkpoints)-1]
+	return &last, nil
+}
+
+func (r *memoryAudit) event(id int64) *domain.Event {
+	for i := range r.events {
+		if r.events[i].ID == id {
+			return &r.events[i]
+		}
+	}
+	return nil
+}
+
+func (r *memoryAudit) delete(id int64) {
+	for i := range r.events {
+		if r.events[i].ID == id {
+			r.events = append(r.events[:i], r.events[i+1:]...)
+			return
+		}
+	}
+}
+
+// rehash пересчитывает цепочку начиная с события id — так её переписал бы злоумышленник без ключа точек
+func (r *memoryAudit) rehash(id int64) {
+	for i := range r.events {
+		if r.events[i].ID < id {
+			continue
+		}
+		prevHash := ""
+		if i > 0 {
+			prevHash = r.events[i-1].Hash
+		}
+		r.events[i].PrevHash = prevHash
+		r.events[i].Hash = r.events[i].ComputeHash(prevHash)
+	}
+}
+
+var checkpointKey = []byte("checkpoint-key")
+
+// newJournal записывает пять событий с контрольными точками после третьего и пятого
+func newJournal(t *testing.T) (*memoryAudit, AuditService) {
+	t.Helper()
+	repo := &memoryAudit{}
+	s := NewAuditService(repo, checkpointKey)
+	ctx := context.Background()
+
+	for i, target := range []string{"a", "b", "c", "d", "e"} {
+		if err := s.Record(ctx, domain.NewEvent("role.edit", "role", target, nil, map[string]string{"name": target})); err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 || i == 4 {
+			if _, err := s.CreateCheckpoint(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return repo, s
+}
+
+func verify(t *testing.T, s AuditService) domain.VerifyReport {
+	t.Helper()
+	report, err := s.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	return report
+}
+
+func wantBroken(t *testing.T, report domain.VerifyReport, eventID int64, reason string) {
+	t.Helper()
+	if report.Broken == nil {
+		t.Fatalf("chain reported intact, want %s at event %d", reason, eventID)
+	}
+	if report.Broken.EventID != eventID || report.Broken.Reason != reason {
+		t.Fatalf("broken = %+v, want %s at event %d", *report.Broken, reason, eventID)
+	}
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	_, s := newJournal(t)
+
+	report := verify(t, s)
+	if !report.OK() {
+		t.Fatalf("intact chain reported broken: %+v", *report.Broken)
+	}
+	if report.EventsChecked != 5 || report.CheckpointsChecked != 2 || report.LastEventID != 5 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestVerifyTamperedEvent(t *testing.T) {
+	repo, s := newJournal(t)
+	repo.event(2).Actor = "someone-else"
+
+	wantBroken(t, verify(t, s), 2, domain.BreakHash)
+}
+
+func TestVerifyTamperedEventWithRecomputedHash(t *testing.T) {
+	repo, s := newJournal(t)
+	tampered := repo.event(4)
+	tampered.TargetID = "z"
+	tampered.Hash = tampered.ComputeHash(tampered.PrevHash)
+
+	wantBroken(t, verify(t, s), 5, domain.BreakPrevHash)
+}
+
+func TestVerifyDeletedEvent(t *testing.T) {
+	repo, s := newJournal(t)
+	repo.delete(2)
+
+	wantBroken(t, verify(t, s), 3, domain.BreakPrevHash)
+}
+
+func TestVerifyDeletedCheckpointedEvent(t *testing.T) {
+	repo, s := newJournal(t)
+	// Удалён хвост журнала: цепочка оставшихся событий цела, но точка ссылается на пропавшее событие
+	repo.delete(5)
+
+	report := verify(t, s)
+	wantBroken(t, report, 5, domain.BreakCheckpoint)
+	if report.Broken.CheckpointID != 2 {
+		t.Fatalf("broken checkpoint %d, want 2", report.Broken.CheckpointID)
+	}
+}
+
+func TestVerifyCheckpointMismatch(t *testing.T) {
+	repo, s := newJournal(t)
+	repo.event(2).Actor = "someone-else"
+	repo.rehash(2)
+
+	report := verify(t, s)
+	wantBroken(t, report, 3, domain.BreakCheckpoint)
+	if report.Broken.Expected != repo.checkpoints[0].Hash || report.Broken.Actual != repo.event(3).Hash {
+		t.Fatalf("unexpected hashes in %+v", *report.Broken)
+	}
+}
+
+func TestVerifyForgedCheckpoint(t *testing.T) {
+	repo, s := newJournal(t)
+	repo.event(2).Actor = "someone-else"
+	repo.rehash(2)
+	// Без ключа подпись переписанной точки не сходится
+	repo.checkpoints[0].Hash = repo.event(3).Hash
+
+	wantBroken(t, verify(t, s), 3, domain.BreakSignature)
+}
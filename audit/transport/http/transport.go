@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/rafaceo/go-test-auth/audit/domain"
+	"github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type QueryEventsResponse struct {
+	domain.Page
+	Error string `json:"error,omitempty"`
+}
+
+func GetAuditHandlers(serv service.AuditService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+
+	queryEventsHandler := kithttp.NewServer(
+		MakeQueryEventsEndpoint(serv),
+		DecodeQueryEventsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/audit/events",
+			Handler: queryEventsHandler,
+			Methods: []string{"GET"},
+		},
+	}
+}
+
+func MakeQueryEventsEndpoint(svc service.AuditService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter := request.(domain.Filter)
+		page, err := svc.QueryEvents(ctx, filter)
+		if err != nil {
+			return QueryEventsResponse{Error: err.Error()}, nil
+		}
+		return QueryEventsResponse{Page: page}, nil
+	}
+}
+
+// DecodeQueryEventsRequest читает фильтры из query: actor, action, target_type, target_id,
+// from и to в RFC 3339, limit и cursor из next_cursor предыдущей страницы
+func DecodeQueryEventsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	filter := domain.Filter{
+		Actor:      query.Get("actor"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Cursor:     query.Get("cursor"),
+	}
+
+	for name, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New("invalid " + name + ": expected RFC 3339 time")
+			}
+			t = t.UTC()
+			*dst = &t
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
@@ -0,0 +1,200 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/changefeed/domain"
+	"github.com/rafaceo/go-test-auth/changefeed/repository"
+	"github.com/rafaceo/go-test-auth/changefeed/repository/postgres"
+)
+
+const (
+	pollBatchSize = 500
+	// gapTimeout — сколько ждать пропущенный id: транзакция с меньшим id могла ещё не зафиксироваться.
+	// Дольше ждать нельзя, потому что пропуски оставляют и откаченные транзакции.
+	gapTimeout = 5 * time.Second
+	// subscriberBuffer — уведомления, которые подписчик может не забрать; переполненный подписчик
+	// отключается и догоняет по Last-Event-ID после переподключения
+	subscriberBuffer = 256
+)
+
+var ErrHubNotReady = errors.New("поток уведомлений ещё не запущен")
+
+// Hub опрашивает outbox_events и раздаёт уведомления об изменении прав подключённым подписчикам.
+// Каждый экземпляр сервиса опрашивает базу сам, поэтому поток работает при нескольких репликах.
+type Hub struct {
+	repo     repository.ChangefeedRepository
+	interval time.Duration
+	logger   log.Logger
+
+	mu          sync.Mutex
+	ready       bool
+	cursor      int64
+	gapSince    time.Time
+	subscribers map[*Subscriber]struct{}
+}
+
+// Subscriber получает уведомления с номером больше From. Канал C закрывается при отписке
+// или переполнении буфера.
+type Subscriber struct {
+	C    chan domain.Notification
+	From int64
+}
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateHub(logger log.Logger, postgresClient *sqlx.DB, interval time.Duration) *Hub {
+	return &Hub{
+		repo:        postgres.NewChangefeedRepository(postgresClient),
+		interval:    interval,
+		logger:      log.With(logger, "component", "changefeed"),
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Run блокируется до отмены ctx
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.poll(ctx); err != nil {
+			_ = h.logger.Log("method", "poll", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) poll(ctx context.Context) error {
+	h.mu.Lock()
+	ready, cursor := h.ready, h.cursor
+	h.mu.Unlock()
+
+	if !ready {
+		last, err := h.repo.GetLastEventID(ctx)
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		h.cursor, h.ready = last, true
+		h.mu.Unlock()
+		return nil
+	}
+
+	events, err := h.repo.GetEventsAfter(ctx, cursor, pollBatchSize)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, event := range events {
+		if event.ID != h.cursor+1 {
+			if h.gapSince.IsZero() {
+				h.gapSince = now
+			}
+			if now.Sub(h.gapSince) < gapTimeout {
+				return nil
+			}
+		}
+		h.gapSince = time.Time{}
+		h.cursor = event.ID
+
+		notification, ok, err := domain.FromOutboxEvent(event)
+		if err != nil {
+			_ = h.logger.Log("method", "poll", "event_id", event.ID, "err", err)
+			continue
+		}
+		if ok {
+			h.broadcast(notification)
+		}
+	}
+	return nil
+}
+
+// broadcast вызывается под h.mu
+func (h *Hub) broadcast(n domain.Notification) {
+	for sub := range h.subscribers {
+		select {
+		case sub.C <- n:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.C)
+		}
+	}
+}
+
+// Subscribe подключает подписчика к живому потоку. Уведомления с номером до From включительно
+// подписчик догоняет сам через CatchUp.
+func (h *Hub) Subscribe() (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.ready {
+		return nil, ErrHubNotReady
+	}
+	sub := &Subscriber{C: make(chan domain.Notification, subscriberBuffer), From: h.cursor}
+	h.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.C)
+	}
+}
+
+// CatchUp возвращает уведомления с номерами в (afterVersion, upTo] из базы, начиная с самых старых.
+// Возвращает не больше limit уведомлений и номер, с которого продолжать.
+func (h *Hub) CatchUp(ctx context.Context, afterVersion, upTo int64, limit int) ([]domain.Notification, int64, error) {
+	events, err := h.repo.GetEventsAfter(ctx, afterVersion, limit)
+	if err != nil {
+		return nil, afterVersion, err
+	}
+
+	var notifications []domain.Notification
+	next := afterVersion
+	for _, event := range events {
+		if event.ID > upTo {
+			return notifications, upTo, nil
+		}
+		next = event.ID
+
+		notification, ok, err := domain.FromOutboxEvent(event)
+		if err != nil || !ok {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	if len(events) < limit {
+		next = upTo
+	}
+	return notifications, next, nil
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.C)
+	}
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+)
+
+// Notification — уведомление об изменении прав для сброса кешей. Version — номер изменения
+// (id события outbox): монотонно растёт и служит id события SSE для возобновления потока.
+type Notification struct {
+	Version int64  `json:"version"`
+	Type    string `json:"type"`
+	// UserID пуст, если изменилась сама роль или мерчант: затронуты все их владельцы
+	UserID string `json:"user_id,omitempty"`
+	// MerchantID заполняется, если изменение касается прав у одного мерчанта
+	MerchantID string    `json:"merchant_id,omitempty"`
+	RoleID     int       `json:"role_id,omitempty"`
+	Change     string    `json:"change,omitempty"`
+	Modules    []string  `json:"modules,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Matches сообщает, нужно ли уведомление подписчику, следящему за userID; пустой userID — все уведомления
+func (n Notification) Matches(userID string) bool {
+	return userID == "" || n.UserID == "" || n.UserID == userID
+}
+
+// FromOutboxEvent строит уведомление из события outbox. События, не влияющие на права, пропускаются.
+func FromOutboxEvent(event outboxDomain.Event) (Notification, bool, error) {
+	n := Notification{Version: event.ID, Type: event.Type, OccurredAt: event.OccurredAt}
+
+	switch event.Type {
+	case outboxDomain.RightsGranted:
+		var payload outboxDomain.RightsGrantedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.Modules = rightsDomain.Modules(payload.Rights)
+	case outboxDomain.RightsRevoked:
+		var payload outboxDomain.RightsRevokedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.Change = payload.Reason
+		n.Modules = rightsDomain.Modules(payload.Rights)
+	case outboxDomain.RoleChanged:
+		var payload outboxDomain.RoleChangedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.MerchantID = payload.MerchantID
+		n.RoleID = payload.RoleID
+		n.Change = payload.Change
+		n.Modules = payload.Modules
+	case outboxDomain.ContextAdded:
+		var payload outboxDomain.ContextAddedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.MerchantID = payload.MerchantID
+	case outboxDomain.ContextRemoved:
+		var payload outboxDomain.ContextRemovedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.MerchantID = payload.MerchantID
+	case outboxDomain.MerchantChanged:
+		var payload outboxDomain.MerchantChangedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.MerchantID = payload.MerchantID
+		n.Change = payload.Change
+	case outboxDomain.SessionRevoked:
+		var payload outboxDomain.SessionRevokedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.Change = payload.Reason
+	case outboxDomain.UsersMerged:
+		var payload outboxDomain.UsersMergedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.Change = "merged"
+	case outboxDomain.UserStatusChanged:
+		var payload outboxDomain.UserStatusChangedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return n, false, err
+		}
+		n.UserID = payload.UserID
+		n.Change = payload.To
+	default:
+		return n, false, nil
+	}
+
+	return n, true, nil
+}
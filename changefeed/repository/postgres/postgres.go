@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/changefeed/repository"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+type changefeedRepository struct {
+	db *sqlx.DB
+}
+
+// NewChangefeedRepository читает outbox_events независимо от ретранслятора: публикация в брокер
+// и поток уведомлений не ждут друг друга
+func NewChangefeedRepository(db *sqlx.DB) repository.ChangefeedRepository {
+	return &changefeedRepository{db: db}
+}
+
+func (r *changefeedRepository) GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]outboxDomain.Event, error) {
+	query := `SELECT id, type, aggregate_type, aggregate_id, payload, actor, request_id, occurred_at
+	          FROM outbox_events
+	          WHERE id > $1
+	          ORDER BY id
+	          LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outboxDomain.Event
+	for rows.Next() {
+		var e outboxDomain.Event
+		var payload []byte
+		err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &payload, &e.Actor, &e.RequestID, &e.OccurredAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *changefeedRepository) GetLastEventID(ctx context.Context) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox_events`).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+type ChangefeedRepository interface {
+	GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]outboxDomain.Event, error)
+	GetLastEventID(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,183 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/changefeed"
+	"github.com/rafaceo/go-test-auth/changefeed/domain"
+	authDomain "github.com/rafaceo/go-test-auth/cmd/domain"
+	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	catchUpBatchSize  = 500
+	heartbeatInterval = 15 * time.Second
+	// retryMs — пауза перед переподключением, которую EventSource берёт из поля retry
+	retryMs = 3000
+)
+
+// TokenVerifier проверяет access_token и то, что его владелец в статусе active
+type TokenVerifier interface {
+	Authenticate(ctx context.Context, accessToken string) (*authDomain.Claims, error)
+}
+
+func GetChangefeedHandlers(hub *changefeed.Hub, tokens TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/events/stream",
+			Handler: &streamHandler{hub: hub, tokens: tokens, logger: logger},
+			Methods: []string{"GET"},
+		},
+	}
+}
+
+// streamHandler отдаёт уведомления об изменении прав как Server-Sent Events. Параметры:
+// user_id — только уведомления пользователя и изменения ролей целиком; Last-Event-ID
+// (или last_event_id в query) — номер последнего полученного уведомления для возобновления.
+type streamHandler struct {
+	hub    *changefeed.Hub
+	tokens TokenVerifier
+	logger kitlog.Logger
+}
+
+func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.tokens.Authenticate(r.Context(), accessToken(r)); err != nil {
+		if errors.Is(err, e.AccountInactive) {
+			writeError(w, http.StatusForbidden, "account is not active")
+			return
+		}
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastEventID, err := parseLastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	userID := r.URL.Query().Get("user_id")
+
+	sub, err := h.hub.Subscribe()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryMs)
+	flusher.Flush()
+
+	ctx := r.Context()
+	if lastEventID != nil {
+		if err := h.catchUp(ctx, w, *lastEventID, sub.From, userID); err != nil {
+			_ = h.logger.Log("method", "stream", "err", err)
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-sub.C:
+			if !ok {
+				// Подписчик отстал или сервис останавливается: клиент переподключится с Last-Event-ID
+				return
+			}
+			if !n.Matches(userID) {
+				continue
+			}
+			if err := writeNotification(w, n); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// catchUp отправляет из базы всё, что клиент пропустил до подключения к живому потоку
+func (h *streamHandler) catchUp(ctx context.Context, w http.ResponseWriter, after, upTo int64, userID string) error {
+	for after < upTo {
+		notifications, next, err := h.hub.CatchUp(ctx, after, upTo, catchUpBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, n := range notifications {
+			if !n.Matches(userID) {
+				continue
+			}
+			if err := writeNotification(w, n); err != nil {
+				return err
+			}
+		}
+		after = next
+	}
+	return nil
+}
+
+func writeNotification(w http.ResponseWriter, n domain.Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.Version, n.Type, data)
+	return err
+}
+
+// accessToken берёт токен из Authorization: Bearer или из access_token в query,
+// потому что браузерный EventSource не умеет передавать заголовки
+func accessToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+func parseLastEventID(r *http.Request) (*int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return nil, errors.New("invalid Last-Event-ID")
+	}
+	return &id, nil
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -1,6 +1,12 @@
 package cmd
 
-import "github.com/jmoiron/sqlx"
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+	userPostgres "github.com/rafaceo/go-test-auth/user/repository/postgres"
+)
 
 var Db *sqlx.DB
 
@@ -14,8 +20,7 @@ func InitDB(dsn string) (*sqlx.DB, error) {
 }
 
 func CreateUser(phone, passwordHash, firstName, lastName, email string) error {
-	query := `INSERT INTO users_profiles (phone, password_hash, first_name, last_name, email)
-              VALUES ($1, $2, $3, $4, $5)`
-	_, err := Db.Exec(query, phone, passwordHash, firstName, lastName, email)
+	user := userDomain.User{Phone: phone, PasswordHash: passwordHash, Email: email, FirstName: firstName, LastName: lastName}
+	_, err := userPostgres.NewUserRepository(Db).CreateUser(context.Background(), user, "registration")
 	return err
 }
@@ -1,8 +1,5 @@
 package domain
 
-// SecretKey для подписи JWT (должен быть в .env)
-var SecretKey = []byte("")
-
 type RefreshRequest struct {
 	RefreshToken string `json:"refreshToken"`
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	conf "github.com/rafaceo/go-test-auth/config"
@@ -16,30 +17,50 @@ func getRefreshTokenExpiration() time.Duration {
 }
 
 type Claims struct {
-	UserID       uuid.UUID `json:"id"`
-	Phone        string    `json:"phone"`
-	Roles        []string  `json:"roles"`
-	Entitlements []string  `json:"entitlements"`
+	UserID uuid.UUID `json:"id"`
+	Phone  string    `json:"phone"`
+	Roles  []string  `json:"roles"`
+	// MerchantID — активный мерчант токена, выпущенного при переключении контекста.
+	// В таком токене Entitlements — права у этого мерчанта, Merchants не заполняется.
+	MerchantID string `json:"merchant_id,omitempty"`
+	// Entitlements — права «модуль:действие», действующие у любого мерчанта
+	Entitlements []string `json:"entitlements"`
+	// Merchants — права у каждого мерчанта из контекстов пользователя. Global — у пользователя
+	// есть глобальный контекст, и у мерчантов не из Merchants действуют Entitlements.
+	Merchants map[string][]string `json:"merchants,omitempty"`
+	Global    bool                `json:"global,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// Генерация access_token
-func GenerateAccessToken(userID uuid.UUID, phone string, roles, entitlements []string, jwtSecret string) (string, error) {
-	claims := Claims{
-		UserID:       userID,
-		Phone:        phone,
-		Roles:        roles,
-		Entitlements: entitlements,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(getAccessTokenExpiration())),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// Генерация access_token; срок действия и время выпуска проставляются здесь
+func GenerateAccessToken(claims Claims, jwtSecret string) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(getAccessTokenExpiration())),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(jwtSecret))
 }
 
+// ParseAccessToken проверяет подпись и срок действия access_token, выданного GenerateAccessToken
+func ParseAccessToken(tokenString string, jwtSecret string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.UserID == uuid.Nil {
+		return nil, errors.New("invalid access token")
+	}
+	return claims, nil
+}
+
 // Генерация refresh_token (простая строка UUID)
 func GenerateRefreshToken() string {
 	return uuid.New().String()
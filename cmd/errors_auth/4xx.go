@@ -8,6 +8,10 @@ var (
 	BadRequestError     = &ArgError{ArgErrorSystemMarket, 400, "Missing required fields: phone, password", "Required fields missing: phone, password"}
 	UnauthorizedError   = &ArgError{ArgErrorSystemMarket, 401, "Incorrect login or password", "Unauthorized: Incorrect login or password"}
 	TooManyRequestError = &ArgError{ArgErrorSystemMarket, 429, "too many requests", "Too many requests: 1 min"}
+	InvalidTokenError   = &ArgError{ArgErrorSystemMarket, 401, "invalid access token", "Unauthorized: missing, expired or invalid access token"}
+	MerchantRequired    = &ArgError{ArgErrorSystemMarket, 400, "merchant_id is required", "Required fields missing: merchant_id"}
+	NoMerchantContext   = &ArgError{ArgErrorSystemMarket, 403, "no access to merchant", "Forbidden: user has no context for this merchant"}
+	AccountInactive     = &ArgError{ArgErrorSystemMarket, 403, "account is not active", "Forbidden: account is suspended, locked, deactivated or deleted"}
 )
 
 const (
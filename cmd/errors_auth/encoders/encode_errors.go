@@ -9,11 +9,11 @@ import (
 
 func EncodeErrorAUTH(_ context.Context, err error, w http.ResponseWriter) {
 	switch err {
-	case errors_auth.Forbidden:
+	case errors_auth.Forbidden, errors_auth.NoMerchantContext, errors_auth.AccountInactive:
 		w.WriteHeader(http.StatusForbidden)
-	case errors_auth.BadRequestError:
+	case errors_auth.BadRequestError, errors_auth.MerchantRequired:
 		w.WriteHeader(http.StatusBadRequest)
-	case errors_auth.UnauthorizedError:
+	case errors_auth.UnauthorizedError, errors_auth.InvalidTokenError:
 		w.WriteHeader(http.StatusUnauthorized)
 	case errors_auth.TooManyRequestError:
 		w.WriteHeader(http.StatusTooManyRequests)
@@ -1,21 +1,36 @@
 package main
 
 import (
+	"context"
 	"github.com/joho/godotenv"
 	cmd "github.com/rafaceo/go-test-auth/cmd/db"
 	"github.com/rafaceo/go-test-auth/config"
 	"github.com/rafaceo/go-test-auth/utils"
 	"log"
 	"net/http"
+	"time"
 
 	kitlog "github.com/go-kit/kit/log"
 	_ "github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/changefeed"
 	authRepoPkg "github.com/rafaceo/go-test-auth/cmd/repository/postgres"
 	authServicePkg "github.com/rafaceo/go-test-auth/cmd/service"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/imports"
+	"github.com/rafaceo/go-test-auth/outbox"
+	"github.com/rafaceo/go-test-auth/outbox/publisher"
+	rightsMiddleware "github.com/rafaceo/go-test-auth/rights/middleware"
 	rightsRepoPkg "github.com/rafaceo/go-test-auth/rights/repository/postgres"
 	rightsServicePkg "github.com/rafaceo/go-test-auth/rights/service"
+	"github.com/rafaceo/go-test-auth/security"
+	"github.com/rafaceo/go-test-auth/siem"
+	userServiceFactory "github.com/rafaceo/go-test-auth/user"
+	userRepoPkg "github.com/rafaceo/go-test-auth/user/repository/postgres"
+	contextMiddleware "github.com/rafaceo/go-test-auth/user_contexts/middleware"
 	contextRepoPkg "github.com/rafaceo/go-test-auth/user_contexts/repository/postgres"
 	contextServicePkg "github.com/rafaceo/go-test-auth/user_contexts/service"
+	"github.com/rafaceo/go-test-auth/webhooks"
 )
 
 func main() {
@@ -39,6 +54,10 @@ func main() {
 
 	logger := kitlog.NewLogfmtLogger(log.Writer())
 
+	if err := requestinfo.SetTrustedProxies(config.AllConfigs.Env.TrustedProxies); err != nil {
+		log.Fatal("Ошибка в TRUSTED_PROXIES:", err)
+	}
+
 	jwtSecret := config.AllConfigs.Env.JwtSecret
 	log.Println("jwtSecret:", jwtSecret)
 	if config.AllConfigs.Env.JwtSecret == "" {
@@ -46,15 +65,75 @@ func main() {
 	}
 
 	authRepo := authRepoPkg.NewAuthRepository(db)
-	authService := authServicePkg.NewAuthService(authRepo, jwtSecret)
+	accessResolver := new(userServiceFactory.ServiceFactory).CreateAccessResolver(logger, db)
+	authService := authServicePkg.NewAuthService(authRepo, userRepoPkg.NewUserRepository(db), jwtSecret, security.NewRecorder(logger, db), accessResolver)
+
+	auditRecorder := audit.NewRecorder(logger, db)
 
 	rightsRepo := rightsRepoPkg.NewPostgresRightsRepository(db)
 	rightsService := rightsServicePkg.NewRightsService(rightsRepo)
+	rightsService = rightsMiddleware.NewAuditMiddleware(auditRecorder, rightsService)
 
 	contextRepo := contextRepoPkg.NewUserContextRepository(db)
 	contextService := contextServicePkg.NewUserContextService(contextRepo)
+	contextService = contextMiddleware.NewAuditMiddleware(auditRecorder, contextService)
+
+	sweepInterval := time.Duration(config.AllConfigs.Env.GrantSweepIntervalSec) * time.Second
+	grantSweeper := new(userServiceFactory.ServiceFactory).CreateGrantSweeper(logger, db, sweepInterval)
+	go grantSweeper.Run(context.Background())
+
+	if key := config.AllConfigs.Env.AuditCheckpointKey; key != "" {
+		checkpointInterval := time.Duration(config.AllConfigs.Env.AuditCheckpointIntervalSec) * time.Second
+		checkpointer := new(audit.ServiceFactory).CreateCheckpointer(logger, db, checkpointInterval, []byte(key))
+		go checkpointer.Run(context.Background())
+	} else {
+		log.Println("AUDIT_CHECKPOINT_KEY не задан: контрольные точки журнала аудита не создаются")
+	}
+
+	if siemCfg := config.AllConfigs.Siem; siemCfg.Sink != "" {
+		exporter, err := new(siem.ServiceFactory).CreateExporter(logger, db, siem.Config{
+			Name:     "server",
+			Sink:     siemCfg.Sink,
+			Format:   siemCfg.Format,
+			Target:   siemCfg.Target,
+			Interval: time.Duration(siemCfg.IntervalSec) * time.Second,
+		})
+		if err != nil {
+			log.Fatal("Ошибка настройки выгрузки в SIEM:", err)
+		}
+		go exporter.Run(context.Background())
+	}
+
+	webhookFactory := new(webhooks.ServiceFactory)
+	publishers := []publisher.Publisher{webhookFactory.CreatePublisher(logger, db)}
+	if rabbitCfg := config.AllConfigs.Rabbit; rabbitCfg.Host != "" {
+		amqpPublisher, err := publisher.NewAMQPPublisher(rabbitCfg)
+		if err != nil {
+			log.Fatal("Ошибка настройки публикации событий:", err)
+		}
+		publishers = append(publishers, amqpPublisher)
+	} else {
+		log.Println("RABBIT_HOST не задан: доменные события доставляются только вебхукам")
+	}
+
+	relayInterval := time.Duration(config.AllConfigs.Env.OutboxRelayIntervalSec) * time.Second
+	relay := new(outbox.ServiceFactory).CreateRelay(logger, db, publisher.NewFanout(publishers...), relayInterval)
+	defer relay.Close()
+	go relay.Run(context.Background())
+
+	dispatchInterval := time.Duration(config.AllConfigs.Env.WebhookDispatchIntervalSec) * time.Second
+	webhookDispatcher := webhookFactory.CreateDispatcher(logger, db, dispatchInterval)
+	go webhookDispatcher.Run(context.Background())
+
+	changefeedInterval := time.Duration(config.AllConfigs.Env.ChangefeedPollIntervalSec) * time.Second
+	changefeedHub := new(changefeed.ServiceFactory).CreateHub(logger, db, changefeedInterval)
+	go changefeedHub.Run(context.Background())
+
+	importInterval := time.Duration(config.AllConfigs.Env.ImportPollIntervalSec) * time.Second
+	importWorker := new(imports.ServiceFactory).CreateWorker(logger, db, importInterval)
+	go importWorker.Run(context.Background())
 
-	router := utils.CreateHTTPRouting(authService, rightsService, contextService, logger, db)
+	router := utils.CreateHTTPRouting(authService, rightsService, contextService, changefeedHub, config.AllConfigs.Env.SamlBaseURL, logger, db)
 
 	log.Println("Сервер запущен на порту 8080")
 	log.Fatal(http.ListenAndServe(":8080", router))
@@ -0,0 +1,285 @@
+// mockidp — локальный провайдер OpenID Connect для разработки и проверки входа через
+// /api/v4/auth/oidc. Вход подтверждается без страницы логина: пользователь задаётся флагами,
+// а login_hint в запросе авторизации подменяет email и subject.
+//
+//	go run ./cmd/mockidp -addr :9000 -client-id auth -client-secret secret -phone +77010000000
+//
+// Затем провайдер заводится с issuer http://localhost:9000 и тем же client_id.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// authorization — выданный код авторизации и всё, что нужно для его обмена
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	subject       string
+	email         string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	kid          string
+	user         map[string]interface{}
+	// tokenTTL — срок жизни id_token; отрицательный выдаёт уже просроченный токен
+	tokenTTL time.Duration
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "адрес HTTP-сервера")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer провайдера")
+	clientID := flag.String("client-id", "auth", "client_id, который принимает провайдер")
+	clientSecret := flag.String("client-secret", "secret", "секрет клиента; пусто — публичный клиент")
+	subject := flag.String("sub", "mock-user-1", "subject пользователя")
+	email := flag.String("email", "user@example.com", "email пользователя")
+	emailVerified := flag.Bool("email-verified", true, "email подтверждён")
+	phone := flag.String("phone", "", "телефон пользователя (phone_number)")
+	phoneVerified := flag.Bool("phone-verified", true, "телефон подтверждён")
+	givenName := flag.String("given-name", "Mock", "имя")
+	familyName := flag.String("family-name", "User", "фамилия")
+	tokenTTL := flag.Duration("token-ttl", 5*time.Minute, "срок жизни id_token")
+	flag.Parse()
+
+	user := map[string]interface{}{
+		"sub":            *subject,
+		"email":          *email,
+		"email_verified": *emailVerified,
+		"given_name":     *givenName,
+		"family_name":    *familyName,
+	}
+	if *phone != "" {
+		user["phone_number"] = *phone
+		user["phone_number_verified"] = *phoneVerified
+	}
+
+	p, err := newProvider(*issuer, *clientID, *clientSecret, user)
+	if err != nil {
+		log.Fatal("Ошибка генерации ключа:", err)
+	}
+	p.tokenTTL = *tokenTTL
+
+	log.Printf("Тестовый провайдер OpenID Connect %s слушает %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p.handler()))
+}
+
+func newProvider(issuer, clientID, clientSecret string, user map[string]interface{}) (*provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &provider{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		kid:          randomString(8),
+		user:         user,
+		tokenTTL:     5 * time.Minute,
+		codes:        make(map[string]authorization),
+	}, nil
+}
+
+func (p *provider) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	return mux
+}
+
+func (p *provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	public := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize сразу подтверждает вход и возвращает браузер на redirect_uri с кодом
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != p.clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	callback := target.Query()
+	callback.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		callback.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		callback.Set("error", "invalid_request")
+		callback.Set("error_description", "PKCE S256 is required")
+	default:
+		code := randomString(24)
+		subject, email := p.user["sub"].(string), p.user["email"].(string)
+		if hint := query.Get("login_hint"); hint != "" {
+			subject, email = "hint-"+hint, hint
+		}
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			clientID:      p.clientID,
+			redirectURI:   redirectURI,
+			codeChallenge: query.Get("code_challenge"),
+			nonce:         query.Get("nonce"),
+			subject:       subject,
+			email:         email,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		callback.Set("code", code)
+	}
+
+	target.RawQuery = callback.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token меняет код на id_token, проверяя клиента, redirect_uri и code_verifier
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mockidp"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(auth.expiresAt) || auth.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "code is invalid, expired or issued for another redirect_uri")
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+		tokenError(w, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	ttl := p.tokenTTL
+	p.mu.Unlock()
+	claims := jwt.MapClaims{}
+	for name, value := range p.user {
+		claims[name] = value
+	}
+	claims["iss"] = p.issuer
+	claims["sub"] = auth.subject
+	claims["email"] = auth.email
+	claims["aud"] = auth.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = p.kid
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(24),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
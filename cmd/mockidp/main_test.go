@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+	"github.com/rafaceo/go-test-auth/federation/service"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+)
+
+// memoryFederation хранит один провайдер, незавершённые входы и одну привязанную учётную запись
+type memoryFederation struct {
+	mu       sync.Mutex
+	provider domain.Provider
+	states   map[string]domain.LoginState
+	identity domain.Identity
+}
+
+func (r *memoryFederation) CreateProvider(context.Context, domain.Provider) error { return nil }
+
+func (r *memoryFederation) GetProvider(_ context.Context, id string) (*domain.Provider, error) {
+	if id != r.provider.ID {
+		return nil, domain.ErrProviderNotFound
+	}
+	provider := r.provider
+	return &provider, nil
+}
+
+func (r *memoryFederation) ListProviders(context.Context) ([]domain.Provider, error) {
+	return []domain.Provider{r.provider}, nil
+}
+
+func (r *memoryFederation) UpdateProvider(context.Context, domain.Provider) error { return nil }
+
+func (r *memoryFederation) DeleteProvider(context.Context, string) error { return nil }
+
+func (r *memoryFederation) MissingRoles(context.Context, []string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *memoryFederation) SaveState(_ context.Context, state domain.LoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[state.StateHash] = state
+	return nil
+}
+
+func (r *memoryFederation) ConsumeState(_ context.Context, stateHash string) (*domain.LoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, domain.ErrInvalidState
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
+
+func (r *memoryFederation) DeleteExpiredStates(context.Context) (int64, error) { return 0, nil }
+
+func (r *memoryFederation) FindIdentity(_ context.Context, providerID, subject string) (*domain.Identity, error) {
+	if providerID != r.identity.ProviderID || subject != r.identity.Subject {
+		return nil, domain.ErrNoLocalAccount
+	}
+	identity := r.identity
+	return &identity, nil
+}
+
+func (r *memoryFederation) FindUserByEmail(context.Context, string) (uuid.UUID, error) {
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+func (r *memoryFederation) FindUserByPhone(context.Context, string) (uuid.UUID, error) {
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+func (r *memoryFederation) LinkIdentity(context.Context, domain.Identity) error { return nil }
+
+func (r *memoryFederation) TouchIdentity(context.Context, string, string, string) error { return nil }
+
+func (r *memoryFederation) ProvisionUser(context.Context, domain.Provider, domain.Claims, string) (uuid.UUID, error) {
+	return uuid.Nil, errors.New("provisioning is disabled")
+}
+
+// noSensitiveRoles — у провайдера теста нет ролей по умолчанию
+type noSensitiveRoles struct{}
+
+func (noSensitiveRoles) CheckRoleGrant(context.Context, []string) error { return nil }
+
+type staticSessions struct{}
+
+func (staticSessions) IssueSession(_ context.Context, userID uuid.UUID) (string, string, error) {
+	return "access-" + userID.String(), "refresh-" + userID.String(), nil
+}
+
+// recordedEvents запоминает события безопасности о неудачных входах
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []securityDomain.Event
+}
+
+func (r *recordedEvents) Record(_ context.Context, event securityDomain.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordedEvents) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+type oidcTest struct {
+	idp      *provider
+	service  service.FederationService
+	events   *recordedEvents
+	userID   uuid.UUID
+	browser  *http.Client
+	redirect string
+}
+
+// newOIDCTest поднимает mockidp на httptest-сервере и сервис федерации, настроенный на него
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	idp, err := newProvider(srv.URL, "auth", "secret", map[string]interface{}{
+		"sub":            "mock-user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = idp.handler()
+
+	redirect := "http://auth.test/api/v4/auth/oidc/mock/callback"
+	provider := domain.Provider{
+		ID:           "mock",
+		Issuer:       srv.URL,
+		ClientID:     "auth",
+		ClientSecret: "secret",
+		RedirectURL:  redirect,
+		Enabled:      true,
+	}
+	provider.Normalize()
+
+	userID := uuid.New()
+	repo := &memoryFederation{
+		provider: provider,
+		states:   map[string]domain.LoginState{},
+		identity: domain.Identity{ProviderID: "mock", Subject: "mock-user-1", UserID: userID},
+	}
+	events := &recordedEvents{}
+
+	return &oidcTest{
+		idp:      idp,
+		service:  service.NewFederationService(repo, service.NewHTTPOIDCClient(5*time.Second), staticSessions{}, events, noSensitiveRoles{}),
+		events:   events,
+		userID:   userID,
+		redirect: redirect,
+		browser: &http.Client{
+			Timeout:       5 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// authorize начинает вход и проходит страницу провайдера, возвращая параметры обратного вызова
+func (o *oidcTest) authorize(t *testing.T) domain.Callback {
+	t.Helper()
+
+	authURL, err := o.service.StartLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	resp, err := o.browser.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), o.redirect+"?") {
+		t.Fatalf("redirected to %q, want %q", location, o.redirect)
+	}
+	query := location.Query()
+	if query.Get("error") != "" {
+		t.Fatalf("provider returned %s: %s", query.Get("error"), query.Get("error_description"))
+	}
+	return domain.Callback{State: query.Get("state"), Code: query.Get("code")}
+}
+
+func TestCompleteLogin(t *testing.T) {
+	o := newOIDCTest(t)
+
+	result, err := o.service.CompleteLogin(context.Background(), o.authorize(t))
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if result.UserID != o.userID {
+		t.Fatalf("logged in as %s, want %s", result.UserID, o.userID)
+	}
+	if result.AccessToken == "" || result.Provider != "mock" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestCompleteLoginRejectsStateMismatch(t *testing.T) {
+	o := newOIDCTest(t)
+	callback := o.authorize(t)
+
+	// Чужой state не найден, а начатый вход при этом не расходуется
+	forged := callback
+	forged.State = "forged-" + callback.State
+	if _, err := o.service.CompleteLogin(context.Background(), forged); !errors.Is(err, domain.ErrInvalidState) {
+		t.Fatalf("forged state: error = %v, want %v", err, domain.ErrInvalidState)
+	}
+
+	if _, err := o.service.CompleteLogin(context.Background(), callback); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	// Повторный обратный вызов с тем же state не принимается
+	if _, err := o.service.CompleteLogin(context.Background(), callback); !errors.Is(err, domain.ErrInvalidState) {
+		t.Fatalf("replayed state: error = %v, want %v", err, domain.ErrInvalidState)
+	}
+}
+
+func TestCompleteLoginRejectsNonceMismatch(t *testing.T) {
+	o := newOIDCTest(t)
+	callback := o.authorize(t)
+
+	// Провайдер выпускает id_token с nonce другого входа
+	o.idp.mu.Lock()
+	auth := o.idp.codes[callback.Code]
+	auth.nonce = "nonce-of-another-login"
+	o.idp.codes[callback.Code] = auth
+	o.idp.mu.Unlock()
+
+	_, err := o.service.CompleteLogin(context.Background(), callback)
+	if !errors.Is(err, domain.ErrInvalidIDToken) || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("error = %v, want %v about nonce", err, domain.ErrInvalidIDToken)
+	}
+	if o.events.count() != 1 {
+		t.Fatalf("recorded %d security events, want 1", o.events.count())
+	}
+}
+
+func TestCompleteLoginRejectsExpiredIDToken(t *testing.T) {
+	o := newOIDCTest(t)
+	callback := o.authorize(t)
+
+	// Просрочка больше допустимого расхождения часов
+	o.idp.mu.Lock()
+	o.idp.tokenTTL = -10 * time.Minute
+	o.idp.mu.Unlock()
+
+	_, err := o.service.CompleteLogin(context.Background(), callback)
+	if !errors.Is(err, domain.ErrInvalidIDToken) || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("error = %v, want %v about expiry", err, domain.ErrInvalidIDToken)
+	}
+	if o.events.count() != 1 {
+		t.Fatalf("recorded %d security events, want 1", o.events.count())
+	}
+}
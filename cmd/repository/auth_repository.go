@@ -2,17 +2,17 @@ package repository
 
 import (
 	"context"
-	"github.com/rafaceo/go-test-auth/cmd/domain"
+	"time"
 )
 
+// AuthRepository — сессии пользователей из users и учёт неудачных попыток входа
 type AuthRepository interface {
-	GetUserByPhone(ctx context.Context, phone string) (*domain.UserProfile, error)
 	SaveRefreshToken(ctx context.Context, userID string, refreshToken string) error
 	GetUserIDByRefreshToken(ctx context.Context, refreshToken string) (string, error) // Новый метод
 	UpdateRefreshToken(ctx context.Context, userID string, newRefreshToken string) error
 	DeleteRefreshToken(ctx context.Context, refreshToken string) error
-	UserExists(ctx context.Context, phone string, email string) (bool, error)
-	CreateUser(ctx context.Context, phone string, email, password, firstName, lastName string) error
-	CreateFiledAttempt(ctx context.Context, phone string) error
+	CreateFiledAttempt(ctx context.Context, phone string) (*time.Time, error)
 	CheckBan(ctx context.Context, phone string) error
+	RevokeRefreshToken(ctx context.Context, userID string, refreshToken string) error
+	GetUserIDByRevokedRefreshToken(ctx context.Context, refreshToken string) (string, error)
 }
@@ -2,12 +2,15 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
-	"github.com/rafaceo/go-test-auth/cmd/domain"
 	repo "github.com/rafaceo/go-test-auth/cmd/repository"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
 	"time"
 )
 
@@ -19,34 +22,8 @@ func NewAuthRepository(db *sqlx.DB) repo.AuthRepository {
 	return &authRepository{db: db}
 }
 
-func (r *authRepository) CreateUser(ctx context.Context, phone string, email, password_hash, firstName, lastName string) error {
-	query := `INSERT INTO users_profiles (phone, email, password_hash, first_name, last_name) VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.db.ExecContext(ctx, query, phone, email, password_hash, firstName, lastName)
-	return err
-}
-
-func (r *authRepository) UserExists(ctx context.Context, phone string, email string) (bool, error) {
-	var count int
-	query := `SELECT COUNT(*) FROM users_profiles WHERE phone = $1 OR email = $2`
-	err := r.db.GetContext(ctx, &count, query, phone, email)
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
-
-func (r *authRepository) GetUserByPhone(ctx context.Context, phone string) (*domain.UserProfile, error) {
-	var user domain.UserProfile
-	query := `SELECT id, phone, password_hash FROM users_profiles WHERE phone = $1`
-	err := r.db.QueryRowContext(ctx, query, phone).Scan(&user.ID, &user.Phone, &user.Password)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
 func (r *authRepository) SaveRefreshToken(ctx context.Context, userID string, refreshToken string) error {
-	query := `UPDATE users_profiles SET refresh_token = $1 WHERE id = $2`
+	query := `UPDATE "users" SET refresh_token = $1 WHERE id = $2`
 	_, err := r.db.ExecContext(ctx, query, refreshToken, userID)
 	return err
 }
@@ -54,7 +31,7 @@ func (r *authRepository) SaveRefreshToken(ctx context.Context, userID string, re
 // Новый метод для получения userID по refresh_token.
 func (r *authRepository) GetUserIDByRefreshToken(ctx context.Context, refreshToken string) (string, error) {
 	var userID string
-	query := `SELECT id FROM users_profiles WHERE refresh_token = $1`
+	query := `SELECT id FROM "users" WHERE refresh_token = $1`
 	err := r.db.QueryRowContext(ctx, query, refreshToken).Scan(&userID)
 	if err != nil {
 		return "", err
@@ -64,18 +41,40 @@ func (r *authRepository) GetUserIDByRefreshToken(ctx context.Context, refreshTok
 
 // Новый метод для обновления refresh_token.
 func (r *authRepository) UpdateRefreshToken(ctx context.Context, userID string, newRefreshToken string) error {
-	query := `UPDATE users_profiles SET refresh_token = $1 WHERE id = $2`
+	query := `UPDATE "users" SET refresh_token = $1 WHERE id = $2`
 	_, err := r.db.ExecContext(ctx, query, newRefreshToken, userID)
 	return err
 }
 
+// DeleteRefreshToken завершает сессию и пишет SessionRevoked в той же транзакции
 func (r *authRepository) DeleteRefreshToken(ctx context.Context, refreshToken string) error {
-	query := `UPDATE users_profiles SET refresh_token = NULL WHERE refresh_token = $1`
-	_, err := r.db.ExecContext(ctx, query, refreshToken)
-	return err
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	query := `UPDATE "users" SET refresh_token = NULL WHERE refresh_token = $1 RETURNING id`
+	err = tx.QueryRowContext(ctx, query, refreshToken).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	payload := outboxDomain.SessionRevokedPayload{UserID: userID, Reason: "logout"}
+	if err := appendEvent(ctx, tx, outboxDomain.SessionRevoked, userID, payload); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (r *authRepository) CreateFiledAttempt(ctx context.Context, phone string) error {
+// CreateFiledAttempt учитывает неудачную попытку входа и возвращает время окончания блокировки,
+// если эта попытка заблокировала вход
+func (r *authRepository) CreateFiledAttempt(ctx context.Context, phone string) (*time.Time, error) {
 	query := `INSERT INTO failed_logins (phone, attempts, blocked_until) 
               VALUES ($1, 0, NULL) 
               ON CONFLICT (phone) DO NOTHING`
@@ -98,7 +97,7 @@ func (r *authRepository) CreateFiledAttempt(ctx context.Context, phone string) e
 	err = r.db.QueryRowContext(ctx, query, phone).Scan(&attempts)
 	if err != nil {
 		fmt.Println("SQL ERROR (increment attempts):", err)
-		return err
+		return nil, err
 	}
 
 	var blockDuration = 0 * time.Second // <- Добавил начальное значение
@@ -108,6 +107,7 @@ func (r *authRepository) CreateFiledAttempt(ctx context.Context, phone string) e
 		blockDuration = 1 * time.Minute
 	}
 
+	var blocked *time.Time
 	if blockDuration > 0 {
 		blockUntil := time.Now().UTC().Add(blockDuration)
 		query = `UPDATE failed_logins 
@@ -116,14 +116,15 @@ func (r *authRepository) CreateFiledAttempt(ctx context.Context, phone string) e
 		_, err = r.db.ExecContext(ctx, query, blockUntil, phone)
 		if err != nil {
 			fmt.Println("SQL ERROR (block user):", err)
-			return err
+			return nil, err
 		}
 		fmt.Println("User", phone, "blocked until", blockUntil)
+		blocked = &blockUntil
 	}
 
 	fmt.Println("INSERT/UPDATE SUCCESS for", phone, "attempts:", attempts)
 
-	return nil
+	return blocked, nil
 }
 
 func (r *authRepository) CheckBan(ctx context.Context, phone string) error {
@@ -173,3 +174,35 @@ func (r *authRepository) CheckBan(ctx context.Context, phone string) error {
 	fmt.Println("Ban expired, attempts kept for", phone)
 	return nil
 }
+
+// RevokeRefreshToken запоминает хеш заменённого или отозванного refresh-токена,
+// чтобы повторное предъявление можно было распознать как переиспользование
+func (r *authRepository) RevokeRefreshToken(ctx context.Context, userID string, refreshToken string) error {
+	query := `INSERT INTO revoked_refresh_tokens (token_hash, user_id) VALUES ($1, $2)
+	          ON CONFLICT (token_hash) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, hashToken(refreshToken), userID)
+	return err
+}
+
+func (r *authRepository) GetUserIDByRevokedRefreshToken(ctx context.Context, refreshToken string) (string, error) {
+	var userID string
+	query := `SELECT user_id FROM revoked_refresh_tokens WHERE token_hash = $1`
+	err := r.db.QueryRowContext(ctx, query, hashToken(refreshToken)).Scan(&userID)
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType, userID string, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID, payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/rafaceo/go-test-auth/cmd/domain"
 	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
 	"github.com/rafaceo/go-test-auth/cmd/repository"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+	securityService "github.com/rafaceo/go-test-auth/security/service"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+	userRepository "github.com/rafaceo/go-test-auth/user/repository"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"time"
@@ -19,19 +23,119 @@ type AuthService interface {
 	RefreshToken(ctx context.Context, refreshToken string) (string, string, error)
 	Logout(ctx context.Context, refreshToken string) error
 	Register(ctx context.Context, phone string, email string, password string, firstName string, lastName string) (string, error)
+	SwitchContext(ctx context.Context, accessToken string, merchantID string) (string, error)
+	// Authenticate проверяет access_token и то, что его владелец по-прежнему в статусе active
+	Authenticate(ctx context.Context, accessToken string) (*domain.Claims, error)
+	// IssueSession выпускает токены пользователю, личность которого уже подтверждена (вход через внешний провайдер)
+	IssueSession(ctx context.Context, userID uuid.UUID) (string, string, error)
+}
+
+// AccessResolver вычисляет права пользователя по мерчантам для клеймов access_token
+type AccessResolver interface {
+	GetAccess(ctx context.Context, id uuid.UUID) (userDomain.Access, error)
+	GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (userDomain.MerchantAccess, error)
 }
 
 type authService struct {
 	repo      repository.AuthRepository
+	users     userRepository.UserRepository
 	jwtSecret string
+	security  securityService.SecurityEventService
+	access    AccessResolver
 }
 
-func NewAuthService(repo repository.AuthRepository, jwtSecret string) AuthService {
-	return &authService{repo: repo, jwtSecret: jwtSecret}
+// NewAuthService: учётные записи читаются и создаются через users — тот же репозиторий, что у UserService
+func NewAuthService(repo repository.AuthRepository, users userRepository.UserRepository, jwtSecret string, security securityService.SecurityEventService, access AccessResolver) AuthService {
+	return &authService{repo: repo, users: users, jwtSecret: jwtSecret, security: security, access: access}
+}
+
+// issueAccessToken выпускает access_token с правами пользователя у любого мерчанта и по его контекстам
+func (s *authService) issueAccessToken(ctx context.Context, userID uuid.UUID, phone string) (string, error) {
+	access, err := s.access.GetAccess(ctx, userID)
+	if err != nil {
+		log.Printf("Error resolving user access: %v", err)
+		return "", errors.New("failed to resolve user rights")
+	}
+
+	claims := domain.Claims{
+		UserID:       userID,
+		Phone:        phone,
+		Entitlements: rightsDomain.Entitlements(access.Rights),
+		Global:       access.Global,
+	}
+	if len(access.Merchants) > 0 {
+		claims.Merchants = make(map[string][]string, len(access.Merchants))
+		for merchantID, rights := range access.Merchants {
+			claims.Merchants[merchantID] = rightsDomain.Entitlements(rights)
+		}
+	}
+
+	accessToken, err := domain.GenerateAccessToken(claims, s.jwtSecret)
+	if err != nil {
+		return "", errors.New("failed to generate access token")
+	}
+	return accessToken, nil
+}
+
+// SwitchContext выпускает по действующему access_token новый, привязанный к мерчанту merchantID:
+// в нём merchant_id, права у этого мерчанта и признак глобального контекста
+func (s *authService) SwitchContext(ctx context.Context, accessToken string, merchantID string) (string, error) {
+	_, user, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	access, err := s.access.GetMerchantAccess(ctx, user.ID, merchantID)
+	if err != nil {
+		if errors.Is(err, userDomain.ErrNoMerchantContext) {
+			return "", e.NoMerchantContext
+		}
+		log.Printf("Error resolving merchant access: %v", err)
+		return "", errors.New("failed to resolve user rights")
+	}
+
+	scoped, err := domain.GenerateAccessToken(domain.Claims{
+		UserID:       user.ID,
+		Phone:        user.Phone,
+		MerchantID:   access.MerchantID,
+		Entitlements: rightsDomain.Entitlements(access.Rights),
+		Global:       access.Global,
+	}, s.jwtSecret)
+	if err != nil {
+		return "", errors.New("failed to generate access token")
+	}
+	return scoped, nil
+}
+
+func (s *authService) Authenticate(ctx context.Context, accessToken string) (*domain.Claims, error) {
+	claims, _, err := s.authenticate(ctx, accessToken)
+	return claims, err
+}
+
+// authenticate: токен удалённого из базы пользователя недействителен, токен неактивного отклоняется с 403
+func (s *authService) authenticate(ctx context.Context, accessToken string) (*domain.Claims, userDomain.User, error) {
+	claims, err := domain.ParseAccessToken(accessToken, s.jwtSecret)
+	if err != nil {
+		return nil, userDomain.User{}, e.InvalidTokenError
+	}
+	user, err := s.users.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Error getting token owner: %v", err)
+		return nil, userDomain.User{}, e.InvalidTokenError
+	}
+	if !user.Active() {
+		return nil, userDomain.User{}, e.AccountInactive
+	}
+	return claims, user, nil
+}
+
+// recordSecurityEvent не влияет на результат входа: ошибку записи логирует middleware сервиса событий
+func (s *authService) recordSecurityEvent(ctx context.Context, event securityDomain.Event) {
+	_ = s.security.Record(ctx, event)
 }
 
 func (s *authService) Register(ctx context.Context, phone string, email, password, firstName, lastName string) (string, error) {
-	exists, err := s.repo.UserExists(ctx, phone, email)
+	exists, err := s.users.UserExists(ctx, phone, email)
 	if err != nil {
 		return "", err
 	}
@@ -44,7 +148,8 @@ func (s *authService) Register(ctx context.Context, phone string, email, passwor
 		return "", err
 	}
 
-	err = s.repo.CreateUser(ctx, phone, email, string(hashedPassword), firstName, lastName)
+	user := userDomain.User{Phone: phone, PasswordHash: string(hashedPassword), Email: email, FirstName: firstName, LastName: lastName}
+	_, err = s.users.CreateUser(ctx, user, "registration")
 	if err != nil {
 		return "", err
 	}
@@ -53,24 +158,75 @@ func (s *authService) Register(ctx context.Context, phone string, email, passwor
 }
 
 func (s *authService) Login(ctx context.Context, phone, password string) (string, string, error) {
-	user, err := s.repo.GetUserByPhone(ctx, phone)
+	user, err := s.users.GetUserByPhone(ctx, phone)
 	if err != nil {
+		if errors.Is(err, userDomain.ErrUserNotFound) {
+			s.recordSecurityEvent(ctx, securityDomain.Event{
+				Type:    securityDomain.EventLoginFailed,
+				Subject: phone,
+				Details: map[string]interface{}{"reason": "unknown_user"},
+			})
+		}
 		return "", "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
 		err := s.repo.CheckBan(ctx, phone)
 		if err != nil {
+			s.recordSecurityEvent(ctx, securityDomain.Event{
+				Type:    securityDomain.EventLockedLoginAttempt,
+				Subject: phone,
+				UserID:  user.ID.String(),
+			})
 			return "", "", e.TooManyRequestError
 		}
-		s.repo.CreateFiledAttempt(ctx, phone)
+		blockedUntil, _ := s.repo.CreateFiledAttempt(ctx, phone)
+		s.recordSecurityEvent(ctx, securityDomain.Event{
+			Type:    securityDomain.EventLoginFailed,
+			Subject: phone,
+			UserID:  user.ID.String(),
+			Details: map[string]interface{}{"reason": "invalid_password"},
+		})
+		if blockedUntil != nil {
+			s.recordSecurityEvent(ctx, securityDomain.Event{
+				Type:    securityDomain.EventAccountLocked,
+				Subject: phone,
+				UserID:  user.ID.String(),
+				Details: map[string]interface{}{"blocked_until": blockedUntil.Format(time.RFC3339)},
+			})
+		}
 		return "", "", errors.New("invalid credentials")
 	}
+	if !user.Active() {
+		s.recordSecurityEvent(ctx, securityDomain.Event{
+			Type:    securityDomain.EventLoginFailed,
+			Subject: phone,
+			UserID:  user.ID.String(),
+			Details: map[string]interface{}{"reason": "inactive", "status": user.Status},
+		})
+		return "", "", e.AccountInactive
+	}
+	return s.issueSession(ctx, user)
+}
+
+func (s *authService) IssueSession(ctx context.Context, userID uuid.UUID) (string, string, error) {
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting user for session: %v", err)
+		return "", "", errors.New("user not found")
+	}
+	if !user.Active() {
+		return "", "", e.AccountInactive
+	}
+	return s.issueSession(ctx, user)
+}
+
+func (s *authService) issueSession(ctx context.Context, user userDomain.User) (string, string, error) {
 	// Генерация access_token
-	accessToken, err := domain.GenerateAccessToken(user.ID, user.Phone, user.Roles, user.Entitlements, s.jwtSecret)
+	accessToken, err := s.issueAccessToken(ctx, user.ID, user.Phone)
 	if err != nil {
-		return "", "", errors.New("failed to generate access token")
+		return "", "", err
 	}
 
 	// Генерация refresh_token
@@ -90,33 +246,64 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (st
 	userID, err := s.repo.GetUserIDByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		log.Printf("Error getting user ID by refresh token: %v", err)
+		s.detectTokenReuse(ctx, refreshToken)
 		return "", "", errors.New("invalid refresh token")
 	}
 
-	expirationTime := time.Now().Add(15 * time.Minute).Unix()
-	newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  userID,
-		"exp": expirationTime,
-	})
-	accessToken, err := newAccessToken.SignedString(domain.SecretKey)
+	ownerID, err := uuid.Parse(userID)
+	if err != nil {
+		log.Printf("Error parsing refresh token owner: %v", err)
+		return "", "", errors.New("invalid refresh token")
+	}
+	user, err := s.users.GetUserByID(ctx, ownerID)
+	if err != nil {
+		log.Printf("Error getting user by refresh token owner: %v", err)
+		return "", "", errors.New("invalid refresh token")
+	}
+	if !user.Active() {
+		return "", "", e.AccountInactive
+	}
+
+	accessToken, err := s.issueAccessToken(ctx, user.ID, user.Phone)
 	if err != nil {
-		return "", "", errors.New("failed to generate access token")
+		return "", "", err
 	}
 
 	newRefreshToken := uuid.NewString()
 	if err := s.repo.UpdateRefreshToken(ctx, userID, newRefreshToken); err != nil {
 		return "", "", errors.New("failed to update refresh token")
 	}
+	if err := s.repo.RevokeRefreshToken(ctx, userID, refreshToken); err != nil {
+		log.Printf("Error revoking rotated refresh token: %v", err)
+	}
 
 	return accessToken, newRefreshToken, nil
 }
 
 func (s *authService) Logout(ctx context.Context, refreshToken string) error {
-	_, err := s.repo.GetUserIDByRefreshToken(ctx, refreshToken)
+	userID, err := s.repo.GetUserIDByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		log.Printf("Error getting user ID by refresh token: %v", err)
+		s.detectTokenReuse(ctx, refreshToken)
 		return errors.New("invalid refresh token")
 	}
-	return s.repo.DeleteRefreshToken(ctx, refreshToken) // Передаём токен, а не userID
+	if err := s.repo.DeleteRefreshToken(ctx, refreshToken); err != nil { // Передаём токен, а не userID
+		return err
+	}
+	if err := s.repo.RevokeRefreshToken(ctx, userID, refreshToken); err != nil {
+		log.Printf("Error revoking refresh token: %v", err)
+	}
+	return nil
+}
 
+// detectTokenReuse отмечает предъявление уже заменённого или отозванного refresh-токена
+func (s *authService) detectTokenReuse(ctx context.Context, refreshToken string) {
+	userID, err := s.repo.GetUserIDByRevokedRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return
+	}
+	s.recordSecurityEvent(ctx, securityDomain.Event{
+		Type:   securityDomain.EventTokenReuse,
+		UserID: userID,
+	})
 }
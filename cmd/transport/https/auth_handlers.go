@@ -10,8 +10,10 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
 	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
 	"log"
 	"net/http"
+	"strings"
 
 	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
 	"github.com/rafaceo/go-test-auth/cmd/service"
@@ -21,6 +23,7 @@ func GetAuthHandlers(serv service.AuthService, logger kitlog.Logger) []*httphand
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
 	}
 
 	registerHandler := kithttp.NewServer(
@@ -51,6 +54,13 @@ func GetAuthHandlers(serv service.AuthService, logger kitlog.Logger) []*httphand
 		opts...,
 	)
 
+	switchContextHandler := kithttp.NewServer(
+		MakeSwitchContextEndpoint(serv),
+		DecodeSwitchContextRequest,
+		EncodeResponse,
+		opts...,
+	)
+
 	return []*httphandlers.HTTPHandler{
 		{
 			Path:    "/api/v4/users",
@@ -72,6 +82,11 @@ func GetAuthHandlers(serv service.AuthService, logger kitlog.Logger) []*httphand
 			Handler: refreshHandler,
 			Methods: []string{"POST"},
 		},
+		{
+			Path:    "/api/v4/auth/context/switch",
+			Handler: switchContextHandler,
+			Methods: []string{"POST"},
+		},
 	}
 }
 
@@ -118,13 +133,25 @@ type RefreshResponse struct {
 	Error        string `json:"error,omitempty"`
 }
 
+// SwitchContextRequest — access_token берётся из заголовка Authorization: Bearer
+type SwitchContextRequest struct {
+	AccessToken string `json:"-"`
+	MerchantID  string `json:"merchant_id"`
+}
+
+type SwitchContextResponse struct {
+	AccessToken string `json:"access_token,omitempty"`
+	MerchantID  string `json:"merchant_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
 // MakeLoginEndpoint создаёт эндпоинт для логина
 func MakeLoginEndpoint(svc service.AuthService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(LoginRequest)
 		accessToken, refreshToken, err := svc.Login(ctx, req.Phone, req.Password)
 		if err != nil {
-			if errors.Is(err, e.TooManyRequestError) {
+			if errors.Is(err, e.TooManyRequestError) || errors.Is(err, e.AccountInactive) {
 				return nil, err
 			}
 			return nil, e.UnauthorizedError
@@ -175,6 +202,21 @@ func MakeRefreshTokenEndpoint(svc service.AuthService) endpoint.Endpoint {
 	}
 }
 
+func MakeSwitchContextEndpoint(svc service.AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SwitchContextRequest)
+		accessToken, err := svc.SwitchContext(ctx, req.AccessToken, req.MerchantID)
+		if err != nil {
+			var argErr *e.ArgError
+			if errors.As(err, &argErr) {
+				return nil, err
+			}
+			return SwitchContextResponse{Error: err.Error()}, nil
+		}
+		return SwitchContextResponse{AccessToken: accessToken, MerchantID: req.MerchantID}, nil
+	}
+}
+
 // DecodeLoginRequest декодирует JSON-запрос
 func DecodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req LoginRequest
@@ -209,6 +251,21 @@ func DecodeRefreshTokenRequest(_ context.Context, r *http.Request) (interface{},
 	return req, nil
 }
 
+func DecodeSwitchContextRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, e.InvalidTokenError
+	}
+
+	var req SwitchContextRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.MerchantID) == "" {
+		return nil, e.MerchantRequired
+	}
+	req.AccessToken = strings.TrimPrefix(header, "Bearer ")
+	req.MerchantID = strings.TrimSpace(req.MerchantID)
+	return req, nil
+}
+
 // EncodeResponse кодирует JSON-ответ
 func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,54 @@
+package authn
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	authDomain "github.com/rafaceo/go-test-auth/cmd/domain"
+	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+)
+
+// TokenVerifier проверяет access_token и то, что его владелец в статусе active
+type TokenVerifier interface {
+	Authenticate(ctx context.Context, accessToken string) (*authDomain.Claims, error)
+}
+
+// Middleware пропускает запрос только с действующим access_token (requestinfo.AccessToken) и делает
+// его владельца подтверждённым инициатором. Ошибка проверки уходит кодировщику ошибок (401 или 403).
+func Middleware(tokens TokenVerifier) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, err := tokens.Authenticate(ctx, requestinfo.AccessToken(ctx))
+			if err != nil {
+				return nil, err
+			}
+			return next(requestinfo.WithVerifiedActor(ctx, claims.UserID.String()), request)
+		}
+	}
+}
+
+// RequireEntitlement — Middleware, который пропускает только владельца права entitlement («модуль:действие»)
+// у любого мерчанта. Токен, привязанный к мерчанту, не подходит: его права действуют только у этого мерчанта.
+func RequireEntitlement(tokens TokenVerifier, entitlement string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, err := tokens.Authenticate(ctx, requestinfo.AccessToken(ctx))
+			if err != nil {
+				return nil, err
+			}
+			if claims.MerchantID != "" || !hasEntitlement(claims.Entitlements, entitlement) {
+				return nil, e.Forbidden
+			}
+			return next(requestinfo.WithVerifiedActor(ctx, claims.UserID.String()), request)
+		}
+	}
+}
+
+func hasEntitlement(entitlements []string, entitlement string) bool {
+	for _, granted := range entitlements {
+		if granted == entitlement {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package requestinfo
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ActorHeader — заголовок с идентификатором пользователя, выполняющего запрос
+const ActorHeader = "X-Owner"
+
+// RequestIDHeader — сквозной идентификатор запроса; если клиент его не передал, генерируется новый
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	verifiedActorKey
+	accessTokenKey
+	requestIDKey
+	sourceIPKey
+)
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor возвращает инициатора запроса или пустую строку, если он неизвестен
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// WithVerifiedActor задаёт инициатора, подтверждённого access_token или доверенным вызовом
+// (authctl). Он же становится Actor вместо заголовка X-Owner.
+func WithVerifiedActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(WithActor(ctx, actor), verifiedActorKey, actor)
+}
+
+// VerifiedActor возвращает подтверждённого инициатора или пустую строку
+func VerifiedActor(ctx context.Context) string {
+	actor, _ := ctx.Value(verifiedActorKey).(string)
+	return actor
+}
+
+func WithAccessToken(ctx context.Context, accessToken string) context.Context {
+	return context.WithValue(ctx, accessTokenKey, accessToken)
+}
+
+// AccessToken возвращает токен из заголовка Authorization: Bearer или пустую строку
+func AccessToken(ctx context.Context) string {
+	accessToken, _ := ctx.Value(accessTokenKey).(string)
+	return accessToken
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceIPKey, ip)
+}
+
+func SourceIP(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey).(string)
+	return ip
+}
+
+// PopulateRequestContext переносит данные HTTP-запроса в контекст (kithttp.ServerBefore)
+func PopulateRequestContext(ctx context.Context, r *http.Request) context.Context {
+	if actor := r.Header.Get(ActorHeader); actor != "" {
+		ctx = WithActor(ctx, actor)
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		ctx = WithAccessToken(ctx, strings.TrimPrefix(header, "Bearer "))
+	}
+
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	ctx = WithRequestID(ctx, requestID)
+
+	return WithSourceIP(ctx, clientIP(r))
+}
+
+// trustedProxies — сети балансировщиков, которым разрешено передавать адрес клиента в X-Forwarded-For
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies задаёт доверенные прокси: адреса или подсети CIDR. Без них заголовки X-Forwarded-For
+// и X-Real-IP игнорируются и источником считается адрес соединения.
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP возвращает адрес соединения. Если соединение пришло от доверенного прокси, X-Forwarded-For
+// читается справа налево до первого адреса не из доверенных: левые значения мог подставить сам клиент.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+		return host
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return host
+}
@@ -0,0 +1,52 @@
+package requestinfo
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+
+	cases := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"untrusted peer forges headers", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"client prepends a forged hop", "10.1.2.3:5000", "1.1.1.1, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "192.0.2.10:5000", "198.51.100.1, 10.0.0.4", "", "198.51.100.1"},
+		{"garbage hop stops the walk", "10.1.2.3:5000", "198.51.100.1, not-an-ip", "", "10.1.2.3"},
+		{"real ip from trusted proxy", "10.1.2.3:5000", "", "198.51.100.9", "198.51.100.9"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+		if got := clientIP(r); got != c.want {
+			t.Errorf("%s: clientIP = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalid(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	if err := SetTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("expected error for invalid CIDR")
+	}
+	if err := SetTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Fatal("expected error for host name")
+	}
+}
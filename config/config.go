@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Configs struct {
@@ -12,6 +13,7 @@ type Configs struct {
 	Elastic     ElasticConfig   `json:"elastic"`
 	Cassandra   CassandraConfig `json:"cassandra"`
 	Rabbit      RabbitConfig    `json:"rabbit"`
+	Siem        SiemConfig      `json:"siem"`
 	Env         Env             `json:"env"`
 	LogrusLevel uint8           `json:"logrus_level"`
 
@@ -19,12 +21,24 @@ type Configs struct {
 }
 
 type Env struct {
-	Mode                 string
-	Namespace            string
-	ForteKeysServiceName string `json:"forte_keys_service_name"`
-	JwtSecret            string `json:"jwt_secret"`
-	AccessTokenExpMin    int    `json:"access_token_exp_min"`
-	RefreshTokenExpMin   int    `json:"refresh_token_exp_min"`
+	Mode                  string
+	Namespace             string
+	ForteKeysServiceName  string `json:"forte_keys_service_name"`
+	JwtSecret             string `json:"jwt_secret"`
+	AccessTokenExpMin     int    `json:"access_token_exp_min"`
+	RefreshTokenExpMin    int    `json:"refresh_token_exp_min"`
+	GrantSweepIntervalSec int    `json:"grant_sweep_interval_sec"`
+	// AuditCheckpointKey подписывает контрольные точки журнала аудита; пустой ключ отключает их
+	AuditCheckpointKey         string `json:"audit_checkpoint_key"`
+	AuditCheckpointIntervalSec int    `json:"audit_checkpoint_interval_sec"`
+	OutboxRelayIntervalSec     int    `json:"outbox_relay_interval_sec"`
+	WebhookDispatchIntervalSec int    `json:"webhook_dispatch_interval_sec"`
+	ChangefeedPollIntervalSec  int    `json:"changefeed_poll_interval_sec"`
+	ImportPollIntervalSec      int    `json:"import_poll_interval_sec"`
+	// SamlBaseURL — внешний адрес сервиса для метаданных SP и адреса ACS в SAML
+	SamlBaseURL string `json:"saml_base_url"`
+	// TrustedProxies — адреса и подсети балансировщиков, которым доверяется X-Forwarded-For
+	TrustedProxies []string `json:"trusted_proxies"`
 }
 
 type PostgresConfig struct {
@@ -53,6 +67,16 @@ type RabbitConfig struct {
 	User        string `json:"user"`
 	Password    string `json:"password"`
 	LogLevel    uint8  `json:"log_level"`
+	// Exchange — topic-exchange доменных событий; по умолчанию auth.events
+	Exchange string `json:"exchange"`
+}
+
+// SiemConfig — выгрузка событий аудита и безопасности; пустой Sink отключает выгрузку
+type SiemConfig struct {
+	Sink        string `json:"sink"`
+	Format      string `json:"format"`
+	Target      string `json:"target"`
+	IntervalSec int    `json:"interval_sec"`
 }
 
 type DarLogisticsConfig struct {
@@ -70,12 +94,70 @@ func LoadConfig() error {
 
 	accessTokenExpMin, _ := strconv.Atoi(os.Getenv("ACCESS_TOKEN_EXP_MIN"))
 	refreshTokenExpMin, _ := strconv.Atoi(os.Getenv("REFRESH_TOKEN_EXP_MIN"))
+	grantSweepIntervalSec, _ := strconv.Atoi(os.Getenv("GRANT_SWEEP_INTERVAL_SEC"))
+	if grantSweepIntervalSec <= 0 {
+		grantSweepIntervalSec = 60
+	}
+	auditCheckpointIntervalSec, _ := strconv.Atoi(os.Getenv("AUDIT_CHECKPOINT_INTERVAL_SEC"))
+	if auditCheckpointIntervalSec <= 0 {
+		auditCheckpointIntervalSec = 300
+	}
+
+	outboxRelayIntervalSec, _ := strconv.Atoi(os.Getenv("OUTBOX_RELAY_INTERVAL_SEC"))
+	if outboxRelayIntervalSec <= 0 {
+		outboxRelayIntervalSec = 1
+	}
+	webhookDispatchIntervalSec, _ := strconv.Atoi(os.Getenv("WEBHOOK_DISPATCH_INTERVAL_SEC"))
+	if webhookDispatchIntervalSec <= 0 {
+		webhookDispatchIntervalSec = 5
+	}
+	changefeedPollIntervalSec, _ := strconv.Atoi(os.Getenv("CHANGEFEED_POLL_INTERVAL_SEC"))
+	if changefeedPollIntervalSec <= 0 {
+		changefeedPollIntervalSec = 1
+	}
+	importPollIntervalSec, _ := strconv.Atoi(os.Getenv("IMPORT_POLL_INTERVAL_SEC"))
+	if importPollIntervalSec <= 0 {
+		importPollIntervalSec = 5
+	}
+	samlBaseURL := os.Getenv("SAML_SP_BASE_URL")
+	if samlBaseURL == "" {
+		samlBaseURL = "http://localhost:8080"
+	}
+	rabbitPort, _ := strconv.Atoi(os.Getenv("RABBIT_PORT"))
+
+	siemIntervalSec, _ := strconv.Atoi(os.Getenv("SIEM_INTERVAL_SEC"))
+	if siemIntervalSec <= 0 {
+		siemIntervalSec = 10
+	}
 
 	AllConfigs = &Configs{
+		Rabbit: RabbitConfig{
+			Host:        os.Getenv("RABBIT_HOST"),
+			VirtualHost: os.Getenv("RABBIT_VHOST"),
+			Port:        rabbitPort,
+			User:        os.Getenv("RABBIT_USER"),
+			Password:    os.Getenv("RABBIT_PASSWORD"),
+			Exchange:    os.Getenv("RABBIT_EXCHANGE"),
+		},
+		Siem: SiemConfig{
+			Sink:        os.Getenv("SIEM_SINK"),
+			Format:      os.Getenv("SIEM_FORMAT"),
+			Target:      os.Getenv("SIEM_TARGET"),
+			IntervalSec: siemIntervalSec,
+		},
 		Env: Env{
-			JwtSecret:          os.Getenv("JWT_SECRET"),
-			AccessTokenExpMin:  accessTokenExpMin,
-			RefreshTokenExpMin: refreshTokenExpMin,
+			JwtSecret:                  os.Getenv("JWT_SECRET"),
+			AccessTokenExpMin:          accessTokenExpMin,
+			RefreshTokenExpMin:         refreshTokenExpMin,
+			GrantSweepIntervalSec:      grantSweepIntervalSec,
+			AuditCheckpointKey:         os.Getenv("AUDIT_CHECKPOINT_KEY"),
+			AuditCheckpointIntervalSec: auditCheckpointIntervalSec,
+			OutboxRelayIntervalSec:     outboxRelayIntervalSec,
+			WebhookDispatchIntervalSec: webhookDispatchIntervalSec,
+			ChangefeedPollIntervalSec:  changefeedPollIntervalSec,
+			ImportPollIntervalSec:      importPollIntervalSec,
+			SamlBaseURL:                samlBaseURL,
+			TrustedProxies:             strings.Split(os.Getenv("TRUSTED_PROXIES"), ","),
 		},
 	}
 
@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StateTTL — сколько живёт незавершённый вход: за это время пользователь должен вернуться от провайдера
+const StateTTL = 10 * time.Minute
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+var (
+	ErrProviderNotFound = errors.New("identity provider not found")
+	ErrProviderExists   = errors.New("identity provider with this id already exists")
+	ErrProviderDisabled = errors.New("identity provider is disabled")
+	ErrInvalidState     = errors.New("login session is invalid or expired, start the login again")
+	ErrInvalidIDToken   = errors.New("identity provider returned an invalid id_token")
+	ErrDomainNotAllowed = errors.New("email domain is not allowed for this identity provider")
+	ErrNoLocalAccount   = errors.New("no account is linked to this external identity")
+	ErrAmbiguousAccount = errors.New("several accounts match this external identity, ask an administrator to link it")
+	ErrPhoneRequired    = errors.New("identity provider did not return a verified phone number required to create an account")
+	ErrAccountExists    = errors.New("an account with this phone or email already exists, ask an administrator to link it")
+)
+
+// Provider — внешний провайдер OpenID Connect. ClientSecret принимается при создании и изменении,
+// но никогда не возвращается.
+type Provider struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+	// Issuer — идентификатор провайдера; конфигурация читается из {issuer}/.well-known/openid-configuration
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// AllowedDomains ограничивает вход адресами из этих доменов; пусто — без ограничений
+	AllowedDomains []string `json:"allowed_domains"`
+	// LinkByEmail и LinkByPhone связывают внешнюю учётную запись с существующим пользователем
+	// по подтверждённому провайдером email или телефону
+	LinkByEmail bool `json:"link_by_email"`
+	LinkByPhone bool `json:"link_by_phone"`
+	// TrustEmail считает email подтверждённым, если провайдер не передаёт email_verified
+	// (например, корпоративный каталог с проверенными доменами)
+	TrustEmail bool `json:"trust_email"`
+	// JITEnabled заводит пользователя при первом входе; DefaultRoles — имена ролей, которые он получает
+	JITEnabled   bool     `json:"jit_enabled"`
+	DefaultRoles []string `json:"default_roles"`
+	// MerchantID — мерчант, в контекст которого попадает заведённый пользователь и у которого действуют роли
+	MerchantID *string   `json:"merchant_id,omitempty"`
+	PhoneClaim string    `json:"phone_claim"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Normalize убирает пробелы и дубли и проставляет значения по умолчанию
+func (p *Provider) Normalize() {
+	p.ID = strings.ToLower(strings.TrimSpace(p.ID))
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	p.Issuer = strings.TrimRight(strings.TrimSpace(p.Issuer), "/")
+	p.ClientID = strings.TrimSpace(p.ClientID)
+	p.RedirectURL = strings.TrimSpace(p.RedirectURL)
+	p.PhoneClaim = strings.TrimSpace(p.PhoneClaim)
+	if p.PhoneClaim == "" {
+		p.PhoneClaim = "phone_number"
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "email", "profile", "phone"}
+	}
+	p.Scopes = uniqueStrings(append([]string{"openid"}, p.Scopes...), false)
+	p.AllowedDomains = uniqueStrings(p.AllowedDomains, true)
+	p.DefaultRoles = uniqueStrings(p.DefaultRoles, false)
+	if p.MerchantID != nil && strings.TrimSpace(*p.MerchantID) == "" {
+		p.MerchantID = nil
+	}
+}
+
+func (p Provider) Validate() error {
+	if !providerIDPattern.MatchString(p.ID) {
+		return errors.New("id must be 2-64 characters: lowercase letters, digits, '-' and '_'")
+	}
+	if err := validateIssuer(p.Issuer); err != nil {
+		return err
+	}
+	if p.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	u, err := url.Parse(p.RedirectURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" {
+		return errors.New("redirect_url must be an absolute http(s) URL without a fragment")
+	}
+	for _, scope := range p.Scopes {
+		if strings.ContainsAny(scope, " \t\"\\") {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	if len(p.DefaultRoles) > 0 && !p.JITEnabled {
+		return errors.New("default_roles require jit_enabled")
+	}
+	return nil
+}
+
+// validateIssuer требует https; http допускается только для локального провайдера (разработка и проверка)
+func validateIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("issuer must be an absolute URL without query and fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return errors.New("issuer must use https")
+}
+
+// Redacted — копия провайдера без секрета для ответов API и журнала аудита
+func (p Provider) Redacted() Provider {
+	p.ClientSecret = ""
+	return p
+}
+
+// EmailAllowed проверяет домен адреса по AllowedDomains
+func (p Provider) EmailAllowed(email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginState — незавершённый вход. Сам state уходит провайдеру и возвращается в callback,
+// в базе хранится только его хеш. LinkUserID задан, если вход начат, чтобы привязать учётную запись
+// провайдера к уже вошедшему пользователю.
+type LoginState struct {
+	StateHash    string
+	ProviderID   string
+	CodeVerifier string
+	Nonce        string
+	LinkUserID   *uuid.UUID
+	ExpiresAt    time.Time
+}
+
+// Identity — внешняя учётная запись, связанная с пользователем
+type Identity struct {
+	ProviderID  string     `json:"provider_id"`
+	Subject     string     `json:"subject"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Email       string     `json:"email,omitempty"`
+	LinkedAt    time.Time  `json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Claims — сведения о пользователе из проверенного id_token
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Phone         string
+	PhoneVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Callback — ответ провайдера, с которым браузер возвращается после входа
+type Callback struct {
+	State            string
+	Code             string
+	Error            string
+	ErrorDescription string
+}
+
+// LoginResult — итог входа через провайдера. Linked — внешняя учётная запись связана
+// с пользователем при этом входе, Provisioned — пользователь заведён при этом входе.
+type LoginResult struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	UserID       uuid.UUID `json:"user_id"`
+	Provider     string    `json:"provider"`
+	Linked       bool      `json:"linked,omitempty"`
+	Provisioned  bool      `json:"provisioned,omitempty"`
+	// LinkRequested — вход начат вошедшим пользователем, чтобы привязать к себе учётную запись провайдера
+	LinkRequested bool `json:"link_requested,omitempty"`
+}
+
+func uniqueStrings(values []string, lower bool) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(value)
+		}
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
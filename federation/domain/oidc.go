@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+// maxNameLength — ограничение столбцов имени и фамилии пользователя
+const maxNameLength = 64
+
+// SigningAlgorithms — алгоритмы подписи id_token, которые принимаются. none и HS* (подпись
+// общим секретом) не принимаются: id_token должен быть подписан ключом провайдера из JWKS.
+var SigningAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Discovery — нужная часть конфигурации провайдера (OpenID Connect Discovery 1.0)
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Validate сверяет issuer из конфигурации с настроенным: иначе чужая конфигурация
+// подменила бы ключи и адреса провайдера
+func (d Discovery) Validate(issuer string) error {
+	if strings.TrimRight(d.Issuer, "/") != issuer {
+		return fmt.Errorf("discovery issuer %q does not match configured issuer %q", d.Issuer, issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return errors.New("discovery document lacks authorization, token or jwks endpoint")
+	}
+	if len(d.CodeChallengeMethodsSupported) > 0 && !contains(d.CodeChallengeMethodsSupported, "S256") {
+		return errors.New("identity provider does not support PKCE S256")
+	}
+	return nil
+}
+
+// BasicClientAuth — передавать секрет клиента в заголовке Authorization (client_secret_basic).
+// По умолчанию спецификация предполагает именно его.
+func (d Discovery) BasicClientAuth() bool {
+	methods := d.TokenEndpointAuthMethodsSupported
+	return len(methods) == 0 || contains(methods, "client_secret_basic") || !contains(methods, "client_secret_post")
+}
+
+// AuthorizationURL — адрес, на который браузер уходит за входом к провайдеру
+func (d Discovery) AuthorizationURL(p Provider, state, nonce, codeVerifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// JWK — открытый ключ из JWKS провайдера (RFC 7517)
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys возвращает ключи подписи по kid; ключи шифрования и неподдерживаемых типов пропускаются
+func (s JWKS) PublicKeys() map[string]interface{} {
+	keys := make(map[string]interface{}, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys
+}
+
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || n.BitLen() < 2048 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// RandomToken — случайная строка для state, nonce и code_verifier (43 символа base64url, RFC 7636)
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CodeChallenge — PKCE S256: BASE64URL(SHA256(code_verifier))
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func HashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimsFrom извлекает сведения о пользователе из клеймов id_token. Телефон читается из клейма
+// phoneClaim провайдера; email_verified и phone_number_verified некоторые провайдеры передают строкой.
+func ClaimsFrom(raw map[string]interface{}, phoneClaim string, trustEmail bool) Claims {
+	claims := Claims{
+		Subject:    stringClaim(raw, "sub"),
+		Email:      strings.ToLower(stringClaim(raw, "email")),
+		GivenName:  truncate(stringClaim(raw, "given_name"), maxNameLength),
+		FamilyName: truncate(stringClaim(raw, "family_name"), maxNameLength),
+		Phone:      strings.ReplaceAll(stringClaim(raw, phoneClaim), " ", ""),
+	}
+	if verified, ok := boolClaim(raw, "email_verified"); ok {
+		claims.EmailVerified = verified
+	} else {
+		claims.EmailVerified = trustEmail
+	}
+	claims.PhoneVerified, _ = boolClaim(raw, phoneClaim+"_verified")
+	return claims
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return value
+}
+
+func stringClaim(raw map[string]interface{}, name string) string {
+	value, _ := raw[name].(string)
+	return strings.TrimSpace(value)
+}
+
+func boolClaim(raw map[string]interface{}, name string) (bool, bool) {
+	switch value := raw[name].(type) {
+	case bool:
+		return value, true
+	case string:
+		return value == "true", true
+	}
+	return false, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package federation
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/federation/middleware"
+	"github.com/rafaceo/go-test-auth/federation/repository/postgres"
+	"github.com/rafaceo/go-test-auth/federation/service"
+	"github.com/rafaceo/go-test-auth/security"
+)
+
+// providerTimeout ограничивает ожидание ответа провайдера: конфигурации, ключей и обмена кода
+const providerTimeout = 10 * time.Second
+
+type ServiceFactory struct{}
+
+// CreateFederationService — вход через внешних провайдеров OpenID Connect; токены выпускает sessions
+func (sf *ServiceFactory) CreateFederationService(logger log.Logger, postgresClient *sqlx.DB, sessions service.SessionIssuer) service.FederationService {
+	federationServ := service.NewFederationService(
+		postgres.NewFederationRepository(postgresClient),
+		service.NewHTTPOIDCClient(providerTimeout),
+		sessions,
+		security.NewRecorder(logger, postgresClient),
+		accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)),
+	)
+	federationServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), federationServ)
+	federationServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "federation"), federationServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("federation_service")
+	federationServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, federationServ)
+
+	return federationServ
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+	"github.com/rafaceo/go-test-auth/federation/service"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+)
+
+// auditingService записывает в журнал аудита изменения провайдеров и связи внешних учётных записей
+// с пользователями, созданные при входе. Секрет клиента в журнал не попадает.
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.FederationService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.FederationService) service.FederationService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, targetType, targetID, before, after))
+}
+
+func (a *auditingService) CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error) {
+	created, err := a.next.CreateProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "identity_provider.create", auditDomain.TargetIdProvider, created.ID, nil, created)
+	return created, nil
+}
+
+func (a *auditingService) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	return a.next.GetProvider(ctx, id)
+}
+
+func (a *auditingService) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	return a.next.ListProviders(ctx)
+}
+
+func (a *auditingService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error) {
+	before, _ := a.next.GetProvider(ctx, id)
+	updated, err := a.next.UpdateProvider(ctx, id, provider)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "identity_provider.update", auditDomain.TargetIdProvider, id, before, updated)
+	return updated, nil
+}
+
+func (a *auditingService) DeleteProvider(ctx context.Context, id string) error {
+	before, _ := a.next.GetProvider(ctx, id)
+	if err := a.next.DeleteProvider(ctx, id); err != nil {
+		return err
+	}
+	a.record(ctx, "identity_provider.delete", auditDomain.TargetIdProvider, id, before, nil)
+	return nil
+}
+
+func (a *auditingService) StartLogin(ctx context.Context, providerID string) (string, error) {
+	return a.next.StartLogin(ctx, providerID)
+}
+
+func (a *auditingService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error) {
+	return a.next.StartLink(ctx, userID, providerID)
+}
+
+func (a *auditingService) CompleteLogin(ctx context.Context, callback domain.Callback) (*domain.LoginResult, error) {
+	result, err := a.next.CompleteLogin(ctx, callback)
+	if err != nil {
+		return nil, err
+	}
+	if result.Linked && result.LinkRequested {
+		ctx = requestinfo.WithVerifiedActor(ctx, result.UserID.String())
+		a.record(ctx, "user_identity.link", auditDomain.TargetUser, result.UserID.String(), nil,
+			map[string]string{"provider": identitiesDomain.ProviderKey(identitiesDomain.ProtocolOIDC, result.Provider)})
+	} else if result.Linked {
+		action := "federated_identity.link"
+		if result.Provisioned {
+			action = "federated_identity.provision"
+		}
+		// Вход не требует заголовка автора: изменение совершает сам провайдер
+		ctx = requestinfo.WithVerifiedActor(ctx, "oidc:"+result.Provider)
+		a.record(ctx, action, auditDomain.TargetUser, result.UserID.String(), nil, map[string]string{"provider": result.Provider})
+	}
+	return result, nil
+}
@@ -0,0 +1,370 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+	"github.com/rafaceo/go-test-auth/federation/repository"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+)
+
+const providerColumns = `id, display_name, issuer, client_id, client_secret, redirect_url, scopes, allowed_domains,
+	link_by_email, link_by_phone, trust_email, jit_enabled, default_roles, merchant_id, phone_claim, enabled,
+	created_at, updated_at`
+
+type federationRepository struct {
+	db *sqlx.DB
+}
+
+func NewFederationRepository(db *sqlx.DB) repository.FederationRepository {
+	return &federationRepository{db: db}
+}
+
+func (r *federationRepository) CreateProvider(ctx context.Context, p domain.Provider) error {
+	query := `INSERT INTO oidc_providers (` + providerColumns + `)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`
+	_, err := r.db.ExecContext(ctx, query, p.ID, p.DisplayName, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL,
+		pq.Array(p.Scopes), pq.Array(p.AllowedDomains), p.LinkByEmail, p.LinkByPhone, p.TrustEmail, p.JITEnabled,
+		pq.Array(p.DefaultRoles), p.MerchantID, p.PhoneClaim, p.Enabled, p.CreatedAt, p.UpdatedAt)
+	return providerError(err)
+}
+
+func (r *federationRepository) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	query := `SELECT ` + providerColumns + ` FROM oidc_providers WHERE id = $1`
+	p, err := scanProvider(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrProviderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *federationRepository) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+providerColumns+` FROM oidc_providers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []domain.Provider{}
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+func (r *federationRepository) UpdateProvider(ctx context.Context, p domain.Provider) error {
+	query := `UPDATE oidc_providers
+	          SET display_name = $2, issuer = $3, client_id = $4, client_secret = $5, redirect_url = $6, scopes = $7,
+	              allowed_domains = $8, link_by_email = $9, link_by_phone = $10, trust_email = $11, jit_enabled = $12,
+	              default_roles = $13, merchant_id = $14, phone_claim = $15, enabled = $16, updated_at = $17
+	          WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, p.ID, p.DisplayName, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL,
+		pq.Array(p.Scopes), pq.Array(p.AllowedDomains), p.LinkByEmail, p.LinkByPhone, p.TrustEmail, p.JITEnabled,
+		pq.Array(p.DefaultRoles), p.MerchantID, p.PhoneClaim, p.Enabled, p.UpdatedAt)
+	if err != nil {
+		return providerError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrProviderNotFound
+	}
+	return nil
+}
+
+// DeleteProvider удаляет провайдера вместе со связями внешних учётных записей; пользователи остаются
+func (r *federationRepository) DeleteProvider(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM oidc_providers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrProviderNotFound
+	}
+	query := `DELETE FROM user_identities WHERE provider = $1`
+	if _, err := tx.ExecContext(ctx, query, providerKey(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *federationRepository) MissingRoles(ctx context.Context, names []string) ([]string, error) {
+	var missing []string
+	query := `SELECT name FROM unnest($1::text[]) AS name
+	          WHERE NOT EXISTS (SELECT 1 FROM roles WHERE role_name = name)`
+	err := r.db.SelectContext(ctx, &missing, query, pq.Array(names))
+	return missing, err
+}
+
+func (r *federationRepository) SaveState(ctx context.Context, state domain.LoginState) error {
+	query := `INSERT INTO oidc_login_states (state_hash, provider_id, code_verifier, nonce, link_user_id, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, state.StateHash, state.ProviderID, state.CodeVerifier, state.Nonce,
+		state.LinkUserID, state.ExpiresAt)
+	return err
+}
+
+func (r *federationRepository) ConsumeState(ctx context.Context, stateHash string) (*domain.LoginState, error) {
+	state := domain.LoginState{StateHash: stateHash}
+	query := `DELETE FROM oidc_login_states WHERE state_hash = $1
+	          RETURNING provider_id, code_verifier, nonce, link_user_id, expires_at`
+	err := r.db.QueryRowContext(ctx, query, stateHash).
+		Scan(&state.ProviderID, &state.CodeVerifier, &state.Nonce, &state.LinkUserID, &state.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *federationRepository) DeleteExpiredStates(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < $1`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *federationRepository) FindIdentity(ctx context.Context, providerID, subject string) (*domain.Identity, error) {
+	identity := domain.Identity{ProviderID: providerID, Subject: subject}
+	query := `SELECT user_id, email, linked_at, last_login_at FROM user_identities WHERE provider = $1 AND subject = $2`
+	err := r.db.QueryRowContext(ctx, query, providerKey(providerID), subject).
+		Scan(&identity.UserID, &identity.Email, &identity.LinkedAt, &identity.LastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNoLocalAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *federationRepository) FindUserByEmail(ctx context.Context, email string) (uuid.UUID, error) {
+	return r.findUser(ctx, `SELECT id FROM "users" WHERE lower(email) = lower($1) LIMIT 2`, email)
+}
+
+func (r *federationRepository) FindUserByPhone(ctx context.Context, phone string) (uuid.UUID, error) {
+	return r.findUser(ctx, `SELECT id FROM "users" WHERE phone = $1 LIMIT 2`, phone)
+}
+
+func (r *federationRepository) findUser(ctx context.Context, query string, value string) (uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.SelectContext(ctx, &ids, query, value); err != nil {
+		return uuid.Nil, err
+	}
+	switch len(ids) {
+	case 0:
+		return uuid.Nil, domain.ErrNoLocalAccount
+	case 1:
+		return ids[0], nil
+	}
+	return uuid.Nil, domain.ErrAmbiguousAccount
+}
+
+func (r *federationRepository) LinkIdentity(ctx context.Context, identity domain.Identity) error {
+	return linkIdentity(ctx, r.db, identity)
+}
+
+func (r *federationRepository) TouchIdentity(ctx context.Context, providerID, subject, email string) error {
+	query := `UPDATE user_identities SET last_login_at = $3, email = $4 WHERE provider = $1 AND subject = $2`
+	_, err := r.db.ExecContext(ctx, query, providerKey(providerID), subject, time.Now().UTC(), email)
+	return err
+}
+
+// ProvisionUser заводит пользователя без входа по паролю: войти он может только через провайдера
+func (r *federationRepository) ProvisionUser(ctx context.Context, provider domain.Provider, claims domain.Claims, passwordHash string) (uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var merchantID string
+	if provider.MerchantID != nil {
+		merchantID = *provider.MerchantID
+		if err := checkMerchant(ctx, tx, merchantID); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	id := uuid.New()
+	now := time.Now().UTC()
+	query := `INSERT INTO "users" (id, phone, password_hash, rights, email, first_name, last_name, created_at)
+	         VALUES ($1, $2, $3, '{}', NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7)`
+	_, err = tx.ExecContext(ctx, query, id, claims.Phone, passwordHash, claims.Email, claims.GivenName, claims.FamilyName, now)
+	if err != nil {
+		return uuid.Nil, accountError(err)
+	}
+
+	registered := outboxDomain.UserRegisteredPayload{UserID: id.String(), Phone: claims.Phone, Email: claims.Email, Source: "oidc"}
+	if err := appendEvent(ctx, tx, outboxDomain.UserRegistered, id, registered); err != nil {
+		return uuid.Nil, err
+	}
+
+	if merchantID != "" {
+		query := `INSERT INTO users_contexts (user_id, merchant_id, global, granted_by) VALUES ($1, $2, FALSE, $3)`
+		if _, err := tx.ExecContext(ctx, query, id, merchantID, requestinfo.Actor(ctx)); err != nil {
+			return uuid.Nil, err
+		}
+		added := outboxDomain.ContextAddedPayload{UserID: id.String(), MerchantID: merchantID}
+		if err := appendEvent(ctx, tx, outboxDomain.ContextAdded, id, added); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	if err := assignRoles(ctx, tx, id, provider.DefaultRoles, provider.MerchantID); err != nil {
+		return uuid.Nil, err
+	}
+
+	identity := domain.Identity{ProviderID: provider.ID, Subject: claims.Subject, UserID: id, Email: claims.Email, LinkedAt: now}
+	if err := linkIdentity(ctx, tx, identity); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// assignRoles выдаёт роли по умолчанию; роль, удалённая после настройки провайдера, пропускается
+func assignRoles(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, names []string, merchantID *string) error {
+	for _, name := range names {
+		var roleID int
+		var rightsJSON []byte
+		err := tx.QueryRowContext(ctx, `SELECT role_id, rights FROM roles WHERE role_name = $1 FOR SHARE`, name).
+			Scan(&roleID, &rightsJSON)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `INSERT INTO users_roles (user_id, role_id, merchant_id, granted_at) VALUES ($1, $2, $3, now())
+		          ON CONFLICT (user_id, role_id, (COALESCE(merchant_id, ''))) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, userID, roleID, merchantID); err != nil {
+			return err
+		}
+
+		payload := outboxDomain.RoleChangedPayload{
+			RoleID:   roleID,
+			RoleName: name,
+			Change:   outboxDomain.RoleAssigned,
+			UserID:   userID.String(),
+			Modules:  rolesPostgres.RightsModules(rightsJSON),
+		}
+		if merchantID != nil {
+			payload.MerchantID = *merchantID
+		}
+		if err := rolesPostgres.AppendRoleEvent(ctx, tx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkIdentity(ctx context.Context, db sqlx.ExecerContext, identity domain.Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at, last_login_at)
+	          VALUES ($1, $2, $3, TRUE, $4, $5, $5)`
+	_, err := db.ExecContext(ctx, query, providerKey(identity.ProviderID), identity.Subject, identity.UserID,
+		identity.Email, identity.LinkedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.ErrAmbiguousAccount
+	}
+	return err
+}
+
+// providerKey — имя способа входа через провайдера в user_identities
+func providerKey(providerID string) string {
+	return identitiesDomain.ProviderKey(identitiesDomain.ProtocolOIDC, providerID)
+}
+
+// checkMerchant не даёт завести пользователя у приостановленного мерчанта
+func checkMerchant(ctx context.Context, tx *sqlx.Tx, merchantID string) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM merchants WHERE id = $1 FOR SHARE`, merchantID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return merchantsDomain.ErrMerchantNotFound
+	}
+	if err == nil && status != merchantsDomain.StatusActive {
+		return merchantsDomain.ErrMerchantSuspended
+	}
+	return err
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProvider(row scanner) (domain.Provider, error) {
+	var p domain.Provider
+	var scopes, domains, roles pq.StringArray
+	var merchantID sql.NullString
+	err := row.Scan(&p.ID, &p.DisplayName, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.RedirectURL, &scopes, &domains,
+		&p.LinkByEmail, &p.LinkByPhone, &p.TrustEmail, &p.JITEnabled, &roles, &merchantID, &p.PhoneClaim, &p.Enabled,
+		&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return domain.Provider{}, err
+	}
+	p.Scopes, p.AllowedDomains, p.DefaultRoles = scopes, domains, roles
+	if merchantID.Valid {
+		p.MerchantID = &merchantID.String
+	}
+	return p, nil
+}
+
+func providerError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return domain.ErrProviderExists
+		case "23503":
+			return merchantsDomain.ErrMerchantNotFound
+		}
+	}
+	return err
+}
+
+// accountError: телефон или email уже заняты другим пользователем
+func accountError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.ErrAccountExists
+	}
+	return err
+}
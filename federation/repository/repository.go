@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+)
+
+type FederationRepository interface {
+	CreateProvider(ctx context.Context, provider domain.Provider) error
+	GetProvider(ctx context.Context, id string) (*domain.Provider, error)
+	ListProviders(ctx context.Context) ([]domain.Provider, error)
+	UpdateProvider(ctx context.Context, provider domain.Provider) error
+	DeleteProvider(ctx context.Context, id string) error
+	// MissingRoles возвращает имена из names, для которых нет роли
+	MissingRoles(ctx context.Context, names []string) ([]string, error)
+
+	SaveState(ctx context.Context, state domain.LoginState) error
+	// ConsumeState забирает незавершённый вход: повторно тот же state не принимается
+	ConsumeState(ctx context.Context, stateHash string) (*domain.LoginState, error)
+	DeleteExpiredStates(ctx context.Context) (int64, error)
+
+	FindIdentity(ctx context.Context, providerID, subject string) (*domain.Identity, error)
+	// FindUserByEmail и FindUserByPhone ищут пользователя, которому можно привязать внешнюю учётную запись
+	FindUserByEmail(ctx context.Context, email string) (uuid.UUID, error)
+	FindUserByPhone(ctx context.Context, phone string) (uuid.UUID, error)
+	LinkIdentity(ctx context.Context, identity domain.Identity) error
+	TouchIdentity(ctx context.Context, providerID, subject, email string) error
+	// ProvisionUser заводит пользователя по внешней учётной записи вместе с контекстом мерчанта
+	// провайдера, ролями по умолчанию и самой связью
+	ProvisionUser(ctx context.Context, provider domain.Provider, claims domain.Claims, passwordHash string) (uuid.UUID, error)
+}
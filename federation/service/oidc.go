@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+)
+
+const (
+	// metadataTTL — сколько конфигурация и ключи провайдера живут в кеше
+	metadataTTL = time.Hour
+	// jwksRefreshInterval — не чаще этого JWKS перечитывается из-за незнакомого kid (смена ключей у провайдера)
+	jwksRefreshInterval = time.Minute
+	// clockSkew — допустимое расхождение часов с провайдером при проверке exp, iat и nbf
+	clockSkew = time.Minute
+	// maxResponseSize ограничивает ответы провайдера
+	maxResponseSize = 1 << 20
+)
+
+// OIDCClient обращается к провайдеру OpenID Connect
+type OIDCClient interface {
+	Discover(ctx context.Context, issuer string) (*domain.Discovery, error)
+	// Exchange меняет код авторизации на токены и возвращает id_token
+	Exchange(ctx context.Context, discovery *domain.Discovery, provider domain.Provider, code, codeVerifier string) (string, error)
+	// VerifyIDToken проверяет подпись id_token ключом из JWKS провайдера, iss, aud, срок и nonce
+	VerifyIDToken(ctx context.Context, discovery *domain.Discovery, provider domain.Provider, rawIDToken, nonce string) (map[string]interface{}, error)
+}
+
+type cachedDiscovery struct {
+	discovery *domain.Discovery
+	fetchedAt time.Time
+}
+
+type cachedKeys struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type httpOIDCClient struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery map[string]cachedDiscovery
+	keys      map[string]cachedKeys
+}
+
+func NewHTTPOIDCClient(timeout time.Duration) OIDCClient {
+	return &httpOIDCClient{
+		client:    &http.Client{Timeout: timeout},
+		discovery: make(map[string]cachedDiscovery),
+		keys:      make(map[string]cachedKeys),
+	}
+}
+
+func (c *httpOIDCClient) Discover(ctx context.Context, issuer string) (*domain.Discovery, error) {
+	c.mu.Lock()
+	cached, ok := c.discovery[issuer]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < metadataTTL {
+		return cached.discovery, nil
+	}
+
+	var discovery domain.Discovery
+	if err := c.getJSON(ctx, issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("identity provider discovery failed: %w", err)
+	}
+	if err := discovery.Validate(issuer); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.discovery[issuer] = cachedDiscovery{discovery: &discovery, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return &discovery, nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *httpOIDCClient) Exchange(ctx context.Context, discovery *domain.Discovery, provider domain.Provider, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	basic := provider.ClientSecret != "" && discovery.BasicClientAuth()
+	if !basic {
+		form.Set("client_id", provider.ClientID)
+		if provider.ClientSecret != "" {
+			form.Set("client_secret", provider.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		// RFC 6749, 2.3.1: идентификатор и секрет кодируются form-urlencoded до Basic
+		req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("identity provider rejected the code: %s %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("identity provider did not return an id_token")
+	}
+	return token.IDToken, nil
+}
+
+func (c *httpOIDCClient) VerifyIDToken(ctx context.Context, discovery *domain.Discovery, provider domain.Provider, rawIDToken, nonce string) (map[string]interface{}, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(domain.SigningAlgorithms), jwt.WithoutClaimsValidation())
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.signingKey(ctx, discovery.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidIDToken, err)
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(discovery.Issuer, true):
+		return nil, fmt.Errorf("%w: unexpected issuer", domain.ErrInvalidIDToken)
+	case !claims.VerifyAudience(provider.ClientID, true):
+		return nil, fmt.Errorf("%w: token is issued for another client", domain.ErrInvalidIDToken)
+	case !authorizedParty(claims, provider.ClientID):
+		return nil, fmt.Errorf("%w: token is issued for another client", domain.ErrInvalidIDToken)
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: token is expired", domain.ErrInvalidIDToken)
+	case !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false), !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false):
+		return nil, fmt.Errorf("%w: token is not valid yet", domain.ErrInvalidIDToken)
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", domain.ErrInvalidIDToken)
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, fmt.Errorf("%w: subject is missing", domain.ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// authorizedParty: при нескольких получателях токен должен быть выдан именно этому клиенту (azp)
+func authorizedParty(claims jwt.MapClaims, clientID string) bool {
+	audiences, ok := claims["aud"].([]interface{})
+	azp, hasAzp := claims["azp"].(string)
+	if hasAzp {
+		return azp == clientID
+	}
+	return !ok || len(audiences) <= 1
+}
+
+// signingKey ищет ключ по kid; незнакомый kid означает смену ключей у провайдера, и JWKS перечитывается
+func (c *httpOIDCClient) signingKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	c.mu.Lock()
+	cached, ok := c.keys[jwksURI]
+	c.mu.Unlock()
+
+	if !ok || time.Since(cached.fetchedAt) > metadataTTL {
+		if err := c.refreshKeys(ctx, jwksURI); err != nil {
+			return nil, err
+		}
+	} else if findKey(cached.keys, kid) == nil && time.Since(cached.fetchedAt) > jwksRefreshInterval {
+		if err := c.refreshKeys(ctx, jwksURI); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	key := findKey(c.keys[jwksURI].keys, kid)
+	c.mu.Unlock()
+	if key == nil {
+		return nil, fmt.Errorf("signing key %q not found", kid)
+	}
+	return key, nil
+}
+
+func (c *httpOIDCClient) refreshKeys(ctx context.Context, jwksURI string) error {
+	var jwks domain.JWKS
+	if err := c.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return fmt.Errorf("jwks request failed: %w", err)
+	}
+	c.mu.Lock()
+	c.keys[jwksURI] = cachedKeys{keys: jwks.PublicKeys(), fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+// findKey: без kid подходит только единственный ключ набора
+func findKey(keys map[string]interface{}, kid string) interface{} {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return keys[kid]
+}
+
+func (c *httpOIDCClient) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
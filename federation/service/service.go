@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+	"github.com/rafaceo/go-test-auth/federation/repository"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+	securityService "github.com/rafaceo/go-test-auth/security/service"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPhoneLength — ограничение столбца телефона в профиле пользователя
+const maxPhoneLength = 16
+
+type FederationService interface {
+	CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error)
+	GetProvider(ctx context.Context, id string) (*domain.Provider, error)
+	ListProviders(ctx context.Context) ([]domain.Provider, error)
+	// UpdateProvider заменяет настройки провайдера; пустой client_secret оставляет прежний
+	UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error)
+	DeleteProvider(ctx context.Context, id string) error
+
+	// StartLogin начинает вход через провайдера и возвращает адрес его страницы входа
+	StartLogin(ctx context.Context, providerID string) (string, error)
+	// StartLink начинает вход, который привяжет учётную запись провайдера к пользователю userID
+	StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error)
+	// CompleteLogin завершает вход по ответу провайдера и выпускает токены сервиса
+	CompleteLogin(ctx context.Context, callback domain.Callback) (*domain.LoginResult, error)
+}
+
+// SessionIssuer выпускает access_token и refresh_token пользователю, личность которого подтвердил провайдер
+type SessionIssuer interface {
+	IssueSession(ctx context.Context, userID uuid.UUID) (string, string, error)
+}
+
+// SensitiveGuard не даёт назначить роли с правами чувствительных модулей в обход заявок на доступ
+type SensitiveGuard interface {
+	CheckRoleGrant(ctx context.Context, roleNames []string) error
+}
+
+type federationService struct {
+	repo     repository.FederationRepository
+	oidc     OIDCClient
+	sessions SessionIssuer
+	security securityService.SecurityEventService
+	guard    SensitiveGuard
+}
+
+func NewFederationService(repo repository.FederationRepository, oidc OIDCClient, sessions SessionIssuer, security securityService.SecurityEventService, guard SensitiveGuard) FederationService {
+	return &federationService{repo: repo, oidc: oidc, sessions: sessions, security: security, guard: guard}
+}
+
+func (s *federationService) CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error) {
+	provider.Normalize()
+	if err := s.validate(ctx, provider); err != nil {
+		return nil, err
+	}
+	provider.CreatedAt = time.Now().UTC()
+	provider.UpdatedAt = provider.CreatedAt
+	if err := s.repo.CreateProvider(ctx, provider); err != nil {
+		return nil, err
+	}
+	redacted := provider.Redacted()
+	return &redacted, nil
+}
+
+func (s *federationService) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	provider, err := s.repo.GetProvider(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	redacted := provider.Redacted()
+	return &redacted, nil
+}
+
+func (s *federationService) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	providers, err := s.repo.ListProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range providers {
+		providers[i] = providers[i].Redacted()
+	}
+	return providers, nil
+}
+
+func (s *federationService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error) {
+	current, err := s.repo.GetProvider(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.ID = current.ID
+	if provider.ClientSecret == "" {
+		provider.ClientSecret = current.ClientSecret
+	}
+	provider.Normalize()
+	if err := s.validate(ctx, provider); err != nil {
+		return nil, err
+	}
+	provider.CreatedAt = current.CreatedAt
+	provider.UpdatedAt = time.Now().UTC()
+	if err := s.repo.UpdateProvider(ctx, provider); err != nil {
+		return nil, err
+	}
+	redacted := provider.Redacted()
+	return &redacted, nil
+}
+
+func (s *federationService) DeleteProvider(ctx context.Context, id string) error {
+	return s.repo.DeleteProvider(ctx, id)
+}
+
+func (s *federationService) validate(ctx context.Context, provider domain.Provider) error {
+	if err := provider.Validate(); err != nil {
+		return err
+	}
+	if len(provider.DefaultRoles) == 0 {
+		return nil
+	}
+	missing, err := s.repo.MissingRoles(ctx, provider.DefaultRoles)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("unknown role %q in default_roles", missing[0])
+	}
+	return nil
+}
+
+// StartLogin сохраняет state, nonce и code_verifier до возврата пользователя от провайдера.
+// Провайдеру уходит только S256-хеш code_verifier.
+func (s *federationService) StartLogin(ctx context.Context, providerID string) (string, error) {
+	return s.start(ctx, providerID, nil)
+}
+
+func (s *federationService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error) {
+	return s.start(ctx, providerID, &userID)
+}
+
+func (s *federationService) start(ctx context.Context, providerID string, linkUserID *uuid.UUID) (string, error) {
+	provider, err := s.repo.GetProvider(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	if !provider.Enabled {
+		return "", domain.ErrProviderDisabled
+	}
+	discovery, err := s.oidc.Discover(ctx, provider.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	// Просроченные входы подчищаются при каждом новом, отдельная фоновая задача не нужна
+	_, _ = s.repo.DeleteExpiredStates(ctx)
+
+	state, err := domain.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := domain.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := domain.RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.SaveState(ctx, domain.LoginState{
+		StateHash:    domain.HashState(state),
+		ProviderID:   provider.ID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().UTC().Add(domain.StateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return discovery.AuthorizationURL(*provider, state, nonce, verifier), nil
+}
+
+func (s *federationService) CompleteLogin(ctx context.Context, callback domain.Callback) (*domain.LoginResult, error) {
+	if callback.State == "" {
+		return nil, domain.ErrInvalidState
+	}
+	state, err := s.repo.ConsumeState(ctx, domain.HashState(callback.State))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().UTC().After(state.ExpiresAt) {
+		return nil, domain.ErrInvalidState
+	}
+
+	provider, err := s.repo.GetProvider(ctx, state.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if !provider.Enabled {
+		return nil, domain.ErrProviderDisabled
+	}
+	if callback.Error != "" {
+		err := fmt.Errorf("identity provider returned error: %s %s", callback.Error, callback.ErrorDescription)
+		return nil, s.fail(ctx, provider.ID, "", "", "provider_error", err)
+	}
+	if callback.Code == "" {
+		return nil, domain.ErrInvalidState
+	}
+
+	discovery, err := s.oidc.Discover(ctx, provider.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, err := s.oidc.Exchange(ctx, discovery, *provider, callback.Code, state.CodeVerifier)
+	if err != nil {
+		return nil, s.fail(ctx, provider.ID, "", "", "code_exchange_failed", err)
+	}
+	rawClaims, err := s.oidc.VerifyIDToken(ctx, discovery, *provider, rawIDToken, state.Nonce)
+	if err != nil {
+		return nil, s.fail(ctx, provider.ID, "", "", "invalid_id_token", err)
+	}
+
+	claims := domain.ClaimsFrom(rawClaims, provider.PhoneClaim, provider.TrustEmail)
+	if len(provider.AllowedDomains) > 0 && (!claims.EmailVerified || !provider.EmailAllowed(claims.Email)) {
+		return nil, s.fail(ctx, provider.ID, claims.Subject, "", "domain_not_allowed", domain.ErrDomainNotAllowed)
+	}
+
+	result := &domain.LoginResult{Provider: provider.ID}
+	if state.LinkUserID != nil {
+		result.UserID, result.LinkRequested = *state.LinkUserID, true
+		result.Linked, err = s.link(ctx, *provider, claims, result.UserID)
+		if err != nil {
+			return nil, s.fail(ctx, provider.ID, claims.Subject, result.UserID.String(), "link_failed", err)
+		}
+	} else {
+		ctx = requestinfo.WithVerifiedActor(ctx, "oidc:"+provider.ID)
+		result.UserID, result.Linked, result.Provisioned, err = s.resolveUser(ctx, *provider, claims)
+		if err != nil {
+			return nil, s.fail(ctx, provider.ID, claims.Subject, "", "no_local_account", err)
+		}
+	}
+
+	result.AccessToken, result.RefreshToken, err = s.sessions.IssueSession(ctx, result.UserID)
+	if err != nil {
+		return nil, s.fail(ctx, provider.ID, claims.Subject, result.UserID.String(), "session_failed", err)
+	}
+	return result, nil
+}
+
+// resolveUser находит пользователя внешней учётной записи: по уже существующей связи, затем по
+// подтверждённым email и телефону, если провайдеру это разрешено, и наконец заводит нового (JIT)
+func (s *federationService) resolveUser(ctx context.Context, provider domain.Provider, claims domain.Claims) (uuid.UUID, bool, bool, error) {
+	if !claims.EmailVerified {
+		claims.Email = ""
+	}
+
+	identity, err := s.repo.FindIdentity(ctx, provider.ID, claims.Subject)
+	if err == nil {
+		_ = s.repo.TouchIdentity(ctx, provider.ID, claims.Subject, claims.Email)
+		return identity.UserID, false, false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return uuid.Nil, false, false, err
+	}
+
+	userID, err := s.findLinkable(ctx, provider, claims)
+	if err == nil {
+		err = s.repo.LinkIdentity(ctx, domain.Identity{
+			ProviderID: provider.ID,
+			Subject:    claims.Subject,
+			UserID:     userID,
+			Email:      claims.Email,
+			LinkedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return uuid.Nil, false, false, err
+		}
+		return userID, true, false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return uuid.Nil, false, false, err
+	}
+
+	if !provider.JITEnabled {
+		return uuid.Nil, false, false, domain.ErrNoLocalAccount
+	}
+	userID, err = s.provision(ctx, provider, claims)
+	if err != nil {
+		return uuid.Nil, false, false, err
+	}
+	return userID, true, true, nil
+}
+
+// link привязывает внешнюю учётную запись к пользователю, начавшему вход. Учётная запись,
+// уже привязанная к другому пользователю, не перепривязывается: для этого есть слияние пользователей.
+func (s *federationService) link(ctx context.Context, provider domain.Provider, claims domain.Claims, userID uuid.UUID) (bool, error) {
+	if !claims.EmailVerified {
+		claims.Email = ""
+	}
+
+	identity, err := s.repo.FindIdentity(ctx, provider.ID, claims.Subject)
+	if err == nil {
+		if identity.UserID != userID {
+			return false, identitiesDomain.ErrIdentityTaken
+		}
+		_ = s.repo.TouchIdentity(ctx, provider.ID, claims.Subject, claims.Email)
+		return false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return false, err
+	}
+
+	err = s.repo.LinkIdentity(ctx, domain.Identity{
+		ProviderID: provider.ID,
+		Subject:    claims.Subject,
+		UserID:     userID,
+		Email:      claims.Email,
+		LinkedAt:   time.Now().UTC(),
+	})
+	if errors.Is(err, domain.ErrAmbiguousAccount) {
+		return false, identitiesDomain.ErrIdentityTaken
+	}
+	return err == nil, err
+}
+
+func (s *federationService) findLinkable(ctx context.Context, provider domain.Provider, claims domain.Claims) (uuid.UUID, error) {
+	if provider.LinkByEmail && claims.Email != "" {
+		userID, err := s.repo.FindUserByEmail(ctx, claims.Email)
+		if !errors.Is(err, domain.ErrNoLocalAccount) {
+			return userID, err
+		}
+	}
+	if provider.LinkByPhone && claims.Phone != "" && claims.PhoneVerified {
+		return s.repo.FindUserByPhone(ctx, claims.Phone)
+	}
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+// provision заводит пользователя. Телефон обязателен для любого пользователя сервиса, поэтому
+// провайдер должен передать подтверждённый номер. Вход по телефону у такого пользователя не заводится:
+// его можно добавить позже, задав пароль.
+func (s *federationService) provision(ctx context.Context, provider domain.Provider, claims domain.Claims) (uuid.UUID, error) {
+	if claims.Phone == "" || !claims.PhoneVerified {
+		return uuid.Nil, domain.ErrPhoneRequired
+	}
+	if err := userDomain.ValidatePhone(claims.Phone); err != nil || len(claims.Phone) > maxPhoneLength {
+		return uuid.Nil, domain.ErrPhoneRequired
+	}
+	if claims.Email != "" && userDomain.ValidateEmail(claims.Email) != nil {
+		claims.Email = ""
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return uuid.Nil, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(password)), bcrypt.DefaultCost)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	// роли по умолчанию могли получить чувствительные модули уже после настройки провайдера
+	if err := s.guard.CheckRoleGrant(ctx, provider.DefaultRoles); err != nil {
+		return uuid.Nil, err
+	}
+	return s.repo.ProvisionUser(ctx, provider, claims, string(hashed))
+}
+
+// fail записывает неудачный вход через провайдера в журнал событий безопасности
+func (s *federationService) fail(ctx context.Context, providerID, subject, userID, reason string, err error) error {
+	_ = s.security.Record(ctx, securityDomain.Event{
+		Type:    securityDomain.EventLoginFailed,
+		Subject: subject,
+		UserID:  userID,
+		Details: map[string]interface{}{"reason": reason, "provider": providerID, "error": err.Error()},
+	})
+	return err
+}
@@ -0,0 +1,282 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/federation/domain"
+	"github.com/rafaceo/go-test-auth/federation/service"
+	"github.com/rafaceo/go-test-auth/federation/transport"
+	"mime"
+	"net/http"
+)
+
+// GetFederationHandlers: изменения провайдеров попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetFederationHandlers(serv service.FederationService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	authenticated := authn.Middleware(tokens)
+
+	createHandler := kithttp.NewServer(
+		authenticated(MakeCreateProviderEndpoint(serv)),
+		DecodeProviderRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listHandler := kithttp.NewServer(
+		MakeListProvidersEndpoint(serv),
+		DecodeListProvidersRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetProviderEndpoint(serv),
+		DecodeProviderIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	updateHandler := kithttp.NewServer(
+		authenticated(MakeUpdateProviderEndpoint(serv)),
+		DecodeProviderRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteHandler := kithttp.NewServer(
+		authenticated(MakeDeleteProviderEndpoint(serv)),
+		DecodeProviderIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	startLoginHandler := kithttp.NewServer(
+		MakeStartLoginEndpoint(serv),
+		DecodeStartLoginRequest,
+		EncodeStartLoginResponse,
+		opts...,
+	)
+
+	callbackHandler := kithttp.NewServer(
+		MakeCallbackEndpoint(serv),
+		DecodeCallbackRequest,
+		EncodeLoginResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/auth/oidc/providers",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/providers",
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/providers/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/providers/{id}",
+			Handler: updateHandler,
+			Methods: []string{"PUT"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/providers/{id}",
+			Handler: deleteHandler,
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/login/{provider}",
+			Handler: startLoginHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/auth/oidc/callback",
+			Handler: callbackHandler,
+			Methods: []string{"GET", "POST"},
+		},
+	}
+}
+
+func MakeCreateProviderEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderRequest)
+		provider, err := svc.CreateProvider(ctx, req.Provider)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeListProvidersEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		providers, err := svc.ListProviders(ctx)
+		if err != nil {
+			return transport.ListProvidersResponse{Error: err.Error()}, nil
+		}
+		return transport.ListProvidersResponse{Providers: providers}, nil
+	}
+}
+
+func MakeGetProviderEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderIDRequest)
+		provider, err := svc.GetProvider(ctx, req.ID)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeUpdateProviderEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderRequest)
+		provider, err := svc.UpdateProvider(ctx, req.ID, req.Provider)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeDeleteProviderEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderIDRequest)
+		if err := svc.DeleteProvider(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Провайдер удалён"}, nil
+	}
+}
+
+func MakeStartLoginEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.StartLoginRequest)
+		authorizationURL, err := svc.StartLogin(ctx, req.ProviderID)
+		if err != nil {
+			return transport.StartLoginResponse{Error: err.Error()}, nil
+		}
+		return transport.StartLoginResponse{AuthorizationURL: authorizationURL, Redirect: req.Redirect}, nil
+	}
+}
+
+func MakeCallbackEndpoint(svc service.FederationService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CallbackRequest)
+		result, err := svc.CompleteLogin(ctx, domain.Callback{
+			State:            req.State,
+			Code:             req.Code,
+			Error:            req.Error,
+			ErrorDescription: req.ErrorDescription,
+		})
+		if err != nil {
+			return transport.LoginResponse{Error: err.Error()}, nil
+		}
+		return transport.LoginResponse{LoginResult: result}, nil
+	}
+}
+
+// DecodeProviderRequest читает настройки провайдера; id при изменении берётся из пути
+func DecodeProviderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.ProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req.Provider); err != nil {
+		return nil, err
+	}
+	req.ID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func DecodeListProvidersRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return transport.ListProvidersRequest{}, nil
+}
+
+func DecodeProviderIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.ProviderIDRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func DecodeStartLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.StartLoginRequest{
+		ProviderID: mux.Vars(r)["provider"],
+		Redirect:   r.URL.Query().Get("redirect") != "false",
+	}, nil
+}
+
+// DecodeCallbackRequest принимает ответ провайдера из query (GET), формы (response_mode=form_post) или JSON
+func DecodeCallbackRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.CallbackRequest
+	if r.Method == http.MethodPost {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				return nil, err
+			}
+			return req, nil
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	req.State = r.Form.Get("state")
+	req.Code = r.Form.Get("code")
+	req.Error = r.Form.Get("error")
+	req.ErrorDescription = r.Form.Get("error_description")
+	return req, nil
+}
+
+// EncodeStartLoginResponse перенаправляет браузер на страницу входа провайдера
+func EncodeStartLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.StartLoginResponse)
+	if resp.Error != "" {
+		return encodeJSON(w, http.StatusBadRequest, resp)
+	}
+	if !resp.Redirect {
+		return EncodeResponse(ctx, w, resp)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", resp.AuthorizationURL)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// EncodeLoginResponse: неудачный вход — 401, как и вход по паролю
+func EncodeLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.LoginResponse)
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Error != "" {
+		return encodeJSON(w, http.StatusUnauthorized, resp)
+	}
+	return EncodeResponse(ctx, w, resp)
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	return encodeJSON(w, http.StatusOK, response)
+}
+
+func encodeJSON(w http.ResponseWriter, status int, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
@@ -0,0 +1,28 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/federation/domain"
+
+type ProviderRequest struct {
+	ID       string `json:"-"`
+	Provider domain.Provider
+}
+
+type ProviderIDRequest struct {
+	ID string `json:"-"`
+}
+
+type ListProvidersRequest struct{}
+
+// StartLoginRequest — Redirect = false возвращает адрес страницы входа в JSON вместо перенаправления
+type StartLoginRequest struct {
+	ProviderID string
+	Redirect   bool
+}
+
+// CallbackRequest — ответ провайдера: query при GET, форма (response_mode=form_post) или JSON при POST
+type CallbackRequest struct {
+	State            string `json:"state"`
+	Code             string `json:"code"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
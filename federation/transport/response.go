@@ -0,0 +1,29 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/federation/domain"
+
+type ProviderResponse struct {
+	Provider *domain.Provider `json:"provider,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type ListProvidersResponse struct {
+	Providers []domain.Provider `json:"providers"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type StartLoginResponse struct {
+	AuthorizationURL string `json:"authorization_url,omitempty"`
+	Redirect         bool   `json:"-"`
+	Error            string `json:"error,omitempty"`
+}
+
+type LoginResponse struct {
+	*domain.LoginResult
+	Error string `json:"error,omitempty"`
+}
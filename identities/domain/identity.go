@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProviderPhone — вход по телефону и паролю; subject такого способа входа — телефон пользователя
+const ProviderPhone = "phone"
+
+// Протоколы внешних провайдеров: способ входа называется "<протокол>:<id провайдера>"
+const (
+	ProtocolOIDC = "oidc"
+	ProtocolSAML = "saml"
+)
+
+// minPasswordLength — минимальная длина пароля при добавлении входа по телефону
+const minPasswordLength = 8
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityExists   = errors.New("this login method is already linked")
+	ErrSubjectRequired  = errors.New("several accounts of this provider are linked, specify subject")
+	ErrIdentityTaken    = errors.New("this external account is already linked to another user")
+	ErrLastLoginMethod  = errors.New("cannot unlink the last login method")
+	ErrUnknownProtocol  = errors.New("protocol must be oidc or saml")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrSameUser         = errors.New("source and target users must differ")
+	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+)
+
+// Identity — способ входа пользователя
+type Identity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Verified    bool       `json:"verified"`
+	Email       string     `json:"email,omitempty"`
+	LinkedAt    time.Time  `json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// ProviderKey — имя способа входа для учётной записи внешнего провайдера
+func ProviderKey(protocol, providerID string) string {
+	return protocol + ":" + providerID
+}
+
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// MergeResult — что перенесено при слиянии пользователя Source в Target. Source после слияния удаляется.
+type MergeResult struct {
+	SourceUserID uuid.UUID `json:"source_user_id"`
+	TargetUserID uuid.UUID `json:"target_user_id"`
+	Identities   int       `json:"identities"`
+	Contexts     int       `json:"contexts"`
+	Roles        int       `json:"roles"`
+	Rights       int       `json:"rights"`
+	// SessionMoved — refresh-токен источника перенесён; иначе его сессия завершена
+	SessionMoved bool `json:"session_moved"`
+}
@@ -0,0 +1,31 @@
+package identities
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/middleware"
+	"github.com/rafaceo/go-test-auth/identities/repository/postgres"
+	"github.com/rafaceo/go-test-auth/identities/service"
+)
+
+type ServiceFactory struct{}
+
+// CreateIdentityService — способы входа пользователя и слияние пользователей; oidc и saml начинают вход
+// через внешнего провайдера для привязки учётной записи
+func (sf *ServiceFactory) CreateIdentityService(logger log.Logger, postgresClient *sqlx.DB, tokens service.TokenVerifier, oidc, saml service.LinkStarter) service.IdentityService {
+	linkers := map[string]service.LinkStarter{
+		domain.ProtocolOIDC: oidc,
+		domain.ProtocolSAML: saml,
+	}
+	identityServ := service.NewIdentityService(postgres.NewIdentityRepository(postgresClient), linkers, tokens)
+	identityServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), identityServ)
+	identityServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "identities"), identityServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("identity_service")
+	identityServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, identityServ)
+
+	return identityServ
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/service"
+)
+
+// auditingService записывает в журнал аудита привязку и отвязку способов входа и слияние пользователей.
+// Привязка через внешнего провайдера записывается при завершении входа сервисом провайдера.
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.IdentityService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.IdentityService) service.IdentityService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, targetType, targetID, before, after))
+}
+
+// selfService: изменение совершает сам пользователь, access_token которого проверил сервис
+func selfService(ctx context.Context, userID uuid.UUID) context.Context {
+	if requestinfo.VerifiedActor(ctx) != "" {
+		return ctx
+	}
+	return requestinfo.WithVerifiedActor(ctx, userID.String())
+}
+
+func (a *auditingService) ListIdentities(ctx context.Context, accessToken string) ([]domain.Identity, error) {
+	return a.next.ListIdentities(ctx, accessToken)
+}
+
+func (a *auditingService) AddPhone(ctx context.Context, accessToken, password string) (*domain.Identity, error) {
+	identity, err := a.next.AddPhone(ctx, accessToken, password)
+	if err != nil {
+		return nil, err
+	}
+	ctx = selfService(ctx, identity.UserID)
+	a.record(ctx, "user_identity.link", auditDomain.TargetUser, identity.UserID.String(), nil, identity)
+	return identity, nil
+}
+
+func (a *auditingService) StartLink(ctx context.Context, accessToken, protocol, providerID string) (string, error) {
+	return a.next.StartLink(ctx, accessToken, protocol, providerID)
+}
+
+func (a *auditingService) Unlink(ctx context.Context, accessToken, provider, subject string) (*domain.Identity, error) {
+	identity, err := a.next.Unlink(ctx, accessToken, provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	ctx = selfService(ctx, identity.UserID)
+	a.record(ctx, "user_identity.unlink", auditDomain.TargetUser, identity.UserID.String(), identity, nil)
+	return identity, nil
+}
+
+func (a *auditingService) Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (*domain.MergeResult, error) {
+	result, err := a.next.Merge(ctx, sourceUserID, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "user.merge", auditDomain.TargetUser, targetUserID.String(), map[string]string{"merged_user_id": sourceUserID.String()}, result)
+	return result, nil
+}
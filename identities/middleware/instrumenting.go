@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/service"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.IdentityService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.IdentityService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) ListIdentities(ctx context.Context, accessToken string) (identities []domain.Identity, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListIdentities"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListIdentities(ctx, accessToken)
+}
+
+func (s *instrumentingService) AddPhone(ctx context.Context, accessToken, password string) (identity *domain.Identity, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "AddPhone"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.AddPhone(ctx, accessToken, password)
+}
+
+func (s *instrumentingService) StartLink(ctx context.Context, accessToken, protocol, providerID string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "StartLink"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.StartLink(ctx, accessToken, protocol, providerID)
+}
+
+func (s *instrumentingService) Unlink(ctx context.Context, accessToken, provider, subject string) (identity *domain.Identity, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Unlink"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Unlink(ctx, accessToken, provider, subject)
+}
+
+func (s *instrumentingService) Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (result *domain.MergeResult, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Merge"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Merge(ctx, sourceUserID, targetUserID)
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/service"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.IdentityService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.IdentityService) service.IdentityService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) ListIdentities(ctx context.Context, accessToken string) (identities []domain.Identity, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListIdentities",
+			"took", time.Since(begin),
+			"count", len(identities),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListIdentities(ctx, accessToken)
+}
+
+func (l loggingService) AddPhone(ctx context.Context, accessToken, password string) (identity *domain.Identity, err error) {
+	defer func(begin time.Time) {
+		var userID string
+		if identity != nil {
+			userID = identity.UserID.String()
+		}
+		_ = l.logger.Log(
+			"method", "AddPhone",
+			"took", time.Since(begin),
+			"user_id", userID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.AddPhone(ctx, accessToken, password)
+}
+
+func (l loggingService) StartLink(ctx context.Context, accessToken, protocol, providerID string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "StartLink",
+			"took", time.Since(begin),
+			"protocol", protocol,
+			"provider", providerID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.StartLink(ctx, accessToken, protocol, providerID)
+}
+
+func (l loggingService) Unlink(ctx context.Context, accessToken, provider, subject string) (identity *domain.Identity, err error) {
+	defer func(begin time.Time) {
+		var userID string
+		if identity != nil {
+			userID = identity.UserID.String()
+		}
+		_ = l.logger.Log(
+			"method", "Unlink",
+			"took", time.Since(begin),
+			"user_id", userID,
+			"provider", provider,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Unlink(ctx, accessToken, provider, subject)
+}
+
+func (l loggingService) Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (result *domain.MergeResult, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Merge",
+			"took", time.Since(begin),
+			"source_user_id", sourceUserID,
+			"target_user_id", targetUserID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Merge(ctx, sourceUserID, targetUserID)
+}
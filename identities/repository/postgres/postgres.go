@@ -0,0 +1,394 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/repository"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+)
+
+const identityColumns = `provider, subject, user_id, verified, email, linked_at, last_login_at`
+
+type identityRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdentityRepository(db *sqlx.DB) repository.IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) ListIdentities(ctx context.Context, userID uuid.UUID) ([]domain.Identity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY linked_at, provider`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []domain.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *identityRepository) AddPhone(ctx context.Context, userID uuid.UUID, passwordHash string) (*domain.Identity, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var phone string
+	var email sql.NullString
+	query := `UPDATE "users" SET password_hash = $2, updated_at = now() WHERE id = $1 RETURNING phone, email`
+	err = tx.QueryRowContext(ctx, query, userID, passwordHash).Scan(&phone, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO user_identities (provider, subject, user_id, verified, email) VALUES ($1, $2, $3, FALSE, $4)
+	         RETURNING ` + identityColumns
+	identity, err := scanIdentity(tx.QueryRowContext(ctx, query, domain.ProviderPhone, phone, userID, email.String))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, domain.ErrIdentityExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) Unlink(ctx context.Context, userID uuid.UUID, provider, subject string) (*domain.Identity, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка пользователя не даёт двум одновременным запросам отвязать два последних способа входа
+	if err := lockUsers(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 AND provider = $2`
+	args := []interface{}{userID, provider}
+	if subject != "" {
+		query += ` AND subject = $3`
+		args = append(args, subject)
+	}
+	rows, err := tx.QueryContext(ctx, query+` LIMIT 2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var found []domain.Identity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, identity)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, domain.ErrIdentityNotFound
+	case 2:
+		return nil, domain.ErrSubjectRequired
+	}
+	identity := found[0]
+
+	var total int
+	if err := tx.GetContext(ctx, &total, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if total <= 1 {
+		return nil, domain.ErrLastLoginMethod
+	}
+
+	query = `DELETE FROM user_identities WHERE provider = $1 AND subject = $2`
+	if _, err := tx.ExecContext(ctx, query, identity.Provider, identity.Subject); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// Merge выполняется в одной транзакции: после неё source не остаётся ни в одной таблице.
+// Вход по телефону source не переносится — у target свой телефон. Связи SCIM удаляются вместе с source:
+// каталог мерчанта заново сопоставит учётную запись при следующей синхронизации.
+func (r *identityRepository) Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (*domain.MergeResult, error) {
+	if sourceUserID == targetUserID {
+		return nil, domain.ErrSameUser
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockUsers(ctx, tx, sourceUserID, targetUserID); err != nil {
+		return nil, err
+	}
+	result := &domain.MergeResult{SourceUserID: sourceUserID, TargetUserID: targetUserID}
+
+	query := `UPDATE user_identities SET user_id = $2 WHERE user_id = $1 AND provider <> $3`
+	res, err := tx.ExecContext(ctx, query, sourceUserID, targetUserID, domain.ProviderPhone)
+	if err != nil {
+		return nil, err
+	}
+	moved, _ := res.RowsAffected()
+	result.Identities = int(moved)
+
+	if result.SessionMoved, err = mergeSession(ctx, tx, sourceUserID, targetUserID); err != nil {
+		return nil, err
+	}
+	if err := mergeAccess(ctx, tx, sourceUserID, targetUserID, result); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE access_requests SET user_id = $2 WHERE user_id = $1`, sourceUserID, targetUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM saml_role_grants WHERE user_id = $1`, sourceUserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "users" WHERE id = $1`, sourceUserID); err != nil {
+		return nil, err
+	}
+
+	merged := outboxDomain.UsersMergedPayload{UserID: targetUserID.String(), MergedUserID: sourceUserID.String()}
+	if err := appendEvent(ctx, tx, outboxDomain.UsersMerged, targetUserID, merged); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeSession переносит сессию source, если у target её нет; иначе сессия source завершается.
+// Хеши отозванных refresh-токенов source переходят к target, чтобы их повторное предъявление
+// по-прежнему распознавалось.
+func mergeSession(ctx context.Context, tx *sqlx.Tx, sourceUserID, targetUserID uuid.UUID) (bool, error) {
+	var sourceToken, targetToken sql.NullString
+	query := `SELECT
+	              (SELECT refresh_token FROM "users" WHERE id = $1),
+	              (SELECT refresh_token FROM "users" WHERE id = $2)`
+	if err := tx.QueryRowContext(ctx, query, sourceUserID, targetUserID).Scan(&sourceToken, &targetToken); err != nil {
+		return false, err
+	}
+
+	query = `UPDATE revoked_refresh_tokens SET user_id = $2 WHERE user_id = $1`
+	if _, err := tx.ExecContext(ctx, query, sourceUserID.String(), targetUserID.String()); err != nil {
+		return false, err
+	}
+
+	if sourceToken.String == "" {
+		return false, nil
+	}
+	if targetToken.String == "" {
+		query := `UPDATE "users" SET refresh_token = $2 WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, targetUserID, sourceToken.String); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	revoked := outboxDomain.SessionRevokedPayload{UserID: sourceUserID.String(), Reason: "merged"}
+	return false, appendEvent(ctx, tx, outboxDomain.SessionRevoked, sourceUserID, revoked)
+}
+
+// mergeAccess объединяет прямые права и переносит контексты и роли source, которых у target нет.
+// Совпадающие права, контексты и назначения остаются такими, как у target, вместе со сроками действия.
+func mergeAccess(ctx context.Context, tx *sqlx.Tx, sourceUserID, targetUserID uuid.UUID, result *domain.MergeResult) error {
+	var sourceJSON, targetJSON []byte
+	query := `SELECT (SELECT rights FROM "users" WHERE id = $1), (SELECT rights FROM "users" WHERE id = $2)`
+	if err := tx.QueryRowContext(ctx, query, sourceUserID, targetUserID).Scan(&sourceJSON, &targetJSON); err != nil {
+		return err
+	}
+	var sourceRights, targetRights map[string][]string
+	if err := json.Unmarshal(sourceJSON, &sourceRights); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(targetJSON, &targetRights); err != nil {
+		return err
+	}
+
+	merged := rightsDomain.MergeRights(targetRights, sourceRights)
+	added := rightsDomain.DiffRights(targetRights, merged).Added
+	if len(added) > 0 {
+		body, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE "users" SET rights = $2, updated_at = now() WHERE id = $1`, targetUserID, body); err != nil {
+			return err
+		}
+		// Срок действия переносится только для прав, которых у target не было
+		for module, actions := range added {
+			query := `INSERT INTO users_rights_validity (user_id, module, action, valid_from, valid_until)
+			          SELECT $2, module, action, valid_from, valid_until FROM users_rights_validity
+			          WHERE user_id = $1 AND module = $3 AND action = ANY($4)
+			          ON CONFLICT (user_id, module, action) DO NOTHING`
+			if _, err := tx.ExecContext(ctx, query, sourceUserID, targetUserID, module, pq.Array(actions)); err != nil {
+				return err
+			}
+		}
+		result.Rights = len(rightsDomain.Entitlements(added))
+		granted := outboxDomain.RightsGrantedPayload{UserID: targetUserID.String(), Rights: added}
+		if err := appendEvent(ctx, tx, outboxDomain.RightsGranted, targetUserID, granted); err != nil {
+			return err
+		}
+	}
+
+	query = `INSERT INTO users_contexts (user_id, merchant_id, global, granted_at, granted_by)
+	         SELECT $2, merchant_id, global, granted_at, granted_by FROM users_contexts WHERE user_id = $1
+	         ON CONFLICT (user_id, merchant_id) DO NOTHING
+	         RETURNING merchant_id, global`
+	rows, err := tx.QueryContext(ctx, query, sourceUserID, targetUserID)
+	if err != nil {
+		return err
+	}
+	var contexts []outboxDomain.ContextAddedPayload
+	for rows.Next() {
+		added := outboxDomain.ContextAddedPayload{UserID: targetUserID.String()}
+		if err := rows.Scan(&added.MerchantID, &added.Global); err != nil {
+			rows.Close()
+			return err
+		}
+		contexts = append(contexts, added)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, added := range contexts {
+		if err := appendEvent(ctx, tx, outboxDomain.ContextAdded, targetUserID, added); err != nil {
+			return err
+		}
+	}
+	result.Contexts = len(contexts)
+
+	query = `WITH moved AS (
+	             INSERT INTO users_roles (user_id, role_id, merchant_id, valid_from, valid_until, granted_at)
+	             SELECT $2, role_id, merchant_id, valid_from, valid_until, granted_at FROM users_roles WHERE user_id = $1
+	             ON CONFLICT (user_id, role_id, (COALESCE(merchant_id, ''))) DO NOTHING
+	             RETURNING role_id, merchant_id, valid_from, valid_until
+	         )
+	         SELECT m.role_id, r.role_name, r.rights, COALESCE(m.merchant_id, ''), m.valid_from, m.valid_until
+	         FROM moved m JOIN roles r ON r.role_id = m.role_id`
+	rows, err = tx.QueryContext(ctx, query, sourceUserID, targetUserID)
+	if err != nil {
+		return err
+	}
+	var roles []outboxDomain.RoleChangedPayload
+	for rows.Next() {
+		var rightsJSON []byte
+		var validFrom, validUntil *time.Time
+		role := outboxDomain.RoleChangedPayload{Change: outboxDomain.RoleAssigned, UserID: targetUserID.String()}
+		if err := rows.Scan(&role.RoleID, &role.RoleName, &rightsJSON, &role.MerchantID, &validFrom, &validUntil); err != nil {
+			rows.Close()
+			return err
+		}
+		role.Modules = rolesPostgres.RightsModules(rightsJSON)
+		role.ValidFrom, role.ValidUntil = validFrom, validUntil
+		roles = append(roles, role)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		// Роль, выданная source по атрибутам SAML, и дальше снимается при входе через этот IdP
+		query := `UPDATE saml_role_grants SET user_id = $2 WHERE user_id = $1 AND role_id = $3 AND merchant_id = $4`
+		if _, err := tx.ExecContext(ctx, query, sourceUserID, targetUserID, role.RoleID, role.MerchantID); err != nil {
+			return err
+		}
+		if err := rolesPostgres.AppendRoleEvent(ctx, tx, role); err != nil {
+			return err
+		}
+	}
+	result.Roles = len(roles)
+	return nil
+}
+
+// lockUsers блокирует пользователей в порядке id, чтобы встречные слияния не взаимоблокировались
+func lockUsers(ctx context.Context, tx *sqlx.Tx, userIDs ...uuid.UUID) error {
+	var locked []uuid.UUID
+	query := `SELECT id FROM "users" WHERE id = ANY($1) ORDER BY id FOR UPDATE`
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = id.String()
+	}
+	if err := tx.SelectContext(ctx, &locked, query, pq.Array(ids)); err != nil {
+		return err
+	}
+	if len(locked) != len(userIDs) {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// AddPhoneIdentity привязывает вход по телефону к пользователю, созданному в транзакции tx
+func AddPhoneIdentity(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, phone, email string) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, verified, email) VALUES ($1, $2, $3, FALSE, $4)`
+	_, err := tx.ExecContext(ctx, query, domain.ProviderPhone, phone, userID, email)
+	return err
+}
+
+// SyncPhoneIdentity переводит вход по телефону на новый телефон пользователя, если такой вход привязан
+func SyncPhoneIdentity(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, phone string) error {
+	query := `UPDATE user_identities SET subject = $3 WHERE user_id = $1 AND provider = $2 AND subject <> $3`
+	_, err := tx.ExecContext(ctx, query, userID, domain.ProviderPhone, phone)
+	return err
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIdentity(row scanner) (domain.Identity, error) {
+	var identity domain.Identity
+	err := row.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Verified, &identity.Email,
+		&identity.LinkedAt, &identity.LastLoginAt)
+	return identity, err
+}
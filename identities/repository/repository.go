@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+)
+
+type IdentityRepository interface {
+	ListIdentities(ctx context.Context, userID uuid.UUID) ([]domain.Identity, error)
+	// AddPhone задаёт пароль и привязывает вход по телефону профиля
+	AddPhone(ctx context.Context, userID uuid.UUID, passwordHash string) (*domain.Identity, error)
+	// Unlink отвязывает способ входа; последний способ входа пользователя не отвязывается
+	Unlink(ctx context.Context, userID uuid.UUID, provider, subject string) (*domain.Identity, error)
+	// Merge переносит способы входа, сессию, права, роли и контексты source в target и удаляет source
+	Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (*domain.MergeResult, error)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	authDomain "github.com/rafaceo/go-test-auth/cmd/domain"
+	"github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/identities/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type IdentityService interface {
+	// ListIdentities возвращает способы входа владельца access_token
+	ListIdentities(ctx context.Context, accessToken string) ([]domain.Identity, error)
+	// AddPhone добавляет вход по телефону профиля с новым паролем
+	AddPhone(ctx context.Context, accessToken, password string) (*domain.Identity, error)
+	// StartLink начинает вход через провайдера protocol/providerID, который привяжет его учётную запись
+	// к владельцу access_token, и возвращает адрес страницы входа провайдера
+	StartLink(ctx context.Context, accessToken, protocol, providerID string) (string, error)
+	// Unlink отвязывает способ входа; subject нужен, только если у пользователя несколько
+	// учётных записей одного провайдера
+	Unlink(ctx context.Context, accessToken, provider, subject string) (*domain.Identity, error)
+	// Merge сливает пользователя source в target; source удаляется
+	Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (*domain.MergeResult, error)
+}
+
+// LinkStarter начинает вход через внешнего провайдера для привязки учётной записи
+type LinkStarter interface {
+	StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error)
+}
+
+// TokenVerifier проверяет access_token и то, что его владелец в статусе active
+type TokenVerifier interface {
+	Authenticate(ctx context.Context, accessToken string) (*authDomain.Claims, error)
+}
+
+type identityService struct {
+	repo    repository.IdentityRepository
+	linkers map[string]LinkStarter
+	tokens  TokenVerifier
+}
+
+// NewIdentityService: linkers — вход для привязки по протоколу провайдера (oidc, saml)
+func NewIdentityService(repo repository.IdentityRepository, linkers map[string]LinkStarter, tokens TokenVerifier) IdentityService {
+	return &identityService{repo: repo, linkers: linkers, tokens: tokens}
+}
+
+func (s *identityService) ListIdentities(ctx context.Context, accessToken string) ([]domain.Identity, error) {
+	userID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListIdentities(ctx, userID)
+}
+
+func (s *identityService) AddPhone(ctx context.Context, accessToken, password string) (*domain.Identity, error) {
+	userID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := domain.ValidatePassword(password); err != nil {
+		return nil, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.AddPhone(ctx, userID, string(hashed))
+}
+
+func (s *identityService) StartLink(ctx context.Context, accessToken, protocol, providerID string) (string, error) {
+	userID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	linker, ok := s.linkers[protocol]
+	if !ok {
+		return "", domain.ErrUnknownProtocol
+	}
+	return linker.StartLink(ctx, userID, providerID)
+}
+
+func (s *identityService) Unlink(ctx context.Context, accessToken, provider, subject string) (*domain.Identity, error) {
+	userID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Unlink(ctx, userID, provider, subject)
+}
+
+func (s *identityService) Merge(ctx context.Context, sourceUserID, targetUserID uuid.UUID) (*domain.MergeResult, error) {
+	return s.repo.Merge(ctx, sourceUserID, targetUserID)
+}
+
+func (s *identityService) authenticate(ctx context.Context, accessToken string) (uuid.UUID, error) {
+	claims, err := s.tokens.Authenticate(ctx, accessToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	e "github.com/rafaceo/go-test-auth/cmd/errors_auth"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/identities/service"
+	"github.com/rafaceo/go-test-auth/identities/transport"
+	"net/http"
+	"strings"
+)
+
+const basePath = "/api/v4/auth/identities"
+
+// GetIdentityHandlers: слияние пользователей попадает в журнал аудита с автором, поэтому требует
+// access_token в Authorization: Bearer
+func GetIdentityHandlers(serv service.IdentityService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	authenticated := authn.Middleware(tokens)
+
+	listHandler := kithttp.NewServer(
+		MakeListIdentitiesEndpoint(serv),
+		DecodeListIdentitiesRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	addPhoneHandler := kithttp.NewServer(
+		MakeAddPhoneEndpoint(serv),
+		DecodeAddPhoneRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	startLinkHandler := kithttp.NewServer(
+		MakeStartLinkEndpoint(serv),
+		DecodeStartLinkRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	unlinkHandler := kithttp.NewServer(
+		MakeUnlinkEndpoint(serv),
+		DecodeUnlinkRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	mergeHandler := kithttp.NewServer(
+		authenticated(MakeMergeEndpoint(serv)),
+		DecodeMergeRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    basePath,
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    basePath + "/phone",
+			Handler: addPhoneHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    basePath + "/link/{protocol}/{provider}",
+			Handler: startLinkHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    basePath + "/merge",
+			Handler: mergeHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    basePath + "/{provider}",
+			Handler: unlinkHandler,
+			Methods: []string{"DELETE"},
+		},
+	}
+}
+
+// tokenError: недействительный access_token или неактивный владелец отдаются кодировщику ошибок (401 или 403)
+func tokenError(err error) bool {
+	var argErr *e.ArgError
+	return errors.As(err, &argErr)
+}
+
+func MakeListIdentitiesEndpoint(svc service.IdentityService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ListIdentitiesRequest)
+		identities, err := svc.ListIdentities(ctx, req.AccessToken)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.ListIdentitiesResponse{Error: err.Error()}, nil
+		}
+		return transport.ListIdentitiesResponse{Identities: identities}, nil
+	}
+}
+
+func MakeAddPhoneEndpoint(svc service.IdentityService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.AddPhoneRequest)
+		identity, err := svc.AddPhone(ctx, req.AccessToken, req.Password)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.IdentityResponse{Error: err.Error()}, nil
+		}
+		return transport.IdentityResponse{Identity: identity}, nil
+	}
+}
+
+func MakeStartLinkEndpoint(svc service.IdentityService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.StartLinkRequest)
+		redirectURL, err := svc.StartLink(ctx, req.AccessToken, req.Protocol, req.ProviderID)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.StartLinkResponse{Error: err.Error()}, nil
+		}
+		return transport.StartLinkResponse{RedirectURL: redirectURL}, nil
+	}
+}
+
+func MakeUnlinkEndpoint(svc service.IdentityService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.UnlinkRequest)
+		identity, err := svc.Unlink(ctx, req.AccessToken, req.Provider, req.Subject)
+		if err != nil {
+			if tokenError(err) {
+				return nil, err
+			}
+			return transport.IdentityResponse{Error: err.Error()}, nil
+		}
+		return transport.IdentityResponse{Identity: identity}, nil
+	}
+}
+
+func MakeMergeEndpoint(svc service.IdentityService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.MergeRequest)
+		result, err := svc.Merge(ctx, req.SourceUserID, req.TargetUserID)
+		if err != nil {
+			return transport.MergeResponse{Error: err.Error()}, nil
+		}
+		return transport.MergeResponse{MergeResult: result}, nil
+	}
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", e.InvalidTokenError
+	}
+	return strings.TrimPrefix(header, "Bearer "), nil
+}
+
+func DecodeListIdentitiesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return transport.ListIdentitiesRequest{AccessToken: token}, nil
+}
+
+func DecodeAddPhoneRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	var req transport.AddPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.AccessToken = token
+	return req, nil
+}
+
+func DecodeStartLinkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	vars := mux.Vars(r)
+	return transport.StartLinkRequest{AccessToken: token, Protocol: vars["protocol"], ProviderID: vars["provider"]}, nil
+}
+
+func DecodeUnlinkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return transport.UnlinkRequest{
+		AccessToken: token,
+		Provider:    mux.Vars(r)["provider"],
+		Subject:     r.URL.Query().Get("subject"),
+	}, nil
+}
+
+func DecodeMergeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	if req.SourceUserID == uuid.Nil || req.TargetUserID == uuid.Nil {
+		return nil, errors.New("source_user_id and target_user_id are required")
+	}
+	return req, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
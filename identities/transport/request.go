@@ -0,0 +1,31 @@
+package transport
+
+import "github.com/google/uuid"
+
+// AccessToken во всех запросах пользователя берётся из заголовка Authorization: Bearer
+
+type ListIdentitiesRequest struct {
+	AccessToken string
+}
+
+type AddPhoneRequest struct {
+	AccessToken string `json:"-"`
+	Password    string `json:"password"`
+}
+
+type StartLinkRequest struct {
+	AccessToken string
+	Protocol    string
+	ProviderID  string
+}
+
+type UnlinkRequest struct {
+	AccessToken string
+	Provider    string
+	Subject     string
+}
+
+type MergeRequest struct {
+	SourceUserID uuid.UUID `json:"source_user_id"`
+	TargetUserID uuid.UUID `json:"target_user_id"`
+}
@@ -0,0 +1,25 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/identities/domain"
+
+type ListIdentitiesResponse struct {
+	Identities []domain.Identity `json:"identities"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type IdentityResponse struct {
+	Identity *domain.Identity `json:"identity,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// StartLinkResponse — адрес страницы входа провайдера; браузер открывает его сам, потому что
+// переход по ссылке не передаёт access_token
+type StartLinkResponse struct {
+	RedirectURL string `json:"redirect_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type MergeResponse struct {
+	*domain.MergeResult
+	Error string `json:"error,omitempty"`
+}
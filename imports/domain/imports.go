@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ModeDryRun = "dry_run"
+	ModeCommit = "commit"
+
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Состояния задания
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Результаты строки: valid — строка прошла проверку в пробном режиме, created — пользователь создан,
+// invalid — строка не прошла проверку, failed — проверка пройдена, но создать пользователя не удалось
+const (
+	RowValid   = "valid"
+	RowCreated = "created"
+	RowInvalid = "invalid"
+	RowFailed  = "failed"
+)
+
+const (
+	// MaxFileSize и MaxRows ограничивают одно задание
+	MaxFileSize = 10 << 20
+	MaxRows     = 10000
+)
+
+var (
+	ErrJobNotFound   = errors.New("import job not found")
+	ErrInvalidMode   = errors.New("invalid mode: use dry_run or commit")
+	ErrInvalidFormat = errors.New("invalid format: use csv or xlsx")
+	ErrEmptyFile     = errors.New("file has no rows")
+	ErrTooManyRows   = errors.New("file has more than " + strconv.Itoa(MaxRows) + " rows")
+	ErrFileTooLarge  = errors.New("file is larger than 10 MB")
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrUserExists и ErrMerchantUnavailable — строка не создана из-за изменений, сделанных
+	// после её проверки; задание при этом продолжается
+	ErrUserExists          = errors.New("user with this phone or email already exists")
+	ErrMerchantUnavailable = errors.New("merchant is missing or suspended")
+)
+
+// Job — задание импорта и его прогресс
+type Job struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	Mode          string     `json:"mode" db:"mode"`
+	Format        string     `json:"format" db:"format"`
+	FileName      string     `json:"file_name,omitempty" db:"file_name"`
+	Status        string     `json:"status" db:"status"`
+	TotalRows     int        `json:"total_rows" db:"total_rows"`
+	ProcessedRows int        `json:"processed_rows" db:"processed_rows"`
+	SucceededRows int        `json:"succeeded_rows" db:"succeeded_rows"`
+	FailedRows    int        `json:"failed_rows" db:"failed_rows"`
+	Error         string     `json:"error,omitempty" db:"error"`
+	CreatedBy     string     `json:"created_by,omitempty" db:"created_by"`
+	RequestID     string     `json:"-" db:"request_id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	Payload       []byte     `json:"-" db:"payload"`
+}
+
+// Row — строка файла импорта. Number — номер строки в файле, заголовок — строка 1.
+type Row struct {
+	Number    int
+	Phone     string
+	Email     string
+	FirstName string
+	LastName  string
+	Password  string
+	Roles     []string
+	Merchants []string
+}
+
+// RowResult — итог обработки строки в отчёте задания
+type RowResult struct {
+	Number int        `json:"row" db:"row_number"`
+	Phone  string     `json:"phone" db:"phone"`
+	Status string     `json:"status" db:"status"`
+	Errors []string   `json:"errors,omitempty" db:"-"`
+	UserID *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+}
+
+// Lookup — данные базы, нужные для проверки строк: роли по имени, статусы мерчантов,
+// уже занятые телефоны и email (в нижнем регистре)
+type Lookup struct {
+	Roles     map[string]int
+	Merchants map[string]string
+	Phones    map[string]bool
+	Emails    map[string]bool
+}
+
+// RowFilter — выборка отчёта задания постранично
+type RowFilter struct {
+	JobID  uuid.UUID
+	Status string
+	Limit  int
+	Cursor string
+}
+
+type RowPage struct {
+	Rows       []RowResult `json:"rows"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func ValidMode(mode string) bool {
+	return mode == ModeDryRun || mode == ModeCommit
+}
+
+// EncodeCursor скрывает от клиента, что курсор — это номер последней выданной строки
+func EncodeCursor(number int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(number)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	number, err := strconv.Atoi(string(data))
+	if err != nil || number <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return number, nil
+}
@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+	"github.com/xuri/excelize/v2"
+)
+
+const maxNameLength = 64
+
+var ErrPhoneColumnRequired = errors.New("phone column is required")
+
+// columns — допустимые заголовки и их синонимы. name делится на имя и фамилию по первому пробелу,
+// списки ролей и мерчантов разделяются запятой, точкой с запятой или «|».
+var columns = map[string]string{
+	"phone":        "phone",
+	"email":        "email",
+	"first_name":   "first_name",
+	"last_name":    "last_name",
+	"name":         "name",
+	"password":     "password",
+	"roles":        "roles",
+	"merchants":    "merchants",
+	"merchant_ids": "merchants",
+	"contexts":     "merchants",
+}
+
+// Parse читает строки файла; заголовок обязателен и должен быть первой строкой
+func Parse(format string, data []byte) ([]Row, error) {
+	var records [][]string
+	var err error
+	switch format {
+	case FormatCSV:
+		records, err = readCSV(data)
+	case FormatXLSX:
+		records, err = readXLSX(data)
+	default:
+		return nil, ErrInvalidFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(records)
+}
+
+// readCSV понимает разделители «,» и «;» — второй ставит Excel в русской локали
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, errors.New("csv file must be UTF-8 encoded")
+	}
+
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	// csv.Reader пропускает пустые строки; на их место встают пустые записи,
+	// чтобы номера строк в отчёте совпадали с номерами строк файла
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		for len(records) < line-1 {
+			records = append(records, nil)
+		}
+		records = append(records, record)
+	}
+}
+
+// readXLSX берёт первый лист книги
+func readXLSX(data []byte) ([][]string, error) {
+	book, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx: %w", err)
+	}
+	defer book.Close()
+
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, ErrEmptyFile
+	}
+	records, err := book.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx: %w", err)
+	}
+	return records, nil
+}
+
+func parseRecords(records [][]string) ([]Row, error) {
+	if len(records) == 0 {
+		return nil, ErrEmptyFile
+	}
+
+	header := make([]string, len(records[0]))
+	hasPhone := false
+	for i, cell := range records[0] {
+		name := strings.ToLower(strings.TrimSpace(cell))
+		column, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", cell)
+		}
+		header[i] = column
+		hasPhone = hasPhone || column == "phone"
+	}
+	if !hasPhone {
+		return nil, ErrPhoneColumnRequired
+	}
+
+	var rows []Row
+	for i, record := range records[1:] {
+		if blank(record) {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+
+		row := Row{Number: i + 2}
+		var fullName string
+		for j, cell := range record {
+			if j >= len(header) {
+				break
+			}
+			cell = strings.TrimSpace(cell)
+			switch header[j] {
+			case "phone":
+				row.Phone = cell
+			case "email":
+				row.Email = cell
+			case "first_name":
+				row.FirstName = cell
+			case "last_name":
+				row.LastName = cell
+			case "name":
+				fullName = cell
+			case "password":
+				row.Password = cell
+			case "roles":
+				row.Roles = splitList(cell)
+			case "merchants":
+				row.Merchants = splitList(cell)
+			}
+		}
+		if row.FirstName == "" && row.LastName == "" && fullName != "" {
+			first, last, _ := strings.Cut(fullName, " ")
+			row.FirstName, row.LastName = first, strings.TrimSpace(last)
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrEmptyFile
+	}
+	return rows, nil
+}
+
+func blank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(cell string) []string {
+	parts := strings.FieldsFunc(cell, func(r rune) bool { return r == ',' || r == ';' || r == '|' })
+
+	var items []string
+	seen := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" && !seen[part] {
+			seen[part] = true
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// Validate проверяет строку по тем же правилам, что и создание пользователя через API,
+// и по данным базы из lookup. Возвращает все найденные ошибки.
+func (r Row) Validate(lookup Lookup) []string {
+	var problems []string
+
+	if err := userDomain.ValidatePhone(r.Phone); err != nil {
+		problems = append(problems, err.Error())
+	} else if lookup.Phones[r.Phone] {
+		problems = append(problems, "user with this phone already exists")
+	}
+
+	if r.Email != "" {
+		if err := userDomain.ValidateEmail(r.Email); err != nil {
+			problems = append(problems, err.Error())
+		} else if lookup.Emails[strings.ToLower(r.Email)] {
+			problems = append(problems, "user with this email already exists")
+		}
+	}
+
+	if utf8.RuneCountInString(r.FirstName) > maxNameLength || utf8.RuneCountInString(r.LastName) > maxNameLength {
+		problems = append(problems, fmt.Sprintf("name parts must be at most %d characters", maxNameLength))
+	}
+
+	for _, role := range r.Roles {
+		if _, ok := lookup.Roles[role]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown role %q", role))
+		}
+	}
+
+	for _, merchantID := range r.Merchants {
+		switch status, ok := lookup.Merchants[merchantID]; {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("unknown merchant %q", merchantID))
+		case status != merchantsDomain.StatusActive:
+			problems = append(problems, fmt.Sprintf("merchant %q is %s", merchantID, status))
+		}
+	}
+
+	return problems
+}
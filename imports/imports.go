@@ -0,0 +1,70 @@
+package imports
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/imports/middleware"
+	"github.com/rafaceo/go-test-auth/imports/repository/postgres"
+	"github.com/rafaceo/go-test-auth/imports/service"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateImportService(logger log.Logger, postgresClient *sqlx.DB) service.ImportService {
+	importServ := newService(logger, postgresClient, "imports")
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("import_service")
+	importServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, importServ)
+
+	return importServ
+}
+
+func (sf *ServiceFactory) CreateWorker(logger log.Logger, postgresClient *sqlx.DB, interval time.Duration) *Worker {
+	return &Worker{
+		service:  newService(logger, postgresClient, "import_worker"),
+		interval: interval,
+	}
+}
+
+func newService(logger log.Logger, postgresClient *sqlx.DB, component string) service.ImportService {
+	importServ := service.NewImportService(
+		postgres.NewImportRepository(postgresClient),
+		accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)),
+	)
+	importServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), importServ)
+	return middleware.NewLoggingMiddleware(log.With(logger, "component", component), importServ)
+}
+
+// Worker обрабатывает задания импорта из очереди: разбирает очередь до конца и ждёт следующего опроса
+type Worker struct {
+	service  service.ImportService
+	interval time.Duration
+}
+
+// Run блокируется до отмены ctx
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := w.service.ProcessNext(ctx)
+			if err != nil || job == nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/service"
+)
+
+// auditingService записывает в журнал аудита загрузку файла и итог задания импорта;
+// созданные пользователи видны в отчёте задания и в событиях outbox
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.ImportService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.ImportService) service.ImportService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action string, job *domain.Job) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, auditDomain.TargetUserImport, job.ID.String(), nil, job))
+}
+
+func (a *auditingService) CreateJob(ctx context.Context, mode, fileName, contentType string, data []byte) (*domain.Job, error) {
+	job, err := a.next.CreateJob(ctx, mode, fileName, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "user_import.create", job)
+	return job, nil
+}
+
+func (a *auditingService) GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	return a.next.GetJob(ctx, id)
+}
+
+func (a *auditingService) ListJobRows(ctx context.Context, filter domain.RowFilter) (*domain.RowPage, error) {
+	return a.next.ListJobRows(ctx, filter)
+}
+
+func (a *auditingService) ProcessNext(ctx context.Context) (*domain.Job, error) {
+	job, err := a.next.ProcessNext(ctx)
+	if err != nil || job == nil {
+		return job, err
+	}
+	ctx = requestinfo.WithVerifiedActor(ctx, job.CreatedBy)
+	ctx = requestinfo.WithRequestID(ctx, job.RequestID)
+	a.record(ctx, "user_import.finish", job)
+	return job, nil
+}
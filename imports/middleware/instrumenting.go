@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.ImportService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.ImportService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateJob(ctx context.Context, mode, fileName, contentType string, data []byte) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateJob"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateJob(ctx, mode, fileName, contentType, data)
+}
+
+func (s *instrumentingService) GetJob(ctx context.Context, id uuid.UUID) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetJob"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetJob(ctx, id)
+}
+
+func (s *instrumentingService) ListJobRows(ctx context.Context, filter domain.RowFilter) (page *domain.RowPage, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListJobRows"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListJobRows(ctx, filter)
+}
+
+func (s *instrumentingService) ProcessNext(ctx context.Context) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ProcessNext"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ProcessNext(ctx)
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.ImportService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.ImportService) service.ImportService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateJob(ctx context.Context, mode, fileName, contentType string, data []byte) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateJob",
+			"took", time.Since(begin),
+			"mode", mode,
+			"fileName", fileName,
+			"size", len(data),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateJob(ctx, mode, fileName, contentType, data)
+}
+
+func (l loggingService) GetJob(ctx context.Context, id uuid.UUID) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetJob",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetJob(ctx, id)
+}
+
+func (l loggingService) ListJobRows(ctx context.Context, filter domain.RowFilter) (page *domain.RowPage, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListJobRows",
+			"took", time.Since(begin),
+			"jobID", filter.JobID,
+			"status", filter.Status,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListJobRows(ctx, filter)
+}
+
+func (l loggingService) ProcessNext(ctx context.Context) (job *domain.Job, err error) {
+	defer func(begin time.Time) {
+		// пустой опрос очереди не логируется
+		if job == nil && err == nil {
+			return
+		}
+		keyvals := []interface{}{"method", "ProcessNext", "took", time.Since(begin)}
+		if job != nil {
+			keyvals = append(keyvals, "id", job.ID, "status", job.Status, "processed", job.ProcessedRows,
+				"failed", job.FailedRows)
+		}
+		_ = l.logger.Log(append(keyvals, "err", err)...)
+	}(time.Now())
+
+	return l.next.ProcessNext(ctx)
+}
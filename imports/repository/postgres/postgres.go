@@ -0,0 +1,337 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesPostgres "github.com/rafaceo/go-test-auth/identities/repository/postgres"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/repository"
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+)
+
+const jobColumns = `id, mode, format, file_name, status, total_rows, processed_rows, succeeded_rows, failed_rows,
+	error, created_by, request_id, created_at, started_at, finished_at`
+
+type importRepository struct {
+	db *sqlx.DB
+}
+
+func NewImportRepository(db *sqlx.DB) repository.ImportRepository {
+	return &importRepository{db: db}
+}
+
+func (r *importRepository) CreateJob(ctx context.Context, job domain.Job) error {
+	query := `INSERT INTO user_import_jobs (id, mode, format, file_name, payload, status, created_by, request_id, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.db.ExecContext(ctx, query, job.ID, job.Mode, job.Format, job.FileName, job.Payload, job.Status,
+		job.CreatedBy, job.RequestID, job.CreatedAt)
+	return err
+}
+
+func (r *importRepository) GetJob(ctx context.Context, id uuid.UUID) (domain.Job, error) {
+	var job domain.Job
+	err := r.db.GetContext(ctx, &job, `SELECT `+jobColumns+` FROM user_import_jobs WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Job{}, domain.ErrJobNotFound
+	}
+	return job, err
+}
+
+// ClaimJob забирает самое старое ожидающее задание или задание, обработчик которого не отмечался
+// с момента staleBefore. Возвращает nil, если забирать нечего.
+func (r *importRepository) ClaimJob(ctx context.Context, staleBefore time.Time) (*domain.Job, error) {
+	now := time.Now().UTC()
+	query := `UPDATE user_import_jobs
+	          SET status = 'running', started_at = COALESCE(started_at, $1), heartbeat_at = $1
+	          WHERE id = (
+	              SELECT id FROM user_import_jobs
+	              WHERE status = 'pending' OR (status = 'running' AND heartbeat_at < $2)
+	              ORDER BY created_at
+	              LIMIT 1
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING ` + jobColumns + `, payload`
+
+	var job domain.Job
+	err := r.db.GetContext(ctx, &job, query, now, staleBefore)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *importRepository) SetTotalRows(ctx context.Context, id uuid.UUID, total int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE user_import_jobs SET total_rows = $2 WHERE id = $1`, id, total)
+	return err
+}
+
+// FinishJob завершает задание и удаляет загруженный файл: пароли и личные данные не хранятся дольше обработки
+func (r *importRepository) FinishJob(ctx context.Context, id uuid.UUID, status string, reason string) error {
+	query := `UPDATE user_import_jobs
+	          SET status = $2, error = $3, finished_at = $4, payload = NULL
+	          WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, status, reason, time.Now().UTC())
+	return err
+}
+
+func (r *importRepository) GetLastRowNumber(ctx context.Context, jobID uuid.UUID) (int, error) {
+	var number int
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(row_number), 0) FROM user_import_rows WHERE job_id = $1`, jobID).
+		Scan(&number)
+	return number, err
+}
+
+// LoadLookup читает одним проходом всё, что нужно для проверки строк файла
+func (r *importRepository) LoadLookup(ctx context.Context, rows []domain.Row) (domain.Lookup, error) {
+	lookup := domain.Lookup{
+		Roles:     map[string]int{},
+		Merchants: map[string]string{},
+		Phones:    map[string]bool{},
+		Emails:    map[string]bool{},
+	}
+
+	var phones, emails, roles, merchants []string
+	for _, row := range rows {
+		phones = append(phones, row.Phone)
+		if row.Email != "" {
+			emails = append(emails, strings.ToLower(row.Email))
+		}
+		roles = append(roles, row.Roles...)
+		merchants = append(merchants, row.Merchants...)
+	}
+
+	queries := []struct {
+		query string
+		arg   []string
+		add   func(rows *sql.Rows) error
+	}{
+		{`SELECT role_name, role_id FROM roles WHERE role_name = ANY($1)`, roles, func(rows *sql.Rows) error {
+			var name string
+			var id int
+			err := rows.Scan(&name, &id)
+			lookup.Roles[name] = id
+			return err
+		}},
+		{`SELECT id, status FROM merchants WHERE id = ANY($1)`, merchants, func(rows *sql.Rows) error {
+			var id, status string
+			err := rows.Scan(&id, &status)
+			lookup.Merchants[id] = status
+			return err
+		}},
+		{`SELECT phone FROM "users" WHERE phone = ANY($1)`, phones, func(rows *sql.Rows) error {
+			var phone string
+			err := rows.Scan(&phone)
+			lookup.Phones[phone] = true
+			return err
+		}},
+		{`SELECT lower(email) FROM "users" WHERE lower(email) = ANY($1)`, emails, func(rows *sql.Rows) error {
+			var email string
+			err := rows.Scan(&email)
+			lookup.Emails[email] = true
+			return err
+		}},
+	}
+
+	for _, q := range queries {
+		if len(q.arg) == 0 {
+			continue
+		}
+		if err := r.scanEach(ctx, q.query, pq.Array(q.arg), q.add); err != nil {
+			return domain.Lookup{}, err
+		}
+	}
+	return lookup, nil
+}
+
+func (r *importRepository) scanEach(ctx context.Context, query string, arg interface{}, add func(rows *sql.Rows) error) error {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := add(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *importRepository) SaveRowResult(ctx context.Context, jobID uuid.UUID, result domain.RowResult) error {
+	return saveRowResult(ctx, r.db, jobID, result)
+}
+
+// CreateUser создаёт пользователя из строки вместе с контекстами и ролями в одной транзакции
+// и сохраняет результат строки. Роли назначаются у каждого мерчанта строки, без мерчантов — у любого.
+func (r *importRepository) CreateUser(ctx context.Context, jobID uuid.UUID, row domain.Row, passwordHash string, roleIDs map[string]int) (uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	query := `INSERT INTO "users" (id, phone, password_hash, rights, email, first_name, last_name, created_at)
+	          VALUES ($1, $2, $3, '{}', NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NOW())`
+	_, err = tx.ExecContext(ctx, query, id, row.Phone, passwordHash, row.Email, row.FirstName, row.LastName)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return uuid.Nil, domain.ErrUserExists
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := identitiesPostgres.AddPhoneIdentity(ctx, tx, id, row.Phone, row.Email); err != nil {
+		return uuid.Nil, err
+	}
+
+	registered := outboxDomain.UserRegisteredPayload{UserID: id.String(), Phone: row.Phone, Email: row.Email, Source: "import"}
+	if err := appendEvent(ctx, tx, outboxDomain.UserRegistered, id, registered); err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, merchantID := range row.Merchants {
+		var status string
+		err := tx.QueryRowContext(ctx, `SELECT status FROM merchants WHERE id = $1 FOR SHARE`, merchantID).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && status != merchantsDomain.StatusActive) {
+			return uuid.Nil, fmt.Errorf("%w: %s", domain.ErrMerchantUnavailable, merchantID)
+		}
+		if err != nil {
+			return uuid.Nil, err
+		}
+
+		query := `INSERT INTO users_contexts (user_id, merchant_id, global, granted_by) VALUES ($1, $2, FALSE, $3)`
+		if _, err := tx.ExecContext(ctx, query, id, merchantID, requestinfo.Actor(ctx)); err != nil {
+			return uuid.Nil, err
+		}
+		added := outboxDomain.ContextAddedPayload{UserID: id.String(), MerchantID: merchantID}
+		if err := appendEvent(ctx, tx, outboxDomain.ContextAdded, id, added); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	scopes := []*string{nil}
+	if len(row.Merchants) > 0 {
+		scopes = scopes[:0]
+		for i := range row.Merchants {
+			scopes = append(scopes, &row.Merchants[i])
+		}
+	}
+	for _, roleName := range row.Roles {
+		roleID := roleIDs[roleName]
+		var rightsJSON []byte
+		if err := tx.QueryRowContext(ctx, `SELECT rights FROM roles WHERE role_id = $1 FOR SHARE`, roleID).Scan(&rightsJSON); err != nil {
+			return uuid.Nil, fmt.Errorf("role %q: %w", roleName, err)
+		}
+
+		for _, merchantID := range scopes {
+			query := `INSERT INTO users_roles (user_id, role_id, merchant_id, granted_at) VALUES ($1, $2, $3, now())`
+			if _, err := tx.ExecContext(ctx, query, id, roleID, merchantID); err != nil {
+				return uuid.Nil, err
+			}
+
+			payload := outboxDomain.RoleChangedPayload{
+				RoleID:   roleID,
+				RoleName: roleName,
+				Change:   outboxDomain.RoleAssigned,
+				UserID:   id.String(),
+				Modules:  rolesPostgres.RightsModules(rightsJSON),
+			}
+			if merchantID != nil {
+				payload.MerchantID = *merchantID
+			}
+			if err := rolesPostgres.AppendRoleEvent(ctx, tx, payload); err != nil {
+				return uuid.Nil, err
+			}
+		}
+	}
+
+	result := domain.RowResult{Number: row.Number, Phone: row.Phone, Status: domain.RowCreated, UserID: &id}
+	if err := saveRowResult(ctx, tx, jobID, result); err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *importRepository) ListRows(ctx context.Context, jobID uuid.UUID, status string, afterNumber int, limit int) ([]domain.RowResult, error) {
+	query := `SELECT row_number, phone, status, errors, user_id
+	          FROM user_import_rows
+	          WHERE job_id = $1 AND ($2::text = '' OR status = $2::text) AND row_number > $3
+	          ORDER BY row_number
+	          LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, jobID, status, afterNumber, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []domain.RowResult{}
+	for rows.Next() {
+		var result domain.RowResult
+		var errorsJSON []byte
+		if err := rows.Scan(&result.Number, &result.Phone, &result.Status, &errorsJSON, &result.UserID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(errorsJSON, &result.Errors); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// saveRowResult записывает результат строки и обновляет счётчики задания. Повторная запись той же
+// строки после перезапуска обработчика счётчики не меняет.
+func saveRowResult(ctx context.Context, db sqlx.ExecerContext, jobID uuid.UUID, result domain.RowResult) error {
+	errorsJSON, err := json.Marshal(result.Errors)
+	if err != nil {
+		return err
+	}
+	if result.Errors == nil {
+		errorsJSON = []byte("[]")
+	}
+
+	succeeded := result.Status == domain.RowValid || result.Status == domain.RowCreated
+	query := `WITH inserted AS (
+	              INSERT INTO user_import_rows (job_id, row_number, phone, status, errors, user_id)
+	              VALUES ($1, $2, $3, $4, $5, $6)
+	              ON CONFLICT (job_id, row_number) DO NOTHING
+	              RETURNING 1
+	          )
+	          UPDATE user_import_jobs
+	          SET processed_rows = processed_rows + (SELECT COUNT(*) FROM inserted),
+	              succeeded_rows = succeeded_rows + CASE WHEN $7 THEN (SELECT COUNT(*) FROM inserted) ELSE 0 END,
+	              failed_rows = failed_rows + CASE WHEN $7 THEN 0 ELSE (SELECT COUNT(*) FROM inserted) END,
+	              heartbeat_at = $8
+	          WHERE id = $1`
+	_, err = db.ExecContext(ctx, query, jobID, result.Number, result.Phone, result.Status, errorsJSON, result.UserID,
+		succeeded, time.Now().UTC())
+	return err
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
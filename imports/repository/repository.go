@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+)
+
+type ImportRepository interface {
+	CreateJob(ctx context.Context, job domain.Job) error
+	GetJob(ctx context.Context, id uuid.UUID) (domain.Job, error)
+	ClaimJob(ctx context.Context, staleBefore time.Time) (*domain.Job, error)
+	SetTotalRows(ctx context.Context, id uuid.UUID, total int) error
+	FinishJob(ctx context.Context, id uuid.UUID, status string, reason string) error
+	GetLastRowNumber(ctx context.Context, jobID uuid.UUID) (int, error)
+	LoadLookup(ctx context.Context, rows []domain.Row) (domain.Lookup, error)
+	SaveRowResult(ctx context.Context, jobID uuid.UUID, result domain.RowResult) error
+	CreateUser(ctx context.Context, jobID uuid.UUID, row domain.Row, passwordHash string, roleIDs map[string]int) (uuid.UUID, error)
+	ListRows(ctx context.Context, jobID uuid.UUID, status string, afterNumber int, limit int) ([]domain.RowResult, error)
+}
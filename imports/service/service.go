@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	accessDomain "github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultRowsLimit = 50
+	maxRowsLimit     = 500
+	// staleAfter — задание, обработчик которого не отмечался столько времени, забирает другой обработчик
+	staleAfter = 2 * time.Minute
+)
+
+type ImportService interface {
+	CreateJob(ctx context.Context, mode, fileName, contentType string, data []byte) (*domain.Job, error)
+	GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error)
+	ListJobRows(ctx context.Context, filter domain.RowFilter) (*domain.RowPage, error)
+	ProcessNext(ctx context.Context) (*domain.Job, error)
+}
+
+// SensitiveGuard не даёт назначить роли с правами чувствительных модулей в обход заявок на доступ
+type SensitiveGuard interface {
+	CheckRoleGrant(ctx context.Context, roleNames []string) error
+}
+
+type importService struct {
+	repo  repository.ImportRepository
+	guard SensitiveGuard
+}
+
+func NewImportService(repo repository.ImportRepository, guard SensitiveGuard) ImportService {
+	return &importService{repo: repo, guard: guard}
+}
+
+// CreateJob сохраняет файл и ставит задание в очередь. Файл разбирается сразу,
+// чтобы повреждённый файл или неверный заголовок отклонялись до постановки в очередь.
+func (s *importService) CreateJob(ctx context.Context, mode, fileName, contentType string, data []byte) (*domain.Job, error) {
+	if mode == "" {
+		mode = domain.ModeDryRun
+	}
+	if !domain.ValidMode(mode) {
+		return nil, domain.ErrInvalidMode
+	}
+	if len(data) > domain.MaxFileSize {
+		return nil, domain.ErrFileTooLarge
+	}
+
+	format, err := detectFormat(fileName, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := domain.Parse(format, data); err != nil {
+		return nil, err
+	}
+
+	job := domain.Job{
+		ID:        uuid.New(),
+		Mode:      mode,
+		Format:    format,
+		Status:    domain.JobPending,
+		CreatedBy: requestinfo.VerifiedActor(ctx),
+		RequestID: requestinfo.RequestID(ctx),
+		CreatedAt: time.Now().UTC(),
+		Payload:   data,
+	}
+	if fileName != "" {
+		job.FileName = filepath.Base(fileName)
+	}
+	if err := s.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *importService) GetJob(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	job, err := s.repo.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *importService) ListJobRows(ctx context.Context, filter domain.RowFilter) (*domain.RowPage, error) {
+	if _, err := s.repo.GetJob(ctx, filter.JobID); err != nil {
+		return nil, err
+	}
+
+	after, err := domain.DecodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultRowsLimit
+	}
+	if limit > maxRowsLimit {
+		limit = maxRowsLimit
+	}
+
+	rows, err := s.repo.ListRows(ctx, filter.JobID, filter.Status, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.RowPage{Rows: rows}
+	if len(rows) > limit {
+		page.Rows = rows[:limit]
+		page.NextCursor = domain.EncodeCursor(page.Rows[limit-1].Number)
+	}
+	return page, nil
+}
+
+// ProcessNext забирает одно задание из очереди и обрабатывает его до конца.
+// Возвращает nil, если очередь пуста. Задание, прерванное остановкой сервиса,
+// продолжается со строки, следующей за последней сохранённой.
+func (s *importService) ProcessNext(ctx context.Context) (*domain.Job, error) {
+	job, err := s.repo.ClaimJob(ctx, time.Now().UTC().Add(-staleAfter))
+	if err != nil || job == nil {
+		return nil, err
+	}
+
+	// события и аудит создаваемых пользователей относятся к автору задания и его запросу
+	ctx = requestinfo.WithVerifiedActor(ctx, job.CreatedBy)
+	ctx = requestinfo.WithRequestID(ctx, job.RequestID)
+
+	status, reason := domain.JobCompleted, ""
+	if err := s.process(ctx, job); err != nil {
+		if ctx.Err() != nil {
+			// сервис останавливается: задание подхватят после перезапуска
+			return nil, err
+		}
+		status, reason = domain.JobFailed, err.Error()
+	}
+
+	if err := s.repo.FinishJob(ctx, job.ID, status, reason); err != nil {
+		return nil, err
+	}
+	return s.GetJob(ctx, job.ID)
+}
+
+func (s *importService) process(ctx context.Context, job *domain.Job) error {
+	rows, err := domain.Parse(job.Format, job.Payload)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetTotalRows(ctx, job.ID, len(rows)); err != nil {
+		return err
+	}
+
+	lookup, err := s.repo.LoadLookup(ctx, rows)
+	if err != nil {
+		return err
+	}
+	last, err := s.repo.GetLastRowNumber(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+
+	// телефоны и email, уже встреченные в файле выше: второе вхождение — ошибка строки
+	seenPhones := map[string]int{}
+	seenEmails := map[string]int{}
+
+	for _, row := range rows {
+		problems := row.Validate(lookup)
+		if first, ok := seenPhones[row.Phone]; ok {
+			problems = append(problems, fmt.Sprintf("phone duplicates row %d", first))
+		} else {
+			seenPhones[row.Phone] = row.Number
+		}
+		if email := strings.ToLower(row.Email); email != "" {
+			if first, ok := seenEmails[email]; ok {
+				problems = append(problems, fmt.Sprintf("email duplicates row %d", first))
+			} else {
+				seenEmails[email] = row.Number
+			}
+		}
+
+		if row.Number <= last {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// роли с чувствительными модулями выдаются только по заявке на доступ: строка с ними ошибочна
+		if len(problems) == 0 {
+			err := s.guard.CheckRoleGrant(ctx, row.Roles)
+			var sensitive *accessDomain.SensitiveRightsError
+			if errors.As(err, &sensitive) {
+				problems = append(problems, sensitive.Error())
+			} else if err != nil {
+				return err
+			}
+		}
+
+		result := domain.RowResult{Number: row.Number, Phone: row.Phone, Status: domain.RowValid, Errors: problems}
+		switch {
+		case len(problems) > 0:
+			result.Status = domain.RowInvalid
+		case job.Mode == domain.ModeCommit:
+			err := s.createUser(ctx, job.ID, row, lookup)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, domain.ErrUserExists) && !errors.Is(err, domain.ErrMerchantUnavailable) {
+				return fmt.Errorf("row %d: %w", row.Number, err)
+			}
+			result.Status, result.Errors = domain.RowFailed, []string{err.Error()}
+		}
+
+		if err := s.repo.SaveRowResult(ctx, job.ID, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUser создаёт пользователя строки; результат строки сохраняет репозиторий в той же транзакции
+func (s *importService) createUser(ctx context.Context, jobID uuid.UUID, row domain.Row, lookup domain.Lookup) error {
+	password := row.Password
+	if password == "" {
+		// без пароля в файле вход возможен только после его сброса
+		random, err := randomPassword()
+		if err != nil {
+			return err
+		}
+		password = random
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.CreateUser(ctx, jobID, row, string(hashedPassword), lookup.Roles)
+	return err
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// detectFormat определяет формат по расширению файла, а без него — по Content-Type
+func detectFormat(fileName, contentType string) (string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return domain.FormatCSV, nil
+	case ".xlsx":
+		return domain.FormatXLSX, nil
+	case "":
+	default:
+		return "", domain.ErrInvalidFormat
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return domain.FormatCSV, nil
+	case strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"):
+		return domain.FormatXLSX, nil
+	}
+	return "", domain.ErrInvalidFormat
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/imports/domain"
+	"github.com/rafaceo/go-test-auth/imports/service"
+	"github.com/rafaceo/go-test-auth/imports/transport"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GetImportHandlers: создание задания импорта попадает в журнал аудита с автором, поэтому требует
+// access_token в Authorization: Bearer
+func GetImportHandlers(serv service.ImportService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	authenticated := authn.Middleware(tokens)
+
+	createHandler := kithttp.NewServer(
+		authenticated(MakeCreateJobEndpoint(serv)),
+		DecodeCreateJobRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetJobEndpoint(serv),
+		DecodeJobIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listRowsHandler := kithttp.NewServer(
+		MakeListRowsEndpoint(serv),
+		DecodeListRowsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/users/imports",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/users/imports/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/users/imports/{id}/rows",
+			Handler: listRowsHandler,
+			Methods: []string{"GET"},
+		},
+	}
+}
+
+func MakeCreateJobEndpoint(svc service.ImportService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateJobRequest)
+		job, err := svc.CreateJob(ctx, req.Mode, req.FileName, req.ContentType, req.Data)
+		if err != nil {
+			return transport.JobResponse{Error: err.Error()}, nil
+		}
+		return transport.JobResponse{Job: job}, nil
+	}
+}
+
+func MakeGetJobEndpoint(svc service.ImportService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.JobIDRequest)
+		job, err := svc.GetJob(ctx, req.ID)
+		if err != nil {
+			return transport.JobResponse{Error: err.Error()}, nil
+		}
+		return transport.JobResponse{Job: job}, nil
+	}
+}
+
+func MakeListRowsEndpoint(svc service.ImportService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter := request.(domain.RowFilter)
+		page, err := svc.ListJobRows(ctx, filter)
+		if err != nil {
+			return transport.ListRowsResponse{Error: err.Error()}, nil
+		}
+		return transport.ListRowsResponse{RowPage: *page}, nil
+	}
+}
+
+// DecodeCreateJobRequest принимает файл полем file формы multipart/form-data или телом запроса целиком;
+// режим передаётся в query mode (dry_run по умолчанию)
+func DecodeCreateJobRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := transport.CreateJobRequest{Mode: r.URL.Query().Get("mode")}
+	body := http.MaxBytesReader(nil, r.Body, domain.MaxFileSize+1<<20)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = body
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("multipart field file is required")
+		}
+		defer file.Close()
+
+		req.FileName = header.Filename
+		req.ContentType = header.Header.Get("Content-Type")
+		body = file
+	} else {
+		req.FileName = r.URL.Query().Get("file_name")
+		req.ContentType = r.Header.Get("Content-Type")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, domain.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	req.Data = data
+
+	return req, nil
+}
+
+func DecodeJobIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid import job ID")
+	}
+	return transport.JobIDRequest{ID: id}, nil
+}
+
+// DecodeListRowsRequest читает из query status, limit и cursor из next_cursor предыдущей страницы
+func DecodeListRowsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid import job ID")
+	}
+
+	query := r.URL.Query()
+	filter := domain.RowFilter{
+		JobID:  id,
+		Status: query.Get("status"),
+		Cursor: query.Get("cursor"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
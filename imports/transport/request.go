@@ -0,0 +1,15 @@
+package transport
+
+import "github.com/google/uuid"
+
+// CreateJobRequest — загруженный файл; ContentType нужен, если у файла нет расширения
+type CreateJobRequest struct {
+	Mode        string
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+type JobIDRequest struct {
+	ID uuid.UUID `json:"-"`
+}
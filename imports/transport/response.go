@@ -0,0 +1,13 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/imports/domain"
+
+type JobResponse struct {
+	Job   *domain.Job `json:"job,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+type ListRowsResponse struct {
+	domain.RowPage
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Manifest декларативно описывает каталог прав и пресеты ролей
+type Manifest struct {
+	Modules []Module `json:"modules" yaml:"modules"`
+	Roles   []Role   `json:"roles" yaml:"roles"`
+}
+
+type Module struct {
+	Module  string   `json:"module" yaml:"module"`
+	Actions []string `json:"actions" yaml:"actions"`
+}
+
+type Role struct {
+	Name   string              `json:"role_name" yaml:"role_name"`
+	NameRu string              `json:"role_name_ru" yaml:"role_name_ru"`
+	Notes  string              `json:"notes" yaml:"notes"`
+	Rights map[string][]string `json:"rights" yaml:"rights"`
+}
+
+// State — текущее содержимое таблиц rights и roles
+type State struct {
+	Modules map[string][]string
+	Roles   map[string]Role
+}
+
+type ModuleChange struct {
+	Op     string   `json:"op"`
+	Module string   `json:"module"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type RoleChange struct {
+	Op     string `json:"op"`
+	Name   string `json:"role_name"`
+	Before *Role  `json:"before,omitempty"`
+	After  *Role  `json:"after,omitempty"`
+}
+
+// Plan — набор изменений, приводящий базу к манифесту
+type Plan struct {
+	Prune   bool           `json:"prune"`
+	Modules []ModuleChange `json:"modules"`
+	Roles   []RoleChange   `json:"roles"`
+}
+
+func (p *Plan) Empty() bool {
+	return len(p.Modules) == 0 && len(p.Roles) == 0
+}
+
+// Parse разбирает манифест в YAML или JSON
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Manifest) validate() error {
+	modules := make(map[string]struct{}, len(m.Modules))
+	for _, module := range m.Modules {
+		if module.Module == "" {
+			return errors.New("manifest: module name cannot be empty")
+		}
+		if _, ok := modules[module.Module]; ok {
+			return fmt.Errorf("manifest: module %q declared twice", module.Module)
+		}
+		if len(module.Actions) == 0 {
+			return fmt.Errorf("manifest: module %q has no actions", module.Module)
+		}
+		modules[module.Module] = struct{}{}
+	}
+
+	roles := make(map[string]struct{}, len(m.Roles))
+	for _, role := range m.Roles {
+		if role.Name == "" || role.NameRu == "" {
+			return errors.New("manifest: role_name and role_name_ru cannot be empty")
+		}
+		if _, ok := roles[role.Name]; ok {
+			return fmt.Errorf("manifest: role %q declared twice", role.Name)
+		}
+		roles[role.Name] = struct{}{}
+	}
+	return nil
+}
+
+// ComputePlan сравнивает манифест с текущим состоянием. Без prune незадекларированные
+// модули, действия и роли сохраняются, с prune — удаляются.
+func ComputePlan(m *Manifest, current State, prune bool) (*Plan, error) {
+	plan := &Plan{Prune: prune, Modules: []ModuleChange{}, Roles: []RoleChange{}}
+
+	target := make(map[string][]string, len(m.Modules))
+	for _, module := range m.Modules {
+		after := normalize(module.Actions)
+		before, exists := current.Modules[module.Module]
+		if exists && !prune {
+			after = normalize(append(append([]string{}, before...), after...))
+		}
+		target[module.Module] = after
+
+		switch {
+		case !exists:
+			plan.Modules = append(plan.Modules, ModuleChange{Op: OpCreate, Module: module.Module, After: after})
+		case !reflect.DeepEqual(normalize(before), after):
+			plan.Modules = append(plan.Modules, ModuleChange{Op: OpUpdate, Module: module.Module, Before: before, After: after})
+		}
+	}
+	for module, before := range current.Modules {
+		if _, declared := target[module]; declared {
+			continue
+		}
+		if prune {
+			plan.Modules = append(plan.Modules, ModuleChange{Op: OpDelete, Module: module, Before: before})
+			continue
+		}
+		target[module] = before
+	}
+
+	catalog := make([]rightsDomain.Right, 0, len(target))
+	for module, actions := range target {
+		catalog = append(catalog, rightsDomain.Right{Module: module, Action: actions})
+	}
+	rightsCatalog := rightsDomain.NewCatalog(catalog)
+
+	declared := make(map[string]struct{}, len(m.Roles))
+	for _, role := range m.Roles {
+		if err := rightsCatalog.Validate(role.Rights); err != nil {
+			return nil, fmt.Errorf("role %q: %w", role.Name, err)
+		}
+		declared[role.Name] = struct{}{}
+
+		after := role
+		after.Rights = normalizeRights(role.Rights)
+		before, exists := current.Roles[role.Name]
+		switch {
+		case !exists:
+			plan.Roles = append(plan.Roles, RoleChange{Op: OpCreate, Name: role.Name, After: &after})
+		case before.NameRu != after.NameRu || before.Notes != after.Notes ||
+			!reflect.DeepEqual(normalizeRights(before.Rights), after.Rights):
+			before := before
+			plan.Roles = append(plan.Roles, RoleChange{Op: OpUpdate, Name: role.Name, Before: &before, After: &after})
+		}
+	}
+	if prune {
+		for name, role := range current.Roles {
+			if _, ok := declared[name]; !ok {
+				role := role
+				plan.Roles = append(plan.Roles, RoleChange{Op: OpDelete, Name: name, Before: &role})
+			}
+		}
+	}
+
+	sort.Slice(plan.Modules, func(i, j int) bool { return plan.Modules[i].Module < plan.Modules[j].Module })
+	sort.Slice(plan.Roles, func(i, j int) bool { return plan.Roles[i].Name < plan.Roles[j].Name })
+
+	return plan, nil
+}
+
+func normalize(actions []string) []string {
+	set := make(map[string]struct{}, len(actions))
+	result := make([]string, 0, len(actions))
+	for _, action := range actions {
+		if _, ok := set[action]; ok {
+			continue
+		}
+		set[action] = struct{}{}
+		result = append(result, action)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func normalizeRights(rights map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(rights))
+	for module, actions := range rightsDomain.NormalizeRights(rights) {
+		result[module] = normalize(actions)
+	}
+	return result
+}
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func currentState() State {
+	return State{
+		Modules: map[string][]string{
+			"orders":  {"read", "write"},
+			"reports": {"read"},
+		},
+		Roles: map[string]Role{
+			"cashier": {Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"write", "read"}}},
+			"auditor": {Name: "auditor", NameRu: "Аудитор", Rights: map[string][]string{"reports": {"read"}}},
+		},
+	}
+}
+
+func TestComputePlanNoChanges(t *testing.T) {
+	m := &Manifest{
+		Modules: []Module{{Module: "orders", Actions: []string{"write", "read", "read"}}},
+		Roles:   []Role{{Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{" orders ": {"read", "write"}}}},
+	}
+
+	plan, err := ComputePlan(m, currentState(), false)
+	if err != nil {
+		t.Fatalf("ComputePlan: %v", err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("plan is not empty: %+v", plan)
+	}
+}
+
+func TestComputePlanAdds(t *testing.T) {
+	m := &Manifest{
+		Modules: []Module{{Module: "refunds", Actions: []string{"approve", "read"}}},
+		Roles:   []Role{{Name: "refunder", NameRu: "Возвраты", Rights: map[string][]string{"refunds": {"approve"}}}},
+	}
+
+	plan, err := ComputePlan(m, currentState(), false)
+	if err != nil {
+		t.Fatalf("ComputePlan: %v", err)
+	}
+	wantModules := []ModuleChange{{Op: OpCreate, Module: "refunds", After: []string{"approve", "read"}}}
+	if !reflect.DeepEqual(plan.Modules, wantModules) {
+		t.Fatalf("modules = %+v, want %+v", plan.Modules, wantModules)
+	}
+	if len(plan.Roles) != 1 || plan.Roles[0].Op != OpCreate || plan.Roles[0].Name != "refunder" || plan.Roles[0].Before != nil {
+		t.Fatalf("roles = %+v, want create of refunder", plan.Roles)
+	}
+}
+
+func TestComputePlanChanges(t *testing.T) {
+	m := &Manifest{
+		Modules: []Module{{Module: "orders", Actions: []string{"cancel"}}},
+		Roles:   []Role{{Name: "cashier", NameRu: "Старший кассир", Rights: map[string][]string{"orders": {"read", "cancel"}}}},
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		plan, err := ComputePlan(m, currentState(), false)
+		if err != nil {
+			t.Fatalf("ComputePlan: %v", err)
+		}
+		wantModules := []ModuleChange{{Op: OpUpdate, Module: "orders", Before: []string{"read", "write"}, After: []string{"cancel", "read", "write"}}}
+		if !reflect.DeepEqual(plan.Modules, wantModules) {
+			t.Fatalf("modules = %+v, want %+v", plan.Modules, wantModules)
+		}
+		if len(plan.Roles) != 1 || plan.Roles[0].Op != OpUpdate {
+			t.Fatalf("roles = %+v, want update of cashier", plan.Roles)
+		}
+		change := plan.Roles[0]
+		if change.Before.NameRu != "Кассир" || change.After.NameRu != "Старший кассир" {
+			t.Fatalf("unexpected role change %+v -> %+v", *change.Before, *change.After)
+		}
+		if want := map[string][]string{"orders": {"cancel", "read"}}; !reflect.DeepEqual(change.After.Rights, want) {
+			t.Fatalf("role rights = %v, want %v", change.After.Rights, want)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		// С prune из каталога уходят незадекларированные действия, поэтому роль не может на них ссылаться
+		if _, err := ComputePlan(m, currentState(), true); err == nil {
+			t.Fatal("expected error for a role right removed by prune")
+		}
+
+		pruned := &Manifest{Modules: m.Modules, Roles: []Role{{Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"cancel"}}}}}
+		plan, err := ComputePlan(pruned, currentState(), true)
+		if err != nil {
+			t.Fatalf("ComputePlan: %v", err)
+		}
+		if len(plan.Modules) != 2 || plan.Modules[0].Op != OpUpdate || !reflect.DeepEqual(plan.Modules[0].After, []string{"cancel"}) {
+			t.Fatalf("modules = %+v, want orders replaced by [cancel]", plan.Modules)
+		}
+		if len(plan.Roles) != 2 || plan.Roles[0].Name != "auditor" || plan.Roles[1].Op != OpUpdate {
+			t.Fatalf("roles = %+v, want auditor deleted and cashier updated", plan.Roles)
+		}
+	})
+}
+
+func TestComputePlanRemoves(t *testing.T) {
+	m := &Manifest{
+		Modules: []Module{{Module: "orders", Actions: []string{"read", "write"}}},
+		Roles:   []Role{{Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"read", "write"}}}},
+	}
+
+	t.Run("without prune", func(t *testing.T) {
+		plan, err := ComputePlan(m, currentState(), false)
+		if err != nil {
+			t.Fatalf("ComputePlan: %v", err)
+		}
+		if !plan.Empty() {
+			t.Fatalf("undeclared entries must be kept without prune: %+v", plan)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		plan, err := ComputePlan(m, currentState(), true)
+		if err != nil {
+			t.Fatalf("ComputePlan: %v", err)
+		}
+		wantModules := []ModuleChange{{Op: OpDelete, Module: "reports", Before: []string{"read"}}}
+		if !reflect.DeepEqual(plan.Modules, wantModules) {
+			t.Fatalf("modules = %+v, want %+v", plan.Modules, wantModules)
+		}
+		if len(plan.Roles) != 1 || plan.Roles[0].Op != OpDelete || plan.Roles[0].Name != "auditor" || plan.Roles[0].After != nil {
+			t.Fatalf("roles = %+v, want delete of auditor", plan.Roles)
+		}
+	})
+}
+
+func TestComputePlanRejectsUnknownRights(t *testing.T) {
+	m := &Manifest{
+		Roles: []Role{{Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"refund"}}}},
+	}
+	if _, err := ComputePlan(m, currentState(), false); err == nil {
+		t.Fatal("expected error for an action missing from the catalog")
+	}
+}
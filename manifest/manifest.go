@@ -0,0 +1,24 @@
+package manifest
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/manifest/middleware"
+	"github.com/rafaceo/go-test-auth/manifest/repository/postgres"
+	"github.com/rafaceo/go-test-auth/manifest/service"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateManifestService(logger log.Logger, postgresClient *sqlx.DB) service.ManifestService {
+	manifestRepo := postgres.NewManifestRepository(postgresClient)
+	manifestServ := service.NewManifestService(manifestRepo, accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)))
+	manifestServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "manifest"), manifestServ)
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("manifest_service")
+	manifestServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, manifestServ)
+
+	return manifestServ
+}
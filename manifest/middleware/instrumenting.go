@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+	"github.com/rafaceo/go-test-auth/manifest/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.ManifestService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.ManifestService) service.ManifestService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) Plan(ctx context.Context, manifest *domain.Manifest, prune bool) (plan *domain.Plan, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Plan"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Plan(ctx, manifest, prune)
+}
+
+func (s *instrumentingService) Apply(ctx context.Context, manifest *domain.Manifest, prune bool) (plan *domain.Plan, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Apply"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Apply(ctx, manifest, prune)
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+	"github.com/rafaceo/go-test-auth/manifest/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.ManifestService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.ManifestService) service.ManifestService {
+	return &loggingService{logger, s}
+}
+
+func (l *loggingService) Plan(ctx context.Context, manifest *domain.Manifest, prune bool) (plan *domain.Plan, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Plan",
+			"prune", prune,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Plan(ctx, manifest, prune)
+}
+
+func (l *loggingService) Apply(ctx context.Context, manifest *domain.Manifest, prune bool) (plan *domain.Plan, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Apply",
+			"prune", prune,
+			"plan", plan,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Apply(ctx, manifest, prune)
+}
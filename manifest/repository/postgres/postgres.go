@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+	"github.com/rafaceo/go-test-auth/manifest/repository"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	rolesDomain "github.com/rafaceo/go-test-auth/roles/domain"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+	"strings"
+)
+
+type manifestRepository struct {
+	db *sqlx.DB
+}
+
+func NewManifestRepository(db *sqlx.DB) repository.ManifestRepository {
+	return &manifestRepository{db: db}
+}
+
+func (r *manifestRepository) LoadState(ctx context.Context) (domain.State, error) {
+	state := domain.State{
+		Modules: make(map[string][]string),
+		Roles:   make(map[string]domain.Role),
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT module, action FROM rights`)
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var module, actionRaw string
+		if err := rows.Scan(&module, &actionRaw); err != nil {
+			return state, err
+		}
+		state.Modules[module] = append(state.Modules[module], parseAction(actionRaw)...)
+	}
+	if err := rows.Err(); err != nil {
+		return state, err
+	}
+
+	roleRows, err := r.db.QueryContext(ctx, `SELECT role_name, role_name_ru, COALESCE(notes, ''), rights FROM roles`)
+	if err != nil {
+		return state, err
+	}
+	defer roleRows.Close()
+
+	for roleRows.Next() {
+		var role domain.Role
+		var rightsJSON []byte
+		if err := roleRows.Scan(&role.Name, &role.NameRu, &role.Notes, &rightsJSON); err != nil {
+			return state, err
+		}
+		if err := json.Unmarshal(rightsJSON, &role.Rights); err != nil {
+			return state, fmt.Errorf("failed to parse rights JSON of role %s: %v", role.Name, err)
+		}
+		state.Roles[role.Name] = role
+	}
+
+	return state, roleRows.Err()
+}
+
+// ApplyPlan применяет план в одной транзакции: любая ошибка откатывает все изменения
+func (r *manifestRepository) ApplyPlan(ctx context.Context, plan *domain.Plan) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range plan.Modules {
+		if change.Op == domain.OpUpdate || change.Op == domain.OpDelete {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM rights WHERE module = $1`, change.Module); err != nil {
+				return fmt.Errorf("module %s: %w", change.Module, err)
+			}
+		}
+		if change.Op == domain.OpCreate || change.Op == domain.OpUpdate {
+			query := `INSERT INTO rights (id, module, action, created_at, updated_at)
+			          VALUES ($1, $2, $3, now(), now())`
+			if _, err := tx.ExecContext(ctx, query, uuid.New().String(), change.Module, pq.Array(change.After)); err != nil {
+				return fmt.Errorf("module %s: %w", change.Module, err)
+			}
+		}
+	}
+
+	for _, change := range plan.Roles {
+		switch change.Op {
+		case domain.OpCreate:
+			rightsJSON, err := json.Marshal(change.After.Rights)
+			if err != nil {
+				return err
+			}
+			query := `INSERT INTO roles (role_name, role_name_ru, notes, rights) VALUES ($1, $2, $3, $4) RETURNING role_id`
+			var roleID int
+			if err := tx.QueryRowContext(ctx, query, change.Name, change.After.NameRu, change.After.Notes, rightsJSON).Scan(&roleID); err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+			if err := rolesPostgres.RecordVersion(ctx, tx, rolesDomain.Role{}, toRole(roleID, change.After)); err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+		case domain.OpUpdate:
+			rightsJSON, err := json.Marshal(change.After.Rights)
+			if err != nil {
+				return err
+			}
+			query := `UPDATE roles SET role_name_ru = $1, notes = $2, rights = $3 WHERE role_name = $4 RETURNING role_id`
+			var roleID int
+			if err := tx.QueryRowContext(ctx, query, change.After.NameRu, change.After.Notes, rightsJSON, change.Name).Scan(&roleID); err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+			if err := rolesPostgres.RecordVersion(ctx, tx, toRole(roleID, change.Before), toRole(roleID, change.After)); err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+		case domain.OpDelete:
+			var roleID int
+			var rightsJSON []byte
+			err := tx.QueryRowContext(ctx, `DELETE FROM roles WHERE role_name = $1 RETURNING role_id, rights`, change.Name).
+				Scan(&roleID, &rightsJSON)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+			payload := outboxDomain.RoleChangedPayload{
+				RoleID:   roleID,
+				RoleName: change.Name,
+				Change:   outboxDomain.RoleDeleted,
+				Modules:  rolesPostgres.RightsModules(rightsJSON),
+			}
+			if err := rolesPostgres.AppendRoleEvent(ctx, tx, payload); err != nil {
+				return fmt.Errorf("role %s: %w", change.Name, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func toRole(roleID int, role *domain.Role) rolesDomain.Role {
+	return rolesDomain.Role{
+		ID:     roleID,
+		Name:   role.Name,
+		NameRu: role.NameRu,
+		Notes:  role.Notes,
+		Rights: role.Rights,
+	}
+}
+
+func parseAction(actionRaw string) []string {
+	actionRaw = strings.Trim(actionRaw, "{}[]")
+	actionRaw = strings.ReplaceAll(actionRaw, `"`, "")
+
+	if actionRaw == "" {
+		return []string{}
+	}
+
+	return strings.Split(actionRaw, ",")
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+)
+
+type ManifestRepository interface {
+	LoadState(ctx context.Context) (domain.State, error)
+	ApplyPlan(ctx context.Context, plan *domain.Plan) error
+}
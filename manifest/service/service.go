@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+	"github.com/rafaceo/go-test-auth/manifest/repository"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+)
+
+type ManifestService interface {
+	Plan(ctx context.Context, manifest *domain.Manifest, prune bool) (*domain.Plan, error)
+	Apply(ctx context.Context, manifest *domain.Manifest, prune bool) (*domain.Plan, error)
+}
+
+// SensitiveGuard проверяет, что выдаваемые права не относятся к чувствительным модулям
+type SensitiveGuard interface {
+	CheckDirectGrant(ctx context.Context, rights map[string][]string) error
+}
+
+type manifestService struct {
+	repo  repository.ManifestRepository
+	guard SensitiveGuard
+}
+
+// NewManifestService создаёт сервис синхронизации прав и ролей с манифестом
+func NewManifestService(repo repository.ManifestRepository, guard SensitiveGuard) ManifestService {
+	return &manifestService{repo: repo, guard: guard}
+}
+
+func (s *manifestService) Plan(ctx context.Context, manifest *domain.Manifest, prune bool) (*domain.Plan, error) {
+	if manifest == nil {
+		return nil, errors.New("manifest cannot be empty")
+	}
+
+	state, err := s.repo.LoadState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.ComputePlan(manifest, state, prune)
+}
+
+func (s *manifestService) Apply(ctx context.Context, manifest *domain.Manifest, prune bool) (*domain.Plan, error) {
+	plan, err := s.Plan(ctx, manifest, prune)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Empty() {
+		return plan, nil
+	}
+	if err := s.checkRoleChanges(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ApplyPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// checkRoleChanges применяет к изменённым ролям то же правило, что и правка роли через API:
+// чувствительные модули, которых у роли ещё не было, сразу получили бы все её владельцы.
+// Новые роли ещё никому не назначены, их права проверяются при назначении.
+func (s *manifestService) checkRoleChanges(ctx context.Context, plan *domain.Plan) error {
+	var added []map[string][]string
+	for _, change := range plan.Roles {
+		if change.Op == domain.OpUpdate {
+			added = append(added, rightsDomain.DiffRights(change.Before.Rights, change.After.Rights).Added)
+		}
+	}
+	if rights := rightsDomain.MergeRights(added...); len(rights) > 0 {
+		return s.guard.CheckDirectGrant(ctx, rights)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+)
+
+type memoryManifest struct {
+	state   domain.State
+	applied *domain.Plan
+}
+
+func (r *memoryManifest) LoadState(context.Context) (domain.State, error) {
+	return r.state, nil
+}
+
+func (r *memoryManifest) ApplyPlan(_ context.Context, plan *domain.Plan) error {
+	r.applied = plan
+	return nil
+}
+
+var errSensitive = errors.New("sensitive module")
+
+// sensitiveModules запоминает проверенные права и отказывает, если среди них есть модуль payments
+type sensitiveModules struct {
+	checked []map[string][]string
+}
+
+func (g *sensitiveModules) CheckDirectGrant(_ context.Context, rights map[string][]string) error {
+	g.checked = append(g.checked, rights)
+	if _, ok := rights["payments"]; ok {
+		return errSensitive
+	}
+	return nil
+}
+
+func newManifestTest() (*memoryManifest, *sensitiveModules, ManifestService) {
+	repo := &memoryManifest{state: domain.State{
+		Modules: map[string][]string{"orders": {"read", "write"}, "payments": {"refund"}},
+		Roles: map[string]domain.Role{
+			"cashier": {Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"read"}}},
+			"finance": {Name: "finance", NameRu: "Финансы", Rights: map[string][]string{"payments": {"refund"}}},
+		},
+	}}
+	guard := &sensitiveModules{}
+	return repo, guard, NewManifestService(repo, guard)
+}
+
+func TestApplyRefusesSensitiveRightsAddedToRole(t *testing.T) {
+	repo, _, s := newManifestTest()
+	m := &domain.Manifest{Roles: []domain.Role{
+		{Name: "cashier", NameRu: "Кассир", Rights: map[string][]string{"orders": {"read"}, "payments": {"refund"}}},
+	}}
+
+	if _, err := s.Apply(context.Background(), m, false); !errors.Is(err, errSensitive) {
+		t.Fatalf("error = %v, want %v", err, errSensitive)
+	}
+	if repo.applied != nil {
+		t.Fatal("plan was applied despite the guard")
+	}
+}
+
+func TestApplyChecksOnlyAddedRights(t *testing.T) {
+	repo, guard, s := newManifestTest()
+	// Роль finance уже владеет payments, новая роль ещё никому не назначена
+	m := &domain.Manifest{Roles: []domain.Role{
+		{Name: "finance", NameRu: "Финансы", Rights: map[string][]string{"payments": {"refund"}, "orders": {"read"}}},
+		{Name: "refunds", NameRu: "Возвраты", Rights: map[string][]string{"payments": {"refund"}}},
+	}}
+
+	if _, err := s.Apply(context.Background(), m, false); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if want := []map[string][]string{{"orders": {"read"}}}; !reflect.DeepEqual(guard.checked, want) {
+		t.Fatalf("checked %v, want %v", guard.checked, want)
+	}
+	if repo.applied == nil || len(repo.applied.Roles) != 2 {
+		t.Fatalf("applied plan %+v, want two role changes", repo.applied)
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/manifest/domain"
+	"github.com/rafaceo/go-test-auth/manifest/service"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// GetManifestHandlers: apply пишет версии ролей с автором, поэтому требует access_token в Authorization: Bearer
+func GetManifestHandlers(serv service.ManifestService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+
+	planHandler := kithttp.NewServer(
+		MakePlanEndpoint(serv),
+		DecodeManifestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	applyHandler := kithttp.NewServer(
+		authn.Middleware(tokens)(MakeApplyEndpoint(serv)),
+		DecodeManifestRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/manifest/plan",
+			Handler: planHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/manifest/apply",
+			Handler: applyHandler,
+			Methods: []string{"POST"},
+		},
+	}
+}
+
+type ManifestRequest struct {
+	Manifest *domain.Manifest
+	Prune    bool
+}
+
+type ManifestResponse struct {
+	Plan  *domain.Plan `json:"plan,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+func MakePlanEndpoint(svc service.ManifestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ManifestRequest)
+		plan, err := svc.Plan(ctx, req.Manifest, req.Prune)
+		if err != nil {
+			return ManifestResponse{Error: err.Error()}, nil
+		}
+		return ManifestResponse{Plan: plan}, nil
+	}
+}
+
+func MakeApplyEndpoint(svc service.ManifestService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ManifestRequest)
+		plan, err := svc.Apply(ctx, req.Manifest, req.Prune)
+		if err != nil {
+			return ManifestResponse{Error: err.Error()}, nil
+		}
+		return ManifestResponse{Plan: plan}, nil
+	}
+}
+
+// DecodeManifestRequest принимает манифест в YAML или JSON, prune передаётся в query
+func DecodeManifestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req ManifestRequest
+
+	if prune := r.URL.Query().Get("prune"); prune != "" {
+		value, err := strconv.ParseBool(prune)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prune: %v", err)
+		}
+		req.Prune = value
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	req.Manifest, err = domain.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// Уровни иерархии сверху вниз: группа объединяет бренды, бренд — филиалы
+const (
+	KindGroup  = "group"
+	KindBrand  = "brand"
+	KindBranch = "branch"
+)
+
+var kindLevels = map[string]int{KindGroup: 0, KindBrand: 1, KindBranch: 2}
+
+var (
+	ErrMerchantNotFound    = errors.New("мерчант не найден")
+	ErrMerchantSuspended   = errors.New("мерчант приостановлен")
+	ErrMerchantCycle       = errors.New("мерчант не может быть вложен в собственного потомка")
+	ErrMerchantHasChildren = errors.New("у мерчанта есть дочерние мерчанты")
+	ErrMerchantInUse       = errors.New("мерчант используется в контекстах пользователей")
+)
+
+// Merchant — узел реестра. Контекст, выданный на узел, открывает доступ ко всем его потомкам.
+type Merchant struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Kind      string    `json:"kind" db:"kind"`
+	Status    string    `json:"status" db:"status"`
+	ParentID  *string   `json:"parent_id,omitempty" db:"parent_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (m Merchant) Validate() error {
+	if m.ID == "" {
+		return errors.New("id is required")
+	}
+	if m.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, ok := kindLevels[m.Kind]; !ok {
+		return errors.New("kind must be group, brand or branch")
+	}
+	if m.Status != StatusActive && m.Status != StatusSuspended {
+		return errors.New("status must be active or suspended")
+	}
+	if m.ParentID != nil && *m.ParentID == m.ID {
+		return ErrMerchantCycle
+	}
+	return nil
+}
+
+// CanContain сообщает, может ли узел быть родителем узла вида kind: родитель стоит выше по иерархии
+func (m Merchant) CanContain(kind string) bool {
+	return kindLevels[m.Kind] < kindLevels[kind]
+}
+
+// MerchantPatch — изменение мерчанта; nil оставляет значение без изменений, пустой ParentID делает узел корневым
+type MerchantPatch struct {
+	Name     *string
+	Kind     *string
+	Status   *string
+	ParentID *string
+}
+
+// Filter — условия выборки реестра. Пустые поля не ограничивают выборку.
+type Filter struct {
+	ParentID string
+	// RootsOnly выбирает только корневые узлы
+	RootsOnly bool
+	Status    string
+	Kind      string
+}
@@ -0,0 +1,24 @@
+package merchants
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/merchants/middleware"
+	"github.com/rafaceo/go-test-auth/merchants/repository/postgres"
+	"github.com/rafaceo/go-test-auth/merchants/service"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateMerchantService(logger log.Logger, postgresClient *sqlx.DB) service.MerchantService {
+	merchantServ := service.NewMerchantService(postgres.NewMerchantRepository(postgresClient))
+	merchantServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), merchantServ)
+	merchantServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "merchants"), merchantServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("merchant_service")
+	merchantServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, merchantServ)
+
+	return merchantServ
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/service"
+)
+
+// auditingService записывает в журнал аудита изменения реестра мерчантов
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.MerchantService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.MerchantService) service.MerchantService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, auditDomain.TargetMerchant, targetID, before, after))
+}
+
+// snapshot возвращает мерчанта или nil, если его не удалось прочитать
+func (a *auditingService) snapshot(ctx context.Context, id string) *domain.Merchant {
+	merchant, err := a.next.GetMerchant(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return merchant
+}
+
+func (a *auditingService) CreateMerchant(ctx context.Context, merchant domain.Merchant) (*domain.Merchant, error) {
+	created, err := a.next.CreateMerchant(ctx, merchant)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "merchant.create", created.ID, nil, created)
+	return created, nil
+}
+
+func (a *auditingService) GetMerchant(ctx context.Context, id string) (*domain.Merchant, error) {
+	return a.next.GetMerchant(ctx, id)
+}
+
+func (a *auditingService) ListMerchants(ctx context.Context, filter domain.Filter) ([]domain.Merchant, error) {
+	return a.next.ListMerchants(ctx, filter)
+}
+
+func (a *auditingService) GetDescendants(ctx context.Context, id string) ([]domain.Merchant, error) {
+	return a.next.GetDescendants(ctx, id)
+}
+
+func (a *auditingService) UpdateMerchant(ctx context.Context, id string, patch domain.MerchantPatch) (*domain.Merchant, error) {
+	before := a.snapshot(ctx, id)
+	updated, err := a.next.UpdateMerchant(ctx, id, patch)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "merchant.update", id, before, updated)
+	return updated, nil
+}
+
+func (a *auditingService) DeleteMerchant(ctx context.Context, id string) error {
+	before := a.snapshot(ctx, id)
+	if err := a.next.DeleteMerchant(ctx, id); err != nil {
+		return err
+	}
+	a.record(ctx, "merchant.delete", id, before, nil)
+	return nil
+}
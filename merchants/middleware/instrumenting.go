@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.MerchantService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.MerchantService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateMerchant(ctx context.Context, merchant domain.Merchant) (created *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateMerchant"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateMerchant(ctx, merchant)
+}
+
+func (s *instrumentingService) GetMerchant(ctx context.Context, id string) (merchant *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetMerchant"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetMerchant(ctx, id)
+}
+
+func (s *instrumentingService) ListMerchants(ctx context.Context, filter domain.Filter) (merchants []domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListMerchants"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListMerchants(ctx, filter)
+}
+
+func (s *instrumentingService) GetDescendants(ctx context.Context, id string) (merchants []domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetDescendants"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetDescendants(ctx, id)
+}
+
+func (s *instrumentingService) UpdateMerchant(ctx context.Context, id string, patch domain.MerchantPatch) (merchant *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "UpdateMerchant"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.UpdateMerchant(ctx, id, patch)
+}
+
+func (s *instrumentingService) DeleteMerchant(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteMerchant"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteMerchant(ctx, id)
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.MerchantService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.MerchantService) service.MerchantService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateMerchant(ctx context.Context, merchant domain.Merchant) (created *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateMerchant",
+			"took", time.Since(begin),
+			"id", merchant.ID,
+			"kind", merchant.Kind,
+			"parentID", merchant.ParentID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateMerchant(ctx, merchant)
+}
+
+func (l loggingService) GetMerchant(ctx context.Context, id string) (merchant *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetMerchant",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetMerchant(ctx, id)
+}
+
+func (l loggingService) ListMerchants(ctx context.Context, filter domain.Filter) (merchants []domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListMerchants",
+			"took", time.Since(begin),
+			"parentID", filter.ParentID,
+			"status", filter.Status,
+			"count", len(merchants),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListMerchants(ctx, filter)
+}
+
+func (l loggingService) GetDescendants(ctx context.Context, id string) (merchants []domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetDescendants",
+			"took", time.Since(begin),
+			"id", id,
+			"count", len(merchants),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetDescendants(ctx, id)
+}
+
+func (l loggingService) UpdateMerchant(ctx context.Context, id string, patch domain.MerchantPatch) (merchant *domain.Merchant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "UpdateMerchant",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.UpdateMerchant(ctx, id, patch)
+}
+
+func (l loggingService) DeleteMerchant(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteMerchant",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteMerchant(ctx, id)
+}
@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/repository"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+)
+
+const merchantColumns = `id, name, kind, status, parent_id, created_at, updated_at`
+
+type merchantRepository struct {
+	db *sqlx.DB
+}
+
+func NewMerchantRepository(db *sqlx.DB) repository.MerchantRepository {
+	return &merchantRepository{db: db}
+}
+
+func (r *merchantRepository) CreateMerchant(ctx context.Context, merchant domain.Merchant) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO merchants (id, name, kind, status, parent_id, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $6)`
+	_, err = tx.ExecContext(ctx, query, merchant.ID, merchant.Name, merchant.Kind, merchant.Status, merchant.ParentID,
+		merchant.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := appendEvent(ctx, tx, merchant, outboxDomain.MerchantCreated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *merchantRepository) GetMerchant(ctx context.Context, id string) (*domain.Merchant, error) {
+	var merchant domain.Merchant
+	err := r.db.GetContext(ctx, &merchant, `SELECT `+merchantColumns+` FROM merchants WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrMerchantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+func (r *merchantRepository) ListMerchants(ctx context.Context, filter domain.Filter) ([]domain.Merchant, error) {
+	query := `SELECT ` + merchantColumns + `
+	          FROM merchants
+	          WHERE ($1::text = '' OR parent_id = $1::text)
+	            AND (NOT $2::boolean OR parent_id IS NULL)
+	            AND ($3::text = '' OR status = $3::text)
+	            AND ($4::text = '' OR kind = $4::text)
+	          ORDER BY id`
+
+	merchants := []domain.Merchant{}
+	err := r.db.SelectContext(ctx, &merchants, query, filter.ParentID, filter.RootsOnly, filter.Status, filter.Kind)
+	if err != nil {
+		return nil, err
+	}
+	return merchants, nil
+}
+
+func (r *merchantRepository) GetDescendants(ctx context.Context, id string) ([]domain.Merchant, error) {
+	query := `WITH RECURSIVE subtree AS (
+	              SELECT ` + merchantColumns + `, ARRAY[id] AS path
+	              FROM merchants
+	              WHERE parent_id = $1
+	              UNION ALL
+	              SELECT m.id, m.name, m.kind, m.status, m.parent_id, m.created_at, m.updated_at, s.path || m.id
+	              FROM merchants m
+	              JOIN subtree s ON m.parent_id = s.id
+	              WHERE NOT m.id = ANY (s.path)
+	          )
+	          SELECT ` + merchantColumns + ` FROM subtree ORDER BY path`
+
+	merchants := []domain.Merchant{}
+	if err := r.db.SelectContext(ctx, &merchants, query, id); err != nil {
+		return nil, err
+	}
+	return merchants, nil
+}
+
+func (r *merchantRepository) UpdateMerchant(ctx context.Context, merchant domain.Merchant) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if merchant.ParentID != nil {
+		// Родитель не может оказаться в поддереве узла: поднимаемся от нового родителя к корню
+		var cycle bool
+		query := `WITH RECURSIVE ancestors AS (
+		              SELECT id, parent_id, ARRAY[id] AS path FROM merchants WHERE id = $1
+		              UNION ALL
+		              SELECT m.id, m.parent_id, a.path || m.id
+		              FROM merchants m
+		              JOIN ancestors a ON m.id = a.parent_id
+		              WHERE NOT m.id = ANY (a.path)
+		          )
+		          SELECT EXISTS(SELECT 1 FROM ancestors WHERE id = $2)`
+		if err := tx.QueryRowContext(ctx, query, *merchant.ParentID, merchant.ID).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return domain.ErrMerchantCycle
+		}
+	}
+
+	query := `UPDATE merchants
+	          SET name = $2, kind = $3, status = $4, parent_id = $5, updated_at = $6
+	          WHERE id = $1`
+	result, err := tx.ExecContext(ctx, query, merchant.ID, merchant.Name, merchant.Kind, merchant.Status,
+		merchant.ParentID, merchant.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrMerchantNotFound
+	}
+
+	if err := appendEvent(ctx, tx, merchant, outboxDomain.MerchantUpdated); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *merchantRepository) DeleteMerchant(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var merchant domain.Merchant
+	err = tx.GetContext(ctx, &merchant, `SELECT `+merchantColumns+` FROM merchants WHERE id = $1 FOR UPDATE`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrMerchantNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var hasChildren, inUse bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM merchants WHERE parent_id = $1),
+	                                      EXISTS(SELECT 1 FROM users_contexts WHERE merchant_id = $1)`, id).
+		Scan(&hasChildren, &inUse)
+	if err != nil {
+		return err
+	}
+	if hasChildren {
+		return domain.ErrMerchantHasChildren
+	}
+	if inUse {
+		return domain.ErrMerchantInUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM merchants WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	if err := appendEvent(ctx, tx, merchant, outboxDomain.MerchantDeleted); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, merchant domain.Merchant, change string) error {
+	payload := outboxDomain.MerchantChangedPayload{
+		MerchantID: merchant.ID,
+		Change:     change,
+		Status:     merchant.Status,
+	}
+	if merchant.ParentID != nil {
+		payload.ParentID = *merchant.ParentID
+	}
+
+	event, err := outboxDomain.NewEvent(outboxDomain.MerchantChanged, outboxDomain.AggregateMerchant, merchant.ID, payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+)
+
+type MerchantRepository interface {
+	CreateMerchant(ctx context.Context, merchant domain.Merchant) error
+	GetMerchant(ctx context.Context, id string) (*domain.Merchant, error)
+	ListMerchants(ctx context.Context, filter domain.Filter) ([]domain.Merchant, error)
+	// GetDescendants возвращает всё поддерево узла без него самого, независимо от статуса
+	GetDescendants(ctx context.Context, id string) ([]domain.Merchant, error)
+	// UpdateMerchant отказывает с ErrMerchantCycle, если новый родитель лежит в поддереве узла
+	UpdateMerchant(ctx context.Context, merchant domain.Merchant) error
+	// DeleteMerchant удаляет только лист, на который не выданы контексты
+	DeleteMerchant(ctx context.Context, id string) error
+}
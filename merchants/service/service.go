@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/repository"
+)
+
+type MerchantService interface {
+	CreateMerchant(ctx context.Context, merchant domain.Merchant) (*domain.Merchant, error)
+	GetMerchant(ctx context.Context, id string) (*domain.Merchant, error)
+	ListMerchants(ctx context.Context, filter domain.Filter) ([]domain.Merchant, error)
+	GetDescendants(ctx context.Context, id string) ([]domain.Merchant, error)
+	UpdateMerchant(ctx context.Context, id string, patch domain.MerchantPatch) (*domain.Merchant, error)
+	DeleteMerchant(ctx context.Context, id string) error
+}
+
+type merchantService struct {
+	repo repository.MerchantRepository
+}
+
+func NewMerchantService(repo repository.MerchantRepository) MerchantService {
+	return &merchantService{repo: repo}
+}
+
+func (s *merchantService) CreateMerchant(ctx context.Context, merchant domain.Merchant) (*domain.Merchant, error) {
+	if merchant.Kind == "" {
+		merchant.Kind = domain.KindBranch
+	}
+	if merchant.Status == "" {
+		merchant.Status = domain.StatusActive
+	}
+	if merchant.ParentID != nil && *merchant.ParentID == "" {
+		merchant.ParentID = nil
+	}
+	if err := merchant.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, merchant); err != nil {
+		return nil, err
+	}
+
+	merchant.CreatedAt = time.Now().UTC()
+	merchant.UpdatedAt = merchant.CreatedAt
+	if err := s.repo.CreateMerchant(ctx, merchant); err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+func (s *merchantService) GetMerchant(ctx context.Context, id string) (*domain.Merchant, error) {
+	return s.repo.GetMerchant(ctx, id)
+}
+
+func (s *merchantService) ListMerchants(ctx context.Context, filter domain.Filter) ([]domain.Merchant, error) {
+	return s.repo.ListMerchants(ctx, filter)
+}
+
+func (s *merchantService) GetDescendants(ctx context.Context, id string) ([]domain.Merchant, error) {
+	if _, err := s.repo.GetMerchant(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDescendants(ctx, id)
+}
+
+func (s *merchantService) UpdateMerchant(ctx context.Context, id string, patch domain.MerchantPatch) (*domain.Merchant, error) {
+	merchant, err := s.repo.GetMerchant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		merchant.Name = *patch.Name
+	}
+	if patch.Kind != nil {
+		merchant.Kind = *patch.Kind
+	}
+	if patch.Status != nil {
+		merchant.Status = *patch.Status
+	}
+	if patch.ParentID != nil {
+		merchant.ParentID = patch.ParentID
+		if *patch.ParentID == "" {
+			merchant.ParentID = nil
+		}
+	}
+	if err := merchant.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, *merchant); err != nil {
+		return nil, err
+	}
+	if patch.Kind != nil {
+		if err := s.checkChildren(ctx, *merchant); err != nil {
+			return nil, err
+		}
+	}
+
+	merchant.UpdatedAt = time.Now().UTC()
+	if err := s.repo.UpdateMerchant(ctx, *merchant); err != nil {
+		return nil, err
+	}
+	return merchant, nil
+}
+
+func (s *merchantService) DeleteMerchant(ctx context.Context, id string) error {
+	return s.repo.DeleteMerchant(ctx, id)
+}
+
+// checkParent проверяет, что родитель существует и стоит выше узла по иерархии
+func (s *merchantService) checkParent(ctx context.Context, merchant domain.Merchant) error {
+	if merchant.ParentID == nil {
+		return nil
+	}
+	parent, err := s.repo.GetMerchant(ctx, *merchant.ParentID)
+	if err != nil {
+		if errors.Is(err, domain.ErrMerchantNotFound) {
+			return errors.New("родительский мерчант не найден")
+		}
+		return err
+	}
+	if !parent.CanContain(merchant.Kind) {
+		return errors.New("родитель должен стоять выше по иерархии: group > brand > branch")
+	}
+	return nil
+}
+
+// checkChildren не даёт сменить вид узла так, что прямые потомки окажутся не ниже его
+func (s *merchantService) checkChildren(ctx context.Context, merchant domain.Merchant) error {
+	children, err := s.repo.ListMerchants(ctx, domain.Filter{ParentID: merchant.ID})
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if !merchant.CanContain(child.Kind) {
+			return errors.New("дочерние мерчанты должны стоять ниже по иерархии: group > brand > branch")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/merchants/domain"
+	"github.com/rafaceo/go-test-auth/merchants/service"
+	"github.com/rafaceo/go-test-auth/merchants/transport"
+	"net/http"
+)
+
+// GetMerchantHandlers: изменения мерчантов попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetMerchantHandlers(serv service.MerchantService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	authenticated := authn.Middleware(tokens)
+
+	createHandler := kithttp.NewServer(
+		authenticated(MakeCreateMerchantEndpoint(serv)),
+		DecodeCreateMerchantRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listHandler := kithttp.NewServer(
+		MakeListMerchantsEndpoint(serv),
+		DecodeListMerchantsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetMerchantEndpoint(serv),
+		DecodeMerchantIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	descendantsHandler := kithttp.NewServer(
+		MakeGetDescendantsEndpoint(serv),
+		DecodeMerchantIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	updateHandler := kithttp.NewServer(
+		authenticated(MakeUpdateMerchantEndpoint(serv)),
+		DecodeUpdateMerchantRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteHandler := kithttp.NewServer(
+		authenticated(MakeDeleteMerchantEndpoint(serv)),
+		DecodeMerchantIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/merchants",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/merchants",
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/merchants/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/merchants/{id}/descendants",
+			Handler: descendantsHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/merchants/{id}",
+			Handler: updateHandler,
+			Methods: []string{"PATCH"},
+		},
+		{
+			Path:    "/api/v4/merchants/{id}",
+			Handler: deleteHandler,
+			Methods: []string{"DELETE"},
+		},
+	}
+}
+
+func MakeCreateMerchantEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateMerchantRequest)
+		merchant, err := svc.CreateMerchant(ctx, domain.Merchant{
+			ID:       req.ID,
+			Name:     req.Name,
+			Kind:     req.Kind,
+			Status:   req.Status,
+			ParentID: req.ParentID,
+		})
+		if err != nil {
+			return transport.MerchantResponse{Error: err.Error()}, nil
+		}
+		return transport.MerchantResponse{Merchant: merchant}, nil
+	}
+}
+
+func MakeListMerchantsEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter := request.(domain.Filter)
+		merchants, err := svc.ListMerchants(ctx, filter)
+		if err != nil {
+			return transport.ListMerchantsResponse{Error: err.Error()}, nil
+		}
+		return transport.ListMerchantsResponse{Merchants: merchants}, nil
+	}
+}
+
+func MakeGetMerchantEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.MerchantIDRequest)
+		merchant, err := svc.GetMerchant(ctx, req.ID)
+		if err != nil {
+			return transport.MerchantResponse{Error: err.Error()}, nil
+		}
+		return transport.MerchantResponse{Merchant: merchant}, nil
+	}
+}
+
+func MakeGetDescendantsEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.MerchantIDRequest)
+		merchants, err := svc.GetDescendants(ctx, req.ID)
+		if err != nil {
+			return transport.ListMerchantsResponse{Error: err.Error()}, nil
+		}
+		return transport.ListMerchantsResponse{Merchants: merchants}, nil
+	}
+}
+
+func MakeUpdateMerchantEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.UpdateMerchantRequest)
+		merchant, err := svc.UpdateMerchant(ctx, req.ID, domain.MerchantPatch{
+			Name:     req.Name,
+			Kind:     req.Kind,
+			Status:   req.Status,
+			ParentID: req.ParentID,
+		})
+		if err != nil {
+			return transport.MerchantResponse{Error: err.Error()}, nil
+		}
+		return transport.MerchantResponse{Merchant: merchant}, nil
+	}
+}
+
+func MakeDeleteMerchantEndpoint(svc service.MerchantService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.MerchantIDRequest)
+		if err := svc.DeleteMerchant(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Мерчант удалён"}, nil
+	}
+}
+
+func DecodeCreateMerchantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.CreateMerchantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// DecodeListMerchantsRequest читает фильтры из query: parent_id, roots=true, status, kind
+func DecodeListMerchantsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	return domain.Filter{
+		ParentID:  query.Get("parent_id"),
+		RootsOnly: query.Get("roots") == "true",
+		Status:    query.Get("status"),
+		Kind:      query.Get("kind"),
+	}, nil
+}
+
+func DecodeMerchantIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		return nil, errors.New("missing merchant ID")
+	}
+	return transport.MerchantIDRequest{ID: id}, nil
+}
+
+func DecodeUpdateMerchantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		return nil, errors.New("missing merchant ID")
+	}
+
+	var req transport.UpdateMerchantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.ID = id
+
+	return req, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
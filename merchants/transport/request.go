@@ -0,0 +1,22 @@
+package transport
+
+type CreateMerchantRequest struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Kind     string  `json:"kind,omitempty"`
+	Status   string  `json:"status,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+type MerchantIDRequest struct {
+	ID string `json:"-"`
+}
+
+// UpdateMerchantRequest — поля, которых нет в теле, не меняются; пустой parent_id делает мерчанта корневым
+type UpdateMerchantRequest struct {
+	ID       string  `json:"-"`
+	Name     *string `json:"name,omitempty"`
+	Kind     *string `json:"kind,omitempty"`
+	Status   *string `json:"status,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
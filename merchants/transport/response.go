@@ -0,0 +1,18 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/merchants/domain"
+
+type MerchantResponse struct {
+	Merchant *domain.Merchant `json:"merchant,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type ListMerchantsResponse struct {
+	Merchants []domain.Merchant `json:"merchants"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
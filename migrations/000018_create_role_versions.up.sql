@@ -0,0 +1,23 @@
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS current_version INT NOT NULL DEFAULT 0;
+
+-- Версии не ссылаются на roles внешним ключом, чтобы история переживала удаление роли
+CREATE TABLE IF NOT EXISTS role_versions (
+                                             role_id INT NOT NULL,
+                                             version INT NOT NULL,
+                                             role_name TEXT NOT NULL,
+                                             role_name_ru TEXT NOT NULL,
+                                             notes TEXT,
+                                             rights JSONB NOT NULL,
+                                             author VARCHAR(255) NOT NULL DEFAULT '',
+                                             diff JSONB NOT NULL DEFAULT '{}',
+                                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                             PRIMARY KEY (role_id, version)
+);
+
+-- Начальная версия для уже существующих ролей
+INSERT INTO role_versions (role_id, version, role_name, role_name_ru, notes, rights, author)
+SELECT role_id, 1, role_name, role_name_ru, notes, rights, 'migration'
+FROM roles
+WHERE current_version = 0;
+
+UPDATE roles SET current_version = 1 WHERE current_version = 0;
@@ -0,0 +1,22 @@
+-- Срок действия прямых прав из users.rights; строки нет — право бессрочное
+CREATE TABLE IF NOT EXISTS users_rights_validity (
+                                                     user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                                                     module VARCHAR(255) NOT NULL,
+                                                     action VARCHAR(255) NOT NULL,
+                                                     valid_from TIMESTAMP,
+                                                     valid_until TIMESTAMP,
+                                                     PRIMARY KEY (user_id, module, action)
+);
+
+CREATE INDEX IF NOT EXISTS users_rights_validity_valid_until_idx ON users_rights_validity (valid_until);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+                                           user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                                           role_id INT NOT NULL REFERENCES roles (role_id) ON DELETE CASCADE,
+                                           valid_from TIMESTAMP,
+                                           valid_until TIMESTAMP,
+                                           granted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                           PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS users_roles_valid_until_idx ON users_roles (valid_until);
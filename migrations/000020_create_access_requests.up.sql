@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS access_requests (
+                                               id UUID PRIMARY KEY,
+                                               user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                                               role_id INT REFERENCES roles (role_id) ON DELETE CASCADE,
+                                               rights JSONB,
+                                               merchant_id VARCHAR(255) NOT NULL DEFAULT '',
+                                               justification TEXT NOT NULL,
+                                               status VARCHAR(16) NOT NULL DEFAULT 'pending',
+                                               required_approvals INT NOT NULL DEFAULT 1,
+                                               requested_by VARCHAR(255) NOT NULL DEFAULT '',
+                                               error TEXT NOT NULL DEFAULT '',
+                                               valid_from TIMESTAMP,
+                                               valid_until TIMESTAMP,
+                                               created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                               resolved_at TIMESTAMP,
+                                               CHECK (role_id IS NOT NULL OR rights IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS access_requests_status_idx ON access_requests (status);
+CREATE INDEX IF NOT EXISTS access_requests_user_id_idx ON access_requests (user_id);
+
+-- Один одобряющий — одно решение по заявке
+CREATE TABLE IF NOT EXISTS access_request_decisions (
+                                                        request_id UUID NOT NULL REFERENCES access_requests (id) ON DELETE CASCADE,
+                                                        approver_id UUID NOT NULL,
+                                                        approved BOOLEAN NOT NULL,
+                                                        comment TEXT NOT NULL DEFAULT '',
+                                                        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                                        PRIMARY KEY (request_id, approver_id)
+);
+
+CREATE TABLE IF NOT EXISTS access_approvers (
+                                                id SERIAL PRIMARY KEY,
+                                                role_id INT REFERENCES roles (role_id) ON DELETE CASCADE,
+                                                merchant_id VARCHAR(255),
+                                                CHECK (role_id IS NOT NULL OR merchant_id IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS sensitive_modules (
+                                                 module VARCHAR(255) PRIMARY KEY,
+                                                 required_approvals INT NOT NULL DEFAULT 2 CHECK (required_approvals >= 2)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+                                            id BIGSERIAL PRIMARY KEY,
+                                            actor VARCHAR(255) NOT NULL DEFAULT '',
+                                            action VARCHAR(64) NOT NULL,
+                                            target_type VARCHAR(32) NOT NULL,
+                                            target_id VARCHAR(255) NOT NULL,
+                                            before JSONB,
+                                            after JSONB,
+                                            diff JSONB,
+                                            request_id VARCHAR(64) NOT NULL DEFAULT '',
+                                            source_ip VARCHAR(64) NOT NULL DEFAULT '',
+                                            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
@@ -0,0 +1,11 @@
+-- События, записанные до включения цепочки, остаются без хеша; цепочка начинается с первого хешированного
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+                                                 id BIGSERIAL PRIMARY KEY,
+                                                 event_id BIGINT NOT NULL,
+                                                 hash VARCHAR(64) NOT NULL,
+                                                 signature VARCHAR(64) NOT NULL,
+                                                 created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS security_events (
+                                               id BIGSERIAL PRIMARY KEY,
+                                               type VARCHAR(64) NOT NULL,
+                                               subject VARCHAR(255) NOT NULL DEFAULT '',
+                                               user_id VARCHAR(64) NOT NULL DEFAULT '',
+                                               source_ip VARCHAR(64) NOT NULL DEFAULT '',
+                                               request_id VARCHAR(64) NOT NULL DEFAULT '',
+                                               details JSONB,
+                                               created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Хеши заменённых и отозванных refresh-токенов для распознавания повторного предъявления
+CREATE TABLE IF NOT EXISTS revoked_refresh_tokens (
+                                                      token_hash VARCHAR(64) PRIMARY KEY,
+                                                      user_id VARCHAR(64) NOT NULL,
+                                                      revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Позиция экспортёра в каждом источнике событий; сдвигается только после записи в приёмник
+CREATE TABLE IF NOT EXISTS siem_cursors (
+                                            exporter VARCHAR(64) NOT NULL,
+                                            source VARCHAR(32) NOT NULL,
+                                            last_id BIGINT NOT NULL DEFAULT 0,
+                                            updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                            PRIMARY KEY (exporter, source)
+);
@@ -0,0 +1,17 @@
+-- Доменные события, записанные в одной транзакции с изменением; публикуются ретранслятором
+CREATE TABLE IF NOT EXISTS outbox_events (
+                                             id BIGSERIAL PRIMARY KEY,
+                                             type VARCHAR(64) NOT NULL,
+                                             aggregate_type VARCHAR(32) NOT NULL,
+                                             aggregate_id VARCHAR(64) NOT NULL,
+                                             payload JSONB NOT NULL,
+                                             actor VARCHAR(255) NOT NULL DEFAULT '',
+                                             request_id VARCHAR(64) NOT NULL DEFAULT '',
+                                             occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                             published_at TIMESTAMP,
+                                             attempts INT NOT NULL DEFAULT 0,
+                                             last_error TEXT NOT NULL DEFAULT '',
+                                             next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (next_attempt_at, id) WHERE published_at IS NULL;
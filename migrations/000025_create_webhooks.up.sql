@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+                                                     id UUID PRIMARY KEY,
+                                                     url TEXT NOT NULL,
+                                                     event_types TEXT[] NOT NULL,
+                                                     secret TEXT NOT NULL,
+                                                     description TEXT NOT NULL DEFAULT '',
+                                                     active BOOLEAN NOT NULL DEFAULT TRUE,
+                                                     created_by VARCHAR(255) NOT NULL DEFAULT '',
+                                                     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Одна доставка на пару подписка/событие: повторная публикация события из outbox не создаёт дублей
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                                                  id BIGSERIAL PRIMARY KEY,
+                                                  subscription_id UUID NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+                                                  event_id BIGINT NOT NULL,
+                                                  event_type VARCHAR(64) NOT NULL,
+                                                  payload JSONB NOT NULL,
+                                                  status VARCHAR(16) NOT NULL,
+                                                  attempts INT NOT NULL DEFAULT 0,
+                                                  next_attempt_at TIMESTAMP,
+                                                  last_status_code INT NOT NULL DEFAULT 0,
+                                                  last_error TEXT NOT NULL DEFAULT '',
+                                                  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                                  delivered_at TIMESTAMP,
+                                                  UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+                                                         id BIGSERIAL PRIMARY KEY,
+                                                         delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+                                                         attempt INT NOT NULL,
+                                                         status_code INT NOT NULL DEFAULT 0,
+                                                         error TEXT NOT NULL DEFAULT '',
+                                                         duration_ms BIGINT NOT NULL DEFAULT 0,
+                                                         manual BOOLEAN NOT NULL DEFAULT FALSE,
+                                                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id, id);
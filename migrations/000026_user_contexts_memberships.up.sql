@@ -0,0 +1,18 @@
+-- Контекст пользователя — членство в мерчанте. Раньше удаление обнуляло merchant_id,
+-- такие строки без глобального доступа ничего не дают
+DELETE FROM users_contexts WHERE merchant_id = '' AND NOT COALESCE(global, FALSE);
+
+UPDATE users_contexts SET global = FALSE WHERE global IS NULL;
+
+ALTER TABLE users_contexts
+    ADD COLUMN IF NOT EXISTS id BIGSERIAL,
+    ADD COLUMN IF NOT EXISTS granted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS granted_by VARCHAR(255) NOT NULL DEFAULT '',
+    ALTER COLUMN user_id SET NOT NULL,
+    ALTER COLUMN global SET NOT NULL;
+
+-- Пустой merchant_id допустим только у глобального контекста
+ALTER TABLE users_contexts
+    ADD CONSTRAINT users_contexts_merchant_required CHECK (merchant_id <> '' OR global);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_contexts_id_idx ON users_contexts (id);
@@ -0,0 +1,15 @@
+-- Назначение роли может быть привязано к контексту пользователя (мерчанту).
+-- merchant_id NULL — назначение действует у любого мерчанта, как раньше.
+ALTER TABLE users_roles
+    ADD COLUMN IF NOT EXISTS merchant_id VARCHAR(255);
+
+ALTER TABLE users_roles
+    DROP CONSTRAINT IF EXISTS users_roles_pkey;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_roles_assignment_idx
+    ON users_roles (user_id, role_id, (COALESCE(merchant_id, '')));
+
+-- Удаление контекста снимает роли, назначенные в нём
+ALTER TABLE users_roles
+    ADD CONSTRAINT users_roles_context_fkey FOREIGN KEY (user_id, merchant_id)
+        REFERENCES users_contexts (user_id, merchant_id) ON DELETE CASCADE;
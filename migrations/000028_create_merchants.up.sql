@@ -0,0 +1,37 @@
+-- Реестр мерчантов: группа > бренд > филиал. Доступ, выданный на узел, распространяется на его потомков.
+CREATE TABLE IF NOT EXISTS merchants (
+                                         id VARCHAR(255) PRIMARY KEY,
+                                         name TEXT NOT NULL,
+                                         kind VARCHAR(16) NOT NULL DEFAULT 'branch',
+                                         status VARCHAR(16) NOT NULL DEFAULT 'active',
+                                         parent_id VARCHAR(255) REFERENCES merchants (id),
+                                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                         CHECK (parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS merchants_parent_id_idx ON merchants (parent_id);
+
+-- Мерчанты, уже встречающиеся в контекстах и правилах одобряющих, попадают в реестр корневыми филиалами
+INSERT INTO merchants (id, name)
+SELECT DISTINCT merchant_id, merchant_id FROM users_contexts WHERE merchant_id <> ''
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO merchants (id, name)
+SELECT DISTINCT merchant_id, merchant_id FROM access_approvers WHERE merchant_id IS NOT NULL AND merchant_id <> ''
+ON CONFLICT (id) DO NOTHING;
+
+-- Пары (предок, мерчант), включая сам мерчант, для мерчантов, у которых активна вся цепочка до корня.
+-- Приостановка узла закрывает доступ ко всему его поддереву.
+CREATE OR REPLACE VIEW merchant_access_paths AS
+WITH RECURSIVE tree (merchant_id, path) AS (
+    SELECT id, ARRAY[id]
+    FROM merchants
+    WHERE parent_id IS NULL AND status = 'active'
+    UNION ALL
+    SELECT m.id, t.path || m.id
+    FROM merchants m
+    JOIN tree t ON m.parent_id = t.merchant_id
+    WHERE m.status = 'active' AND NOT m.id = ANY (t.path)
+)
+SELECT unnest(path) AS ancestor_id, merchant_id FROM tree;
@@ -0,0 +1,12 @@
+-- Поля для поиска пользователей: email и статус учётной записи
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(128);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email)) WHERE email IS NOT NULL;
+
+-- Индексы под сортировки и поиск по префиксу
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_phone_id_idx ON users (phone, id);
+CREATE INDEX IF NOT EXISTS users_phone_prefix_idx ON users (phone text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_email_prefix_idx ON users (lower(email) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_status_idx ON users (status);
@@ -0,0 +1,38 @@
+-- Имя пользователя из импорта; совпадает с полями users_profiles
+ALTER TABLE users ADD COLUMN IF NOT EXISTS first_name VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_name VARCHAR(64);
+
+-- Задания массового импорта пользователей. payload хранит загруженный файл до конца обработки,
+-- heartbeat_at позволяет подхватить задание, обработчик которого остановился.
+CREATE TABLE IF NOT EXISTS user_import_jobs (
+    id UUID PRIMARY KEY,
+    mode VARCHAR(16) NOT NULL CHECK (mode IN ('dry_run', 'commit')),
+    format VARCHAR(8) NOT NULL CHECK (format IN ('csv', 'xlsx')),
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    payload BYTEA,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    total_rows INT NOT NULL DEFAULT 0,
+    processed_rows INT NOT NULL DEFAULT 0,
+    succeeded_rows INT NOT NULL DEFAULT 0,
+    failed_rows INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    heartbeat_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_import_jobs_status_idx ON user_import_jobs (status, created_at);
+
+-- Результат обработки каждой строки файла; row_number считает строки файла вместе с заголовком
+CREATE TABLE IF NOT EXISTS user_import_rows (
+    job_id UUID NOT NULL REFERENCES user_import_jobs (id) ON DELETE CASCADE,
+    row_number INT NOT NULL,
+    phone VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    errors JSONB NOT NULL DEFAULT '[]',
+    user_id UUID,
+    PRIMARY KEY (job_id, row_number)
+);
@@ -0,0 +1,41 @@
+-- Токены SCIM: каждый токен привязан к мерчанту, от имени которого IdP заводит сотрудников.
+-- Хранится только SHA-256 токена.
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id UUID PRIMARY KEY,
+    merchant_id VARCHAR(255) NOT NULL REFERENCES merchants (id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scim_tokens_merchant_idx ON scim_tokens (merchant_id);
+
+-- Пользователи, заведённые через SCIM: ресурс SCIM User — это пользователь в контексте мерчанта.
+-- active = FALSE снимает контекст мерчанта, но оставляет ресурс; version — основа ETag.
+CREATE TABLE IF NOT EXISTS scim_users (
+    merchant_id VARCHAR(255) NOT NULL REFERENCES merchants (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (merchant_id, user_id)
+);
+
+-- userName в SCIM не зависит от регистра
+CREATE UNIQUE INDEX IF NOT EXISTS scim_users_user_name_idx ON scim_users (merchant_id, lower(user_name));
+CREATE INDEX IF NOT EXISTS scim_users_created_idx ON scim_users (merchant_id, created_at, user_id);
+
+-- Версия состава группы (роли) у мерчанта; вместе с версией роли образует ETag группы
+CREATE TABLE IF NOT EXISTS scim_groups (
+    merchant_id VARCHAR(255) NOT NULL REFERENCES merchants (id) ON DELETE CASCADE,
+    role_id INT NOT NULL REFERENCES roles (role_id) ON DELETE CASCADE,
+    version INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (merchant_id, role_id)
+);
@@ -0,0 +1,48 @@
+-- Внешние провайдеры OpenID Connect, через которые разрешён вход. client_secret наружу не отдаётся.
+-- default_roles — имена ролей, которые получает пользователь, заведённый при первом входе (JIT);
+-- если задан merchant_id, пользователь получает контекст мерчанта, а роли действуют у него.
+CREATE TABLE IF NOT EXISTS oidc_providers (
+    id VARCHAR(64) PRIMARY KEY,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    issuer TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL DEFAULT '',
+    redirect_url TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT ARRAY['openid', 'email', 'profile', 'phone'],
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    link_by_email BOOLEAN NOT NULL DEFAULT FALSE,
+    link_by_phone BOOLEAN NOT NULL DEFAULT FALSE,
+    trust_email BOOLEAN NOT NULL DEFAULT FALSE,
+    jit_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    default_roles TEXT[] NOT NULL DEFAULT '{}',
+    merchant_id VARCHAR(255) REFERENCES merchants (id) ON DELETE SET NULL,
+    phone_claim VARCHAR(64) NOT NULL DEFAULT 'phone_number',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Незавершённые входы: state одноразовый и хранится в виде SHA-256, code_verifier — секрет PKCE
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash CHAR(64) PRIMARY KEY,
+    provider_id VARCHAR(64) NOT NULL REFERENCES oidc_providers (id) ON DELETE CASCADE,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oidc_login_states_expires_idx ON oidc_login_states (expires_at);
+
+-- Внешние учётные записи пользователя: subject уникален в пределах провайдера
+CREATE TABLE IF NOT EXISTS federated_identities (
+    provider_id VARCHAR(64) NOT NULL REFERENCES oidc_providers (id) ON DELETE CASCADE,
+    subject VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users_profiles (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    linked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (provider_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS federated_identities_user_idx ON federated_identities (user_id);
@@ -0,0 +1,63 @@
+-- Провайдеры SAML 2.0 (IdP мерчантов). certificates — сертификаты подписи IdP в base64 DER;
+-- несколько сертификатов позволяют сменить ключ без простоя.
+-- role_mappings: [{"attribute": ..., "value": ..., "role": ..., "merchant_id": ...}] — значения атрибутов,
+-- дающие роли и контексты мерчантов; merchant_id — мерчант по умолчанию для всех пользователей провайдера.
+CREATE TABLE IF NOT EXISTS saml_providers (
+    id VARCHAR(64) PRIMARY KEY,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    entity_id TEXT NOT NULL UNIQUE,
+    sso_url TEXT NOT NULL,
+    certificates TEXT[] NOT NULL,
+    merchant_id VARCHAR(255) REFERENCES merchants (id) ON DELETE SET NULL,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    role_mappings JSONB NOT NULL DEFAULT '[]',
+    link_by_email BOOLEAN NOT NULL DEFAULT FALSE,
+    link_by_phone BOOLEAN NOT NULL DEFAULT FALSE,
+    jit_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    allow_idp_initiated BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Отправленные AuthnRequest: ответ IdP принимается только на запрос, который ещё не использован
+CREATE TABLE IF NOT EXISTS saml_requests (
+    id VARCHAR(64) PRIMARY KEY,
+    provider_id VARCHAR(64) NOT NULL REFERENCES saml_providers (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Принятые утверждения: повторно то же утверждение не принимается, пока оно не истекло
+CREATE TABLE IF NOT EXISTS saml_assertions (
+    provider_id VARCHAR(64) NOT NULL REFERENCES saml_providers (id) ON DELETE CASCADE,
+    assertion_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider_id, assertion_id)
+);
+
+CREATE INDEX IF NOT EXISTS saml_requests_expires_idx ON saml_requests (expires_at);
+CREATE INDEX IF NOT EXISTS saml_assertions_expires_idx ON saml_assertions (expires_at);
+
+-- Учётные записи IdP: NameID уникален в пределах провайдера
+CREATE TABLE IF NOT EXISTS saml_identities (
+    provider_id VARCHAR(64) NOT NULL REFERENCES saml_providers (id) ON DELETE CASCADE,
+    name_id VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users_profiles (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    linked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (provider_id, name_id)
+);
+
+CREATE INDEX IF NOT EXISTS saml_identities_user_idx ON saml_identities (user_id);
+
+-- Роли, выданные по атрибутам SAML: при следующем входе роль снимается, если IdP перестал её давать.
+-- Роли, выданные вручную, здесь не учитываются и при входе не снимаются.
+CREATE TABLE IF NOT EXISTS saml_role_grants (
+    provider_id VARCHAR(64) NOT NULL REFERENCES saml_providers (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    role_id INT NOT NULL REFERENCES roles (role_id) ON DELETE CASCADE,
+    merchant_id VARCHAR(255) NOT NULL DEFAULT '',
+    granted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider_id, user_id, role_id, merchant_id)
+);
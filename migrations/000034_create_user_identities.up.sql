@@ -0,0 +1,36 @@
+-- Способы входа пользователя. provider: phone — вход по телефону и паролю (subject — телефон профиля),
+-- oidc:<id> и saml:<id> — учётные записи внешних провайдеров. verified — владение подтверждено:
+-- внешнюю учётную запись подтверждает провайдер при входе, телефон пока не подтверждается.
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider VARCHAR(80) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users_profiles (id) ON DELETE CASCADE,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    linked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id);
+
+-- Вход по паролю остаётся у всех существующих пользователей, в том числе заведённых через провайдеров:
+-- отличить их от остальных по данным нельзя, а пароль у них случайный
+INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at)
+SELECT 'phone', phone, id, FALSE, COALESCE(email, ''), created_at FROM users_profiles
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at, last_login_at)
+SELECT 'oidc:' || provider_id, subject, user_id, TRUE, email, linked_at, last_login_at FROM federated_identities
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at, last_login_at)
+SELECT 'saml:' || provider_id, name_id, user_id, TRUE, email, linked_at, last_login_at FROM saml_identities
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS federated_identities;
+DROP TABLE IF EXISTS saml_identities;
+
+-- Вход, начатый уже вошедшим пользователем, привязывает внешнюю учётную запись к нему
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS link_user_id UUID;
+ALTER TABLE saml_requests ADD COLUMN IF NOT EXISTS link_user_id UUID;
@@ -0,0 +1,137 @@
+-- Единое хранилище пользователей: вход и сессия из users_profiles переносятся в users, с которой связаны
+-- права, роли и контексты. Строки объединяются по id, затем по телефону. Всё, что нельзя объединить без
+-- потерь, попадает в отчёт users_merge_conflicts; users_profiles остаётся как users_profiles_legacy
+-- до разбора отчёта.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS refresh_token VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS users_refresh_token_idx ON users (refresh_token) WHERE refresh_token IS NOT NULL;
+
+-- kind: phone_taken — профиль не перенесён, его телефон у другого пользователя; id_changed — профиль
+-- объединён с пользователем с другим id; phone_mismatch — у профиля и пользователя с одним id разные
+-- телефоны; password_differs, email_differs — значения расходились; email_taken — email профиля
+-- принадлежит другому пользователю и не перенесён
+CREATE TABLE IF NOT EXISTS users_merge_conflicts (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    profile_id UUID NOT NULL,
+    user_id UUID,
+    phone VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    resolution TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Пользователи, заведённые через провайдеров, уже имеют один id в обеих таблицах, поэтому совпадение
+-- по id важнее совпадения по телефону
+CREATE TEMP TABLE profile_matches AS
+SELECT p.id AS profile_id, m.id AS user_id, p.phone, NULLIF(p.email, '') AS email, FALSE AS skipped
+FROM users_profiles p
+LEFT JOIN LATERAL (
+    SELECT u.id FROM users u WHERE u.id = p.id OR u.phone = p.phone
+    ORDER BY (u.id = p.id) DESC
+    LIMIT 1
+) m ON TRUE;
+
+-- С пользователем совпали два профиля: один по id, другой по телефону. Объединяется первый.
+UPDATE profile_matches m SET skipped = TRUE
+WHERE m.user_id <> m.profile_id
+  AND EXISTS (SELECT 1 FROM profile_matches o WHERE o.profile_id = m.user_id);
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'phone_taken', profile_id, user_id, phone, COALESCE(email, ''),
+       'profile not migrated: its phone belongs to another user, login with it is no longer possible'
+FROM profile_matches WHERE skipped;
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'id_changed', profile_id, user_id, phone, COALESCE(email, ''),
+       'merged into the user with the same phone; access tokens issued before the migration are invalid'
+FROM profile_matches WHERE user_id <> profile_id AND NOT skipped;
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'phone_mismatch', m.profile_id, m.user_id, m.phone, COALESCE(m.email, ''),
+       'phone of the user kept (' || u.phone || '), login now uses it'
+FROM profile_matches m JOIN users u ON u.id = m.user_id
+WHERE m.user_id = m.profile_id AND u.phone <> m.phone;
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'password_differs', m.profile_id, m.user_id, m.phone, COALESCE(m.email, ''),
+       'login password of the profile kept, the password set by an administrator no longer works'
+FROM profile_matches m
+JOIN users u ON u.id = m.user_id
+JOIN users_profiles p ON p.id = m.profile_id
+WHERE NOT m.skipped AND u.password_hash <> p.password_hash;
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'email_differs', m.profile_id, m.user_id, m.phone, m.email, 'email of the user kept (' || u.email || ')'
+FROM profile_matches m JOIN users u ON u.id = m.user_id
+WHERE NOT m.skipped AND u.email IS NOT NULL AND m.email IS NOT NULL AND lower(u.email) <> lower(m.email);
+
+INSERT INTO users_merge_conflicts (kind, profile_id, user_id, phone, email, resolution)
+SELECT 'email_taken', m.profile_id, m.user_id, m.phone, m.email, 'email not migrated: it belongs to user ' || o.id
+FROM profile_matches m
+LEFT JOIN users u ON u.id = m.user_id
+JOIN users o ON lower(o.email) = lower(m.email) AND o.id IS DISTINCT FROM m.user_id
+WHERE NOT m.skipped AND m.email IS NOT NULL AND u.email IS NULL;
+
+-- Пароль и сессия берутся из профиля, по которому выполнялся вход; email и имя — если их нет у пользователя
+UPDATE users u SET
+    password_hash = p.password_hash,
+    refresh_token = p.refresh_token,
+    email = COALESCE(u.email, CASE WHEN NOT EXISTS (
+        SELECT 1 FROM users o WHERE lower(o.email) = lower(m.email) AND o.id <> u.id
+    ) THEN m.email END),
+    first_name = COALESCE(u.first_name, p.first_name),
+    last_name = COALESCE(u.last_name, p.last_name),
+    updated_at = now()
+FROM profile_matches m JOIN users_profiles p ON p.id = m.profile_id
+WHERE u.id = m.user_id AND NOT m.skipped;
+
+INSERT INTO users (id, phone, password_hash, rights, email, first_name, last_name, refresh_token, created_at, updated_at)
+SELECT p.id, p.phone, p.password_hash, '{}',
+       CASE WHEN NOT EXISTS (SELECT 1 FROM users o WHERE lower(o.email) = lower(m.email)) THEN m.email END,
+       p.first_name, p.last_name, p.refresh_token, p.created_at, p.updated_at
+FROM profile_matches m JOIN users_profiles p ON p.id = m.profile_id
+WHERE m.user_id IS NULL;
+
+-- Способы входа и отозванные refresh-токены переходят к пользователю, с которым объединён профиль
+ALTER TABLE user_identities DROP CONSTRAINT IF EXISTS user_identities_user_id_fkey;
+
+DELETE FROM user_identities i USING profile_matches m WHERE i.user_id = m.profile_id AND m.skipped;
+
+UPDATE user_identities i SET user_id = m.user_id
+FROM profile_matches m
+WHERE i.user_id = m.profile_id AND m.user_id <> m.profile_id AND NOT m.skipped;
+
+UPDATE revoked_refresh_tokens t SET user_id = m.user_id::text
+FROM profile_matches m
+WHERE t.user_id = m.profile_id::text AND m.user_id <> m.profile_id AND NOT m.skipped;
+
+UPDATE user_identities i SET subject = u.phone
+FROM users u
+WHERE i.user_id = u.id AND i.provider = 'phone' AND i.subject <> u.phone
+  AND NOT EXISTS (SELECT 1 FROM user_identities o WHERE o.provider = 'phone' AND o.subject = u.phone);
+
+-- Пользователи, созданные администратором, импортом или SCIM, входили только в users и не могли войти
+INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at)
+SELECT 'phone', u.phone, u.id, FALSE, COALESCE(u.email, ''), u.created_at
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = u.id)
+ON CONFLICT DO NOTHING;
+
+DELETE FROM user_identities i WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = i.user_id);
+
+ALTER TABLE user_identities
+    ADD CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN SELECT kind, COUNT(*) AS n FROM users_merge_conflicts GROUP BY kind ORDER BY kind LOOP
+        RAISE NOTICE 'users merge: % conflict(s) of kind %, see users_merge_conflicts', r.n, r.kind;
+    END LOOP;
+END $$;
+
+DROP TABLE profile_matches;
+
+ALTER TABLE users_profiles RENAME TO users_profiles_legacy;
@@ -0,0 +1,13 @@
+-- Жизненный цикл учётной записи: причина, время и автор последней смены статуса.
+-- Допустимые переходы между статусами проверяет сервис пользователей.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_by VARCHAR(255) NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_status_valid' AND conrelid = 'users'::regclass) THEN
+        ALTER TABLE users
+            ADD CONSTRAINT users_status_valid CHECK (status IN ('active', 'suspended', 'locked', 'deactivated', 'deleted'));
+    END IF;
+END $$;
@@ -0,0 +1,3 @@
+-- Право на выпуск и отзыв токенов SCIM: без него /api/v4/scim/tokens отвечает 403
+INSERT INTO rights (id, module, action) VALUES (gen_random_uuid(), 'scim', 'manage')
+ON CONFLICT (module, action) DO NOTHING;
@@ -0,0 +1,7 @@
+-- Подписка на вебхуки принадлежит мерчанту и получает только события его поддерева.
+-- Подписки без мерчанта получали события всех мерчантов: они выключаются, пока им не задан merchant_id.
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS merchant_id VARCHAR(255) REFERENCES merchants (id) ON DELETE CASCADE;
+
+UPDATE webhook_subscriptions SET active = FALSE WHERE merchant_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_merchant_id_idx ON webhook_subscriptions (merchant_id);
@@ -0,0 +1,166 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы доменных событий; они же ключи маршрутизации при публикации
+const (
+	UserRegistered    = "UserRegistered"
+	RightsGranted     = "RightsGranted"
+	RightsRevoked     = "RightsRevoked"
+	RoleChanged       = "RoleChanged"
+	ContextAdded      = "ContextAdded"
+	ContextRemoved    = "ContextRemoved"
+	MerchantChanged   = "MerchantChanged"
+	SessionRevoked    = "SessionRevoked"
+	UsersMerged       = "UsersMerged"
+	UserStatusChanged = "UserStatusChanged"
+)
+
+const (
+	AggregateUser     = "user"
+	AggregateRole     = "role"
+	AggregateMerchant = "merchant"
+)
+
+// Изменения роли в RoleChanged
+const (
+	RoleCreated           = "created"
+	RoleEdited            = "edited"
+	RoleDeleted           = "deleted"
+	RoleAssigned          = "assigned"
+	RoleUnassigned        = "unassigned"
+	RoleAssignmentExpired = "assignment_expired"
+)
+
+// Изменения мерчанта в MerchantChanged
+const (
+	MerchantCreated = "created"
+	MerchantUpdated = "updated"
+	MerchantDeleted = "deleted"
+)
+
+// Причины отзыва прав в RightsRevoked
+const (
+	RevokeReasonRevoked  = "revoked"
+	RevokeReasonReplaced = "replaced"
+	RevokeReasonExpired  = "expired"
+)
+
+// Event — запись outbox. Сохраняется в одной транзакции с изменением и публикуется ретранслятором.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Actor         string          `json:"actor,omitempty"`
+	RequestID     string          `json:"request_id,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Attempts      int             `json:"-"`
+}
+
+func NewEvent(eventType, aggregateType, aggregateID string, payload interface{}) (Event, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       body,
+	}, nil
+}
+
+type UserRegisteredPayload struct {
+	UserID string `json:"user_id"`
+	Phone  string `json:"phone"`
+	Email  string `json:"email,omitempty"`
+	// Source — registration для самостоятельной регистрации, admin для создания через API пользователей,
+	// import для массового импорта
+	Source string `json:"source"`
+}
+
+type RightsGrantedPayload struct {
+	UserID     string              `json:"user_id"`
+	Rights     map[string][]string `json:"rights"`
+	ValidFrom  *time.Time          `json:"valid_from,omitempty"`
+	ValidUntil *time.Time          `json:"valid_until,omitempty"`
+}
+
+type RightsRevokedPayload struct {
+	UserID string              `json:"user_id"`
+	Rights map[string][]string `json:"rights"`
+	Reason string              `json:"reason"`
+}
+
+type RoleChangedPayload struct {
+	RoleID   int    `json:"role_id"`
+	RoleName string `json:"role_name,omitempty"`
+	Change   string `json:"change"`
+	// Version заполняется при создании и изменении роли
+	Version int `json:"version,omitempty"`
+	// Modules — модули, на права в которых влияет изменение
+	Modules []string `json:"modules,omitempty"`
+	// UserID и MerchantID заполняются для назначений роли; пустой MerchantID — назначение у любого мерчанта
+	UserID     string     `json:"user_id,omitempty"`
+	MerchantID string     `json:"merchant_id,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+type ContextAddedPayload struct {
+	UserID     string `json:"user_id"`
+	MerchantID string `json:"merchant_id"`
+	Global     bool   `json:"global"`
+}
+
+type ContextRemovedPayload struct {
+	UserID     string `json:"user_id"`
+	MerchantID string `json:"merchant_id"`
+	Global     bool   `json:"global"`
+}
+
+// MerchantChangedPayload — изменение узла реестра; затрагивает доступ ко всему его поддереву
+type MerchantChangedPayload struct {
+	MerchantID string `json:"merchant_id"`
+	Change     string `json:"change"`
+	Status     string `json:"status,omitempty"`
+	ParentID   string `json:"parent_id,omitempty"`
+}
+
+type SessionRevokedPayload struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// UsersMergedPayload — пользователь MergedUserID слит в UserID и удалён: его способы входа, права,
+// роли и контексты теперь у UserID
+type UsersMergedPayload struct {
+	UserID       string `json:"user_id"`
+	MergedUserID string `json:"merged_user_id"`
+}
+
+// UserStatusChangedPayload — смена статуса учётной записи; токены пользователя не в статусе active
+// больше не принимаются
+type UserStatusChangedPayload struct {
+	UserID string `json:"user_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// EventTypes — все типы событий, на которые можно подписаться
+var EventTypes = []string{UserRegistered, RightsGranted, RightsRevoked, RoleChanged, ContextAdded, ContextRemoved, MerchantChanged, SessionRevoked, UsersMerged, UserStatusChanged}
+
+func KnownEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
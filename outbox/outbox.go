@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/outbox/publisher"
+	"github.com/rafaceo/go-test-auth/outbox/repository"
+	"github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+)
+
+const (
+	defaultBatchSize = 100
+	// claimLease — на сколько событие скрыто от других ретрансляторов, пока идёт публикация
+	claimLease = time.Minute
+	maxBackoff = 10 * time.Minute
+)
+
+// Relay публикует события outbox по порядку id с доставкой «хотя бы один раз»: событие
+// отмечается опубликованным только после того, как его принял Publisher
+type Relay struct {
+	repo      repository.OutboxRepository
+	publisher publisher.Publisher
+	batchSize int
+	interval  time.Duration
+	logger    log.Logger
+}
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateRelay(logger log.Logger, postgresClient *sqlx.DB, pub publisher.Publisher, interval time.Duration) *Relay {
+	return &Relay{
+		repo:      postgres.NewOutboxRepository(postgresClient),
+		publisher: pub,
+		batchSize: defaultBatchSize,
+		interval:  interval,
+		logger:    log.With(logger, "component", "outbox_relay"),
+	}
+}
+
+// RelayOnce публикует всё, что готово к отправке, и возвращает число опубликованных событий.
+// На первой ошибке пачка прерывается, а её хвост возвращается в очередь, чтобы не нарушать порядок.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := r.repo.ClaimPending(ctx, r.batchSize, claimLease)
+		if err != nil {
+			return published, err
+		}
+		if len(events) == 0 {
+			return published, nil
+		}
+
+		for i, event := range events {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				retryAt := time.Now().UTC().Add(backoff(r.interval, event.Attempts))
+				if markErr := r.repo.MarkFailed(ctx, event.ID, err.Error(), retryAt); markErr != nil {
+					return published, markErr
+				}
+
+				rest := make([]int64, 0, len(events)-i-1)
+				for _, e := range events[i+1:] {
+					rest = append(rest, e.ID)
+				}
+				if rescheduleErr := r.repo.Reschedule(ctx, rest, retryAt); rescheduleErr != nil {
+					return published, rescheduleErr
+				}
+				return published, err
+			}
+
+			if err := r.repo.MarkPublished(ctx, event.ID); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(events) < r.batchSize {
+			return published, nil
+		}
+	}
+}
+
+// Run блокируется до отмены ctx
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			_ = r.logger.Log("method", "RelayOnce", "published", n, "err", err)
+		} else if n > 0 {
+			_ = r.logger.Log("method", "RelayOnce", "published", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) Close() error {
+	return r.publisher.Close()
+}
+
+// backoff удваивает задержку с каждой неудачной попыткой, но не больше maxBackoff
+func backoff(base time.Duration, attempts int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
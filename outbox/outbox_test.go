@@ -0,0 +1,217 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/outbox/publisher"
+)
+
+// memoryRepository повторяет семантику outbox_events из postgres-репозитория: выдача по порядку id,
+// аренда через next_attempt_at, попытка считается при выдаче и возвращается при Reschedule
+type memoryRepository struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	rows   map[int64]*outboxRow
+	marked func(id int64)
+}
+
+type outboxRow struct {
+	event         domain.Event
+	nextAttemptAt time.Time
+	published     bool
+	lastError     string
+}
+
+func newMemoryRepository(n int) *memoryRepository {
+	repo := &memoryRepository{now: time.Now, rows: map[int64]*outboxRow{}}
+	for id := int64(1); id <= int64(n); id++ {
+		repo.rows[id] = &outboxRow{event: domain.Event{ID: id, Type: domain.RightsGranted, AggregateID: "user"}}
+	}
+	return repo
+}
+
+func (r *memoryRepository) ClaimPending(_ context.Context, limit int, lease time.Duration) ([]domain.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.rows))
+	for id, row := range r.rows {
+		if !row.published && !row.nextAttemptAt.After(r.now()) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	events := make([]domain.Event, 0, len(ids))
+	for _, id := range ids {
+		row := r.rows[id]
+		row.nextAttemptAt = r.now().Add(lease)
+		row.event.Attempts++
+		events = append(events, row.event)
+	}
+	return events, nil
+}
+
+func (r *memoryRepository) MarkPublished(_ context.Context, id int64) error {
+	r.mu.Lock()
+	r.rows[id].published = true
+	marked := r.marked
+	r.mu.Unlock()
+
+	if marked != nil {
+		marked(id)
+	}
+	return nil
+}
+
+func (r *memoryRepository) MarkFailed(_ context.Context, id int64, errMsg string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rows[id].lastError = errMsg
+	r.rows[id].nextAttemptAt = retryAt
+	return nil
+}
+
+func (r *memoryRepository) Reschedule(_ context.Context, ids []int64, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		r.rows[id].nextAttemptAt = retryAt
+		r.rows[id].event.Attempts--
+	}
+	return nil
+}
+
+// advance сдвигает часы репозитория, чтобы отложенные события снова стали доступны
+func (r *memoryRepository) advance(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now
+	r.now = func() time.Time { return now().Add(d) }
+}
+
+func newTestRelay(repo *memoryRepository, pub publisher.Publisher, batchSize int) *Relay {
+	return &Relay{repo: repo, publisher: pub, batchSize: batchSize, interval: time.Second, logger: log.NewNopLogger()}
+}
+
+func publishedIDs(pub *publisher.MemoryPublisher) []int64 {
+	ids := []int64{}
+	for _, e := range pub.Events() {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRelayOncePublishesInOrder(t *testing.T) {
+	repo := newMemoryRepository(5)
+	pub := publisher.NewMemoryPublisher()
+	relay := newTestRelay(repo, pub, 2)
+
+	n, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("published %d events, want 5", n)
+	}
+	if got, want := publishedIDs(pub), []int64{1, 2, 3, 4, 5}; !equalIDs(got, want) {
+		t.Fatalf("published ids %v, want %v", got, want)
+	}
+
+	n, err = relay.RelayOnce(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("second RelayOnce = %d, %v; want nothing to publish", n, err)
+	}
+}
+
+func TestRelayOnceRedeliversAfterPublishFailure(t *testing.T) {
+	repo := newMemoryRepository(3)
+	pub := publisher.NewMemoryPublisher()
+	relay := newTestRelay(repo, pub, 10)
+
+	// Брокер принимает первое событие и отказывает на втором
+	brokerDown := errors.New("broker unavailable")
+	repo.marked = func(id int64) {
+		if id == 1 {
+			pub.FailWith(brokerDown)
+		}
+	}
+
+	n, err := relay.RelayOnce(context.Background())
+	if !errors.Is(err, brokerDown) {
+		t.Fatalf("RelayOnce error = %v, want %v", err, brokerDown)
+	}
+	if n != 1 {
+		t.Fatalf("published %d events before the failure, want 1", n)
+	}
+	if repo.rows[2].lastError != brokerDown.Error() {
+		t.Fatalf("failed event last_error = %q", repo.rows[2].lastError)
+	}
+	if repo.rows[3].event.Attempts != 0 {
+		t.Fatalf("tail of the batch counted %d attempts, want 0", repo.rows[3].event.Attempts)
+	}
+
+	// До истечения задержки событие не выдаётся повторно, хвост пачки не обгоняет его
+	pub.FailWith(nil)
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("RelayOnce before retry = %d, %v; want nothing to publish", n, err)
+	}
+
+	repo.advance(time.Hour)
+	n, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce after retry: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("redelivered %d events, want 2", n)
+	}
+	if got, want := publishedIDs(pub), []int64{1, 2, 3}; !equalIDs(got, want) {
+		t.Fatalf("published ids %v, want %v", got, want)
+	}
+	if repo.rows[2].event.Attempts != 2 {
+		t.Fatalf("redelivered event has %d attempts, want 2", repo.rows[2].event.Attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 3, 4 * time.Second},
+		{0, 1, time.Second},
+		{time.Minute, 20, maxBackoff},
+	}
+	for _, c := range cases {
+		if got := backoff(c.base, c.attempts); got != c.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", c.base, c.attempts, got, c.want)
+		}
+	}
+}
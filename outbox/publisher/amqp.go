@@ -0,0 +1,142 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rafaceo/go-test-auth/config"
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+const (
+	DefaultExchange = "auth.events"
+	appID           = "go-test-auth"
+)
+
+// AMQPPublisher публикует события в topic-exchange RabbitMQ с ключом маршрутизации, равным типу события.
+// Событие считается доставленным после подтверждения брокера (publisher confirms).
+type AMQPPublisher struct {
+	url      string
+	exchange string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+// NewAMQPPublisher не подключается сразу: соединение открывается при первой публикации
+// и пересоздаётся после сбоя, поэтому недоступный брокер не мешает старту сервиса
+func NewAMQPPublisher(cfg config.RabbitConfig) (*AMQPPublisher, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("rabbit host is required")
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 5672
+	}
+	vhost := cfg.VirtualHost
+	if vhost == "" {
+		vhost = "/"
+	}
+	exchange := cfg.Exchange
+	if exchange == "" {
+		exchange = DefaultExchange
+	}
+
+	uri := amqp.URI{
+		Scheme:   "amqp",
+		Host:     cfg.Host,
+		Port:     port,
+		Username: cfg.User,
+		Password: cfg.Password,
+		Vhost:    vhost,
+	}
+	return &AMQPPublisher{url: uri.String(), exchange: exchange}, nil
+}
+
+func (p *AMQPPublisher) Publish(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    strconv.FormatInt(event.ID, 10),
+		Timestamp:    event.OccurredAt,
+		Type:         event.Type,
+		AppId:        appID,
+		Body:         body,
+	})
+	if err != nil {
+		p.reset()
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		p.reset()
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected event %d", event.ID)
+	}
+	return nil
+}
+
+func (p *AMQPPublisher) connect() error {
+	if p.ch != nil && !p.ch.IsClosed() {
+		return nil
+	}
+	p.reset()
+
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := ch.ExchangeDeclare(p.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn, p.ch = conn, ch
+	return nil
+}
+
+func (p *AMQPPublisher) reset() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn, p.ch = nil, nil
+}
+
+func (p *AMQPPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reset()
+	return nil
+}
@@ -0,0 +1,37 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+type fanoutPublisher struct {
+	publishers []Publisher
+}
+
+// NewFanout публикует событие во все publishers по порядку. При ошибке событие будет
+// опубликовано повторно во все, поэтому каждый из них должен переносить дубли.
+func NewFanout(publishers ...Publisher) Publisher {
+	return &fanoutPublisher{publishers: publishers}
+}
+
+func (p *fanoutPublisher) Publish(ctx context.Context, event domain.Event) error {
+	for _, pub := range p.publishers {
+		if err := pub.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *fanoutPublisher) Close() error {
+	var errs []error
+	for _, pub := range p.publishers {
+		if err := pub.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
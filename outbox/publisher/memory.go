@@ -0,0 +1,58 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+// MemoryPublisher хранит опубликованные события в памяти; предназначен для тестов и локального запуска
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []domain.Event
+	err    error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events возвращает копию опубликованных событий в порядке публикации
+func (p *MemoryPublisher) Events() []domain.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]domain.Event(nil), p.events...)
+}
+
+// FailWith заставляет последующие публикации возвращать err; nil снимает сбой
+func (p *MemoryPublisher) FailWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = nil
+	p.err = nil
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+// Publisher доставляет событие outbox во внешний транспорт. Ошибка означает, что событие
+// не принято, и ретранслятор повторит попытку позже.
+type Publisher interface {
+	Publish(ctx context.Context, event domain.Event) error
+	Close() error
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/outbox/repository"
+)
+
+// Append записывает события в outbox. Вызывается в транзакции изменения, чтобы событие
+// появлялось тогда и только тогда, когда изменение зафиксировано.
+func Append(ctx context.Context, tx sqlx.ExecerContext, events ...domain.Event) error {
+	query := `INSERT INTO outbox_events (type, aggregate_type, aggregate_id, payload, actor, request_id, occurred_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	now := time.Now().UTC()
+	for _, event := range events {
+		_, err := tx.ExecContext(ctx, query, event.Type, event.AggregateType, event.AggregateID, []byte(event.Payload),
+			requestinfo.VerifiedActor(ctx), requestinfo.RequestID(ctx), now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type outboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) repository.OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]domain.Event, error) {
+	query := `UPDATE outbox_events
+	          SET next_attempt_at = $2, attempts = attempts + 1
+	          WHERE id IN (
+	              SELECT id FROM outbox_events
+	              WHERE published_at IS NULL AND next_attempt_at <= now()
+	              ORDER BY id
+	              LIMIT $1
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING id, type, aggregate_type, aggregate_id, payload, actor, request_id, occurred_at, attempts`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, time.Now().UTC().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []domain.Event{}
+	for rows.Next() {
+		var e domain.Event
+		var payload []byte
+		err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &payload, &e.Actor, &e.RequestID,
+			&e.OccurredAt, &e.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING не гарантирует порядок
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox_events SET published_at = now(), last_error = '' WHERE id = $1`, id)
+	return err
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id int64, errMsg string, retryAt time.Time) error {
+	query := `UPDATE outbox_events SET last_error = $2, next_attempt_at = $3 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, errMsg, retryAt)
+	return err
+}
+
+// Reschedule возвращает события в очередь без учёта попытки, например хвост пачки после сбоя публикации
+func (r *outboxRepository) Reschedule(ctx context.Context, ids []int64, retryAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `UPDATE outbox_events SET next_attempt_at = $2, attempts = attempts - 1 WHERE id = ANY($1)`
+	_, err := r.db.ExecContext(ctx, query, pq.Array(ids), retryAt)
+	return err
+}
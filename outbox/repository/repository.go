@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/outbox/domain"
+	"time"
+)
+
+type OutboxRepository interface {
+	// ClaimPending забирает до limit неопубликованных событий и откладывает их повторную выдачу на lease,
+	// чтобы параллельные ретрансляторы не публиковали одно событие одновременно
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]domain.Event, error)
+	MarkPublished(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, errMsg string, retryAt time.Time) error
+	Reschedule(ctx context.Context, ids []int64, retryAt time.Time) error
+}
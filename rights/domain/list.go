@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	SortModuleAsc   = "module"
+	SortModuleDesc  = "-module"
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort: use module, -module, created_at or -created_at")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Filter — выборка каталога прав постранично. Search ищет подстроку в модуле и действиях,
+// Module оставляет записи одного модуля.
+type Filter struct {
+	Search string
+	Module string
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// Page — страница каталога; Total — число записей под фильтром без учёта пагинации
+type Page struct {
+	Rights     []Right `json:"rights"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Cursor — позиция последней выданной записи: ключ сортировки и ID
+type Cursor struct {
+	Sort      string    `json:"s"`
+	Module    string    `json:"m,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	ID        string    `json:"id"`
+}
+
+func CursorAfter(sort string, right Right) Cursor {
+	cursor := Cursor{Sort: sort, ID: right.ID}
+	if sort == SortModuleAsc || sort == SortModuleDesc {
+		cursor.Module = right.Module
+	} else {
+		cursor.CreatedAt = right.CreatedAt
+	}
+	return cursor
+}
+
+// EncodeCursor скрывает от клиента устройство курсора
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor проверяет, что курсор выдан для той же сортировки
+func DecodeCursor(cursor, sort string) (*Cursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortModuleAsc, SortModuleDesc, SortCreatedAsc, SortCreatedDesc:
+		return true
+	}
+	return false
+}
@@ -1,6 +1,12 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 type Right struct {
 	ID        string    `json:"id"`
@@ -9,3 +15,255 @@ type Right struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// UnknownRightsError перечисляет модули и действия, которых нет в каталоге rights
+type UnknownRightsError struct {
+	Modules []string            `json:"unknown_modules,omitempty"`
+	Actions map[string][]string `json:"unknown_actions,omitempty"`
+}
+
+func (e *UnknownRightsError) Error() string {
+	parts := make([]string, 0, 2)
+	if len(e.Modules) > 0 {
+		parts = append(parts, "unknown modules: "+strings.Join(e.Modules, ", "))
+	}
+	if len(e.Actions) > 0 {
+		modules := make([]string, 0, len(e.Actions))
+		for module := range e.Actions {
+			modules = append(modules, module)
+		}
+		sort.Strings(modules)
+
+		actions := make([]string, 0, len(modules))
+		for _, module := range modules {
+			actions = append(actions, fmt.Sprintf("%s: %s", module, strings.Join(e.Actions[module], ", ")))
+		}
+		parts = append(parts, "unknown actions: "+strings.Join(actions, "; "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Catalog — множество допустимых пар module/action
+type Catalog map[string]map[string]struct{}
+
+func NewCatalog(rights []Right) Catalog {
+	catalog := make(Catalog)
+	for _, right := range rights {
+		module := strings.TrimSpace(right.Module)
+		actions, ok := catalog[module]
+		if !ok {
+			actions = make(map[string]struct{})
+			catalog[module] = actions
+		}
+		for _, action := range right.Action {
+			actions[strings.TrimSpace(action)] = struct{}{}
+		}
+	}
+	return catalog
+}
+
+// NormalizeRights возвращает права с именами модулей и действий без пробелов по краям, как их хранит каталог.
+// Модули, совпавшие после обрезки, объединяются, повторы действий убираются.
+func NormalizeRights(rights map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(rights))
+	for module, actions := range rights {
+		module = strings.TrimSpace(module)
+		for _, action := range actions {
+			action = strings.TrimSpace(action)
+			if !containsAction(result[module], action) {
+				result[module] = append(result[module], action)
+			}
+		}
+		if _, ok := result[module]; !ok {
+			result[module] = []string{}
+		}
+	}
+	return result
+}
+
+func containsAction(actions []string, action string) bool {
+	for _, existing := range actions {
+		if existing == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate возвращает *UnknownRightsError, если права ссылаются на отсутствующие модули или действия.
+// Имена сравниваются без пробелов по краям, как их хранит NewCatalog; сохранять следует результат NormalizeRights.
+func (c Catalog) Validate(rights map[string][]string) error {
+	unknown := &UnknownRightsError{}
+	for module, actions := range rights {
+		known, ok := c[strings.TrimSpace(module)]
+		if !ok {
+			unknown.Modules = append(unknown.Modules, module)
+			continue
+		}
+		for _, action := range actions {
+			if _, ok := known[strings.TrimSpace(action)]; !ok {
+				if unknown.Actions == nil {
+					unknown.Actions = make(map[string][]string)
+				}
+				unknown.Actions[module] = append(unknown.Actions[module], action)
+			}
+		}
+	}
+
+	if len(unknown.Modules) == 0 && len(unknown.Actions) == 0 {
+		return nil
+	}
+	sort.Strings(unknown.Modules)
+	for module := range unknown.Actions {
+		sort.Strings(unknown.Actions[module])
+	}
+	return unknown
+}
+
+const (
+	HolderTypeUser = "user"
+	HolderTypeRole = "role"
+)
+
+// RightsHolder — пользователь или роль с правами в JSONB
+type RightsHolder struct {
+	Type   string
+	ID     string
+	Rights map[string][]string
+}
+
+// StaleGrant — права владельца, которых больше нет в каталоге
+type StaleGrant struct {
+	HolderType string              `json:"holder_type"`
+	HolderID   string              `json:"holder_id"`
+	Unknown    *UnknownRightsError `json:"unknown"`
+}
+
+// RightsDiff — добавленные и удалённые действия по модулям
+type RightsDiff struct {
+	Added   map[string][]string `json:"added,omitempty"`
+	Removed map[string][]string `json:"removed,omitempty"`
+}
+
+func (d RightsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Modules возвращает отсортированный список модулей, затронутых изменением
+func (d RightsDiff) Modules() []string {
+	return Modules(d.Added, d.Removed)
+}
+
+func DiffRights(before, after map[string][]string) RightsDiff {
+	return RightsDiff{
+		Added:   subtractRights(after, before),
+		Removed: subtractRights(before, after),
+	}
+}
+
+func subtractRights(from, other map[string][]string) map[string][]string {
+	var result map[string][]string
+	for module, actions := range from {
+		known := make(map[string]struct{}, len(other[module]))
+		for _, action := range other[module] {
+			known[action] = struct{}{}
+		}
+		for _, action := range actions {
+			if _, ok := known[action]; ok {
+				continue
+			}
+			if result == nil {
+				result = make(map[string][]string)
+			}
+			result[module] = append(result[module], action)
+		}
+	}
+	for module := range result {
+		sort.Strings(result[module])
+	}
+	return result
+}
+
+// ErrPermanentGrant — срочная выдача того, что уже выдано бессрочно. Срок не записывается,
+// чтобы не сократить действующий доступ: сначала нужно отозвать бессрочную выдачу.
+var ErrPermanentGrant = errors.New("already granted without expiry, a bounded grant would shorten it")
+
+// Validity — необязательный срок действия выдачи прав или роли
+type Validity struct {
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+func (v Validity) Bounded() bool {
+	return v.ValidFrom != nil || v.ValidUntil != nil
+}
+
+func (v Validity) Validate(now time.Time) error {
+	if v.ValidFrom != nil && v.ValidUntil != nil && !v.ValidUntil.After(*v.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+	if v.ValidUntil != nil && !v.ValidUntil.After(now) {
+		return errors.New("valid_until must be in the future")
+	}
+	return nil
+}
+
+func (v Validity) ActiveAt(t time.Time) bool {
+	if v.ValidFrom != nil && t.Before(*v.ValidFrom) {
+		return false
+	}
+	if v.ValidUntil != nil && !t.Before(*v.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// Modules возвращает отсортированный список модулей, встречающихся в наборах прав
+func Modules(sets ...map[string][]string) []string {
+	seen := make(map[string]struct{})
+	var modules []string
+	for _, set := range sets {
+		for module := range set {
+			if _, ok := seen[module]; ok {
+				continue
+			}
+			seen[module] = struct{}{}
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// MergeRights объединяет наборы прав без повторов действий
+func MergeRights(sets ...map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	seen := make(map[string]map[string]struct{})
+	for _, set := range sets {
+		for module, actions := range set {
+			if seen[module] == nil {
+				seen[module] = make(map[string]struct{})
+			}
+			for _, action := range actions {
+				if _, ok := seen[module][action]; ok {
+					continue
+				}
+				seen[module][action] = struct{}{}
+				result[module] = append(result[module], action)
+			}
+		}
+	}
+	return result
+}
+
+// Entitlements разворачивает набор прав в отсортированный список «модуль:действие»
+func Entitlements(rights map[string][]string) []string {
+	entitlements := make([]string, 0, len(rights))
+	for module, actions := range rights {
+		for _, action := range actions {
+			entitlements = append(entitlements, module+":"+action)
+		}
+	}
+	sort.Strings(entitlements)
+	return entitlements
+}
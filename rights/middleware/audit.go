@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/rights/service"
+)
+
+// auditingService записывает в журнал аудита изменения каталога прав
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.RightsService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.RightsService) service.RightsService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetID string, before, after *domain.Right) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, auditDomain.TargetRight, targetID, before, after))
+}
+
+func (a *auditingService) byName(ctx context.Context, module string) *domain.Right {
+	right, err := a.next.GetRightByName(ctx, module)
+	if err != nil {
+		return nil
+	}
+	return right
+}
+
+func (a *auditingService) byID(ctx context.Context, id string) *domain.Right {
+	right, err := a.next.GetRightById(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return right
+}
+
+func (a *auditingService) AddRights(ctx context.Context, module string, action []string) error {
+	before := a.byName(ctx, module)
+	if err := a.next.AddRights(ctx, module, action); err != nil {
+		return err
+	}
+	a.record(ctx, "right.add", module, before, a.byName(ctx, module))
+	return nil
+}
+
+func (a *auditingService) EditRight(ctx context.Context, id string, module string, action []string) error {
+	before := a.byID(ctx, id)
+	if err := a.next.EditRight(ctx, id, module, action); err != nil {
+		return err
+	}
+	a.record(ctx, "right.edit", id, before, a.byID(ctx, id))
+	return nil
+}
+
+func (a *auditingService) GetAllRights(ctx context.Context) ([]domain.Right, error) {
+	return a.next.GetAllRights(ctx)
+}
+
+func (a *auditingService) ListRights(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return a.next.ListRights(ctx, filter)
+}
+
+func (a *auditingService) GetRightByName(ctx context.Context, module string) (*domain.Right, error) {
+	return a.next.GetRightByName(ctx, module)
+}
+
+func (a *auditingService) GetRightById(ctx context.Context, id string) (*domain.Right, error) {
+	return a.next.GetRightById(ctx, id)
+}
+
+func (a *auditingService) DeleteRight(ctx context.Context, id string) error {
+	before := a.byID(ctx, id)
+	if err := a.next.DeleteRight(ctx, id); err != nil {
+		return err
+	}
+	a.record(ctx, "right.delete", id, before, nil)
+	return nil
+}
+
+func (a *auditingService) ValidateRights(ctx context.Context, rights map[string][]string) error {
+	return a.next.ValidateRights(ctx, rights)
+}
+
+func (a *auditingService) CheckConsistency(ctx context.Context) ([]domain.StaleGrant, error) {
+	return a.next.CheckConsistency(ctx)
+}
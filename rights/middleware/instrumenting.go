@@ -66,6 +66,20 @@ func (s *instrumentingService) GetAllRights(ctx context.Context) (rights []domai
 	return s.next.GetAllRights(ctx)
 }
 
+// ListRights
+func (s *instrumentingService) ListRights(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListRights"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListRights(ctx, filter)
+}
+
 // GetRightByName
 func (s *instrumentingService) GetRightByName(ctx context.Context, module string) (right *domain.Right, err error) {
 	defer func(begin time.Time) {
@@ -107,3 +121,31 @@ func (s *instrumentingService) DeleteRight(ctx context.Context, id string) (err
 
 	return s.next.DeleteRight(ctx, id)
 }
+
+// ValidateRights
+func (s *instrumentingService) ValidateRights(ctx context.Context, rights map[string][]string) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ValidateRights"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ValidateRights(ctx, rights)
+}
+
+// CheckConsistency
+func (s *instrumentingService) CheckConsistency(ctx context.Context) (stale []domain.StaleGrant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CheckConsistency"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CheckConsistency(ctx)
+}
@@ -57,6 +57,23 @@ func (l *loggingService) GetAllRights(ctx context.Context) (rights []domain.Righ
 	return l.next.GetAllRights(ctx)
 }
 
+// ListRights
+func (l *loggingService) ListRights(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListRights",
+			"search", filter.Search,
+			"module", filter.Module,
+			"sort", filter.Sort,
+			"count", len(page.Rights),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListRights(ctx, filter)
+}
+
 // GetRightByName
 func (l *loggingService) GetRightByName(ctx context.Context, module string) (right *domain.Right, err error) {
 	defer func(begin time.Time) {
@@ -99,6 +116,34 @@ func (l *loggingService) DeleteRight(ctx context.Context, id string) (err error)
 	return l.next.DeleteRight(ctx, id)
 }
 
+// ValidateRights
+func (l *loggingService) ValidateRights(ctx context.Context, rights map[string][]string) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ValidateRights",
+			"rights", rights,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ValidateRights(ctx, rights)
+}
+
+// CheckConsistency
+func (l *loggingService) CheckConsistency(ctx context.Context) (stale []domain.StaleGrant, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CheckConsistency",
+			"stale", len(stale),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CheckConsistency(ctx)
+}
+
 func NewLoggingMiddleware(logger log.Logger, next service.RightsService) *loggingService {
 	return &loggingService{
 		logger: logger,
@@ -4,11 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	domain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/rights/repository"
+	"strconv"
 	"strings"
 )
 
@@ -66,6 +68,81 @@ func (r *PostgresRightsRepository) GetAllRights(ctx context.Context) ([]domain.R
 	return rights, nil
 }
 
+// rightFilter — условия фильтра каталога; $1 — шаблон поиска по модулю и действиям, $2 — модуль
+const rightFilter = `WHERE ($1::text = '' OR module ILIKE $1::text OR action::text ILIKE $1::text)
+	  AND ($2::text = '' OR module = $2::text)`
+
+// rightSorts — допустимые сортировки: порядок и условие продолжения после курсора.
+// ID замыкает каждый порядок, чтобы он был однозначным между страницами.
+var rightSorts = map[string]struct {
+	order, after string
+	byModule     bool
+}{
+	domain.SortModuleAsc:   {"module, id", "(module, id) > ($3::text, $4::uuid)", true},
+	domain.SortModuleDesc:  {"module DESC, id DESC", "(module, id) < ($3::text, $4::uuid)", true},
+	domain.SortCreatedAsc:  {"created_at, id", "(created_at, id) > ($3::timestamp, $4::uuid)", false},
+	domain.SortCreatedDesc: {"created_at DESC, id DESC", "(created_at, id) < ($3::timestamp, $4::uuid)", false},
+}
+
+// ListRights возвращает записи каталога под фильтром в порядке filter.Sort;
+// after продолжает выборку после курсора
+func (r *PostgresRightsRepository) ListRights(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Right, error) {
+	sort, ok := rightSorts[filter.Sort]
+	if !ok {
+		return nil, domain.ErrInvalidSort
+	}
+
+	query := `SELECT id, module, action, created_at, updated_at FROM rights ` + rightFilter
+	args := []interface{}{likeContains(filter.Search), filter.Module}
+	if after != nil {
+		query += ` AND ` + sort.after
+		if sort.byModule {
+			args = append(args, after.Module)
+		} else {
+			args = append(args, after.CreatedAt)
+		}
+		args = append(args, after.ID)
+	}
+	args = append(args, limit)
+	query += ` ORDER BY ` + sort.order + ` LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rights := []domain.Right{}
+	for rows.Next() {
+		var right domain.Right
+		var actionRaw string
+
+		if err := rows.Scan(&right.ID, &right.Module, &actionRaw, &right.CreatedAt, &right.UpdatedAt); err != nil {
+			return nil, err
+		}
+		right.Action = parseAction(actionRaw)
+
+		rights = append(rights, right)
+	}
+
+	return rights, rows.Err()
+}
+
+func (r *PostgresRightsRepository) CountRights(ctx context.Context, filter domain.Filter) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM rights `+rightFilter, likeContains(filter.Search), filter.Module).
+		Scan(&total)
+	return total, err
+}
+
+// likeContains превращает строку в шаблон ILIKE на вхождение, экранируя спецсимволы; пустая остаётся пустой
+func likeContains(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
 func (r *PostgresRightsRepository) GetRightByName(ctx context.Context, module string) (*domain.Right, error) {
 	query := `SELECT id, module, action, created_at, updated_at FROM rights WHERE module = $1`
 	row := r.db.QueryRowContext(ctx, query, module)
@@ -111,6 +188,38 @@ func (r *PostgresRightsRepository) DeleteRight(ctx context.Context, id string) e
 	return err
 }
 
+// GetRightsHolders возвращает права всех пользователей и ролей для проверки согласованности с каталогом
+func (r *PostgresRightsRepository) GetRightsHolders(ctx context.Context) ([]domain.RightsHolder, error) {
+	query := `SELECT 'user', id::text, rights FROM "users"
+	          UNION ALL
+	          SELECT 'role', role_id::text, rights FROM roles`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holders []domain.RightsHolder
+	for rows.Next() {
+		var holder domain.RightsHolder
+		var rightsJSON []byte
+
+		if err := rows.Scan(&holder.Type, &holder.ID, &rightsJSON); err != nil {
+			return nil, err
+		}
+
+		if len(rightsJSON) > 0 {
+			if err := json.Unmarshal(rightsJSON, &holder.Rights); err != nil {
+				return nil, fmt.Errorf("failed to parse rights JSON of %s %s: %v", holder.Type, holder.ID, err)
+			}
+		}
+
+		holders = append(holders, holder)
+	}
+
+	return holders, rows.Err()
+}
+
 func parseAction(actionRaw string) []string {
 	actionRaw = strings.ReplaceAll(actionRaw, "{", "")
 	actionRaw = strings.ReplaceAll(actionRaw, "}", "")
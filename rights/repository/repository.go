@@ -9,7 +9,10 @@ type RightsRepository interface {
 	AddRights(ctx context.Context, module string, action []string) error
 	EditRight(ctx context.Context, id string, module string, action []string) error
 	GetAllRights(ctx context.Context) ([]domain.Right, error)
+	ListRights(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Right, error)
+	CountRights(ctx context.Context, filter domain.Filter) (int, error)
 	GetRightByName(ctx context.Context, module string) (*domain.Right, error)
 	GetRightById(ctx context.Context, id string) (*domain.Right, error)
 	DeleteRight(ctx context.Context, id string) error
+	GetRightsHolders(ctx context.Context) ([]domain.RightsHolder, error)
 }
@@ -3,6 +3,7 @@ package rights
 import (
 	"github.com/go-kit/kit/log"
 	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit"
 	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
 	"github.com/rafaceo/go-test-auth/rights/middleware"
 	"github.com/rafaceo/go-test-auth/rights/repository/postgres"
@@ -14,6 +15,7 @@ func CreateRightsService(logger log.Logger, postgresClient *sqlx.DB) service.Rig
 	rightsRepo := postgres.NewPostgresRightsRepository(postgresClient)
 
 	rightsServ := service.NewRightsService(rightsRepo)
+	rightsServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), rightsServ)
 	rightsServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "rights"), rightsServ)
 	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("user_profile_service")
 	rightsServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, rightsServ)
@@ -2,10 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/rights/repository"
 )
 
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
 type rightsService struct {
 	repo repository.RightsRepository
 }
@@ -14,9 +20,12 @@ type RightsService interface {
 	AddRights(ctx context.Context, module string, action []string) error
 	EditRight(ctx context.Context, id string, module string, action []string) error
 	GetAllRights(ctx context.Context) ([]domain.Right, error)
+	ListRights(ctx context.Context, filter domain.Filter) (domain.Page, error)
 	GetRightByName(ctx context.Context, module string) (*domain.Right, error)
 	GetRightById(ctx context.Context, id string) (*domain.Right, error)
 	DeleteRight(ctx context.Context, id string) error
+	ValidateRights(ctx context.Context, rights map[string][]string) error
+	CheckConsistency(ctx context.Context) ([]domain.StaleGrant, error)
 }
 
 func NewRightsService(repo repository.RightsRepository) RightsService {
@@ -35,6 +44,43 @@ func (s *rightsService) GetAllRights(ctx context.Context) ([]domain.Right, error
 	return s.repo.GetAllRights(ctx)
 }
 
+// ListRights возвращает страницу каталога прав; по умолчанию записи упорядочены по модулю
+func (s *rightsService) ListRights(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	if filter.Sort == "" {
+		filter.Sort = domain.SortModuleAsc
+	}
+	if !domain.ValidSort(filter.Sort) {
+		return domain.Page{}, domain.ErrInvalidSort
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+
+	after, err := domain.DecodeCursor(filter.Cursor, filter.Sort)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	items, err := s.repo.ListRights(ctx, filter, after, filter.Limit+1)
+	if err != nil {
+		return domain.Page{}, err
+	}
+	total, err := s.repo.CountRights(ctx, filter)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	page := domain.Page{Rights: items, Total: total}
+	if len(items) > filter.Limit {
+		page.Rights = items[:filter.Limit]
+		page.NextCursor = domain.EncodeCursor(domain.CursorAfter(filter.Sort, page.Rights[filter.Limit-1]))
+	}
+	return page, nil
+}
+
 func (s *rightsService) GetRightByName(ctx context.Context, module string) (*domain.Right, error) {
 	return s.repo.GetRightByName(ctx, module)
 }
@@ -46,3 +92,40 @@ func (s *rightsService) GetRightById(ctx context.Context, id string) (*domain.Ri
 func (s *rightsService) DeleteRight(ctx context.Context, id string) error {
 	return s.repo.DeleteRight(ctx, id)
 }
+
+// ValidateRights сверяет права с каталогом rights и возвращает *domain.UnknownRightsError при расхождении
+func (s *rightsService) ValidateRights(ctx context.Context, rights map[string][]string) error {
+	all, err := s.repo.GetAllRights(ctx)
+	if err != nil {
+		return err
+	}
+	return domain.NewCatalog(all).Validate(rights)
+}
+
+// CheckConsistency ищет в users.rights и roles.rights записи, отсутствующие в каталоге
+func (s *rightsService) CheckConsistency(ctx context.Context) ([]domain.StaleGrant, error) {
+	all, err := s.repo.GetAllRights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	catalog := domain.NewCatalog(all)
+
+	holders, err := s.repo.GetRightsHolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []domain.StaleGrant
+	for _, holder := range holders {
+		var unknown *domain.UnknownRightsError
+		if errors.As(catalog.Validate(holder.Rights), &unknown) {
+			stale = append(stale, domain.StaleGrant{
+				HolderType: holder.Type,
+				HolderID:   holder.ID,
+				Unknown:    unknown,
+			})
+		}
+	}
+
+	return stale, nil
+}
@@ -11,27 +11,34 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
 	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
 	"github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/rights/service"
 	"net/http"
+	"strconv"
 )
 
-func GetRightHandlers(serv service.RightsService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+// GetRightHandlers: изменения каталога прав попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetRightHandlers(serv service.RightsService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
 	}
+	authenticated := authn.Middleware(tokens)
 
 	addRightHandler := kithttp.NewServer(
-		MakeAddRightEndpoint(serv),
+		authenticated(MakeAddRightEndpoint(serv)),
 		DecodeAddRightRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	editRightHandler := kithttp.NewServer(
-		MakeEditRightEndpoint(serv),
+		authenticated(MakeEditRightEndpoint(serv)),
 		DecodeEditRightRequest,
 		EncodeResponse,
 		opts...,
@@ -59,7 +66,7 @@ func GetRightHandlers(serv service.RightsService, logger kitlog.Logger) []*httph
 	)
 
 	deleteRightHandler := kithttp.NewServer(
-		MakeDeleteRightEndpoint(serv),
+		authenticated(MakeDeleteRightEndpoint(serv)),
 		DecodeDeleteRightRequest,
 		EncodeResponse,
 		opts...,
@@ -119,10 +126,11 @@ type EditRightResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
-type GetAllRightsRequest struct{}
 type GetAllRightsResponse struct {
-	Rights []domain.Right `json:"rights"`
-	Err    error          `json:"error,omitempty"`
+	Rights     []domain.Right `json:"rights"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Err        error          `json:"error,omitempty"`
 }
 
 type GetRightByNameRequest struct {
@@ -170,8 +178,8 @@ func MakeEditRightEndpoint(svc service.RightsService) endpoint.Endpoint {
 
 func MakeGetAllRightsEndpoint(svc service.RightsService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		rights, err := svc.GetAllRights(ctx)
-		return GetAllRightsResponse{Rights: rights, Err: err}, err
+		page, err := svc.ListRights(ctx, request.(domain.Filter))
+		return GetAllRightsResponse{Rights: page.Rights, Total: page.Total, NextCursor: page.NextCursor, Err: err}, err
 	}
 }
 
@@ -217,8 +225,23 @@ func DecodeEditRightRequest(_ context.Context, r *http.Request) (interface{}, er
 	return req, nil
 }
 
+// DecodeGetAllRightsRequest собирает фильтр каталога из query: search, module, sort, limit, cursor
 func DecodeGetAllRightsRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	return GetAllRightsRequest{}, nil
+	query := r.URL.Query()
+	filter := domain.Filter{
+		Search: query.Get("search"),
+		Module: query.Get("module"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
 }
 
 func DecodeGetRightByNameRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	SortNameAsc  = "role_name"
+	SortNameDesc = "-role_name"
+	SortIDAsc    = "id"
+	SortIDDesc   = "-id"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort: use role_name, -role_name, id or -id")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Filter — выборка ролей постранично. Search ищет подстроку в role_name и role_name_ru,
+// Module оставляет роли, в правах которых есть этот модуль.
+type Filter struct {
+	Search string
+	Module string
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// Page — страница ролей; Total — число ролей под фильтром без учёта пагинации
+type Page struct {
+	Roles      []Role `json:"roles"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Cursor — позиция последней выданной роли: имя (для сортировки по имени) и ID
+type Cursor struct {
+	Sort string `json:"s"`
+	Name string `json:"n,omitempty"`
+	ID   int    `json:"id"`
+}
+
+func CursorAfter(sort string, role Role) Cursor {
+	cursor := Cursor{Sort: sort, ID: role.ID}
+	if sort == SortNameAsc || sort == SortNameDesc {
+		cursor.Name = role.Name
+	}
+	return cursor
+}
+
+// EncodeCursor скрывает от клиента устройство курсора
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor проверяет, что курсор выдан для той же сортировки
+func DecodeCursor(cursor, sort string) (*Cursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortNameAsc, SortNameDesc, SortIDAsc, SortIDDesc:
+		return true
+	}
+	return false
+}
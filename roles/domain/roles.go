@@ -1,9 +1,73 @@
 package domain
 
+import (
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"time"
+)
+
 type Role struct {
-	ID     int                 `json:"id,omitempty"`
-	Name   string              `json:"role_name"`
-	NameRu string              `json:"role_name_ru"`
-	Notes  string              `json:"notes"`
-	Rights map[string][]string `json:"rights"`
+	ID      int                 `json:"id,omitempty"`
+	Name    string              `json:"role_name"`
+	NameRu  string              `json:"role_name_ru"`
+	Notes   string              `json:"notes"`
+	Rights  map[string][]string `json:"rights"`
+	Version int                 `json:"version,omitempty"`
+}
+
+// RoleVersion — неизменяемый снимок роли после очередного изменения
+type RoleVersion struct {
+	RoleID    int                 `json:"role_id"`
+	Version   int                 `json:"version"`
+	Name      string              `json:"role_name"`
+	NameRu    string              `json:"role_name_ru"`
+	Notes     string              `json:"notes"`
+	Rights    map[string][]string `json:"rights"`
+	Author    string              `json:"author"`
+	Diff      RoleDiff            `json:"diff"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+func (v RoleVersion) Role() Role {
+	return Role{
+		ID:      v.RoleID,
+		Name:    v.Name,
+		NameRu:  v.NameRu,
+		Notes:   v.Notes,
+		Rights:  v.Rights,
+		Version: v.Version,
+	}
+}
+
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type RoleDiff struct {
+	Fields map[string]FieldChange  `json:"fields,omitempty"`
+	Rights rightsDomain.RightsDiff `json:"rights"`
+}
+
+func DiffRoles(before, after Role) RoleDiff {
+	diff := RoleDiff{Rights: rightsDomain.DiffRights(before.Rights, after.Rights)}
+
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"role_name", before.Name, after.Name},
+		{"role_name_ru", before.NameRu, after.NameRu},
+		{"notes", before.Notes, after.Notes},
+	}
+	for _, field := range fields {
+		if field.before == field.after {
+			continue
+		}
+		if diff.Fields == nil {
+			diff.Fields = make(map[string]FieldChange)
+		}
+		diff.Fields[field.name] = FieldChange{From: field.before, To: field.after}
+	}
+
+	return diff
 }
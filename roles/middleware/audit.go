@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/roles/domain"
+	"github.com/rafaceo/go-test-auth/roles/service"
+	"strconv"
+)
+
+// auditingService записывает в журнал аудита изменения ролей и их назначения пользователям
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.RoleService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.RoleService) service.RoleService {
+	return &auditingService{audit: audit, next: s}
+}
+
+type roleAssignment struct {
+	RoleID     int    `json:"role_id"`
+	MerchantID string `json:"merchant_id,omitempty"`
+	Merge      bool   `json:"merge"`
+	rightsDomain.Validity
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, targetType, targetID, before, after))
+}
+
+// snapshot возвращает роль целиком или nil, если её не удалось прочитать
+func (a *auditingService) snapshot(ctx context.Context, match func(domain.Role) bool) *domain.Role {
+	roles, err := a.next.GetRoles(ctx)
+	if err != nil {
+		return nil
+	}
+	for i := range roles {
+		if match(roles[i]) {
+			return &roles[i]
+		}
+	}
+	return nil
+}
+
+func (a *auditingService) byID(ctx context.Context, roleID int) *domain.Role {
+	return a.snapshot(ctx, func(r domain.Role) bool { return r.ID == roleID })
+}
+
+func (a *auditingService) AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	if err := a.next.AddRole(ctx, roleName, roleNameRu, notes, rights); err != nil {
+		return err
+	}
+
+	after := a.snapshot(ctx, func(r domain.Role) bool { return r.Name == roleName })
+	targetID := roleName
+	if after != nil {
+		targetID = strconv.Itoa(after.ID)
+	}
+	a.record(ctx, "role.create", auditDomain.TargetRole, targetID, nil, after)
+	return nil
+}
+
+func (a *auditingService) EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	before := a.byID(ctx, roleID)
+	if err := a.next.EditRole(ctx, roleID, roleName, roleNameRu, notes, rights); err != nil {
+		return err
+	}
+	a.record(ctx, "role.edit", auditDomain.TargetRole, strconv.Itoa(roleID), before, a.byID(ctx, roleID))
+	return nil
+}
+
+func (a *auditingService) GetRoles(ctx context.Context) ([]domain.Role, error) {
+	return a.next.GetRoles(ctx)
+}
+
+func (a *auditingService) ListRoles(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return a.next.ListRoles(ctx, filter)
+}
+
+func (a *auditingService) GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error) {
+	return a.next.GetRoleRights(ctx, roleID)
+}
+
+func (a *auditingService) DeleteRole(ctx context.Context, roleID int) error {
+	before := a.byID(ctx, roleID)
+	if err := a.next.DeleteRole(ctx, roleID); err != nil {
+		return err
+	}
+	a.record(ctx, "role.delete", auditDomain.TargetRole, strconv.Itoa(roleID), before, nil)
+	return nil
+}
+
+func (a *auditingService) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error {
+	if err := a.next.AssignRoleToUser(ctx, userID, roleID, merchantID, merge, validity); err != nil {
+		return err
+	}
+	after := roleAssignment{RoleID: roleID, MerchantID: merchantID, Merge: merge, Validity: validity}
+	a.record(ctx, "role.assign", auditDomain.TargetUser, userID.String(), nil, after)
+	return nil
+}
+
+func (a *auditingService) GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error) {
+	return a.next.GetRoleVersions(ctx, roleID)
+}
+
+func (a *auditingService) DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (domain.RoleDiff, error) {
+	return a.next.DiffRoleVersions(ctx, roleID, fromVersion, toVersion)
+}
+
+func (a *auditingService) RollbackRole(ctx context.Context, roleID int, version int) error {
+	before := a.byID(ctx, roleID)
+	if err := a.next.RollbackRole(ctx, roleID, version); err != nil {
+		return err
+	}
+	a.record(ctx, "role.rollback", auditDomain.TargetRole, strconv.Itoa(roleID), before, a.byID(ctx, roleID))
+	return nil
+}
@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 	"github.com/rafaceo/go-test-auth/roles/service"
 	"time"
@@ -63,6 +65,19 @@ func (s *instrumentingService) GetRoles(ctx context.Context) (roles []domain.Rol
 	return s.next.GetRoles(ctx)
 }
 
+func (s *instrumentingService) ListRoles(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListRoles"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListRoles(ctx, filter)
+}
+
 func (s *instrumentingService) GetRoleRights(ctx context.Context, roleID int) (rights map[string][]string, err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "GetRoleRights"}
@@ -89,7 +104,7 @@ func (s *instrumentingService) DeleteRole(ctx context.Context, roleID int) (err
 	return s.next.DeleteRole(ctx, roleID)
 }
 
-func (s *instrumentingService) AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) (err error) {
+func (s *instrumentingService) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) (err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "AssignRoleToUser"}
 		s.requestCount.With(labels...).Add(1)
@@ -99,5 +114,44 @@ func (s *instrumentingService) AssignRoleToUser(ctx context.Context, userID int,
 		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.AssignRoleToUser(ctx, userID, roleID, merge)
+	return s.next.AssignRoleToUser(ctx, userID, roleID, merchantID, merge, validity)
+}
+
+func (s *instrumentingService) GetRoleVersions(ctx context.Context, roleID int) (versions []domain.RoleVersion, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetRoleVersions"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetRoleVersions(ctx, roleID)
+}
+
+func (s *instrumentingService) DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (diff domain.RoleDiff, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DiffRoleVersions"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DiffRoleVersions(ctx, roleID, fromVersion, toVersion)
+}
+
+func (s *instrumentingService) RollbackRole(ctx context.Context, roleID int, version int) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "RollbackRole"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.RollbackRole(ctx, roleID, version)
 }
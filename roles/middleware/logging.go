@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 	"github.com/rafaceo/go-test-auth/roles/service"
 	"time"
@@ -59,6 +61,22 @@ func (l loggingService) GetRoles(ctx context.Context) (roles []domain.Role, err
 	return l.next.GetRoles(ctx)
 }
 
+func (l loggingService) ListRoles(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListRoles",
+			"took", time.Since(begin),
+			"search", filter.Search,
+			"module", filter.Module,
+			"sort", filter.Sort,
+			"count", len(page.Roles),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListRoles(ctx, filter)
+}
+
 func (l loggingService) GetRoleRights(ctx context.Context, roleID int) (rights map[string][]string, err error) {
 	defer func(begin time.Time) {
 		_ = l.logger.Log(
@@ -86,19 +104,64 @@ func (l loggingService) DeleteRole(ctx context.Context, roleID int) (err error)
 	return l.next.DeleteRole(ctx, roleID)
 }
 
-func (l loggingService) AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) (err error) {
+func (l loggingService) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) (err error) {
 	defer func(begin time.Time) {
 		_ = l.logger.Log(
 			"method", "AssignRoleToUser",
 			"took", time.Since(begin),
 			"userID", userID,
 			"roleID", roleID,
+			"merchantID", merchantID,
 			"merge", merge,
+			"validity", validity,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.AssignRoleToUser(ctx, userID, roleID, merchantID, merge, validity)
+}
+
+func (l loggingService) GetRoleVersions(ctx context.Context, roleID int) (versions []domain.RoleVersion, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetRoleVersions",
+			"took", time.Since(begin),
+			"roleID", roleID,
+			"count", len(versions),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetRoleVersions(ctx, roleID)
+}
+
+func (l loggingService) DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (diff domain.RoleDiff, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DiffRoleVersions",
+			"took", time.Since(begin),
+			"roleID", roleID,
+			"from", fromVersion,
+			"to", toVersion,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DiffRoleVersions(ctx, roleID, fromVersion, toVersion)
+}
+
+func (l loggingService) RollbackRole(ctx context.Context, roleID int, version int) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "RollbackRole",
+			"took", time.Since(begin),
+			"roleID", roleID,
+			"version", version,
 			"err", err,
 		)
 	}(time.Now())
 
-	return l.next.AssignRoleToUser(ctx, userID, roleID, merge)
+	return l.next.RollbackRole(ctx, roleID, version)
 }
 
 func NewLoggingMiddleware(logger log.Logger, s service.RoleService) service.RoleService {
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/roles/domain"
+	"github.com/rafaceo/go-test-auth/roles/service"
+)
+
+// SensitiveGuard проверяет, что выдаваемые права не относятся к чувствительным модулям
+type SensitiveGuard interface {
+	CheckDirectGrant(ctx context.Context, rights map[string][]string) error
+}
+
+// sensitiveGuardService отказывает в назначении роли с правами чувствительных модулей:
+// такую роль получают только через заявку на доступ. Изменение и откат роли не могут добавить
+// ей чувствительные модули: их сразу получили бы все, кому роль уже назначена.
+type sensitiveGuardService struct {
+	guard SensitiveGuard
+	next  service.RoleService
+}
+
+func NewSensitiveGuardMiddleware(guard SensitiveGuard, s service.RoleService) service.RoleService {
+	return &sensitiveGuardService{guard: guard, next: s}
+}
+
+func (g *sensitiveGuardService) AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	return g.next.AddRole(ctx, roleName, roleNameRu, notes, rights)
+}
+
+func (g *sensitiveGuardService) EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	if err := g.checkAdded(ctx, roleID, rights); err != nil {
+		return err
+	}
+	return g.next.EditRole(ctx, roleID, roleName, roleNameRu, notes, rights)
+}
+
+func (g *sensitiveGuardService) GetRoles(ctx context.Context) ([]domain.Role, error) {
+	return g.next.GetRoles(ctx)
+}
+
+func (g *sensitiveGuardService) ListRoles(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return g.next.ListRoles(ctx, filter)
+}
+
+func (g *sensitiveGuardService) GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error) {
+	return g.next.GetRoleRights(ctx, roleID)
+}
+
+func (g *sensitiveGuardService) DeleteRole(ctx context.Context, roleID int) error {
+	return g.next.DeleteRole(ctx, roleID)
+}
+
+func (g *sensitiveGuardService) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error {
+	rights, err := g.next.GetRoleRights(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if err := g.guard.CheckDirectGrant(ctx, rights); err != nil {
+		return err
+	}
+	return g.next.AssignRoleToUser(ctx, userID, roleID, merchantID, merge, validity)
+}
+
+func (g *sensitiveGuardService) GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error) {
+	return g.next.GetRoleVersions(ctx, roleID)
+}
+
+func (g *sensitiveGuardService) DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (domain.RoleDiff, error) {
+	return g.next.DiffRoleVersions(ctx, roleID, fromVersion, toVersion)
+}
+
+func (g *sensitiveGuardService) RollbackRole(ctx context.Context, roleID int, version int) error {
+	versions, err := g.next.GetRoleVersions(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if v.Version != version {
+			continue
+		}
+		if err := g.checkAdded(ctx, roleID, v.Rights); err != nil {
+			return err
+		}
+		break
+	}
+	return g.next.RollbackRole(ctx, roleID, version)
+}
+
+// checkAdded проверяет только права, которых у роли ещё нет: уже выданные по заявке модули
+// не мешают менять остальное
+func (g *sensitiveGuardService) checkAdded(ctx context.Context, roleID int, rights map[string][]string) error {
+	current, err := g.next.GetRoleRights(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	added := rightsDomain.DiffRights(current, rights).Added
+	if len(added) == 0 {
+		return nil
+	}
+	return g.guard.CheckDirectGrant(ctx, added)
+}
@@ -2,11 +2,19 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 	"github.com/rafaceo/go-test-auth/roles/repository"
+	"strconv"
+	"strings"
 )
 
 type roleRepo struct {
@@ -18,19 +26,46 @@ func NewRoleRepository(db *sqlx.DB) repository.RoleRepository {
 }
 
 func (r *roleRepo) AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error {
-	query := `INSERT INTO roles (role_name, role_name_ru, notes, rights) 
-	          VALUES ($1, $2, $3, $4)`
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	rightsJSON, err := json.Marshal(rights)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.db.ExecContext(ctx, query, roleName, roleNameRu, notes, rightsJSON)
-	return err
+	query := `INSERT INTO roles (role_name, role_name_ru, notes, rights) 
+	          VALUES ($1, $2, $3, $4)
+	          RETURNING role_id`
+
+	var roleID int
+	if err := tx.QueryRowContext(ctx, query, roleName, roleNameRu, notes, rightsJSON).Scan(&roleID); err != nil {
+		return err
+	}
+
+	after := domain.Role{ID: roleID, Name: roleName, NameRu: roleNameRu, Notes: notes, Rights: rights}
+	if err := RecordVersion(ctx, tx, domain.Role{}, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *roleRepo) EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getRoleForUpdate(ctx, tx, roleID)
+	if err != nil {
+		return err
+	}
+
 	query := `UPDATE roles 
 	          SET role_name = $1, role_name_ru = $2, notes = $3, rights = $4
 	          WHERE role_id = $5`
@@ -40,12 +75,20 @@ func (r *roleRepo) EditRole(ctx context.Context, roleID int, roleName, roleNameR
 		return err
 	}
 
-	_, err = r.db.ExecContext(ctx, query, roleName, roleNameRu, notes, rightsJSON, roleID)
-	return err
+	if _, err := tx.ExecContext(ctx, query, roleName, roleNameRu, notes, rightsJSON, roleID); err != nil {
+		return err
+	}
+
+	after := domain.Role{ID: roleID, Name: roleName, NameRu: roleNameRu, Notes: notes, Rights: rights}
+	if err := RecordVersion(ctx, tx, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *roleRepo) GetRoles(ctx context.Context) ([]domain.Role, error) {
-	query := `SELECT role_id, role_name, role_name_ru, notes, rights FROM roles`
+	query := `SELECT role_id, role_name, role_name_ru, notes, rights, current_version FROM roles`
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -58,7 +101,7 @@ func (r *roleRepo) GetRoles(ctx context.Context) ([]domain.Role, error) {
 		var role domain.Role
 		var rightsJSON []byte
 
-		if err := rows.Scan(&role.ID, &role.Name, &role.NameRu, &role.Notes, &rightsJSON); err != nil {
+		if err := rows.Scan(&role.ID, &role.Name, &role.NameRu, &role.Notes, &rightsJSON, &role.Version); err != nil {
 			return nil, err
 		}
 
@@ -72,6 +115,80 @@ func (r *roleRepo) GetRoles(ctx context.Context) ([]domain.Role, error) {
 	return roles, nil
 }
 
+// roleFilter — условия фильтра ролей; $1 — шаблон поиска по именам, $2 — модуль
+const roleFilter = `WHERE ($1::text = '' OR role_name ILIKE $1::text OR role_name_ru ILIKE $1::text)
+	  AND ($2::text = '' OR rights -> $2::text IS NOT NULL)`
+
+// roleSorts — допустимые сортировки: порядок и условие продолжения после курсора.
+// ID замыкает каждый порядок, чтобы он был однозначным между страницами.
+var roleSorts = map[string]struct {
+	order, after string
+	byName       bool
+}{
+	domain.SortNameAsc:  {"role_name, role_id", "(role_name, role_id) > ($3::text, $4::int)", true},
+	domain.SortNameDesc: {"role_name DESC, role_id DESC", "(role_name, role_id) < ($3::text, $4::int)", true},
+	domain.SortIDAsc:    {"role_id", "role_id > $3::int", false},
+	domain.SortIDDesc:   {"role_id DESC", "role_id < $3::int", false},
+}
+
+// ListRoles возвращает роли под фильтром в порядке filter.Sort; after продолжает выборку после курсора
+func (r *roleRepo) ListRoles(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Role, error) {
+	sort, ok := roleSorts[filter.Sort]
+	if !ok {
+		return nil, domain.ErrInvalidSort
+	}
+
+	query := `SELECT role_id, role_name, role_name_ru, notes, rights, current_version FROM roles ` + roleFilter
+	args := []interface{}{likeContains(filter.Search), filter.Module}
+	if after != nil {
+		query += ` AND ` + sort.after
+		if sort.byName {
+			args = append(args, after.Name)
+		}
+		args = append(args, after.ID)
+	}
+	args = append(args, limit)
+	query += ` ORDER BY ` + sort.order + ` LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+	for rows.Next() {
+		var role domain.Role
+		var rightsJSON []byte
+
+		if err := rows.Scan(&role.ID, &role.Name, &role.NameRu, &role.Notes, &rightsJSON, &role.Version); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(rightsJSON, &role.Rights); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *roleRepo) CountRoles(ctx context.Context, filter domain.Filter) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM roles `+roleFilter, likeContains(filter.Search), filter.Module).
+		Scan(&total)
+	return total, err
+}
+
+// likeContains превращает строку в шаблон ILIKE на вхождение, экранируя спецсимволы; пустая остаётся пустой
+func likeContains(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
 func (r *roleRepo) GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error) {
 	query := `SELECT rights FROM roles WHERE role_id = $1`
 
@@ -90,65 +207,274 @@ func (r *roleRepo) GetRoleRights(ctx context.Context, roleID int) (map[string][]
 }
 
 func (r *roleRepo) DeleteRole(ctx context.Context, roleID int) error {
-	deleteQuery := `DELETE FROM roles WHERE role_id = $1`
-	result, err := r.db.ExecContext(ctx, deleteQuery, roleID)
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	var roleName string
+	var rightsJSON []byte
+	deleteQuery := `DELETE FROM roles WHERE role_id = $1 RETURNING role_name, rights`
+	if err := tx.QueryRowContext(ctx, deleteQuery, roleID).Scan(&roleName, &rightsJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("роль не найдена")
+		}
+		return err
+	}
+
+	payload := outboxDomain.RoleChangedPayload{
+		RoleID:   roleID,
+		RoleName: roleName,
+		Change:   outboxDomain.RoleDeleted,
+		Modules:  RightsModules(rightsJSON),
+	}
+	if err := AppendRoleEvent(ctx, tx, payload); err != nil {
+		return err
+	}
 
-	rowsAffected, err := result.RowsAffected()
+	return tx.Commit()
+}
+
+func (r *roleRepo) GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error) {
+	query := `SELECT role_id, version, role_name, role_name_ru, COALESCE(notes, ''), rights, author, diff, created_at
+	          FROM role_versions
+	          WHERE role_id = $1
+	          ORDER BY version DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, roleID)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []domain.RoleVersion
+	for rows.Next() {
+		version, err := scanRoleVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *roleRepo) GetRoleVersion(ctx context.Context, roleID int, version int) (*domain.RoleVersion, error) {
+	query := `SELECT role_id, version, role_name, role_name_ru, COALESCE(notes, ''), rights, author, diff, created_at
+	          FROM role_versions
+	          WHERE role_id = $1 AND version = $2`
+
+	roleVersion, err := scanRoleVersion(r.db.QueryRowContext(ctx, query, roleID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("версия роли не найдена")
+		}
+		return nil, err
+	}
+
+	return roleVersion, nil
+}
+
+// AssignRoleToUser назначает роль пользователю в контексте мерчанта; пустой merchantID — у любого мерчанта.
+// Без merge остальные назначения пользователя в том же контексте снимаются.
+func (r *roleRepo) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rightsJSON []byte
+	if err := tx.QueryRowContext(ctx, `SELECT rights FROM roles WHERE role_id = $1`, roleID).Scan(&rightsJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("роль не найдена")
+		}
 		return err
 	}
+
+	var merchant *string
+	if merchantID != "" {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users_contexts WHERE user_id = $1 AND merchant_id = $2)`,
+			userID, merchantID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("у пользователя нет контекста этого мерчанта")
+		}
+		merchant = &merchantID
+	}
+
+	if !merge {
+		var unassigned []struct {
+			RoleID int    `db:"role_id"`
+			Rights []byte `db:"rights"`
+		}
+		query := `DELETE FROM users_roles ur
+		          USING roles r
+		          WHERE ur.user_id = $1 AND ur.role_id <> $2 AND ur.merchant_id IS NOT DISTINCT FROM $3
+		            AND r.role_id = ur.role_id
+		          RETURNING ur.role_id, r.rights`
+		if err := tx.SelectContext(ctx, &unassigned, query, userID, roleID, merchant); err != nil {
+			return err
+		}
+		for _, role := range unassigned {
+			payload := outboxDomain.RoleChangedPayload{
+				RoleID:     role.RoleID,
+				Change:     outboxDomain.RoleUnassigned,
+				UserID:     userID.String(),
+				MerchantID: merchantID,
+				Modules:    RightsModules(role.Rights),
+			}
+			if err := AppendRoleEvent(ctx, tx, payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `INSERT INTO users_roles (user_id, role_id, merchant_id, valid_from, valid_until, granted_at)
+	          VALUES ($1, $2, $3, $4, $5, now())
+	          ON CONFLICT (user_id, role_id, (COALESCE(merchant_id, '')))
+	          DO UPDATE SET valid_from = EXCLUDED.valid_from, valid_until = EXCLUDED.valid_until
+	          WHERE (EXCLUDED.valid_from IS NULL AND EXCLUDED.valid_until IS NULL)
+	             OR users_roles.valid_from IS NOT NULL OR users_roles.valid_until IS NOT NULL`
+	res, err := tx.ExecContext(ctx, query, userID, roleID, merchant, validity.ValidFrom, validity.ValidUntil)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Роль уже назначена бессрочно: срочное назначение её бы сократило
 	if rowsAffected == 0 {
-		return errors.New("роль не найдена")
+		return rightsDomain.ErrPermanentGrant
+	}
+
+	payload := outboxDomain.RoleChangedPayload{
+		RoleID:     roleID,
+		Change:     outboxDomain.RoleAssigned,
+		UserID:     userID.String(),
+		MerchantID: merchantID,
+		ValidFrom:  validity.ValidFrom,
+		ValidUntil: validity.ValidUntil,
+		Modules:    RightsModules(rightsJSON),
+	}
+	if err := AppendRoleEvent(ctx, tx, payload); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (r *roleRepo) AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) error {
-	userRights, err := r.GetRoleRights(ctx, userID)
+// RecordVersion увеличивает current_version роли, сохраняет новую версию с автором и диффом
+// и пишет RoleChanged в outbox. Вызывается в той же транзакции, что и изменение роли. Автор —
+// подтверждённый инициатор (requestinfo.VerifiedActor), без него версия не записывается.
+func RecordVersion(ctx context.Context, tx *sqlx.Tx, before, after domain.Role) error {
+	author := requestinfo.VerifiedActor(ctx)
+	if author == "" {
+		return errors.New("role change author is not authenticated")
+	}
+
+	var version int
+	err := tx.QueryRowContext(ctx, `UPDATE roles SET current_version = current_version + 1
+	                                WHERE role_id = $1
+	                                RETURNING current_version`, after.ID).Scan(&version)
 	if err != nil {
 		return err
 	}
 
-	roleRights, err := r.GetRoleRights(ctx, roleID)
+	rightsJSON, err := json.Marshal(after.Rights)
+	if err != nil {
+		return err
+	}
+	diff := domain.DiffRoles(before, after)
+	diffJSON, err := json.Marshal(diff)
 	if err != nil {
 		return err
 	}
 
-	var roleName, roleNameRu, notes string
-	err = r.db.QueryRowContext(ctx, "SELECT role_name, role_name_ru, notes FROM roles WHERE role_id = $1", userID).
-		Scan(&roleName, &roleNameRu, &notes)
+	query := `INSERT INTO role_versions (role_id, version, role_name, role_name_ru, notes, rights, author, diff, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())`
+	_, err = tx.ExecContext(ctx, query, after.ID, version, after.Name, after.NameRu, after.Notes, rightsJSON,
+		author, diffJSON)
 	if err != nil {
 		return err
 	}
 
-	if merge {
-		for key, roleValues := range roleRights {
-			userValues, exists := userRights[key]
-			if exists {
-				rightsSet := make(map[string]struct{})
-				for _, v := range userValues {
-					rightsSet[v] = struct{}{}
-				}
-				for _, v := range roleValues {
-					rightsSet[v] = struct{}{}
-				}
+	change := outboxDomain.RoleEdited
+	if before.ID == 0 {
+		change = outboxDomain.RoleCreated
+	}
+	return AppendRoleEvent(ctx, tx, outboxDomain.RoleChangedPayload{
+		RoleID:   after.ID,
+		RoleName: after.Name,
+		Change:   change,
+		Version:  version,
+		Modules:  diff.Rights.Modules(),
+	})
+}
 
-				mergedValues := make([]string, 0, len(rightsSet))
-				for v := range rightsSet {
-					mergedValues = append(mergedValues, v)
-				}
-				userRights[key] = mergedValues
-			} else {
-				userRights[key] = roleValues
-			}
+// AppendRoleEvent пишет RoleChanged в outbox в транзакции изменения роли или назначения
+func AppendRoleEvent(ctx context.Context, tx *sqlx.Tx, payload outboxDomain.RoleChangedPayload) error {
+	event, err := outboxDomain.NewEvent(outboxDomain.RoleChanged, outboxDomain.AggregateRole, strconv.Itoa(payload.RoleID), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+func getRoleForUpdate(ctx context.Context, tx *sqlx.Tx, roleID int) (domain.Role, error) {
+	var role domain.Role
+	var rightsJSON []byte
+
+	query := `SELECT role_id, role_name, role_name_ru, COALESCE(notes, ''), rights, current_version
+	          FROM roles WHERE role_id = $1 FOR UPDATE`
+	err := tx.QueryRowContext(ctx, query, roleID).
+		Scan(&role.ID, &role.Name, &role.NameRu, &role.Notes, &rightsJSON, &role.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return role, errors.New("роль не найдена")
 		}
-	} else {
-		userRights = roleRights
+		return role, err
 	}
 
-	return r.EditRole(ctx, userID, roleName, roleNameRu, notes, userRights)
+	if err := json.Unmarshal(rightsJSON, &role.Rights); err != nil {
+		return role, err
+	}
+	return role, nil
+}
+
+// RightsModules возвращает модули из JSONB прав роли; нечитаемые права дают пустой список
+func RightsModules(rightsJSON []byte) []string {
+	var rights map[string][]string
+	if err := json.Unmarshal(rightsJSON, &rights); err != nil {
+		return nil
+	}
+	return rightsDomain.Modules(rights)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoleVersion(row rowScanner) (*domain.RoleVersion, error) {
+	var version domain.RoleVersion
+	var rightsJSON, diffJSON []byte
+
+	err := row.Scan(&version.RoleID, &version.Version, &version.Name, &version.NameRu, &version.Notes,
+		&rightsJSON, &version.Author, &diffJSON, &version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(rightsJSON, &version.Rights); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(diffJSON, &version.Diff); err != nil {
+		return nil, err
+	}
+	return &version, nil
 }
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 )
 
@@ -9,7 +11,11 @@ type RoleRepository interface {
 	AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error
 	EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error
 	GetRoles(ctx context.Context) ([]domain.Role, error)
+	ListRoles(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Role, error)
+	CountRoles(ctx context.Context, filter domain.Filter) (int, error)
 	GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error)
 	DeleteRole(ctx context.Context, roleID int) error
-	AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) error
+	AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error
+	GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error)
+	GetRoleVersion(ctx context.Context, roleID int, version int) (*domain.RoleVersion, error)
 }
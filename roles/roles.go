@@ -3,7 +3,12 @@ package roles
 import (
 	"github.com/go-kit/kit/log"
 	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
 	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	rightsPostgres "github.com/rafaceo/go-test-auth/rights/repository/postgres"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
 	"github.com/rafaceo/go-test-auth/roles/middleware"
 	"github.com/rafaceo/go-test-auth/roles/repository/postgres"
 	"github.com/rafaceo/go-test-auth/roles/service"
@@ -13,7 +18,10 @@ type ServiceFactory struct{}
 
 func (sf *ServiceFactory) CreateRolesService(logger log.Logger, postgresClient *sqlx.DB) service.RoleService {
 	rolesRepo := postgres.NewRoleRepository(postgresClient)
-	roleService := service.NewRoleService(rolesRepo)
+	rightsServ := rightsService.NewRightsService(rightsPostgres.NewPostgresRightsRepository(postgresClient))
+	roleService := service.NewRoleService(rolesRepo, rightsServ)
+	roleService = middleware.NewSensitiveGuardMiddleware(accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)), roleService)
+	roleService = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), roleService)
 	roleService = middleware.NewLoggingMiddleware(log.With(logger, "component", "roles"), roleService)
 	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("user_profile_service")
 	roleService = middleware.NewInstrumentingMiddleware(counter, duration, counterError, roleService)
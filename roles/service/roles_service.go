@@ -3,34 +3,50 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 	"github.com/rafaceo/go-test-auth/roles/repository"
 )
 
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
 type RoleService interface {
 	AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error
 	EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error
 	GetRoles(ctx context.Context) ([]domain.Role, error)
+	ListRoles(ctx context.Context, filter domain.Filter) (domain.Page, error)
 	GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error)
 	DeleteRole(ctx context.Context, roleID int) error
-	AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) error
+	AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error
+	GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error)
+	DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (domain.RoleDiff, error)
+	RollbackRole(ctx context.Context, roleID int, version int) error
 }
 
 type roleService struct {
-	repo repository.RoleRepository
+	repo   repository.RoleRepository
+	rights rightsService.RightsService
 }
 
 // NewRoleService создаёт сервис управления ролями
-func NewRoleService(repo repository.RoleRepository) RoleService {
-	return &roleService{repo: repo}
+func NewRoleService(repo repository.RoleRepository, rights rightsService.RightsService) RoleService {
+	return &roleService{repo: repo, rights: rights}
 }
 
 func (s *roleService) AddRole(ctx context.Context, roleName, roleNameRu, notes string, rights map[string][]string) error {
+	rights = rightsDomain.NormalizeRights(rights)
+	if err := s.rights.ValidateRights(ctx, rights); err != nil {
+		return err
+	}
 
-	s.repo.AddRole(ctx, roleName, roleNameRu, notes, rights)
-
-	return nil
+	return s.repo.AddRole(ctx, roleName, roleNameRu, notes, rights)
 }
 
 func (s *roleService) EditRole(ctx context.Context, roleID int, roleName, roleNameRu, notes string, rights map[string][]string) error {
@@ -40,6 +56,10 @@ func (s *roleService) EditRole(ctx context.Context, roleID int, roleName, roleNa
 	if roleName == "" || roleNameRu == "" {
 		return errors.New("role name cannot be empty")
 	}
+	rights = rightsDomain.NormalizeRights(rights)
+	if err := s.rights.ValidateRights(ctx, rights); err != nil {
+		return err
+	}
 
 	return s.repo.EditRole(ctx, roleID, roleName, roleNameRu, notes, rights)
 }
@@ -48,6 +68,43 @@ func (s *roleService) GetRoles(ctx context.Context) ([]domain.Role, error) {
 	return s.repo.GetRoles(ctx)
 }
 
+// ListRoles возвращает страницу ролей; по умолчанию роли упорядочены по имени
+func (s *roleService) ListRoles(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	if filter.Sort == "" {
+		filter.Sort = domain.SortNameAsc
+	}
+	if !domain.ValidSort(filter.Sort) {
+		return domain.Page{}, domain.ErrInvalidSort
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+
+	after, err := domain.DecodeCursor(filter.Cursor, filter.Sort)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	items, err := s.repo.ListRoles(ctx, filter, after, filter.Limit+1)
+	if err != nil {
+		return domain.Page{}, err
+	}
+	total, err := s.repo.CountRoles(ctx, filter)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	page := domain.Page{Roles: items, Total: total}
+	if len(items) > filter.Limit {
+		page.Roles = items[:filter.Limit]
+		page.NextCursor = domain.EncodeCursor(domain.CursorAfter(filter.Sort, page.Roles[filter.Limit-1]))
+	}
+	return page, nil
+}
+
 func (s *roleService) GetRoleRights(ctx context.Context, roleID int) (map[string][]string, error) {
 	return s.repo.GetRoleRights(ctx, roleID)
 }
@@ -55,6 +112,43 @@ func (s *roleService) GetRoleRights(ctx context.Context, roleID int) (map[string
 func (s *roleService) DeleteRole(ctx context.Context, roleID int) error {
 	return s.repo.DeleteRole(ctx, roleID)
 }
-func (s *roleService) AssignRoleToUser(ctx context.Context, userID int, roleID int, merge bool) error {
-	return s.repo.AssignRoleToUser(ctx, userID, roleID, merge)
+func (s *roleService) AssignRoleToUser(ctx context.Context, userID uuid.UUID, roleID int, merchantID string, merge bool, validity rightsDomain.Validity) error {
+	if userID == uuid.Nil {
+		return errors.New("invalid user ID")
+	}
+	if roleID <= 0 {
+		return errors.New("invalid role ID")
+	}
+	if err := validity.Validate(time.Now().UTC()); err != nil {
+		return err
+	}
+	return s.repo.AssignRoleToUser(ctx, userID, roleID, merchantID, merge, validity)
+}
+
+func (s *roleService) GetRoleVersions(ctx context.Context, roleID int) ([]domain.RoleVersion, error) {
+	if roleID <= 0 {
+		return nil, errors.New("invalid role ID")
+	}
+	return s.repo.GetRoleVersions(ctx, roleID)
+}
+
+func (s *roleService) DiffRoleVersions(ctx context.Context, roleID int, fromVersion, toVersion int) (domain.RoleDiff, error) {
+	from, err := s.repo.GetRoleVersion(ctx, roleID, fromVersion)
+	if err != nil {
+		return domain.RoleDiff{}, err
+	}
+	to, err := s.repo.GetRoleVersion(ctx, roleID, toVersion)
+	if err != nil {
+		return domain.RoleDiff{}, err
+	}
+	return domain.DiffRoles(from.Role(), to.Role()), nil
+}
+
+// RollbackRole возвращает роль к содержимому указанной версии, сохраняя откат как новую версию
+func (s *roleService) RollbackRole(ctx context.Context, roleID int, version int) error {
+	target, err := s.repo.GetRoleVersion(ctx, roleID, version)
+	if err != nil {
+		return err
+	}
+	return s.EditRole(ctx, roleID, target.Name, target.NameRu, target.Notes, target.Rights)
 }
@@ -12,7 +12,10 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
 	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 	service "github.com/rafaceo/go-test-auth/roles/service"
 	"strconv"
@@ -21,21 +24,25 @@ import (
 	"net/http"
 )
 
-func GetRoleHandlers(serv service.RoleService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+// GetRoleHandlers: изменения ролей пишут версию и событие аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetRoleHandlers(serv service.RoleService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
 	}
+	authenticated := authn.Middleware(tokens)
 
 	addRolesHandler := kithttp.NewServer(
-		MakeAddRoleEndpoint(serv),
+		authenticated(MakeAddRoleEndpoint(serv)),
 		DecodeAddRoleRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	editRolesHandler := kithttp.NewServer(
-		MakeEditRoleEndpoint(serv),
+		authenticated(MakeEditRoleEndpoint(serv)),
 		DecodeEditRoleRequest,
 		EncodeResponse,
 		opts...,
@@ -56,19 +63,40 @@ func GetRoleHandlers(serv service.RoleService, logger kitlog.Logger) []*httphand
 	)
 
 	deleteRolesHandler := kithttp.NewServer(
-		MakeDeleteRoleEndpoint(serv),
+		authenticated(MakeDeleteRoleEndpoint(serv)),
 		DecodeDeleteRoleRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	assignRoleToUserHandler := kithttp.NewServer(
-		MakeAssignRoleToUserEndpoint(serv),
+		authenticated(MakeAssignRoleToUserEndpoint(serv)),
 		DecodeAssignRoleToUserRequest,
 		EncodeResponse,
 		opts...,
 	)
 
+	getRoleVersionsHandler := kithttp.NewServer(
+		MakeGetRoleVersionsEndpoint(serv),
+		DecodeGetRoleVersionsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	diffRoleVersionsHandler := kithttp.NewServer(
+		MakeDiffRoleVersionsEndpoint(serv),
+		DecodeDiffRoleVersionsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	rollbackRoleHandler := kithttp.NewServer(
+		authenticated(MakeRollbackRoleEndpoint(serv)),
+		DecodeRollbackRoleRequest,
+		EncodeResponse,
+		opts...,
+	)
+
 	return []*httphandlers.HTTPHandler{
 		{
 			Path:    "/api/v4/roles",
@@ -100,6 +128,21 @@ func GetRoleHandlers(serv service.RoleService, logger kitlog.Logger) []*httphand
 			Handler: assignRoleToUserHandler,
 			Methods: []string{"PUT"},
 		},
+		{
+			Path:    "/api/v4/roles/{role_id}/versions",
+			Handler: getRoleVersionsHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/roles/{role_id}/versions/diff",
+			Handler: diffRoleVersionsHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/roles/{role_id}/versions/{version}/rollback",
+			Handler: rollbackRoleHandler,
+			Methods: []string{"POST"},
+		},
 	}
 }
 
@@ -109,7 +152,9 @@ func MakeAddRoleEndpoint(svc service.RoleService) endpoint.Endpoint {
 
 		err := svc.AddRole(ctx, req.RoleName, req.RoleNameRu, req.Notes, req.Rights)
 		if err != nil {
-			return transport.AddRoleResponse{Error: err.Error()}, nil
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return transport.AddRoleResponse{Error: err.Error(), UnknownRights: unknown}, nil
 		}
 		return transport.AddRoleResponse{Message: "Роль успешно добавлена"}, nil
 	}
@@ -121,7 +166,9 @@ func MakeEditRoleEndpoint(svc service.RoleService) endpoint.Endpoint {
 
 		err := svc.EditRole(ctx, req.RoleID, req.RoleName, req.RoleNameRu, req.Notes, req.Rights)
 		if err != nil {
-			return transport.EditRoleResponse{Error: err.Error()}, nil
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return transport.EditRoleResponse{Error: err.Error(), UnknownRights: unknown}, nil
 		}
 
 		return transport.EditRoleResponse{Message: "Роль успешно изменена"}, nil
@@ -130,23 +177,31 @@ func MakeEditRoleEndpoint(svc service.RoleService) endpoint.Endpoint {
 
 func MakeGetRolesEndpoint(svc service.RoleService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		roles, err := svc.GetRoles(ctx)
+		req := request.(transport.GetRoleRequest)
+		page, err := svc.ListRoles(ctx, domain.Filter{
+			Search: req.Search,
+			Module: req.Module,
+			Sort:   req.Sort,
+			Limit:  req.Limit,
+			Cursor: req.Cursor,
+		})
 		if err != nil {
 			return transport.GetRolesResponse{Error: err.Error()}, nil
 		}
 
-		var responseRoles []domain.Role
-		for _, r := range roles {
+		responseRoles := make([]domain.Role, 0, len(page.Roles))
+		for _, r := range page.Roles {
 			responseRoles = append(responseRoles, domain.Role{
-				ID:     r.ID,
-				Name:   r.Name,
-				NameRu: r.NameRu,
-				Notes:  r.Notes,
-				Rights: r.Rights,
+				ID:      r.ID,
+				Name:    r.Name,
+				NameRu:  r.NameRu,
+				Notes:   r.Notes,
+				Rights:  r.Rights,
+				Version: r.Version,
 			})
 		}
 
-		return transport.GetRolesResponse{Roles: responseRoles}, nil
+		return transport.GetRolesResponse{Roles: responseRoles, Total: page.Total, NextCursor: page.NextCursor}, nil
 	}
 }
 
@@ -175,7 +230,8 @@ func MakeDeleteRoleEndpoint(svc service.RoleService) endpoint.Endpoint {
 func MakeAssignRoleToUserEndpoint(svc service.RoleService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(transport.AssignRoleToUserRequest)
-		err := svc.AssignRoleToUser(ctx, req.UserID, req.RoleID, req.Merge)
+		validity := rightsDomain.Validity{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil}
+		err := svc.AssignRoleToUser(ctx, req.UserID, req.RoleID, req.MerchantID, req.Merge, validity)
 		if err != nil {
 			return transport.AssignRoleToUserResponse{Error: err.Error()}, nil
 		}
@@ -183,6 +239,41 @@ func MakeAssignRoleToUserEndpoint(svc service.RoleService) endpoint.Endpoint {
 	}
 }
 
+func MakeGetRoleVersionsEndpoint(svc service.RoleService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.GetRoleVersionsRequest)
+		versions, err := svc.GetRoleVersions(ctx, req.RoleID)
+		if err != nil {
+			return transport.GetRoleVersionsResponse{Error: err.Error()}, nil
+		}
+		return transport.GetRoleVersionsResponse{Versions: versions}, nil
+	}
+}
+
+func MakeDiffRoleVersionsEndpoint(svc service.RoleService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DiffRoleVersionsRequest)
+		diff, err := svc.DiffRoleVersions(ctx, req.RoleID, req.From, req.To)
+		if err != nil {
+			return transport.DiffRoleVersionsResponse{From: req.From, To: req.To, Error: err.Error()}, nil
+		}
+		return transport.DiffRoleVersionsResponse{From: req.From, To: req.To, Diff: &diff}, nil
+	}
+}
+
+func MakeRollbackRoleEndpoint(svc service.RoleService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.RollbackRoleRequest)
+		err := svc.RollbackRole(ctx, req.RoleID, req.Version)
+		if err != nil {
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return transport.RollbackRoleResponse{Error: err.Error(), UnknownRights: unknown}, nil
+		}
+		return transport.RollbackRoleResponse{Message: fmt.Sprintf("Роль возвращена к версии %d", req.Version)}, nil
+	}
+}
+
 func DecodeAddRoleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	var req transport.AddRoleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -213,8 +304,22 @@ func DecodeEditRoleRequest(ctx context.Context, r *http.Request) (interface{}, e
 	return req, nil
 }
 
-func DecodeGetRolesRequest(_ context.Context, _ *http.Request) (interface{}, error) {
-	return transport.GetRoleRequest{}, nil
+func DecodeGetRolesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	req := transport.GetRoleRequest{
+		Search: query.Get("search"),
+		Module: query.Get("module"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		req.Limit = limit
+	}
+	return req, nil
 }
 
 func DecodeGetRoleRightsRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -255,6 +360,46 @@ func DecodeAssignRoleToUserRequest(_ context.Context, r *http.Request) (interfac
 	return req, nil
 }
 
+func DecodeGetRoleVersionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["role_id"])
+	if err != nil {
+		return nil, errors.New("invalid role ID")
+	}
+	return transport.GetRoleVersionsRequest{RoleID: roleID}, nil
+}
+
+func DecodeDiffRoleVersionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	roleID, err := strconv.Atoi(mux.Vars(r)["role_id"])
+	if err != nil {
+		return nil, errors.New("invalid role ID")
+	}
+
+	query := r.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		return nil, errors.New("invalid from version")
+	}
+	to, err := strconv.Atoi(query.Get("to"))
+	if err != nil {
+		return nil, errors.New("invalid to version")
+	}
+
+	return transport.DiffRoleVersionsRequest{RoleID: roleID, From: from, To: to}, nil
+}
+
+func DecodeRollbackRoleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	roleID, err := strconv.Atoi(vars["role_id"])
+	if err != nil {
+		return nil, errors.New("invalid role ID")
+	}
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		return nil, errors.New("invalid version")
+	}
+	return transport.RollbackRoleRequest{RoleID: roleID, Version: version}, nil
+}
+
 func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -1,5 +1,10 @@
 package transport
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
 type AddRoleRequest struct {
 	RoleName   string              `json:"role_name"`
 	RoleNameRu string              `json:"role_name_ru"`
@@ -15,7 +20,13 @@ type EditRoleRequest struct {
 	Rights     map[string][]string `json:"rights"`
 }
 
+// GetRoleRequest — параметры списка ролей из query: search, module, sort, limit, cursor
 type GetRoleRequest struct {
+	Search string
+	Module string
+	Sort   string
+	Limit  int
+	Cursor string
 }
 
 type GetRoleRightsRequest struct {
@@ -27,7 +38,25 @@ type DeleteRoleRequest struct {
 }
 
 type AssignRoleToUserRequest struct {
-	RoleID int  `json:"role_id"`
-	UserID int  `json:"user_id"`
-	Merge  bool `json:"merge"`
+	RoleID     int        `json:"role_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	MerchantID string     `json:"merchant_id,omitempty"`
+	Merge      bool       `json:"merge"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+type GetRoleVersionsRequest struct {
+	RoleID int `json:"-"`
+}
+
+type DiffRoleVersionsRequest struct {
+	RoleID int `json:"-"`
+	From   int `json:"from"`
+	To     int `json:"to"`
+}
+
+type RollbackRoleRequest struct {
+	RoleID  int `json:"-"`
+	Version int `json:"-"`
 }
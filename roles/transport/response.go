@@ -1,22 +1,27 @@
 package transport
 
 import (
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
 	"github.com/rafaceo/go-test-auth/roles/domain"
 )
 
 type AddRoleResponse struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Message       string                           `json:"message,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
 }
 
 type EditRoleResponse struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Message       string                           `json:"message,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
 }
 
 type GetRolesResponse struct {
-	Roles []domain.Role `json:"roles"`
-	Error string        `json:"error,omitempty"`
+	Roles      []domain.Role `json:"roles"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Error      string        `json:"error,omitempty"`
 }
 
 type GetRoleRightsResponse struct {
@@ -33,3 +38,21 @@ type AssignRoleToUserResponse struct {
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
+
+type GetRoleVersionsResponse struct {
+	Versions []domain.RoleVersion `json:"versions"`
+	Error    string               `json:"error,omitempty"`
+}
+
+type DiffRoleVersionsResponse struct {
+	From  int              `json:"from"`
+	To    int              `json:"to"`
+	Diff  *domain.RoleDiff `json:"diff,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+type RollbackRoleResponse struct {
+	Message       string                           `json:"message,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
+}
@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NamespaceSignature = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// IdPMetadata — то, что SP берёт из метаданных IdP
+type IdPMetadata struct {
+	EntityID     string
+	SSOURL       string
+	Certificates []string
+}
+
+// ParseIdPMetadata читает entityID, адрес SSO для HTTP-Redirect и сертификаты подписи из EntityDescriptor
+func ParseIdPMetadata(raw []byte) (*IdPMetadata, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, errors.New("idp_metadata is not valid XML")
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "EntityDescriptor" || root.NamespaceURI() != NamespaceMetadata {
+		return nil, errors.New("idp_metadata must be a single EntityDescriptor")
+	}
+	descriptor := child(root, NamespaceMetadata, "IDPSSODescriptor")
+	if descriptor == nil {
+		return nil, errors.New("idp_metadata has no IDPSSODescriptor")
+	}
+
+	metadata := &IdPMetadata{EntityID: root.SelectAttrValue("entityID", "")}
+	for _, sso := range children(descriptor, NamespaceMetadata, "SingleSignOnService") {
+		if sso.SelectAttrValue("Binding", "") == BindingRedirect {
+			metadata.SSOURL = sso.SelectAttrValue("Location", "")
+			break
+		}
+	}
+	if metadata.SSOURL == "" {
+		return nil, errors.New("idp_metadata has no SingleSignOnService with HTTP-Redirect binding")
+	}
+	for _, key := range children(descriptor, NamespaceMetadata, "KeyDescriptor") {
+		if use := key.SelectAttrValue("use", ""); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := child(key, NamespaceSignature, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range children(keyInfo, NamespaceSignature, "X509Data") {
+			for _, cert := range children(data, NamespaceSignature, "X509Certificate") {
+				metadata.Certificates = append(metadata.Certificates, cert.Text())
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// SPMetadata — метаданные нашего SP для настройки приложения на стороне IdP. Запросы не подписываются,
+// ответ принимается по HTTP-POST; подписано должно быть утверждение или весь ответ.
+func SPMetadata(sp ServiceProvider) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	entity := doc.CreateElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", NamespaceMetadata)
+	entity.CreateAttr("entityID", sp.EntityID)
+
+	descriptor := entity.CreateElement("md:SPSSODescriptor")
+	descriptor.CreateAttr("AuthnRequestsSigned", "false")
+	descriptor.CreateAttr("WantAssertionsSigned", "true")
+	descriptor.CreateAttr("protocolSupportEnumeration", NamespaceProtocol)
+	for _, format := range []string{NameIDFormatPersistent, NameIDFormatEmail, NameIDFormatUnspecified} {
+		descriptor.CreateElement("md:NameIDFormat").SetText(format)
+	}
+	acs := descriptor.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", BindingPOST)
+	acs.CreateAttr("Location", sp.ACSURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// AuthnRequest — запрос входа для HTTP-Redirect binding: ID запоминается, чтобы принять только ответ на него
+type AuthnRequest struct {
+	ID          string
+	RedirectURL string
+}
+
+func NewAuthnRequest(sp ServiceProvider, provider Provider, relayState string, now time.Time) (*AuthnRequest, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	request := doc.CreateElement("samlp:AuthnRequest")
+	request.CreateAttr("xmlns:samlp", NamespaceProtocol)
+	request.CreateAttr("xmlns:saml", NamespaceAssertion)
+	request.CreateAttr("ID", id)
+	request.CreateAttr("Version", "2.0")
+	request.CreateAttr("IssueInstant", now.UTC().Format(time.RFC3339))
+	request.CreateAttr("Destination", provider.SSOURL)
+	request.CreateAttr("AssertionConsumerServiceURL", sp.ACSURL)
+	request.CreateAttr("ProtocolBinding", BindingPOST)
+	request.CreateElement("saml:Issuer").SetText(sp.EntityID)
+	policy := request.CreateElement("samlp:NameIDPolicy")
+	policy.CreateAttr("AllowCreate", "true")
+
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())}}
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	separator := "?"
+	if strings.Contains(provider.SSOURL, "?") {
+		separator = "&"
+	}
+	return &AuthnRequest{ID: id, RedirectURL: provider.SSOURL + separator + query.Encode()}, nil
+}
+
+// newID — идентификатор xs:ID: не может начинаться с цифры
+func newID() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(buf), nil
+}
+
+func child(el *etree.Element, namespace, tag string) *etree.Element {
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == namespace {
+			return c
+		}
+	}
+	return nil
+}
+
+func children(el *etree.Element, namespace, tag string) []*etree.Element {
+	var result []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == namespace {
+			result = append(result, c)
+		}
+	}
+	return result
+}
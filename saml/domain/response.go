@@ -0,0 +1,266 @@
+package domain
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	statusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	maxResponseSize     = 1 << 20
+	clockSkew           = 2 * time.Minute
+	maxAssertionTTL     = 24 * time.Hour
+	responseVersion     = "2.0"
+	errInvalidResponseF = "%w: %s"
+)
+
+// Assertion — проверенное утверждение IdP. ExpiresAt — до какого момента утверждение нельзя принять
+// повторно. InResponseTo пуст для входа, начатого на стороне IdP.
+type Assertion struct {
+	ID           string
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	InResponseTo string
+	ExpiresAt    time.Time
+	Attributes   map[string][]string
+}
+
+// ParseResponse разбирает SAMLResponse из HTTP-POST binding и проверяет его по правилам профиля
+// Web Browser SSO: подпись ответа или утверждения сертификатом IdP, издатель, получатель и
+// аудитория, сроки действия. Данные берутся только из подписанной части документа.
+// Сверка InResponseTo с отправленными запросами и защита от повторов — на вызывающем.
+func ParseResponse(encoded string, provider Provider, sp ServiceProvider, now time.Time) (*Assertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil || len(raw) == 0 || len(raw) > maxResponseSize {
+		return nil, invalid("SAMLResponse is not valid base64")
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, invalid("SAMLResponse is not valid XML")
+	}
+	for _, token := range doc.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, invalid("DTD is not allowed")
+		}
+	}
+	response := doc.Root()
+	if response == nil || response.Tag != "Response" || response.NamespaceURI() != NamespaceProtocol {
+		return nil, invalid("root element must be samlp:Response")
+	}
+
+	validator, err := newValidator(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	responseSigned := child(response, NamespaceSignature, "Signature") != nil
+	if responseSigned {
+		if response, err = validator.Validate(response); err != nil {
+			return nil, invalid("response signature: " + err.Error())
+		}
+	}
+	if err := checkResponse(response, provider, sp); err != nil {
+		return nil, err
+	}
+
+	if len(children(response, NamespaceAssertion, "EncryptedAssertion")) > 0 {
+		return nil, ErrEncryptedAssertion
+	}
+	assertions := children(response, NamespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalid("response must contain exactly one assertion")
+	}
+	assertionEl := assertions[0]
+	if child(assertionEl, NamespaceSignature, "Signature") != nil {
+		if assertionEl, err = validator.Validate(assertionEl); err != nil {
+			return nil, invalid("assertion signature: " + err.Error())
+		}
+	} else if !responseSigned {
+		return nil, invalid("neither the response nor the assertion is signed")
+	}
+
+	assertion, err := parseAssertion(assertionEl, provider, sp, now)
+	if err != nil {
+		return nil, err
+	}
+	// InResponseTo неподписанного ответа не учитывается: его можно подменить, не трогая подписанное утверждение
+	if inResponseTo := response.SelectAttrValue("InResponseTo", ""); responseSigned && inResponseTo != "" {
+		if assertion.InResponseTo != "" && assertion.InResponseTo != inResponseTo {
+			return nil, invalid("InResponseTo of the response and the assertion differ")
+		}
+		assertion.InResponseTo = inResponseTo
+	}
+	return assertion, nil
+}
+
+func newValidator(provider Provider) (*dsig.ValidationContext, error) {
+	certs := make([]*x509.Certificate, 0, len(provider.Certificates))
+	for _, raw := range provider.Certificates {
+		cert, err := ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs}), nil
+}
+
+func checkResponse(response *etree.Element, provider Provider, sp ServiceProvider) error {
+	if response.SelectAttrValue("Version", "") != responseVersion {
+		return invalid("unsupported SAML version")
+	}
+	if destination := response.SelectAttrValue("Destination", ""); destination != "" && destination != sp.ACSURL {
+		return invalid("response is addressed to another destination")
+	}
+	if issuer := child(response, NamespaceAssertion, "Issuer"); issuer != nil && strings.TrimSpace(issuer.Text()) != provider.EntityID {
+		return invalid("response is issued by another IdP")
+	}
+
+	status := child(response, NamespaceProtocol, "Status")
+	if status == nil {
+		return invalid("response has no status")
+	}
+	code := child(status, NamespaceProtocol, "StatusCode")
+	if code == nil {
+		return invalid("response has no status code")
+	}
+	if value := code.SelectAttrValue("Value", ""); value != statusSuccess {
+		if nested := child(code, NamespaceProtocol, "StatusCode"); nested != nil {
+			value += " / " + nested.SelectAttrValue("Value", "")
+		}
+		return fmt.Errorf("IdP rejected the login: %s", value)
+	}
+	return nil
+}
+
+func parseAssertion(el *etree.Element, provider Provider, sp ServiceProvider, now time.Time) (*Assertion, error) {
+	assertion := &Assertion{ID: el.SelectAttrValue("ID", ""), Attributes: map[string][]string{}}
+	if assertion.ID == "" || el.SelectAttrValue("Version", "") != responseVersion {
+		return nil, invalid("assertion has no ID or unsupported version")
+	}
+
+	issuer := child(el, NamespaceAssertion, "Issuer")
+	if issuer == nil || strings.TrimSpace(issuer.Text()) != provider.EntityID {
+		return nil, invalid("assertion is issued by another IdP")
+	}
+	assertion.Issuer = provider.EntityID
+
+	if err := checkSubject(el, assertion, sp, now); err != nil {
+		return nil, err
+	}
+	if err := checkConditions(el, assertion, sp, now); err != nil {
+		return nil, err
+	}
+	if child(el, NamespaceAssertion, "AuthnStatement") == nil {
+		return nil, invalid("assertion has no AuthnStatement")
+	}
+
+	for _, statement := range children(el, NamespaceAssertion, "AttributeStatement") {
+		for _, attribute := range children(statement, NamespaceAssertion, "Attribute") {
+			var values []string
+			for _, value := range children(attribute, NamespaceAssertion, "AttributeValue") {
+				values = append(values, strings.TrimSpace(value.Text()))
+			}
+			for _, name := range []string{attribute.SelectAttrValue("Name", ""), attribute.SelectAttrValue("FriendlyName", "")} {
+				if name != "" {
+					assertion.Attributes[name] = append(assertion.Attributes[name], values...)
+				}
+			}
+		}
+	}
+	return assertion, nil
+}
+
+// checkSubject требует NameID и подтверждение bearer, адресованное нашему ACS и ещё не истёкшее
+func checkSubject(el *etree.Element, assertion *Assertion, sp ServiceProvider, now time.Time) error {
+	subject := child(el, NamespaceAssertion, "Subject")
+	if subject == nil {
+		return invalid("assertion has no subject")
+	}
+	nameID := child(subject, NamespaceAssertion, "NameID")
+	if nameID == nil || strings.TrimSpace(nameID.Text()) == "" {
+		return invalid("assertion has no NameID")
+	}
+	assertion.NameID = strings.TrimSpace(nameID.Text())
+	assertion.NameIDFormat = nameID.SelectAttrValue("Format", NameIDFormatUnspecified)
+
+	for _, confirmation := range children(subject, NamespaceAssertion, "SubjectConfirmation") {
+		if confirmation.SelectAttrValue("Method", "") != confirmationBearer {
+			continue
+		}
+		data := child(confirmation, NamespaceAssertion, "SubjectConfirmationData")
+		if data == nil || data.SelectAttrValue("Recipient", "") != sp.ACSURL {
+			continue
+		}
+		notOnOrAfter, err := parseTime(data.SelectAttrValue("NotOnOrAfter", ""))
+		if err != nil || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			continue
+		}
+		assertion.InResponseTo = data.SelectAttrValue("InResponseTo", "")
+		assertion.ExpiresAt = notOnOrAfter
+		return nil
+	}
+	return invalid("assertion has no valid bearer confirmation for this service provider")
+}
+
+// checkConditions проверяет срок действия и то, что утверждение выдано нашему SP
+func checkConditions(el *etree.Element, assertion *Assertion, sp ServiceProvider, now time.Time) error {
+	conditions := child(el, NamespaceAssertion, "Conditions")
+	if conditions == nil {
+		return invalid("assertion has no conditions")
+	}
+	if value := conditions.SelectAttrValue("NotBefore", ""); value != "" {
+		notBefore, err := parseTime(value)
+		if err != nil || now.Add(clockSkew).Before(notBefore) {
+			return invalid("assertion is not yet valid")
+		}
+	}
+	if value := conditions.SelectAttrValue("NotOnOrAfter", ""); value != "" {
+		notOnOrAfter, err := parseTime(value)
+		if err != nil || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			return invalid("assertion has expired")
+		}
+		if notOnOrAfter.After(assertion.ExpiresAt) {
+			assertion.ExpiresAt = notOnOrAfter
+		}
+	}
+	if assertion.ExpiresAt.After(now.Add(maxAssertionTTL)) {
+		assertion.ExpiresAt = now.Add(maxAssertionTTL)
+	}
+	assertion.ExpiresAt = assertion.ExpiresAt.Add(clockSkew)
+
+	restrictions := children(conditions, NamespaceAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return invalid("assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		matched := false
+		for _, audience := range children(restriction, NamespaceAssertion, "Audience") {
+			if strings.TrimSpace(audience.Text()) == sp.EntityID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return invalid("assertion is intended for another audience")
+		}
+	}
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf(errInvalidResponseF, ErrInvalidResponse, reason)
+}
@@ -0,0 +1,279 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// idp подписывает ответы так, как это делает настоящий IdP
+type idp struct {
+	signer   *dsig.SigningContext
+	provider Provider
+	sp       ServiceProvider
+}
+
+func newIdP(t *testing.T) *idp {
+	t.Helper()
+	keys := dsig.RandomKeyStoreForTest()
+	_, cert, err := keys.GetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := dsig.NewDefaultSigningContext(keys)
+	signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	return &idp{
+		signer: signer,
+		provider: Provider{
+			ID:           "corp",
+			EntityID:     "https://idp.example.com",
+			Certificates: []string{base64.StdEncoding.EncodeToString(cert)},
+		},
+		sp: NewServiceProvider("https://auth.example.com", "corp"),
+	}
+}
+
+// responseParams — изменяемые части ответа; по умолчанию ответ корректен в момент now
+type responseParams struct {
+	now          time.Time
+	audience     string
+	notOnOrAfter time.Time
+	inResponseTo string
+	nameID       string
+}
+
+func (i *idp) params(now time.Time) responseParams {
+	return responseParams{
+		now:          now,
+		audience:     i.sp.EntityID,
+		notOnOrAfter: now.Add(5 * time.Minute),
+		inResponseTo: "_request-1",
+		nameID:       "jdoe",
+	}
+}
+
+func (i *idp) document(p responseParams) *etree.Document {
+	ts := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	xml := fmt.Sprintf(`<samlp:Response xmlns:samlp="%[1]s" ID="_response-1" Version="2.0" IssueInstant="%[3]s" Destination="%[4]s" InResponseTo="%[7]s">
+<saml:Issuer xmlns:saml="%[2]s">%[5]s</saml:Issuer>
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+<saml:Assertion xmlns:saml="%[2]s" ID="_assertion-1" Version="2.0" IssueInstant="%[3]s">
+<saml:Issuer>%[5]s</saml:Issuer>
+<saml:Subject>
+<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">%[9]s</saml:NameID>
+<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+<saml:SubjectConfirmationData Recipient="%[4]s" NotOnOrAfter="%[8]s" InResponseTo="%[7]s"/>
+</saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%[3]s" NotOnOrAfter="%[8]s">
+<saml:AudienceRestriction><saml:Audience>%[6]s</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AuthnStatement AuthnInstant="%[3]s"/>
+<saml:AttributeStatement>
+<saml:Attribute Name="email"><saml:AttributeValue>jdoe@example.com</saml:AttributeValue></saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`,
+		NamespaceProtocol, NamespaceAssertion, ts(p.now.Add(-time.Minute)), i.sp.ACSURL, i.provider.EntityID,
+		p.audience, p.inResponseTo, ts(p.notOnOrAfter), p.nameID)
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xml); err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// signAssertion заменяет утверждение в документе подписанным
+func (i *idp) signAssertion(t *testing.T, doc *etree.Document) {
+	t.Helper()
+	response := doc.Root()
+	assertion := response.FindElement("./Assertion")
+	signed, err := i.signer.SignEnveloped(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := assertion.Index()
+	response.RemoveChildAt(index)
+	response.InsertChildAt(index, signed)
+}
+
+func (i *idp) signResponse(t *testing.T, doc *etree.Document) {
+	t.Helper()
+	signed, err := i.signer.SignEnveloped(doc.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.SetRoot(signed)
+}
+
+func encode(t *testing.T, doc *etree.Document) string {
+	t.Helper()
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestParseResponse(t *testing.T) {
+	i := newIdP(t)
+	now := time.Now().UTC()
+
+	for _, sign := range []struct {
+		name string
+		sign func(*testing.T, *etree.Document)
+	}{
+		{"signed assertion", i.signAssertion},
+		{"signed response", i.signResponse},
+	} {
+		doc := i.document(i.params(now))
+		sign.sign(t, doc)
+
+		assertion, err := ParseResponse(encode(t, doc), i.provider, i.sp, now)
+		if err != nil {
+			t.Fatalf("%s: ParseResponse: %v", sign.name, err)
+		}
+		if assertion.ID != "_assertion-1" || assertion.NameID != "jdoe" || assertion.Issuer != i.provider.EntityID {
+			t.Fatalf("%s: unexpected assertion %+v", sign.name, assertion)
+		}
+		if assertion.InResponseTo != "_request-1" {
+			t.Fatalf("%s: InResponseTo = %q, want %q", sign.name, assertion.InResponseTo, "_request-1")
+		}
+		if got := assertion.Attributes["email"]; len(got) != 1 || got[0] != "jdoe@example.com" {
+			t.Fatalf("%s: email attribute = %v", sign.name, got)
+		}
+		if !assertion.ExpiresAt.After(now) {
+			t.Fatalf("%s: ExpiresAt %s is not after now", sign.name, assertion.ExpiresAt)
+		}
+	}
+}
+
+func TestParseResponseRejects(t *testing.T) {
+	i := newIdP(t)
+	now := time.Now().UTC()
+
+	cases := []struct {
+		name   string
+		build  func(t *testing.T) string
+		reason string
+	}{
+		{
+			name: "unsigned",
+			build: func(t *testing.T) string {
+				return encode(t, i.document(i.params(now)))
+			},
+			reason: "neither the response nor the assertion is signed",
+		},
+		{
+			name: "signed by another key",
+			build: func(t *testing.T) string {
+				other := newIdP(t)
+				doc := other.document(i.params(now))
+				other.signAssertion(t, doc)
+				return encode(t, doc)
+			},
+			reason: "assertion signature",
+		},
+		{
+			name: "assertion changed after signing",
+			build: func(t *testing.T) string {
+				doc := i.document(i.params(now))
+				i.signAssertion(t, doc)
+				doc.Root().FindElement("./Assertion/Subject/NameID").SetText("admin")
+				return encode(t, doc)
+			},
+			reason: "assertion signature",
+		},
+		{
+			// Подписанное утверждение спрятано в Extensions, а обрабатываемое место занимает поддельное
+			name: "signature wrapping",
+			build: func(t *testing.T) string {
+				doc := i.document(i.params(now))
+				i.signAssertion(t, doc)
+				response := doc.Root()
+				signed := response.FindElement("./Assertion")
+				response.RemoveChild(signed)
+				extensions := response.CreateElement("samlp:Extensions")
+				extensions.AddChild(signed)
+
+				evil := i.document(i.params(now)).Root().FindElement("./Assertion")
+				evil.FindElement("./Subject/NameID").SetText("admin")
+				response.AddChild(evil)
+				return encode(t, doc)
+			},
+			reason: "neither the response nor the assertion is signed",
+		},
+		{
+			name: "signature wrapping with a copied signature",
+			build: func(t *testing.T) string {
+				doc := i.document(i.params(now))
+				i.signAssertion(t, doc)
+				response := doc.Root()
+				signed := response.FindElement("./Assertion")
+
+				evil := signed.Copy()
+				evil.FindElement("./Subject/NameID").SetText("admin")
+				response.RemoveChild(signed)
+				response.AddChild(evil)
+				evil.FindElement("./Signature").AddChild(signed)
+				return encode(t, doc)
+			},
+			reason: "assertion signature",
+		},
+		{
+			name: "wrong audience",
+			build: func(t *testing.T) string {
+				p := i.params(now)
+				p.audience = "https://other-sp.example.com/metadata"
+				doc := i.document(p)
+				i.signAssertion(t, doc)
+				return encode(t, doc)
+			},
+			reason: "intended for another audience",
+		},
+		{
+			name: "expired",
+			build: func(t *testing.T) string {
+				p := i.params(now.Add(-time.Hour))
+				doc := i.document(p)
+				i.signAssertion(t, doc)
+				return encode(t, doc)
+			},
+			reason: "no valid bearer confirmation",
+		},
+		{
+			name: "DTD",
+			build: func(t *testing.T) string {
+				doc := i.document(i.params(now))
+				i.signAssertion(t, doc)
+				raw, err := doc.WriteToString()
+				if err != nil {
+					t.Fatal(err)
+				}
+				dtd := `<!DOCTYPE Response [<!ENTITY lol "lol">]>`
+				return base64.StdEncoding.EncodeToString([]byte(dtd + raw))
+			},
+			reason: "DTD is not allowed",
+		},
+		{
+			name: "not base64",
+			build: func(*testing.T) string {
+				return "<samlp:Response/>"
+			},
+			reason: "not valid base64",
+		},
+	}
+	for _, c := range cases {
+		_, err := ParseResponse(c.build(t), i.provider, i.sp, now)
+		if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("%s: error = %v, want %v with %q", c.name, err, ErrInvalidResponse, c.reason)
+		}
+	}
+}
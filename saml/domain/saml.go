@@ -0,0 +1,368 @@
+package domain
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BasePath — префикс маршрутов SAML; адреса SP (entityID и ACS) строятся от него
+const BasePath = "/api/v4/auth/saml"
+
+// RequestTTL — сколько ждём ответа IdP на AuthnRequest
+const RequestTTL = 10 * time.Minute
+
+// MaxRelayStateLength — ограничение RelayState по спецификации HTTP-Redirect binding
+const MaxRelayStateLength = 80
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+var (
+	ErrProviderNotFound   = errors.New("saml provider not found")
+	ErrProviderExists     = errors.New("saml provider with this id or entity_id already exists")
+	ErrProviderDisabled   = errors.New("saml provider is disabled")
+	ErrInvalidResponse    = errors.New("invalid SAML response")
+	ErrEncryptedAssertion = errors.New("encrypted assertions are not supported, configure the IdP to sign assertions without encryption")
+	ErrUnknownRequest     = errors.New("SAML response does not answer a pending login request, start the login again")
+	ErrUnsolicited        = errors.New("IdP-initiated login is not allowed for this provider")
+	ErrReplay             = errors.New("SAML assertion has already been used")
+	ErrNoLocalAccount     = errors.New("no account is linked to this SAML identity")
+	ErrAmbiguousAccount   = errors.New("several accounts match this SAML identity, ask an administrator to link it")
+	ErrPhoneRequired      = errors.New("IdP did not send a valid phone number required to create an account")
+	ErrAccountExists      = errors.New("an account with this phone or email already exists, ask an administrator to link it")
+	ErrRelayStateTooLong  = errors.New("relay_state must not exceed 80 bytes")
+)
+
+// Provider — IdP мерчанта. Сертификаты — сертификаты подписи IdP (base64 DER); IdPMetadata
+// принимается вместо entity_id, sso_url и certificates и в ответах не возвращается.
+type Provider struct {
+	ID           string   `json:"id"`
+	DisplayName  string   `json:"display_name,omitempty"`
+	EntityID     string   `json:"entity_id"`
+	SSOURL       string   `json:"sso_url"`
+	Certificates []string `json:"certificates"`
+	IdPMetadata  string   `json:"idp_metadata,omitempty"`
+	// MerchantID — мерчант, контекст которого получает каждый пользователь провайдера
+	MerchantID   *string          `json:"merchant_id,omitempty"`
+	Attributes   AttributeMapping `json:"attributes"`
+	RoleMappings []RoleMapping    `json:"role_mappings"`
+	LinkByEmail  bool             `json:"link_by_email"`
+	LinkByPhone  bool             `json:"link_by_phone"`
+	JITEnabled   bool             `json:"jit_enabled"`
+	// AllowIdPInitiated принимает ответы без AuthnRequest (вход из портала IdP)
+	AllowIdPInitiated bool      `json:"allow_idp_initiated"`
+	Enabled           bool      `json:"enabled"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// AttributeMapping — имена атрибутов утверждения с данными пользователя
+type AttributeMapping struct {
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// RoleMapping: если атрибут Attribute содержит значение Value (без учёта регистра), пользователь получает
+// роль Role и контекст мерчанта MerchantID. Без MerchantID роль действует у мерчанта провайдера, а если
+// его нет — у любого мерчанта. Без Role правило даёт только контекст.
+type RoleMapping struct {
+	Attribute  string `json:"attribute"`
+	Value      string `json:"value"`
+	Role       string `json:"role,omitempty"`
+	MerchantID string `json:"merchant_id,omitempty"`
+}
+
+// Grant — роль, выданная по атрибутам; MerchantID пуст для роли у любого мерчанта
+type Grant struct {
+	Role       string
+	MerchantID string
+}
+
+// Access — контексты мерчантов и роли, которые дают атрибуты утверждения
+type Access struct {
+	Contexts []string
+	Grants   []Grant
+}
+
+// Roles возвращает имена ролей из Grants без повторов
+func (a Access) Roles() []string {
+	seen := map[string]bool{}
+	roles := []string{}
+	for _, grant := range a.Grants {
+		if !seen[grant.Role] {
+			seen[grant.Role] = true
+			roles = append(roles, grant.Role)
+		}
+	}
+	return roles
+}
+
+// Profile — данные пользователя из утверждения
+type Profile struct {
+	NameID    string
+	Email     string
+	Phone     string
+	FirstName string
+	LastName  string
+}
+
+// Identity — учётная запись IdP, связанная с пользователем
+type Identity struct {
+	ProviderID  string     `json:"provider_id"`
+	NameID      string     `json:"name_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Email       string     `json:"email,omitempty"`
+	LinkedAt    time.Time  `json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// ServiceProvider — адреса нашего SP для провайдера: entityID совпадает с адресом метаданных
+type ServiceProvider struct {
+	EntityID string
+	ACSURL   string
+}
+
+func NewServiceProvider(baseURL, providerID string) ServiceProvider {
+	base := strings.TrimRight(baseURL, "/") + BasePath
+	return ServiceProvider{
+		EntityID: base + "/metadata/" + providerID,
+		ACSURL:   base + "/acs/" + providerID,
+	}
+}
+
+// LoginResult — итог входа через IdP; RelayState возвращается клиенту без изменений
+type LoginResult struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	UserID       uuid.UUID `json:"user_id"`
+	Provider     string    `json:"provider"`
+	RelayState   string    `json:"relay_state,omitempty"`
+	Linked       bool      `json:"linked,omitempty"`
+	Provisioned  bool      `json:"provisioned,omitempty"`
+	// LinkRequested — вход начат вошедшим пользователем, чтобы привязать к себе учётную запись IdP
+	LinkRequested bool `json:"link_requested,omitempty"`
+}
+
+// Normalize применяет метаданные IdP, если они переданы, и проставляет имена атрибутов по умолчанию
+func (p *Provider) Normalize() error {
+	p.ID = strings.ToLower(strings.TrimSpace(p.ID))
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	if strings.TrimSpace(p.IdPMetadata) != "" {
+		metadata, err := ParseIdPMetadata([]byte(p.IdPMetadata))
+		if err != nil {
+			return err
+		}
+		p.EntityID, p.SSOURL, p.Certificates = metadata.EntityID, metadata.SSOURL, metadata.Certificates
+		p.IdPMetadata = ""
+	}
+	p.EntityID = strings.TrimSpace(p.EntityID)
+	p.SSOURL = strings.TrimSpace(p.SSOURL)
+
+	certificates := make([]string, 0, len(p.Certificates))
+	for _, raw := range p.Certificates {
+		cert, err := ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certificates = append(certificates, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	p.Certificates = certificates
+
+	if p.MerchantID != nil && strings.TrimSpace(*p.MerchantID) == "" {
+		p.MerchantID = nil
+	}
+	if p.Attributes.Email == "" {
+		p.Attributes.Email = "email"
+	}
+	if p.Attributes.Phone == "" {
+		p.Attributes.Phone = "phone"
+	}
+	if p.Attributes.FirstName == "" {
+		p.Attributes.FirstName = "firstName"
+	}
+	if p.Attributes.LastName == "" {
+		p.Attributes.LastName = "lastName"
+	}
+	if p.RoleMappings == nil {
+		p.RoleMappings = []RoleMapping{}
+	}
+	for i := range p.RoleMappings {
+		m := &p.RoleMappings[i]
+		m.Attribute, m.Value = strings.TrimSpace(m.Attribute), strings.TrimSpace(m.Value)
+		m.Role, m.MerchantID = strings.TrimSpace(m.Role), strings.TrimSpace(m.MerchantID)
+	}
+	return nil
+}
+
+func (p Provider) Validate() error {
+	if !providerIDPattern.MatchString(p.ID) {
+		return errors.New("id must be 2-64 characters: lowercase letters, digits, '-' and '_'")
+	}
+	if p.EntityID == "" {
+		return errors.New("entity_id is required")
+	}
+	if err := validateSSOURL(p.SSOURL); err != nil {
+		return err
+	}
+	if len(p.Certificates) == 0 {
+		return errors.New("at least one IdP signing certificate is required")
+	}
+	for i, m := range p.RoleMappings {
+		if m.Attribute == "" || m.Value == "" {
+			return fmt.Errorf("role_mappings[%d]: attribute and value are required", i)
+		}
+		if m.Role == "" && m.MerchantID == "" {
+			return fmt.Errorf("role_mappings[%d]: role or merchant_id is required", i)
+		}
+	}
+	return nil
+}
+
+// validateSSOURL требует https; http допускается только для локального IdP
+func validateSSOURL(ssoURL string) error {
+	u, err := url.Parse(ssoURL)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return errors.New("sso_url must be an absolute URL")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return errors.New("sso_url must use https")
+}
+
+// MappedRoles — имена ролей из правил, для проверки, что роли существуют
+func (p Provider) MappedRoles() []string {
+	var roles []string
+	for _, m := range p.RoleMappings {
+		if m.Role != "" {
+			roles = append(roles, m.Role)
+		}
+	}
+	return roles
+}
+
+// MappedMerchants — мерчанты из правил и мерчант провайдера
+func (p Provider) MappedMerchants() []string {
+	var merchants []string
+	if p.MerchantID != nil {
+		merchants = append(merchants, *p.MerchantID)
+	}
+	for _, m := range p.RoleMappings {
+		if m.MerchantID != "" {
+			merchants = append(merchants, m.MerchantID)
+		}
+	}
+	return merchants
+}
+
+// Access вычисляет контексты и роли по атрибутам утверждения
+func (p Provider) Access(attributes map[string][]string) Access {
+	var access Access
+	contexts := map[string]bool{}
+	grants := map[Grant]bool{}
+	addContext := func(merchantID string) {
+		if merchantID != "" && !contexts[merchantID] {
+			contexts[merchantID] = true
+			access.Contexts = append(access.Contexts, merchantID)
+		}
+	}
+
+	if p.MerchantID != nil {
+		addContext(*p.MerchantID)
+	}
+	for _, m := range p.RoleMappings {
+		if !hasValue(attributes[m.Attribute], m.Value) {
+			continue
+		}
+		merchantID := m.MerchantID
+		if merchantID == "" && p.MerchantID != nil {
+			merchantID = *p.MerchantID
+		}
+		addContext(merchantID)
+		if m.Role == "" {
+			continue
+		}
+		grant := Grant{Role: m.Role, MerchantID: merchantID}
+		if !grants[grant] {
+			grants[grant] = true
+			access.Grants = append(access.Grants, grant)
+		}
+	}
+	return access
+}
+
+// Profile извлекает данные пользователя; если атрибута email нет, а NameID — адрес, email берётся из NameID
+func (p Provider) Profile(a *Assertion) Profile {
+	profile := Profile{
+		NameID:    a.NameID,
+		Email:     strings.ToLower(first(a.Attributes[p.Attributes.Email])),
+		Phone:     strings.ReplaceAll(first(a.Attributes[p.Attributes.Phone]), " ", ""),
+		FirstName: truncate(first(a.Attributes[p.Attributes.FirstName]), maxNameLength),
+		LastName:  truncate(first(a.Attributes[p.Attributes.LastName]), maxNameLength),
+	}
+	if profile.Email == "" && a.NameIDFormat == NameIDFormatEmail {
+		profile.Email = strings.ToLower(a.NameID)
+	}
+	return profile
+}
+
+// ParseCertificate принимает сертификат в PEM или base64 DER (как в X509Certificate метаданных)
+func ParseCertificate(raw string) (*x509.Certificate, error) {
+	raw = strings.TrimSpace(raw)
+	var der []byte
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(raw), ""))
+		if err != nil {
+			return nil, errors.New("certificate must be PEM or base64 DER")
+		}
+		der = decoded
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	return cert, nil
+}
+
+const maxNameLength = 64
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return value
+}
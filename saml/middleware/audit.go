@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/service"
+)
+
+// auditingService записывает в журнал аудита изменения провайдеров SAML и связи учётных записей IdP
+// с пользователями, созданные при входе
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.SamlService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.SamlService) service.SamlService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, targetType, targetID, before, after))
+}
+
+func (a *auditingService) CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error) {
+	created, err := a.next.CreateProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "saml_provider.create", auditDomain.TargetSamlProvider, created.ID, nil, created)
+	return created, nil
+}
+
+func (a *auditingService) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	return a.next.GetProvider(ctx, id)
+}
+
+func (a *auditingService) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	return a.next.ListProviders(ctx)
+}
+
+func (a *auditingService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error) {
+	before, _ := a.next.GetProvider(ctx, id)
+	updated, err := a.next.UpdateProvider(ctx, id, provider)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "saml_provider.update", auditDomain.TargetSamlProvider, id, before, updated)
+	return updated, nil
+}
+
+func (a *auditingService) DeleteProvider(ctx context.Context, id string) error {
+	before, _ := a.next.GetProvider(ctx, id)
+	if err := a.next.DeleteProvider(ctx, id); err != nil {
+		return err
+	}
+	a.record(ctx, "saml_provider.delete", auditDomain.TargetSamlProvider, id, before, nil)
+	return nil
+}
+
+func (a *auditingService) Metadata(ctx context.Context, providerID string) ([]byte, error) {
+	return a.next.Metadata(ctx, providerID)
+}
+
+func (a *auditingService) StartLogin(ctx context.Context, providerID, relayState string) (string, error) {
+	return a.next.StartLogin(ctx, providerID, relayState)
+}
+
+func (a *auditingService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error) {
+	return a.next.StartLink(ctx, userID, providerID)
+}
+
+func (a *auditingService) ConsumeResponse(ctx context.Context, providerID, samlResponse, relayState string) (*domain.LoginResult, error) {
+	result, err := a.next.ConsumeResponse(ctx, providerID, samlResponse, relayState)
+	if err != nil {
+		return nil, err
+	}
+	if result.Linked && result.LinkRequested {
+		ctx = requestinfo.WithVerifiedActor(ctx, result.UserID.String())
+		a.record(ctx, "user_identity.link", auditDomain.TargetUser, result.UserID.String(), nil,
+			map[string]string{"provider": identitiesDomain.ProviderKey(identitiesDomain.ProtocolSAML, result.Provider)})
+	} else if result.Linked {
+		action := "saml_identity.link"
+		if result.Provisioned {
+			action = "saml_identity.provision"
+		}
+		// Вход не требует заголовка автора: изменение совершает сам IdP
+		ctx = requestinfo.WithVerifiedActor(ctx, "saml:"+result.Provider)
+		a.record(ctx, action, auditDomain.TargetUser, result.UserID.String(), nil, map[string]string{"provider": result.Provider})
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/service"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.SamlService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.SamlService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateProvider(ctx context.Context, provider domain.Provider) (created *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateProvider"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateProvider(ctx, provider)
+}
+
+func (s *instrumentingService) GetProvider(ctx context.Context, id string) (provider *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetProvider"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetProvider(ctx, id)
+}
+
+func (s *instrumentingService) ListProviders(ctx context.Context) (providers []domain.Provider, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListProviders"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListProviders(ctx)
+}
+
+func (s *instrumentingService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (updated *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "UpdateProvider"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.UpdateProvider(ctx, id, provider)
+}
+
+func (s *instrumentingService) DeleteProvider(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteProvider"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteProvider(ctx, id)
+}
+
+func (s *instrumentingService) Metadata(ctx context.Context, providerID string) (metadata []byte, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Metadata"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Metadata(ctx, providerID)
+}
+
+func (s *instrumentingService) StartLogin(ctx context.Context, providerID, relayState string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "StartLogin"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.StartLogin(ctx, providerID, relayState)
+}
+
+func (s *instrumentingService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "StartLink"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.StartLink(ctx, userID, providerID)
+}
+
+func (s *instrumentingService) ConsumeResponse(ctx context.Context, providerID, samlResponse, relayState string) (result *domain.LoginResult, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ConsumeResponse"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ConsumeResponse(ctx, providerID, samlResponse, relayState)
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/service"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.SamlService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.SamlService) service.SamlService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateProvider(ctx context.Context, provider domain.Provider) (created *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateProvider",
+			"took", time.Since(begin),
+			"id", provider.ID,
+			"entityID", provider.EntityID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateProvider(ctx, provider)
+}
+
+func (l loggingService) GetProvider(ctx context.Context, id string) (provider *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetProvider",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetProvider(ctx, id)
+}
+
+func (l loggingService) ListProviders(ctx context.Context) (providers []domain.Provider, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListProviders",
+			"took", time.Since(begin),
+			"count", len(providers),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListProviders(ctx)
+}
+
+func (l loggingService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (updated *domain.Provider, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "UpdateProvider",
+			"took", time.Since(begin),
+			"id", id,
+			"entityID", provider.EntityID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.UpdateProvider(ctx, id, provider)
+}
+
+func (l loggingService) DeleteProvider(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteProvider",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteProvider(ctx, id)
+}
+
+func (l loggingService) Metadata(ctx context.Context, providerID string) (metadata []byte, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Metadata",
+			"took", time.Since(begin),
+			"provider", providerID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Metadata(ctx, providerID)
+}
+
+func (l loggingService) StartLogin(ctx context.Context, providerID, relayState string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "StartLogin",
+			"took", time.Since(begin),
+			"provider", providerID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.StartLogin(ctx, providerID, relayState)
+}
+
+func (l loggingService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (redirectURL string, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "StartLink",
+			"took", time.Since(begin),
+			"user_id", userID,
+			"provider", providerID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.StartLink(ctx, userID, providerID)
+}
+
+func (l loggingService) ConsumeResponse(ctx context.Context, providerID, samlResponse, relayState string) (result *domain.LoginResult, err error) {
+	defer func(begin time.Time) {
+		var userID string
+		var linked, provisioned bool
+		if result != nil {
+			userID, linked, provisioned = result.UserID.String(), result.Linked, result.Provisioned
+		}
+		_ = l.logger.Log(
+			"method", "ConsumeResponse",
+			"took", time.Since(begin),
+			"provider", providerID,
+			"userID", userID,
+			"linked", linked,
+			"provisioned", provisioned,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ConsumeResponse(ctx, providerID, samlResponse, relayState)
+}
@@ -0,0 +1,492 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/repository"
+)
+
+const providerColumns = `id, display_name, entity_id, sso_url, certificates, merchant_id, attributes, role_mappings,
+	link_by_email, link_by_phone, jit_enabled, allow_idp_initiated, enabled, created_at, updated_at`
+
+type samlRepository struct {
+	db *sqlx.DB
+}
+
+func NewSamlRepository(db *sqlx.DB) repository.SamlRepository {
+	return &samlRepository{db: db}
+}
+
+func (r *samlRepository) CreateProvider(ctx context.Context, p domain.Provider) error {
+	attributes, mappings, err := marshalMappings(p)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO saml_providers (` + providerColumns + `)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err = r.db.ExecContext(ctx, query, p.ID, p.DisplayName, p.EntityID, p.SSOURL, pq.Array(p.Certificates), p.MerchantID,
+		attributes, mappings, p.LinkByEmail, p.LinkByPhone, p.JITEnabled, p.AllowIdPInitiated, p.Enabled, p.CreatedAt, p.UpdatedAt)
+	return providerError(err)
+}
+
+func (r *samlRepository) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	query := `SELECT ` + providerColumns + ` FROM saml_providers WHERE id = $1`
+	p, err := scanProvider(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrProviderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *samlRepository) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+providerColumns+` FROM saml_providers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []domain.Provider{}
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+func (r *samlRepository) UpdateProvider(ctx context.Context, p domain.Provider) error {
+	attributes, mappings, err := marshalMappings(p)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE saml_providers
+	          SET display_name = $2, entity_id = $3, sso_url = $4, certificates = $5, merchant_id = $6, attributes = $7,
+	              role_mappings = $8, link_by_email = $9, link_by_phone = $10, jit_enabled = $11,
+	              allow_idp_initiated = $12, enabled = $13, updated_at = $14
+	          WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, p.ID, p.DisplayName, p.EntityID, p.SSOURL, pq.Array(p.Certificates), p.MerchantID,
+		attributes, mappings, p.LinkByEmail, p.LinkByPhone, p.JITEnabled, p.AllowIdPInitiated, p.Enabled, p.UpdatedAt)
+	if err != nil {
+		return providerError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrProviderNotFound
+	}
+	return nil
+}
+
+// DeleteProvider удаляет провайдера со связями учётных записей; выданные по атрибутам роли остаются
+func (r *samlRepository) DeleteProvider(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM saml_providers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrProviderNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_identities WHERE provider = $1`, providerKey(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *samlRepository) MissingRoles(ctx context.Context, names []string) ([]string, error) {
+	var missing []string
+	query := `SELECT name FROM unnest($1::text[]) AS name
+	          WHERE NOT EXISTS (SELECT 1 FROM roles WHERE role_name = name)`
+	err := r.db.SelectContext(ctx, &missing, query, pq.Array(names))
+	return missing, err
+}
+
+func (r *samlRepository) MissingMerchants(ctx context.Context, ids []string) ([]string, error) {
+	var missing []string
+	query := `SELECT merchant_id FROM unnest($1::text[]) AS merchant_id
+	          WHERE NOT EXISTS (SELECT 1 FROM merchants WHERE id = merchant_id)`
+	err := r.db.SelectContext(ctx, &missing, query, pq.Array(ids))
+	return missing, err
+}
+
+func (r *samlRepository) SaveRequest(ctx context.Context, providerID, requestID string, linkUserID *uuid.UUID, expiresAt time.Time) error {
+	query := `INSERT INTO saml_requests (id, provider_id, link_user_id, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, requestID, providerID, linkUserID, expiresAt)
+	return err
+}
+
+func (r *samlRepository) ConsumeRequest(ctx context.Context, providerID, requestID string) (*uuid.UUID, error) {
+	var expiresAt time.Time
+	var linkUserID *uuid.UUID
+	query := `DELETE FROM saml_requests WHERE id = $1 AND provider_id = $2 RETURNING link_user_id, expires_at`
+	err := r.db.QueryRowContext(ctx, query, requestID, providerID).Scan(&linkUserID, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && time.Now().UTC().After(expiresAt)) {
+		return nil, domain.ErrUnknownRequest
+	}
+	if err != nil {
+		return nil, err
+	}
+	return linkUserID, nil
+}
+
+func (r *samlRepository) SaveAssertion(ctx context.Context, providerID, assertionID string, expiresAt time.Time) error {
+	query := `INSERT INTO saml_assertions (provider_id, assertion_id, expires_at) VALUES ($1, $2, $3)
+	          ON CONFLICT (provider_id, assertion_id) DO NOTHING`
+	res, err := r.db.ExecContext(ctx, query, providerID, assertionID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrReplay
+	}
+	return nil
+}
+
+func (r *samlRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	requests, err := r.db.ExecContext(ctx, `DELETE FROM saml_requests WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	assertions, err := r.db.ExecContext(ctx, `DELETE FROM saml_assertions WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := requests.RowsAffected()
+	m, _ := assertions.RowsAffected()
+	return n + m, nil
+}
+
+func (r *samlRepository) FindIdentity(ctx context.Context, providerID, nameID string) (*domain.Identity, error) {
+	identity := domain.Identity{ProviderID: providerID, NameID: nameID}
+	query := `SELECT user_id, email, linked_at, last_login_at FROM user_identities WHERE provider = $1 AND subject = $2`
+	err := r.db.QueryRowContext(ctx, query, providerKey(providerID), nameID).
+		Scan(&identity.UserID, &identity.Email, &identity.LinkedAt, &identity.LastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNoLocalAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *samlRepository) FindUserByEmail(ctx context.Context, email string) (uuid.UUID, error) {
+	return r.findUser(ctx, `SELECT id FROM "users" WHERE lower(email) = lower($1) LIMIT 2`, email)
+}
+
+func (r *samlRepository) FindUserByPhone(ctx context.Context, phone string) (uuid.UUID, error) {
+	return r.findUser(ctx, `SELECT id FROM "users" WHERE phone = $1 LIMIT 2`, phone)
+}
+
+func (r *samlRepository) findUser(ctx context.Context, query string, value string) (uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.SelectContext(ctx, &ids, query, value); err != nil {
+		return uuid.Nil, err
+	}
+	switch len(ids) {
+	case 0:
+		return uuid.Nil, domain.ErrNoLocalAccount
+	case 1:
+		return ids[0], nil
+	}
+	return uuid.Nil, domain.ErrAmbiguousAccount
+}
+
+func (r *samlRepository) LinkIdentity(ctx context.Context, identity domain.Identity) error {
+	return linkIdentity(ctx, r.db, identity)
+}
+
+func (r *samlRepository) TouchIdentity(ctx context.Context, providerID, nameID, email string) error {
+	query := `UPDATE user_identities SET last_login_at = $3, email = $4 WHERE provider = $1 AND subject = $2`
+	_, err := r.db.ExecContext(ctx, query, providerKey(providerID), nameID, time.Now().UTC(), email)
+	return err
+}
+
+// ProvisionUser заводит пользователя без входа по паролю: войти он может только через провайдера
+func (r *samlRepository) ProvisionUser(ctx context.Context, provider domain.Provider, profile domain.Profile, access domain.Access, passwordHash string) (uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	now := time.Now().UTC()
+	query := `INSERT INTO "users" (id, phone, password_hash, rights, email, first_name, last_name, created_at)
+	         VALUES ($1, $2, $3, '{}', NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7)`
+	_, err = tx.ExecContext(ctx, query, id, profile.Phone, passwordHash, profile.Email, profile.FirstName, profile.LastName, now)
+	if err != nil {
+		return uuid.Nil, accountError(err)
+	}
+
+	registered := outboxDomain.UserRegisteredPayload{UserID: id.String(), Phone: profile.Phone, Email: profile.Email, Source: "saml"}
+	if err := appendEvent(ctx, tx, outboxDomain.UserRegistered, id, registered); err != nil {
+		return uuid.Nil, err
+	}
+
+	identity := domain.Identity{ProviderID: provider.ID, NameID: profile.NameID, UserID: id, Email: profile.Email, LinkedAt: now}
+	if err := linkIdentity(ctx, tx, identity); err != nil {
+		return uuid.Nil, err
+	}
+	if err := syncAccess(ctx, tx, provider.ID, id, access); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+func (r *samlRepository) SyncAccess(ctx context.Context, providerID string, userID uuid.UUID, access domain.Access) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := syncAccess(ctx, tx, providerID, userID, access); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// syncAccess приводит роли, выданные по атрибутам, к тому, что передал IdP. Контексты только добавляются:
+// их могли выдать и вручную. Мерчант, который не найден или приостановлен, пропускается вместе с ролями у него.
+func syncAccess(ctx context.Context, tx *sqlx.Tx, providerID string, userID uuid.UUID, access domain.Access) error {
+	available := map[string]bool{}
+	for _, merchantID := range access.Contexts {
+		err := checkMerchant(ctx, tx, merchantID)
+		if errors.Is(err, merchantsDomain.ErrMerchantNotFound) || errors.Is(err, merchantsDomain.ErrMerchantSuspended) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := addContext(ctx, tx, userID, merchantID); err != nil {
+			return err
+		}
+		available[merchantID] = true
+	}
+
+	type key struct {
+		roleID     int
+		merchantID string
+	}
+	desired := map[key]bool{}
+	for _, grant := range access.Grants {
+		var roleID int
+		var rightsJSON []byte
+		err := tx.QueryRowContext(ctx, `SELECT role_id, rights FROM roles WHERE role_name = $1 FOR SHARE`, grant.Role).
+			Scan(&roleID, &rightsJSON)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		desired[key{roleID, grant.MerchantID}] = true
+		if grant.MerchantID != "" && !available[grant.MerchantID] {
+			continue
+		}
+
+		query := `INSERT INTO users_roles (user_id, role_id, merchant_id, granted_at) VALUES ($1, $2, NULLIF($3, ''), now())
+		          ON CONFLICT (user_id, role_id, (COALESCE(merchant_id, ''))) DO NOTHING`
+		res, err := tx.ExecContext(ctx, query, userID, roleID, grant.MerchantID)
+		if err != nil {
+			return err
+		}
+		// Роль, которая у пользователя уже была, не запоминается: при следующем входе её не снимаем
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		query = `INSERT INTO saml_role_grants (provider_id, user_id, role_id, merchant_id) VALUES ($1, $2, $3, $4)
+		         ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, providerID, userID, roleID, grant.MerchantID); err != nil {
+			return err
+		}
+		if err := appendRoleEvent(ctx, tx, outboxDomain.RoleAssigned, roleID, grant.Role, rightsJSON, userID, grant.MerchantID); err != nil {
+			return err
+		}
+	}
+
+	var tracked []struct {
+		RoleID     int    `db:"role_id"`
+		MerchantID string `db:"merchant_id"`
+		RoleName   string `db:"role_name"`
+		Rights     []byte `db:"rights"`
+	}
+	query := `SELECT g.role_id, g.merchant_id, r.role_name, r.rights
+	          FROM saml_role_grants g JOIN roles r ON r.role_id = g.role_id
+	          WHERE g.provider_id = $1 AND g.user_id = $2`
+	if err := tx.SelectContext(ctx, &tracked, query, providerID, userID); err != nil {
+		return err
+	}
+	for _, grant := range tracked {
+		if desired[key{grant.RoleID, grant.MerchantID}] {
+			continue
+		}
+		query := `DELETE FROM saml_role_grants WHERE provider_id = $1 AND user_id = $2 AND role_id = $3 AND merchant_id = $4`
+		if _, err := tx.ExecContext(ctx, query, providerID, userID, grant.RoleID, grant.MerchantID); err != nil {
+			return err
+		}
+		query = `DELETE FROM users_roles WHERE user_id = $1 AND role_id = $2 AND COALESCE(merchant_id, '') = $3`
+		res, err := tx.ExecContext(ctx, query, userID, grant.RoleID, grant.MerchantID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := appendRoleEvent(ctx, tx, outboxDomain.RoleUnassigned, grant.RoleID, grant.RoleName, grant.Rights, userID, grant.MerchantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addContext(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, merchantID string) error {
+	query := `INSERT INTO users_contexts (user_id, merchant_id, global, granted_by) VALUES ($1, $2, FALSE, $3)
+	          ON CONFLICT (user_id, merchant_id) DO NOTHING`
+	res, err := tx.ExecContext(ctx, query, userID, merchantID, requestinfo.Actor(ctx))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	added := outboxDomain.ContextAddedPayload{UserID: userID.String(), MerchantID: merchantID}
+	return appendEvent(ctx, tx, outboxDomain.ContextAdded, userID, added)
+}
+
+func linkIdentity(ctx context.Context, db sqlx.ExecerContext, identity domain.Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, verified, email, linked_at, last_login_at)
+	          VALUES ($1, $2, $3, TRUE, $4, $5, $5)`
+	_, err := db.ExecContext(ctx, query, providerKey(identity.ProviderID), identity.NameID, identity.UserID,
+		identity.Email, identity.LinkedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.ErrAmbiguousAccount
+	}
+	return err
+}
+
+// providerKey — имя способа входа через IdP в user_identities
+func providerKey(providerID string) string {
+	return identitiesDomain.ProviderKey(identitiesDomain.ProtocolSAML, providerID)
+}
+
+func checkMerchant(ctx context.Context, tx *sqlx.Tx, merchantID string) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM merchants WHERE id = $1 FOR SHARE`, merchantID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return merchantsDomain.ErrMerchantNotFound
+	}
+	if err == nil && status != merchantsDomain.StatusActive {
+		return merchantsDomain.ErrMerchantSuspended
+	}
+	return err
+}
+
+func appendRoleEvent(ctx context.Context, tx *sqlx.Tx, change string, roleID int, roleName string, rightsJSON []byte, userID uuid.UUID, merchantID string) error {
+	return rolesPostgres.AppendRoleEvent(ctx, tx, outboxDomain.RoleChangedPayload{
+		RoleID:     roleID,
+		RoleName:   roleName,
+		Change:     change,
+		UserID:     userID.String(),
+		MerchantID: merchantID,
+		Modules:    rolesPostgres.RightsModules(rightsJSON),
+	})
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+func marshalMappings(p domain.Provider) ([]byte, []byte, error) {
+	attributes, err := json.Marshal(p.Attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	mappings, err := json.Marshal(p.RoleMappings)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attributes, mappings, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProvider(row scanner) (domain.Provider, error) {
+	var p domain.Provider
+	var certificates pq.StringArray
+	var merchantID sql.NullString
+	var attributes, mappings []byte
+	err := row.Scan(&p.ID, &p.DisplayName, &p.EntityID, &p.SSOURL, &certificates, &merchantID, &attributes, &mappings,
+		&p.LinkByEmail, &p.LinkByPhone, &p.JITEnabled, &p.AllowIdPInitiated, &p.Enabled, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return domain.Provider{}, err
+	}
+	p.Certificates = certificates
+	if merchantID.Valid {
+		p.MerchantID = &merchantID.String
+	}
+	if err := json.Unmarshal(attributes, &p.Attributes); err != nil {
+		return domain.Provider{}, err
+	}
+	if err := json.Unmarshal(mappings, &p.RoleMappings); err != nil {
+		return domain.Provider{}, err
+	}
+	return p, nil
+}
+
+func providerError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return domain.ErrProviderExists
+		case "23503":
+			return merchantsDomain.ErrMerchantNotFound
+		}
+	}
+	return err
+}
+
+// accountError: телефон или email уже заняты другим пользователем
+func accountError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.ErrAccountExists
+	}
+	return err
+}
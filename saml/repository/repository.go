@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+)
+
+type SamlRepository interface {
+	CreateProvider(ctx context.Context, provider domain.Provider) error
+	GetProvider(ctx context.Context, id string) (*domain.Provider, error)
+	ListProviders(ctx context.Context) ([]domain.Provider, error)
+	UpdateProvider(ctx context.Context, provider domain.Provider) error
+	DeleteProvider(ctx context.Context, id string) error
+	// MissingRoles и MissingMerchants возвращают значения, для которых нет роли или мерчанта
+	MissingRoles(ctx context.Context, names []string) ([]string, error)
+	MissingMerchants(ctx context.Context, ids []string) ([]string, error)
+
+	// SaveRequest запоминает отправленный AuthnRequest; linkUserID задан, если вход начат для привязки
+	SaveRequest(ctx context.Context, providerID, requestID string, linkUserID *uuid.UUID, expiresAt time.Time) error
+	// ConsumeRequest забирает отправленный AuthnRequest: на один запрос принимается один ответ.
+	// Возвращает пользователя, к которому привязывается учётная запись, если вход начат для привязки.
+	ConsumeRequest(ctx context.Context, providerID, requestID string) (*uuid.UUID, error)
+	// SaveAssertion запоминает утверждение до его истечения; повтор даёт ErrReplay
+	SaveAssertion(ctx context.Context, providerID, assertionID string, expiresAt time.Time) error
+	// DeleteExpired удаляет просроченные запросы и утверждения
+	DeleteExpired(ctx context.Context) (int64, error)
+
+	FindIdentity(ctx context.Context, providerID, nameID string) (*domain.Identity, error)
+	FindUserByEmail(ctx context.Context, email string) (uuid.UUID, error)
+	FindUserByPhone(ctx context.Context, phone string) (uuid.UUID, error)
+	LinkIdentity(ctx context.Context, identity domain.Identity) error
+	TouchIdentity(ctx context.Context, providerID, nameID, email string) error
+	// ProvisionUser заводит пользователя по учётной записи IdP вместе со связью, контекстами и ролями
+	ProvisionUser(ctx context.Context, provider domain.Provider, profile domain.Profile, access domain.Access, passwordHash string) (uuid.UUID, error)
+	// SyncAccess добавляет контексты и роли по атрибутам и снимает роли, ранее выданные по атрибутам,
+	// которых IdP больше не передаёт
+	SyncAccess(ctx context.Context, providerID string, userID uuid.UUID, access domain.Access) error
+}
@@ -0,0 +1,35 @@
+package saml
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/saml/middleware"
+	"github.com/rafaceo/go-test-auth/saml/repository/postgres"
+	"github.com/rafaceo/go-test-auth/saml/service"
+	"github.com/rafaceo/go-test-auth/security"
+)
+
+type ServiceFactory struct{}
+
+// CreateSamlService — вход через IdP мерчантов по SAML 2.0; baseURL — внешний адрес сервиса,
+// от которого строятся entityID и адрес ACS нашего SP
+func (sf *ServiceFactory) CreateSamlService(logger log.Logger, postgresClient *sqlx.DB, sessions service.SessionIssuer, baseURL string) service.SamlService {
+	samlServ := service.NewSamlService(
+		postgres.NewSamlRepository(postgresClient),
+		sessions,
+		security.NewRecorder(logger, postgresClient),
+		accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)),
+		baseURL,
+	)
+	samlServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), samlServ)
+	samlServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "saml"), samlServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("saml_service")
+	samlServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, samlServ)
+
+	return samlServ
+}
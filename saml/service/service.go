@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/repository"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+	securityService "github.com/rafaceo/go-test-auth/security/service"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPhoneLength — ограничение столбца телефона в профиле пользователя
+const maxPhoneLength = 16
+
+type SamlService interface {
+	CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error)
+	GetProvider(ctx context.Context, id string) (*domain.Provider, error)
+	ListProviders(ctx context.Context) ([]domain.Provider, error)
+	// UpdateProvider заменяет настройки провайдера; без certificates и idp_metadata сертификаты остаются прежними
+	UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error)
+	DeleteProvider(ctx context.Context, id string) error
+
+	// Metadata — XML метаданных нашего SP для настройки приложения в IdP
+	Metadata(ctx context.Context, providerID string) ([]byte, error)
+	// StartLogin запоминает AuthnRequest и возвращает адрес IdP для перенаправления браузера
+	StartLogin(ctx context.Context, providerID, relayState string) (string, error)
+	// StartLink начинает вход, который привяжет учётную запись IdP к пользователю userID
+	StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error)
+	// ConsumeResponse проверяет ответ IdP, пришедший на ACS, и выпускает токены сервиса
+	ConsumeResponse(ctx context.Context, providerID, samlResponse, relayState string) (*domain.LoginResult, error)
+}
+
+// SessionIssuer выпускает access_token и refresh_token пользователю, личность которого подтвердил IdP
+type SessionIssuer interface {
+	IssueSession(ctx context.Context, userID uuid.UUID) (string, string, error)
+}
+
+// SensitiveGuard не даёт назначить роли с правами чувствительных модулей в обход заявок на доступ
+type SensitiveGuard interface {
+	CheckRoleGrant(ctx context.Context, roleNames []string) error
+}
+
+type samlService struct {
+	repo     repository.SamlRepository
+	sessions SessionIssuer
+	security securityService.SecurityEventService
+	guard    SensitiveGuard
+	baseURL  string
+}
+
+func NewSamlService(repo repository.SamlRepository, sessions SessionIssuer, security securityService.SecurityEventService, guard SensitiveGuard, baseURL string) SamlService {
+	return &samlService{repo: repo, sessions: sessions, security: security, guard: guard, baseURL: baseURL}
+}
+
+func (s *samlService) CreateProvider(ctx context.Context, provider domain.Provider) (*domain.Provider, error) {
+	if err := provider.Normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, provider); err != nil {
+		return nil, err
+	}
+	provider.CreatedAt = time.Now().UTC()
+	provider.UpdatedAt = provider.CreatedAt
+	if err := s.repo.CreateProvider(ctx, provider); err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (s *samlService) GetProvider(ctx context.Context, id string) (*domain.Provider, error) {
+	return s.repo.GetProvider(ctx, id)
+}
+
+func (s *samlService) ListProviders(ctx context.Context) ([]domain.Provider, error) {
+	return s.repo.ListProviders(ctx)
+}
+
+func (s *samlService) UpdateProvider(ctx context.Context, id string, provider domain.Provider) (*domain.Provider, error) {
+	current, err := s.repo.GetProvider(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.ID = current.ID
+	if len(provider.Certificates) == 0 && provider.IdPMetadata == "" {
+		provider.Certificates = current.Certificates
+	}
+	if err := provider.Normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, provider); err != nil {
+		return nil, err
+	}
+	provider.CreatedAt = current.CreatedAt
+	provider.UpdatedAt = time.Now().UTC()
+	if err := s.repo.UpdateProvider(ctx, provider); err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (s *samlService) DeleteProvider(ctx context.Context, id string) error {
+	return s.repo.DeleteProvider(ctx, id)
+}
+
+// validate проверяет, что роли и мерчанты из правил существуют: опечатка в настройке иначе
+// обнаружилась бы только при входе пользователя
+func (s *samlService) validate(ctx context.Context, provider domain.Provider) error {
+	if err := provider.Validate(); err != nil {
+		return err
+	}
+	if roles := provider.MappedRoles(); len(roles) > 0 {
+		missing, err := s.repo.MissingRoles(ctx, roles)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("unknown role %q in role_mappings", missing[0])
+		}
+	}
+	if merchants := provider.MappedMerchants(); len(merchants) > 0 {
+		missing, err := s.repo.MissingMerchants(ctx, merchants)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("unknown merchant %q", missing[0])
+		}
+	}
+	return nil
+}
+
+func (s *samlService) Metadata(ctx context.Context, providerID string) ([]byte, error) {
+	provider, err := s.repo.GetProvider(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return domain.SPMetadata(domain.NewServiceProvider(s.baseURL, provider.ID))
+}
+
+func (s *samlService) StartLogin(ctx context.Context, providerID, relayState string) (string, error) {
+	return s.start(ctx, providerID, relayState, nil)
+}
+
+func (s *samlService) StartLink(ctx context.Context, userID uuid.UUID, providerID string) (string, error) {
+	return s.start(ctx, providerID, "", &userID)
+}
+
+func (s *samlService) start(ctx context.Context, providerID, relayState string, linkUserID *uuid.UUID) (string, error) {
+	if len(relayState) > domain.MaxRelayStateLength {
+		return "", domain.ErrRelayStateTooLong
+	}
+	provider, err := s.repo.GetProvider(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	if !provider.Enabled {
+		return "", domain.ErrProviderDisabled
+	}
+
+	// Просроченные запросы и утверждения подчищаются при каждом новом входе, отдельная фоновая задача не нужна
+	_, _ = s.repo.DeleteExpired(ctx)
+
+	now := time.Now().UTC()
+	request, err := domain.NewAuthnRequest(domain.NewServiceProvider(s.baseURL, provider.ID), *provider, relayState, now)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SaveRequest(ctx, provider.ID, request.ID, linkUserID, now.Add(domain.RequestTTL)); err != nil {
+		return "", err
+	}
+	return request.RedirectURL, nil
+}
+
+func (s *samlService) ConsumeResponse(ctx context.Context, providerID, samlResponse, relayState string) (*domain.LoginResult, error) {
+	provider, err := s.repo.GetProvider(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	if !provider.Enabled {
+		return nil, domain.ErrProviderDisabled
+	}
+
+	assertion, err := domain.ParseResponse(samlResponse, *provider, domain.NewServiceProvider(s.baseURL, provider.ID), time.Now().UTC())
+	if err != nil {
+		return nil, s.fail(ctx, provider.ID, "", "", "invalid_response", err)
+	}
+	// Привязка возможна только по ответу на наш запрос: по нему известно, кто её начал
+	var linkUserID *uuid.UUID
+	if assertion.InResponseTo != "" {
+		linkUserID, err = s.repo.ConsumeRequest(ctx, provider.ID, assertion.InResponseTo)
+		if err != nil {
+			return nil, s.fail(ctx, provider.ID, assertion.NameID, "", "unknown_request", err)
+		}
+	} else if !provider.AllowIdPInitiated {
+		return nil, s.fail(ctx, provider.ID, assertion.NameID, "", "unsolicited_response", domain.ErrUnsolicited)
+	}
+	if err := s.repo.SaveAssertion(ctx, provider.ID, assertion.ID, assertion.ExpiresAt); err != nil {
+		return nil, s.fail(ctx, provider.ID, assertion.NameID, "", "replay", err)
+	}
+
+	profile := provider.Profile(assertion)
+	access := provider.Access(assertion.Attributes)
+	// роли по атрибутам выдаются без заявки, поэтому роль с чувствительными модулями в сопоставлении — ошибка настройки
+	if err := s.guard.CheckRoleGrant(ctx, access.Roles()); err != nil {
+		return nil, s.fail(ctx, provider.ID, assertion.NameID, "", "sensitive_role", err)
+	}
+
+	ctx = requestinfo.WithVerifiedActor(ctx, "saml:"+provider.ID)
+	result := &domain.LoginResult{Provider: provider.ID, RelayState: relayState}
+	if linkUserID != nil {
+		result.UserID, result.LinkRequested = *linkUserID, true
+		result.Linked, err = s.link(ctx, *provider, profile, result.UserID)
+		if err != nil {
+			return nil, s.fail(ctx, provider.ID, assertion.NameID, result.UserID.String(), "link_failed", err)
+		}
+	} else {
+		result.UserID, result.Linked, result.Provisioned, err = s.resolveUser(ctx, *provider, profile, access)
+		if err != nil {
+			return nil, s.fail(ctx, provider.ID, assertion.NameID, "", "no_local_account", err)
+		}
+	}
+	if !result.Provisioned {
+		if err := s.repo.SyncAccess(ctx, provider.ID, result.UserID, access); err != nil {
+			return nil, s.fail(ctx, provider.ID, assertion.NameID, result.UserID.String(), "access_sync_failed", err)
+		}
+	}
+
+	result.AccessToken, result.RefreshToken, err = s.sessions.IssueSession(ctx, result.UserID)
+	if err != nil {
+		return nil, s.fail(ctx, provider.ID, assertion.NameID, result.UserID.String(), "session_failed", err)
+	}
+	return result, nil
+}
+
+// resolveUser находит пользователя учётной записи IdP: по существующей связи, затем по email и телефону,
+// если провайдеру это разрешено, и наконец заводит нового (JIT). Новый пользователь получает контексты
+// и роли в той же транзакции.
+func (s *samlService) resolveUser(ctx context.Context, provider domain.Provider, profile domain.Profile, access domain.Access) (uuid.UUID, bool, bool, error) {
+	identity, err := s.repo.FindIdentity(ctx, provider.ID, profile.NameID)
+	if err == nil {
+		_ = s.repo.TouchIdentity(ctx, provider.ID, profile.NameID, profile.Email)
+		return identity.UserID, false, false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return uuid.Nil, false, false, err
+	}
+
+	userID, err := s.findLinkable(ctx, provider, profile)
+	if err == nil {
+		err = s.repo.LinkIdentity(ctx, domain.Identity{
+			ProviderID: provider.ID,
+			NameID:     profile.NameID,
+			UserID:     userID,
+			Email:      profile.Email,
+			LinkedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return uuid.Nil, false, false, err
+		}
+		return userID, true, false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return uuid.Nil, false, false, err
+	}
+
+	if !provider.JITEnabled {
+		return uuid.Nil, false, false, domain.ErrNoLocalAccount
+	}
+	userID, err = s.provision(ctx, provider, profile, access)
+	if err != nil {
+		return uuid.Nil, false, false, err
+	}
+	return userID, true, true, nil
+}
+
+// link привязывает учётную запись IdP к пользователю, начавшему вход. Учётная запись, уже привязанная
+// к другому пользователю, не перепривязывается: для этого есть слияние пользователей.
+func (s *samlService) link(ctx context.Context, provider domain.Provider, profile domain.Profile, userID uuid.UUID) (bool, error) {
+	identity, err := s.repo.FindIdentity(ctx, provider.ID, profile.NameID)
+	if err == nil {
+		if identity.UserID != userID {
+			return false, identitiesDomain.ErrIdentityTaken
+		}
+		_ = s.repo.TouchIdentity(ctx, provider.ID, profile.NameID, profile.Email)
+		return false, nil
+	}
+	if !errors.Is(err, domain.ErrNoLocalAccount) {
+		return false, err
+	}
+
+	err = s.repo.LinkIdentity(ctx, domain.Identity{
+		ProviderID: provider.ID,
+		NameID:     profile.NameID,
+		UserID:     userID,
+		Email:      profile.Email,
+		LinkedAt:   time.Now().UTC(),
+	})
+	if errors.Is(err, domain.ErrAmbiguousAccount) {
+		return false, identitiesDomain.ErrIdentityTaken
+	}
+	return err == nil, err
+}
+
+func (s *samlService) findLinkable(ctx context.Context, provider domain.Provider, profile domain.Profile) (uuid.UUID, error) {
+	if provider.LinkByEmail && profile.Email != "" {
+		userID, err := s.repo.FindUserByEmail(ctx, profile.Email)
+		if !errors.Is(err, domain.ErrNoLocalAccount) {
+			return userID, err
+		}
+	}
+	if provider.LinkByPhone && profile.Phone != "" {
+		return s.repo.FindUserByPhone(ctx, profile.Phone)
+	}
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+// provision заводит пользователя. Телефон обязателен для любого пользователя сервиса, поэтому IdP
+// должен передавать его в атрибуте. Вход по телефону у такого пользователя не заводится: его можно
+// добавить позже, задав пароль.
+func (s *samlService) provision(ctx context.Context, provider domain.Provider, profile domain.Profile, access domain.Access) (uuid.UUID, error) {
+	if err := userDomain.ValidatePhone(profile.Phone); err != nil || len(profile.Phone) > maxPhoneLength {
+		return uuid.Nil, domain.ErrPhoneRequired
+	}
+	if profile.Email != "" && userDomain.ValidateEmail(profile.Email) != nil {
+		profile.Email = ""
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return uuid.Nil, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(password)), bcrypt.DefaultCost)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return s.repo.ProvisionUser(ctx, provider, profile, access, string(hashed))
+}
+
+// fail записывает неудачный вход через IdP в журнал событий безопасности
+func (s *samlService) fail(ctx context.Context, providerID, nameID, userID, reason string, err error) error {
+	_ = s.security.Record(ctx, securityDomain.Event{
+		Type:    securityDomain.EventLoginFailed,
+		Subject: nameID,
+		UserID:  userID,
+		Details: map[string]interface{}{"reason": reason, "provider": providerID, "protocol": "saml", "error": err.Error()},
+	})
+	return err
+}
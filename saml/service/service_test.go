@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const baseURL = "https://auth.example.com"
+
+// memorySaml хранит один провайдер, отправленные запросы, принятые утверждения и одну связь с пользователем
+type memorySaml struct {
+	mu         sync.Mutex
+	provider   domain.Provider
+	requests   map[string]*uuid.UUID
+	assertions map[string]bool
+	identity   domain.Identity
+}
+
+func (r *memorySaml) CreateProvider(context.Context, domain.Provider) error { return nil }
+
+func (r *memorySaml) GetProvider(_ context.Context, id string) (*domain.Provider, error) {
+	if id != r.provider.ID {
+		return nil, domain.ErrProviderNotFound
+	}
+	provider := r.provider
+	return &provider, nil
+}
+
+func (r *memorySaml) ListProviders(context.Context) ([]domain.Provider, error) {
+	return []domain.Provider{r.provider}, nil
+}
+
+func (r *memorySaml) UpdateProvider(context.Context, domain.Provider) error { return nil }
+
+func (r *memorySaml) DeleteProvider(context.Context, string) error { return nil }
+
+func (r *memorySaml) MissingRoles(context.Context, []string) ([]string, error) { return nil, nil }
+
+func (r *memorySaml) MissingMerchants(context.Context, []string) ([]string, error) { return nil, nil }
+
+func (r *memorySaml) SaveRequest(_ context.Context, _, requestID string, linkUserID *uuid.UUID, _ time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[requestID] = linkUserID
+	return nil
+}
+
+func (r *memorySaml) ConsumeRequest(_ context.Context, _, requestID string) (*uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	linkUserID, ok := r.requests[requestID]
+	if !ok {
+		return nil, domain.ErrUnknownRequest
+	}
+	delete(r.requests, requestID)
+	return linkUserID, nil
+}
+
+func (r *memorySaml) SaveAssertion(_ context.Context, _, assertionID string, _ time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.assertions[assertionID] {
+		return domain.ErrReplay
+	}
+	r.assertions[assertionID] = true
+	return nil
+}
+
+func (r *memorySaml) DeleteExpired(context.Context) (int64, error) { return 0, nil }
+
+func (r *memorySaml) FindIdentity(_ context.Context, providerID, nameID string) (*domain.Identity, error) {
+	if providerID != r.identity.ProviderID || nameID != r.identity.NameID {
+		return nil, domain.ErrNoLocalAccount
+	}
+	identity := r.identity
+	return &identity, nil
+}
+
+func (r *memorySaml) FindUserByEmail(context.Context, string) (uuid.UUID, error) {
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+func (r *memorySaml) FindUserByPhone(context.Context, string) (uuid.UUID, error) {
+	return uuid.Nil, domain.ErrNoLocalAccount
+}
+
+func (r *memorySaml) LinkIdentity(context.Context, domain.Identity) error { return nil }
+
+func (r *memorySaml) TouchIdentity(context.Context, string, string, string) error { return nil }
+
+func (r *memorySaml) ProvisionUser(context.Context, domain.Provider, domain.Profile, domain.Access, string) (uuid.UUID, error) {
+	return uuid.Nil, errors.New("provisioning is disabled")
+}
+
+func (r *memorySaml) SyncAccess(context.Context, string, uuid.UUID, domain.Access) error { return nil }
+
+type staticSessions struct{}
+
+func (staticSessions) IssueSession(_ context.Context, userID uuid.UUID) (string, string, error) {
+	return "access-" + userID.String(), "refresh-" + userID.String(), nil
+}
+
+// noSensitiveRoles — у провайдера теста нет сопоставлений ролей
+type noSensitiveRoles struct{}
+
+func (noSensitiveRoles) CheckRoleGrant(context.Context, []string) error { return nil }
+
+// recordedEvents запоминает причины неудачных входов
+type recordedEvents struct {
+	reasons []string
+}
+
+func (r *recordedEvents) Record(_ context.Context, event securityDomain.Event) error {
+	reason, _ := event.Details["reason"].(string)
+	r.reasons = append(r.reasons, reason)
+	return nil
+}
+
+type samlTest struct {
+	service SamlService
+	repo    *memorySaml
+	events  *recordedEvents
+	signer  *dsig.SigningContext
+	sp      domain.ServiceProvider
+	userID  uuid.UUID
+}
+
+func newSamlTest(t *testing.T, allowIdPInitiated bool) *samlTest {
+	t.Helper()
+	keys := dsig.RandomKeyStoreForTest()
+	_, cert, err := keys.GetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	repo := &memorySaml{
+		provider: domain.Provider{
+			ID:                "corp",
+			EntityID:          "https://idp.example.com",
+			Certificates:      []string{base64.StdEncoding.EncodeToString(cert)},
+			AllowIdPInitiated: allowIdPInitiated,
+			Enabled:           true,
+		},
+		requests:   map[string]*uuid.UUID{},
+		assertions: map[string]bool{},
+		identity:   domain.Identity{ProviderID: "corp", NameID: "jdoe", UserID: userID},
+	}
+	events := &recordedEvents{}
+	return &samlTest{
+		service: NewSamlService(repo, staticSessions{}, events, noSensitiveRoles{}, baseURL),
+		repo:    repo,
+		events:  events,
+		signer:  dsig.NewDefaultSigningContext(keys),
+		sp:      domain.NewServiceProvider(baseURL, "corp"),
+		userID:  userID,
+	}
+}
+
+// response возвращает SAMLResponse с подписанным утверждением; пустой inResponseTo — вход со стороны IdP
+func (s *samlTest) response(t *testing.T, assertionID, inResponseTo string) string {
+	t.Helper()
+	now := time.Now().UTC()
+	issued, expires := now.Add(-time.Minute).Format(time.RFC3339), now.Add(5*time.Minute).Format(time.RFC3339)
+	inResponseToAttr := ""
+	if inResponseTo != "" {
+		inResponseToAttr = fmt.Sprintf(` InResponseTo="%s"`, inResponseTo)
+	}
+
+	assertion := etree.NewDocument()
+	err := assertion.ReadFromString(fmt.Sprintf(`<saml:Assertion xmlns:saml="%[1]s" ID="%[2]s" Version="2.0" IssueInstant="%[3]s">
+<saml:Issuer>%[5]s</saml:Issuer>
+<saml:Subject>
+<saml:NameID>jdoe</saml:NameID>
+<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+<saml:SubjectConfirmationData Recipient="%[6]s" NotOnOrAfter="%[4]s"%[8]s/>
+</saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%[3]s" NotOnOrAfter="%[4]s">
+<saml:AudienceRestriction><saml:Audience>%[7]s</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AuthnStatement AuthnInstant="%[3]s"/>
+</saml:Assertion>`, domain.NamespaceAssertion, assertionID, issued, expires, s.repo.provider.EntityID, s.sp.ACSURL, s.sp.EntityID, inResponseToAttr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := s.signer.SignEnveloped(assertion.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := etree.NewDocument()
+	err = doc.ReadFromString(fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" ID="_response-%s" Version="2.0" IssueInstant="%s" Destination="%s">
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+</samlp:Response>`, domain.NamespaceProtocol, assertionID, issued, s.sp.ACSURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Root().AddChild(signed)
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestConsumeResponse(t *testing.T) {
+	s := newSamlTest(t, false)
+	if err := s.repo.SaveRequest(context.Background(), "corp", "_request-1", nil, time.Now().Add(domain.RequestTTL)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-1", "_request-1"), "/home")
+	if err != nil {
+		t.Fatalf("ConsumeResponse: %v", err)
+	}
+	if result.UserID != s.userID || result.AccessToken == "" || result.RelayState != "/home" || result.LinkRequested {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestConsumeResponseLinksRequestingUser(t *testing.T) {
+	s := newSamlTest(t, false)
+	s.repo.identity = domain.Identity{}
+	linkUserID := uuid.New()
+	if err := s.repo.SaveRequest(context.Background(), "corp", "_request-1", &linkUserID, time.Now().Add(domain.RequestTTL)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-1", "_request-1"), "")
+	if err != nil {
+		t.Fatalf("ConsumeResponse: %v", err)
+	}
+	if result.UserID != linkUserID || !result.LinkRequested || !result.Linked {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestConsumeResponseRejectsUnknownInResponseTo(t *testing.T) {
+	s := newSamlTest(t, true)
+	if err := s.repo.SaveRequest(context.Background(), "corp", "_request-1", nil, time.Now().Add(domain.RequestTTL)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-1", "_request-2"), "")
+	if !errors.Is(err, domain.ErrUnknownRequest) {
+		t.Fatalf("error = %v, want %v", err, domain.ErrUnknownRequest)
+	}
+	if len(s.events.reasons) != 1 || s.events.reasons[0] != "unknown_request" {
+		t.Fatalf("recorded %v, want [unknown_request]", s.events.reasons)
+	}
+}
+
+func TestConsumeResponseRejectsSecondAnswerToRequest(t *testing.T) {
+	s := newSamlTest(t, false)
+	if err := s.repo.SaveRequest(context.Background(), "corp", "_request-1", nil, time.Now().Add(domain.RequestTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-1", "_request-1"), ""); err != nil {
+		t.Fatalf("ConsumeResponse: %v", err)
+	}
+
+	// Другое утверждение на тот же запрос не принимается: запрос уже израсходован
+	_, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-2", "_request-1"), "")
+	if !errors.Is(err, domain.ErrUnknownRequest) {
+		t.Fatalf("error = %v, want %v", err, domain.ErrUnknownRequest)
+	}
+}
+
+func TestConsumeResponseRejectsUnsolicited(t *testing.T) {
+	s := newSamlTest(t, false)
+
+	_, err := s.service.ConsumeResponse(context.Background(), "corp", s.response(t, "_assertion-1", ""), "")
+	if !errors.Is(err, domain.ErrUnsolicited) {
+		t.Fatalf("error = %v, want %v", err, domain.ErrUnsolicited)
+	}
+}
+
+func TestConsumeResponseRejectsReplay(t *testing.T) {
+	s := newSamlTest(t, true)
+	response := s.response(t, "_assertion-1", "")
+
+	if _, err := s.service.ConsumeResponse(context.Background(), "corp", response, ""); err != nil {
+		t.Fatalf("ConsumeResponse: %v", err)
+	}
+	_, err := s.service.ConsumeResponse(context.Background(), "corp", response, "")
+	if !errors.Is(err, domain.ErrReplay) {
+		t.Fatalf("replayed response: error = %v, want %v", err, domain.ErrReplay)
+	}
+	if len(s.events.reasons) != 1 || s.events.reasons[0] != "replay" {
+		t.Fatalf("recorded %v, want [replay]", s.events.reasons)
+	}
+}
@@ -0,0 +1,316 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/saml/domain"
+	"github.com/rafaceo/go-test-auth/saml/service"
+	"github.com/rafaceo/go-test-auth/saml/transport"
+	"net/http"
+)
+
+// maxACSBody — ограничение формы с ответом IdP
+const maxACSBody = 2 << 20
+
+// GetSamlHandlers: изменения провайдеров попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetSamlHandlers(serv service.SamlService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	authenticated := authn.Middleware(tokens)
+
+	createHandler := kithttp.NewServer(
+		authenticated(MakeCreateProviderEndpoint(serv)),
+		DecodeProviderRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listHandler := kithttp.NewServer(
+		MakeListProvidersEndpoint(serv),
+		DecodeListProvidersRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetProviderEndpoint(serv),
+		DecodeProviderIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	updateHandler := kithttp.NewServer(
+		authenticated(MakeUpdateProviderEndpoint(serv)),
+		DecodeProviderRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteHandler := kithttp.NewServer(
+		authenticated(MakeDeleteProviderEndpoint(serv)),
+		DecodeProviderIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	metadataHandler := kithttp.NewServer(
+		MakeMetadataEndpoint(serv),
+		DecodeMetadataRequest,
+		EncodeMetadataResponse,
+		opts...,
+	)
+
+	startLoginHandler := kithttp.NewServer(
+		MakeStartLoginEndpoint(serv),
+		DecodeStartLoginRequest,
+		EncodeStartLoginResponse,
+		opts...,
+	)
+
+	acsHandler := kithttp.NewServer(
+		MakeACSEndpoint(serv),
+		DecodeACSRequest,
+		EncodeLoginResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    domain.BasePath + "/providers",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    domain.BasePath + "/providers",
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/providers/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/providers/{id}",
+			Handler: updateHandler,
+			Methods: []string{"PUT"},
+		},
+		{
+			Path:    domain.BasePath + "/providers/{id}",
+			Handler: deleteHandler,
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    domain.BasePath + "/metadata/{provider}",
+			Handler: metadataHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/login/{provider}",
+			Handler: startLoginHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/acs/{provider}",
+			Handler: acsHandler,
+			Methods: []string{"POST"},
+		},
+	}
+}
+
+func MakeCreateProviderEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderRequest)
+		provider, err := svc.CreateProvider(ctx, req.Provider)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeListProvidersEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		providers, err := svc.ListProviders(ctx)
+		if err != nil {
+			return transport.ListProvidersResponse{Error: err.Error()}, nil
+		}
+		return transport.ListProvidersResponse{Providers: providers}, nil
+	}
+}
+
+func MakeGetProviderEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderIDRequest)
+		provider, err := svc.GetProvider(ctx, req.ID)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeUpdateProviderEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderRequest)
+		provider, err := svc.UpdateProvider(ctx, req.ID, req.Provider)
+		if err != nil {
+			return transport.ProviderResponse{Error: err.Error()}, nil
+		}
+		return transport.ProviderResponse{Provider: provider}, nil
+	}
+}
+
+func MakeDeleteProviderEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ProviderIDRequest)
+		if err := svc.DeleteProvider(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Провайдер удалён"}, nil
+	}
+}
+
+func MakeMetadataEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.MetadataRequest)
+		metadata, err := svc.Metadata(ctx, req.ProviderID)
+		if err != nil {
+			return transport.MetadataResponse{Error: err.Error()}, nil
+		}
+		return transport.MetadataResponse{Metadata: metadata}, nil
+	}
+}
+
+func MakeStartLoginEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.StartLoginRequest)
+		redirectURL, err := svc.StartLogin(ctx, req.ProviderID, req.RelayState)
+		if err != nil {
+			return transport.StartLoginResponse{Error: err.Error()}, nil
+		}
+		return transport.StartLoginResponse{RedirectURL: redirectURL, Redirect: req.Redirect}, nil
+	}
+}
+
+func MakeACSEndpoint(svc service.SamlService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ACSRequest)
+		result, err := svc.ConsumeResponse(ctx, req.ProviderID, req.SAMLResponse, req.RelayState)
+		if err != nil {
+			return transport.LoginResponse{Error: err.Error()}, nil
+		}
+		return transport.LoginResponse{LoginResult: result}, nil
+	}
+}
+
+// DecodeProviderRequest читает настройки провайдера; id при изменении берётся из пути
+func DecodeProviderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.ProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req.Provider); err != nil {
+		return nil, err
+	}
+	req.ID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func DecodeListProvidersRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return transport.ListProvidersRequest{}, nil
+}
+
+func DecodeProviderIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.ProviderIDRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func DecodeMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.MetadataRequest{ProviderID: mux.Vars(r)["provider"]}, nil
+}
+
+func DecodeStartLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	return transport.StartLoginRequest{
+		ProviderID: mux.Vars(r)["provider"],
+		RelayState: query.Get("relay_state"),
+		Redirect:   query.Get("redirect") != "false",
+	}, nil
+}
+
+// DecodeACSRequest читает форму HTTP-POST binding: SAMLResponse и RelayState
+func DecodeACSRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxACSBody)
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return transport.ACSRequest{
+		ProviderID:   mux.Vars(r)["provider"],
+		SAMLResponse: r.PostForm.Get("SAMLResponse"),
+		RelayState:   r.PostForm.Get("RelayState"),
+	}, nil
+}
+
+// EncodeMetadataResponse отдаёт метаданные SP как XML, чтобы их можно было загрузить в IdP по ссылке
+func EncodeMetadataResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.MetadataResponse)
+	if resp.Error != "" {
+		status := http.StatusBadRequest
+		if resp.Error == domain.ErrProviderNotFound.Error() {
+			status = http.StatusNotFound
+		}
+		return encodeJSON(w, status, resp)
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(resp.Metadata)
+	return err
+}
+
+// EncodeStartLoginResponse перенаправляет браузер на страницу входа IdP
+func EncodeStartLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.StartLoginResponse)
+	if resp.Error != "" {
+		return encodeJSON(w, http.StatusBadRequest, resp)
+	}
+	if !resp.Redirect {
+		return EncodeResponse(ctx, w, resp)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", resp.RedirectURL)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// EncodeLoginResponse: неудачный вход — 401, как и вход по паролю
+func EncodeLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.LoginResponse)
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Error != "" {
+		return encodeJSON(w, http.StatusUnauthorized, resp)
+	}
+	return EncodeResponse(ctx, w, resp)
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	return encodeJSON(w, http.StatusOK, response)
+}
+
+func encodeJSON(w http.ResponseWriter, status int, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
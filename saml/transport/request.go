@@ -0,0 +1,32 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/saml/domain"
+
+type ProviderRequest struct {
+	ID       string `json:"-"`
+	Provider domain.Provider
+}
+
+type ProviderIDRequest struct {
+	ID string `json:"-"`
+}
+
+type ListProvidersRequest struct{}
+
+type MetadataRequest struct {
+	ProviderID string
+}
+
+// StartLoginRequest — Redirect = false возвращает адрес IdP в JSON вместо перенаправления
+type StartLoginRequest struct {
+	ProviderID string
+	RelayState string
+	Redirect   bool
+}
+
+// ACSRequest — ответ IdP, отправленный браузером формой (HTTP-POST binding)
+type ACSRequest struct {
+	ProviderID   string
+	SAMLResponse string
+	RelayState   string
+}
@@ -0,0 +1,34 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/saml/domain"
+
+type ProviderResponse struct {
+	Provider *domain.Provider `json:"provider,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type ListProvidersResponse struct {
+	Providers []domain.Provider `json:"providers"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type MetadataResponse struct {
+	Metadata []byte `json:"-"`
+	Error    string `json:"error,omitempty"`
+}
+
+type StartLoginResponse struct {
+	RedirectURL string `json:"redirect_url,omitempty"`
+	Redirect    bool   `json:"-"`
+	Error       string `json:"error,omitempty"`
+}
+
+type LoginResponse struct {
+	*domain.LoginResult
+	Error string `json:"error,omitempty"`
+}
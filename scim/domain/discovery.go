@@ -0,0 +1,47 @@
+package domain
+
+// ServiceProviderConfig описывает возможности сервера для IdP (RFC 7643, раздел 5)
+func ServiceProviderConfig(baseURL string) map[string]interface{} {
+	unsupported := map[string]bool{"supported": false}
+	return map[string]interface{}{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": "",
+		"patch":            map[string]bool{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": MaxCount},
+		"changePassword":   map[string]bool{"supported": true},
+		"sort":             unsupported,
+		"etag":             map[string]bool{"supported": true},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Per-merchant SCIM token issued via /api/v4/scim/tokens",
+			"primary":     true,
+		}},
+		"meta": map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     baseURL + BasePath + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// ResourceTypes — поддерживаемые типы ресурсов: пользователи и группы
+func ResourceTypes(baseURL string) []map[string]interface{} {
+	resourceType := func(name, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{SchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": map[string]string{
+				"resourceType": "ResourceType",
+				"location":     baseURL + BasePath + "/ResourceTypes/" + name,
+			},
+		}
+	}
+	return []map[string]interface{}{
+		resourceType(ResourceUser, "/Users", SchemaUser),
+		resourceType(ResourceGroup, "/Groups", SchemaGroup),
+	}
+}
@@ -0,0 +1,255 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Операторы сравнения фильтра SCIM (RFC 7644, 3.4.2.2)
+const (
+	OpEq = "eq"
+	OpNe = "ne"
+	OpCo = "co"
+	OpSw = "sw"
+	OpEw = "ew"
+	OpGt = "gt"
+	OpGe = "ge"
+	OpLt = "lt"
+	OpLe = "le"
+	OpPr = "pr"
+)
+
+// Expr — узел разобранного фильтра: *AttrExpr, *LogicalExpr или *NotExpr
+type Expr interface {
+	expr()
+}
+
+// AttrExpr — сравнение атрибута. Path — путь в нижнем регистре без URN схемы,
+// Value — string, bool, float64 или nil; для pr значения нет.
+type AttrExpr struct {
+	Path  string
+	Op    string
+	Value interface{}
+}
+
+// LogicalExpr — and или or
+type LogicalExpr struct {
+	Op          string
+	Left, Right Expr
+}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+func (*AttrExpr) expr()    {}
+func (*LogicalExpr) expr() {}
+func (*NotExpr) expr()     {}
+
+var compareOps = map[string]bool{OpEq: true, OpNe: true, OpCo: true, OpSw: true, OpEw: true, OpGt: true, OpGe: true, OpLt: true, OpLe: true}
+
+// ParseFilter разбирает фильтр; пустой фильтр даёт nil. Фильтры по значению
+// многозначного атрибута (emails[type eq "work"]) не поддерживаются.
+func ParseFilter(filter string) (Expr, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, invalidFilter("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, ScimTypeInvalidFilter, "invalid filter: "+format, args...)
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(filter string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '[' || r == ']':
+			return nil, invalidFilter("value path filters are not supported")
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:j+1])), &value); err != nil {
+				return nil, invalidFilter("invalid string %s", string(runes[i:j+1]))
+			}
+			tokens = append(tokens, filterToken{text: value, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word)
+}
+
+func (p *filterParser) next() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, true
+}
+
+func (p *filterParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpr{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpr{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Expr, error) {
+	if p.peekWord("not") {
+		p.pos++
+		if !p.peekWord("(") {
+			return nil, invalidFilter("not must be followed by (")
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: inner}, nil
+	}
+
+	if p.peekWord("(") {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekWord(")") {
+			return nil, invalidFilter("missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	return p.parseAttr()
+}
+
+func (p *filterParser) parseAttr() (Expr, error) {
+	attr, ok := p.next()
+	if !ok || attr.quoted {
+		return nil, invalidFilter("attribute expected")
+	}
+	op, ok := p.next()
+	if !ok || op.quoted {
+		return nil, invalidFilter("operator expected after %q", attr.text)
+	}
+
+	path := AttributePath(attr.text)
+	operator := strings.ToLower(op.text)
+	if operator == OpPr {
+		return &AttrExpr{Path: path, Op: OpPr}, nil
+	}
+	if !compareOps[operator] {
+		return nil, invalidFilter("unknown operator %q", op.text)
+	}
+
+	value, ok := p.next()
+	if !ok {
+		return nil, invalidFilter("value expected after %q", op.text)
+	}
+	expr := &AttrExpr{Path: path, Op: operator, Value: value.text}
+	if !value.quoted {
+		switch lower := strings.ToLower(value.text); {
+		case lower == "true" || lower == "false":
+			expr.Value = lower == "true"
+		case lower == "null":
+			expr.Value = nil
+		default:
+			number, err := strconv.ParseFloat(value.text, 64)
+			if err != nil {
+				return nil, invalidFilter("invalid value %q", value.text)
+			}
+			expr.Value = number
+		}
+	}
+	return expr, nil
+}
+
+// AttributePath приводит путь атрибута к нижнему регистру и убирает URN схемы ресурса
+func AttributePath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(path, prefix) {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
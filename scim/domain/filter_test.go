@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	cases := []struct {
+		filter string
+		want   Expr
+	}{
+		{"", nil},
+		{`userName eq "bjensen"`, &AttrExpr{Path: "username", Op: OpEq, Value: "bjensen"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName EQ "BJensen"`, &AttrExpr{Path: "username", Op: OpEq, Value: "BJensen"}},
+		{`name.familyName co "O\"Malley"`, &AttrExpr{Path: "name.familyname", Op: OpCo, Value: `O"Malley`}},
+		{`active eq True`, &AttrExpr{Path: "active", Op: OpEq, Value: true}},
+		{`externalId eq null`, &AttrExpr{Path: "externalid", Op: OpEq, Value: nil}},
+		{`meta.version gt 2`, &AttrExpr{Path: "meta.version", Op: OpGt, Value: float64(2)}},
+		{`title pr`, &AttrExpr{Path: "title", Op: OpPr}},
+		{
+			`userName sw "a" and active eq true or emails pr`,
+			&LogicalExpr{Op: "or",
+				Left: &LogicalExpr{Op: "and",
+					Left:  &AttrExpr{Path: "username", Op: OpSw, Value: "a"},
+					Right: &AttrExpr{Path: "active", Op: OpEq, Value: true},
+				},
+				Right: &AttrExpr{Path: "emails", Op: OpPr},
+			},
+		},
+		{
+			`userName eq "a" and (active eq false or not (emails pr))`,
+			&LogicalExpr{Op: "and",
+				Left: &AttrExpr{Path: "username", Op: OpEq, Value: "a"},
+				Right: &LogicalExpr{Op: "or",
+					Left:  &AttrExpr{Path: "active", Op: OpEq, Value: false},
+					Right: &NotExpr{Expr: &AttrExpr{Path: "emails", Op: OpPr}},
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := ParseFilter(c.filter)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.filter, got, c.want)
+		}
+	}
+}
+
+func TestParseFilterRejectsInvalidSyntax(t *testing.T) {
+	cases := []string{
+		`userName`,
+		`userName eq`,
+		`userName like "a"`,
+		`userName eq bjensen`,
+		`userName eq "unterminated`,
+		`"userName" eq "a"`,
+		`(userName eq "a"`,
+		`userName eq "a")`,
+		`not userName eq "a"`,
+		`userName eq "a" and`,
+		`userName eq "a" extra`,
+		`emails[type eq "work"]`,
+	}
+	for _, filter := range cases {
+		_, err := ParseFilter(filter)
+		var scimErr *Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != ScimTypeInvalidFilter {
+			t.Errorf("%s: error = %v, want %s", filter, err, ScimTypeInvalidFilter)
+		}
+	}
+}
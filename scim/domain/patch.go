@@ -0,0 +1,357 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PatchAdd     = "add"
+	PatchReplace = "replace"
+	PatchRemove  = "remove"
+)
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchPath разбирает путь PATCH: атрибут, необязательный фильтр в скобках и податрибут,
+// например emails[type eq "work"].value
+var patchPath = regexp.MustCompile(`^([A-Za-z][\w$-]*)(\[(.*)\])?(\.([A-Za-z][\w$-]*))?$`)
+
+func invalidPath(path string) *Error {
+	return NewError(http.StatusBadRequest, ScimTypeInvalidPath, "unsupported path %q", path)
+}
+
+func invalidValue(format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, ScimTypeInvalidValue, format, args...)
+}
+
+func (r PatchRequest) validate() error {
+	if len(r.Operations) == 0 {
+		return invalidValue("Operations must not be empty")
+	}
+	for _, op := range r.Operations {
+		switch strings.ToLower(op.Op) {
+		case PatchAdd, PatchReplace, PatchRemove:
+		default:
+			return invalidValue("unknown op %q", op.Op)
+		}
+	}
+	return nil
+}
+
+// ApplyToUser применяет операции к записи пользователя. Возвращает новый пароль, если он задан.
+// У пользователя одно значение email и телефона, поэтому фильтр в пути emails[...] не сужает выбор.
+func (r PatchRequest) ApplyToUser(record *UserRecord) (string, error) {
+	if err := r.validate(); err != nil {
+		return "", err
+	}
+
+	var password string
+	for _, op := range r.Operations {
+		operation := strings.ToLower(op.Op)
+		if op.Path == "" {
+			if operation == PatchRemove {
+				return "", NewError(http.StatusBadRequest, ScimTypeNoTarget, "remove requires a path")
+			}
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return "", invalidValue("value must be an object when path is omitted")
+			}
+			for path, value := range values {
+				if err := applyUserPath(record, operation, path, value, &password); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+		if err := applyUserPath(record, operation, op.Path, op.Value, &password); err != nil {
+			return "", err
+		}
+	}
+	return password, nil
+}
+
+func applyUserPath(record *UserRecord, op, path string, value json.RawMessage, password *string) error {
+	match := patchPath.FindStringSubmatch(AttributePath(path))
+	if match == nil {
+		return invalidPath(path)
+	}
+	attr, sub := match[1], match[5]
+	remove := op == PatchRemove
+
+	var text string
+	decodeText := func() error {
+		if remove {
+			return nil
+		}
+		if err := json.Unmarshal(value, &text); err != nil {
+			return invalidValue("%s must be a string", path)
+		}
+		text = strings.TrimSpace(text)
+		return nil
+	}
+
+	switch {
+	case attr == "active" && sub == "":
+		if remove {
+			return NewError(http.StatusBadRequest, ScimTypeMutability, "active cannot be removed")
+		}
+		active, err := decodeBool(value)
+		if err != nil {
+			return invalidValue("active must be a boolean")
+		}
+		record.Active = active
+	case attr == "username" && sub == "":
+		if remove {
+			return NewError(http.StatusBadRequest, ScimTypeMutability, "userName is required")
+		}
+		if err := decodeText(); err != nil {
+			return err
+		}
+		record.UserName = text
+	case attr == "externalid" && sub == "":
+		if err := decodeText(); err != nil {
+			return err
+		}
+		record.ExternalID = text
+	case attr == "password" && sub == "":
+		if remove {
+			return NewError(http.StatusBadRequest, ScimTypeMutability, "password cannot be removed")
+		}
+		if err := decodeText(); err != nil {
+			return err
+		}
+		*password = text
+	case attr == "name" && sub == "":
+		record.FirstName, record.LastName = "", ""
+		if remove {
+			return nil
+		}
+		var name Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return invalidValue("name must be an object")
+		}
+		User{Name: &name}.applyName(record)
+	case attr == "name":
+		if err := decodeText(); err != nil {
+			return err
+		}
+		switch sub {
+		case "givenname":
+			record.FirstName = text
+		case "familyname":
+			record.LastName = text
+		case "formatted":
+			if record.FirstName == "" && record.LastName == "" {
+				User{Name: &Name{Formatted: text}}.applyName(record)
+			}
+		default:
+			return invalidPath(path)
+		}
+	case attr == "emails" || attr == "phonenumbers":
+		target := &record.Email
+		if attr == "phonenumbers" {
+			target = &record.Phone
+		}
+		switch {
+		case remove:
+			*target = ""
+		case sub == "value":
+			if err := decodeText(); err != nil {
+				return err
+			}
+			*target = text
+		case sub == "":
+			var values []MultiValue
+			if err := json.Unmarshal(value, &values); err != nil {
+				return invalidValue("%s must be a list of values", path)
+			}
+			*target = primaryValue(values)
+		default:
+			// type и primary не хранятся
+		}
+	default:
+		return invalidPath(path)
+	}
+	return nil
+}
+
+// decodeBool принимает и строки "True"/"False": их присылают некоторые IdP
+func decodeBool(value json.RawMessage) (bool, error) {
+	var flag bool
+	if err := json.Unmarshal(value, &flag); err == nil {
+		return flag, nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return false, err
+	}
+	switch strings.ToLower(text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, invalidValue("invalid boolean %q", text)
+}
+
+// memberFilter — единственный поддерживаемый фильтр участников: members[value eq "id"]
+var memberFilter = regexp.MustCompile(`(?i)^\s*value\s+eq\s+"([^"]*)"\s*$`)
+
+// ApplyToGroup вычисляет, кого добавить в группу и кого из неё убрать. displayName менять нельзя:
+// группа — это роль каталога; совпадающее имя допускается, потому что IdP присылают его вместе с участниками.
+func (r PatchRequest) ApplyToGroup(group GroupRecord) (add, remove []uuid.UUID, err error) {
+	if err := r.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	members := make(map[uuid.UUID]bool, len(group.Members))
+	for _, member := range group.Members {
+		members[member.UserID] = true
+	}
+	target := make(map[uuid.UUID]bool, len(members))
+	for id := range members {
+		target[id] = true
+	}
+
+	for _, op := range r.Operations {
+		operation := strings.ToLower(op.Op)
+		ops := map[string]json.RawMessage{op.Path: op.Value}
+		if op.Path == "" {
+			if operation == PatchRemove {
+				return nil, nil, NewError(http.StatusBadRequest, ScimTypeNoTarget, "remove requires a path")
+			}
+			ops = nil
+			if err := json.Unmarshal(op.Value, &ops); err != nil {
+				return nil, nil, invalidValue("value must be an object when path is omitted")
+			}
+		}
+
+		for path, value := range ops {
+			if err := applyGroupPath(group, target, operation, path, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	for id := range target {
+		if !members[id] {
+			add = append(add, id)
+		}
+	}
+	for id := range members {
+		if !target[id] {
+			remove = append(remove, id)
+		}
+	}
+	return add, remove, nil
+}
+
+func applyGroupPath(group GroupRecord, target map[uuid.UUID]bool, op, path string, value json.RawMessage) error {
+	match := patchPath.FindStringSubmatch(AttributePath(path))
+	if match == nil {
+		return invalidPath(path)
+	}
+	attr, filter, sub := match[1], match[3], match[5]
+
+	switch {
+	case attr == "displayname" && sub == "" && filter == "":
+		var name string
+		if op == PatchRemove || json.Unmarshal(value, &name) != nil || name != group.Name {
+			return NewError(http.StatusBadRequest, ScimTypeMutability, "displayName is the role name and cannot be changed via SCIM")
+		}
+	case attr == "id" && sub == "" && filter == "":
+		// Okta присылает id вместе с displayName; id неизменяем
+	case attr == "members" && sub == "" && filter != "":
+		if op != PatchRemove {
+			return invalidPath(path)
+		}
+		found := memberFilter.FindStringSubmatch(filter)
+		if found == nil {
+			return invalidPath(path)
+		}
+		id, err := uuid.Parse(found[1])
+		if err != nil {
+			return NewError(http.StatusBadRequest, ScimTypeNoTarget, "member %q not found", found[1])
+		}
+		delete(target, id)
+	case attr == "members" && sub == "":
+		ids, err := decodeMembers(value, op == PatchRemove)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case PatchReplace:
+			for id := range target {
+				delete(target, id)
+			}
+			fallthrough
+		case PatchAdd:
+			for _, id := range ids {
+				target[id] = true
+			}
+		case PatchRemove:
+			if len(value) == 0 {
+				// remove без значения очищает группу
+				for id := range target {
+					delete(target, id)
+				}
+			}
+			for _, id := range ids {
+				delete(target, id)
+			}
+		}
+	default:
+		return invalidPath(path)
+	}
+	return nil
+}
+
+// ReplaceGroupMembers — состав группы при PUT
+func ReplaceGroupMembers(group GroupRecord, replacement Group) (add, remove []uuid.UUID, err error) {
+	if replacement.DisplayName != "" && replacement.DisplayName != group.Name {
+		return nil, nil, NewError(http.StatusBadRequest, ScimTypeMutability, "displayName is the role name and cannot be changed via SCIM")
+	}
+	value, err := json.Marshal(replacement.Members)
+	if err != nil {
+		return nil, nil, err
+	}
+	if replacement.Members == nil {
+		value = []byte("[]")
+	}
+	patch := PatchRequest{Operations: []PatchOperation{{Op: PatchReplace, Path: "members", Value: value}}}
+	return patch.ApplyToGroup(group)
+}
+
+func decodeMembers(value json.RawMessage, optional bool) ([]uuid.UUID, error) {
+	if len(value) == 0 && optional {
+		return nil, nil
+	}
+	var refs []Ref
+	if err := json.Unmarshal(value, &refs); err != nil {
+		return nil, invalidValue("members must be a list of {\"value\": id}")
+	}
+
+	ids := make([]uuid.UUID, 0, len(refs))
+	for _, ref := range refs {
+		id, err := uuid.Parse(ref.Value)
+		if err != nil {
+			return nil, invalidValue("member %q is not a user id", ref.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
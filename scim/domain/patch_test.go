@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func patch(ops ...PatchOperation) PatchRequest {
+	return PatchRequest{Schemas: []string{SchemaPatchOp}, Operations: ops}
+}
+
+func op(operation, path, value string) PatchOperation {
+	o := PatchOperation{Op: operation, Path: path}
+	if value != "" {
+		o.Value = json.RawMessage(value)
+	}
+	return o
+}
+
+func wantScimType(t *testing.T, name string, err error, scimType string) {
+	t.Helper()
+	var scimErr *Error
+	if !errors.As(err, &scimErr) || scimErr.ScimType != scimType {
+		t.Errorf("%s: error = %v, want %s", name, err, scimType)
+	}
+}
+
+func TestApplyToUser(t *testing.T) {
+	record := UserRecord{UserName: "old", Active: true, Email: "old@example.com", FirstName: "Old"}
+	password, err := patch(
+		op("Replace", "active", `"False"`),
+		op("replace", "userName", `" bjensen "`),
+		op("replace", "name.givenName", `"Barbara"`),
+		op("replace", `emails[type eq "work"].value`, `"bjensen@example.com"`),
+		op("add", "", `{"externalId": "ext-1", "password": "secret"}`),
+		op("remove", "phoneNumbers", ""),
+	).ApplyToUser(&record)
+	if err != nil {
+		t.Fatalf("ApplyToUser: %v", err)
+	}
+	want := UserRecord{UserName: "bjensen", Active: false, Email: "bjensen@example.com", FirstName: "Barbara", ExternalID: "ext-1"}
+	if record.UserName != want.UserName || record.Active != want.Active || record.Email != want.Email ||
+		record.FirstName != want.FirstName || record.ExternalID != want.ExternalID || record.Phone != "" {
+		t.Fatalf("got %+v, want %+v", record, want)
+	}
+	if password != "secret" {
+		t.Fatalf("password = %q, want %q", password, "secret")
+	}
+}
+
+func TestApplyToUserRejectsInvalidOperations(t *testing.T) {
+	cases := []struct {
+		name     string
+		request  PatchRequest
+		scimType string
+	}{
+		{"no operations", patch(), ScimTypeInvalidValue},
+		{"unknown op", patch(op("move", "userName", `"a"`)), ScimTypeInvalidValue},
+		{"remove without path", patch(op("remove", "", "")), ScimTypeNoTarget},
+		{"value is not an object", patch(op("replace", "", `"a"`)), ScimTypeInvalidValue},
+		{"unsupported attribute", patch(op("replace", "title", `"Boss"`)), ScimTypeInvalidPath},
+		{"unsupported sub-attribute", patch(op("replace", "name.middleName", `"J"`)), ScimTypeInvalidPath},
+		{"malformed path", patch(op("replace", "emails[type eq", `"a"`)), ScimTypeInvalidPath},
+		{"remove required userName", patch(op("remove", "userName", "")), ScimTypeMutability},
+		{"remove active", patch(op("remove", "active", "")), ScimTypeMutability},
+		{"active is not a boolean", patch(op("replace", "active", `"yes"`)), ScimTypeInvalidValue},
+		{"userName is not a string", patch(op("replace", "userName", `42`)), ScimTypeInvalidValue},
+	}
+	for _, c := range cases {
+		record := UserRecord{UserName: "bjensen", Active: true}
+		_, err := c.request.ApplyToUser(&record)
+		wantScimType(t, c.name, err, c.scimType)
+	}
+}
+
+func sortedIDs(ids []uuid.UUID) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, id.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestApplyToGroup(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	group := GroupRecord{Name: "cashiers", Members: []MemberRef{{UserID: alice}, {UserID: bob}}}
+
+	cases := []struct {
+		name         string
+		request      PatchRequest
+		add, removed []uuid.UUID
+	}{
+		{"add member", patch(op("add", "members", `[{"value":"`+carol.String()+`"}]`)), []uuid.UUID{carol}, nil},
+		{"remove by filter", patch(op("remove", `members[value eq "`+bob.String()+`"]`, "")), nil, []uuid.UUID{bob}},
+		{"remove by value", patch(op("remove", "members", `[{"value":"`+alice.String()+`"}]`)), nil, []uuid.UUID{alice}},
+		{"remove all", patch(op("remove", "members", "")), nil, []uuid.UUID{alice, bob}},
+		{"replace", patch(op("replace", "members", `[{"value":"`+bob.String()+`"},{"value":"`+carol.String()+`"}]`)), []uuid.UUID{carol}, []uuid.UUID{alice}},
+		{"same displayName with id", patch(op("replace", "", `{"id":"1","displayName":"cashiers"}`)), nil, nil},
+	}
+	for _, c := range cases {
+		add, remove, err := c.request.ApplyToGroup(group)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if got, want := sortedIDs(add), sortedIDs(c.add); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: add = %v, want %v", c.name, got, want)
+		}
+		if got, want := sortedIDs(remove), sortedIDs(c.removed); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: remove = %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+func TestApplyToGroupRejectsInvalidOperations(t *testing.T) {
+	group := GroupRecord{Name: "cashiers"}
+	cases := []struct {
+		name     string
+		request  PatchRequest
+		scimType string
+	}{
+		{"unknown op", patch(op("merge", "members", `[]`)), ScimTypeInvalidValue},
+		{"remove without path", patch(op("remove", "", "")), ScimTypeNoTarget},
+		{"rename", patch(op("replace", "displayName", `"admins"`)), ScimTypeMutability},
+		{"remove displayName", patch(op("remove", "displayName", "")), ScimTypeMutability},
+		{"unsupported attribute", patch(op("replace", "externalId", `"x"`)), ScimTypeInvalidPath},
+		{"add with filter", patch(op("add", `members[value eq "x"]`, `[]`)), ScimTypeInvalidPath},
+		{"unsupported member filter", patch(op("remove", `members[display eq "x"]`, "")), ScimTypeInvalidPath},
+		{"member filter is not an id", patch(op("remove", `members[value eq "x"]`, "")), ScimTypeNoTarget},
+		{"members is not a list", patch(op("add", "members", `{"value":"x"}`)), ScimTypeInvalidValue},
+		{"member is not a user id", patch(op("add", "members", `[{"value":"x"}]`)), ScimTypeInvalidValue},
+	}
+	for _, c := range cases {
+		_, _, err := c.request.ApplyToGroup(group)
+		wantScimType(t, c.name, err, c.scimType)
+	}
+}
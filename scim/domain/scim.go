@@ -0,0 +1,402 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	userDomain "github.com/rafaceo/go-test-auth/user/domain"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	ResourceUser  = "User"
+	ResourceGroup = "Group"
+
+	// BasePath — префикс маршрутов SCIM; location ресурсов строится от него
+	BasePath = "/scim/v2"
+
+	// ManageEntitlement — право на выпуск, просмотр и отзыв токенов SCIM
+	ManageEntitlement = "scim:manage"
+
+	DefaultCount = 100
+	MaxCount     = 500
+
+	tokenPrefix = "scim_"
+
+	maxNameLength = 64
+)
+
+// Значения scimType ошибок из RFC 7644, 3.12
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeInvalidValue  = "invalidValue"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeMutability    = "mutability"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+)
+
+// Error — ошибка SCIM: HTTP-статус и scimType попадают в ответ в формате RFC 7644
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func NewError(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+var (
+	ErrUnauthorized       = &Error{Status: http.StatusUnauthorized, Detail: "invalid or revoked SCIM token"}
+	ErrUserNotFound       = &Error{Status: http.StatusNotFound, Detail: "user not found"}
+	ErrGroupNotFound      = &Error{Status: http.StatusNotFound, Detail: "group not found"}
+	ErrPreconditionFailed = &Error{Status: http.StatusPreconditionFailed, Detail: "resource version does not match If-Match"}
+	ErrConflict           = &Error{Status: http.StatusConflict, Detail: "resource was modified concurrently, retry the request"}
+	ErrUserNameTaken      = &Error{Status: http.StatusConflict, ScimType: ScimTypeUniqueness, Detail: "userName is already taken"}
+	ErrPhoneTaken         = &Error{Status: http.StatusConflict, ScimType: ScimTypeUniqueness, Detail: "user with this phone or email already exists"}
+	ErrGroupsReadOnly     = &Error{Status: http.StatusForbidden, ScimType: ScimTypeMutability, Detail: "groups are roles managed in the roles catalog and cannot be created or deleted via SCIM"}
+
+	ErrTokenNotFound   = errors.New("scim token not found")
+	ErrMerchantMissing = errors.New("merchant_id is required")
+)
+
+// Token — токен IdP мерчанта; сам токен показывается один раз при создании
+type Token struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	MerchantID  string     `json:"merchant_id" db:"merchant_id"`
+	Description string     `json:"description,omitempty" db:"description"`
+	CreatedBy   string     `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// NewToken возвращает токен и его хеш для хранения
+func NewToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+	Version      string    `json:"version,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue — элемент emails или phoneNumbers
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Ref — ссылка на связанный ресурс: группа пользователя или участник группы
+type Ref struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User — ресурс SCIM User. У пользователя один телефон и один email, поэтому из списков
+// берётся основное значение, а при его отсутствии — первое.
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         *Name        `json:"name,omitempty"`
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool        `json:"active,omitempty"`
+	Password     string       `json:"password,omitempty"`
+	Groups       []Ref        `json:"groups,omitempty"`
+	Meta         *Meta        `json:"meta,omitempty"`
+}
+
+// Group — ресурс SCIM Group: роль из каталога ролей и её участники у мерчанта токена
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Ref    `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// ListQuery — параметры запроса списка: filter, startIndex (с 1), count (по умолчанию DefaultCount)
+// и excludedAttributes
+type ListQuery struct {
+	Filter             string
+	StartIndex         int
+	Count              int
+	ExcludedAttributes []string
+}
+
+// Normalize приводит startIndex и count к допустимым значениям по RFC 7644, 3.4.2.4:
+// startIndex меньше 1 считается 1, отрицательный count — 0 (только totalResults)
+func (q *ListQuery) Normalize() {
+	if q.StartIndex < 1 {
+		q.StartIndex = 1
+	}
+	if q.Count < 0 {
+		q.Count = 0
+	}
+	if q.Count > MaxCount {
+		q.Count = MaxCount
+	}
+}
+
+func (q ListQuery) Excludes(attribute string) bool {
+	for _, excluded := range q.ExcludedAttributes {
+		if strings.EqualFold(excluded, attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserRecord — пользователь SCIM в хранилище
+type UserRecord struct {
+	UserID     uuid.UUID
+	UserName   string
+	ExternalID string
+	Active     bool
+	Version    int
+	Phone      string
+	Email      string
+	FirstName  string
+	LastName   string
+	Groups     []GroupRef
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type GroupRef struct {
+	RoleID int
+	Name   string
+}
+
+// GroupRecord — роль и её участники у мерчанта. RoleVersion меняется при правке роли,
+// Version — при изменении состава участников.
+type GroupRecord struct {
+	RoleID      int
+	Name        string
+	RoleVersion int
+	Version     int
+	Members     []MemberRef
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type MemberRef struct {
+	UserID   uuid.UUID
+	UserName string
+}
+
+// Validate проверяет пользователя по тем же правилам, что и создание через API. Телефон обязателен:
+// по нему пользователь входит в систему.
+func (r UserRecord) Validate() error {
+	if r.UserName == "" {
+		return NewError(http.StatusBadRequest, ScimTypeInvalidValue, "userName is required")
+	}
+	if r.Phone == "" {
+		return NewError(http.StatusBadRequest, ScimTypeInvalidValue, "phoneNumbers is required: users sign in by phone")
+	}
+	if err := userDomain.ValidatePhone(r.Phone); err != nil {
+		return NewError(http.StatusBadRequest, ScimTypeInvalidValue, "%s", err.Error())
+	}
+	if r.Email != "" {
+		if err := userDomain.ValidateEmail(r.Email); err != nil {
+			return NewError(http.StatusBadRequest, ScimTypeInvalidValue, "%s", err.Error())
+		}
+	}
+	if utf8.RuneCountInString(r.FirstName) > maxNameLength || utf8.RuneCountInString(r.LastName) > maxNameLength {
+		return NewError(http.StatusBadRequest, ScimTypeInvalidValue, "name parts must be at most %d characters", maxNameLength)
+	}
+	return nil
+}
+
+// MatchETag проверяет заголовок If-Match или If-None-Match: список ETag через запятую или «*».
+// Сравнение слабое, как требует RFC 7232 для If-None-Match.
+func MatchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ETag пользователя
+func (r UserRecord) ETag() string {
+	return `W/"` + strconv.Itoa(r.Version) + `"`
+}
+
+// ETag группы учитывает и правку роли, и изменение состава
+func (r GroupRecord) ETag() string {
+	return `W/"` + strconv.Itoa(r.RoleVersion) + "-" + strconv.Itoa(r.Version) + `"`
+}
+
+// ToResource собирает ресурс SCIM; baseURL — схема и хост, на которых обслуживается BasePath
+func (r UserRecord) ToResource(baseURL string) *User {
+	active := r.Active
+	user := &User{
+		Schemas:    []string{SchemaUser},
+		ID:         r.UserID.String(),
+		ExternalID: r.ExternalID,
+		UserName:   r.UserName,
+		Active:     &active,
+		Meta: &Meta{
+			ResourceType: ResourceUser,
+			Created:      r.CreatedAt,
+			LastModified: r.UpdatedAt,
+			Location:     baseURL + BasePath + "/Users/" + r.UserID.String(),
+			Version:      r.ETag(),
+		},
+	}
+	if r.FirstName != "" || r.LastName != "" {
+		user.Name = &Name{
+			Formatted:  strings.TrimSpace(r.FirstName + " " + r.LastName),
+			GivenName:  r.FirstName,
+			FamilyName: r.LastName,
+		}
+	}
+	if r.Email != "" {
+		user.Emails = []MultiValue{{Value: r.Email, Type: "work", Primary: true}}
+	}
+	if r.Phone != "" {
+		user.PhoneNumbers = []MultiValue{{Value: r.Phone, Type: "mobile", Primary: true}}
+	}
+	for _, group := range r.Groups {
+		id := strconv.Itoa(group.RoleID)
+		user.Groups = append(user.Groups, Ref{Value: id, Display: group.Name, Ref: baseURL + BasePath + "/Groups/" + id})
+	}
+	return user
+}
+
+func (r GroupRecord) ToResource(baseURL string, withMembers bool) *Group {
+	id := strconv.Itoa(r.RoleID)
+	group := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          id,
+		DisplayName: r.Name,
+		Meta: &Meta{
+			ResourceType: ResourceGroup,
+			Created:      r.CreatedAt,
+			LastModified: r.UpdatedAt,
+			Location:     baseURL + BasePath + "/Groups/" + id,
+			Version:      r.ETag(),
+		},
+	}
+	if withMembers {
+		group.Members = []Ref{}
+		for _, member := range r.Members {
+			userID := member.UserID.String()
+			group.Members = append(group.Members, Ref{Value: userID, Display: member.UserName, Ref: baseURL + BasePath + "/Users/" + userID})
+		}
+	}
+	return group
+}
+
+// ApplyTo переносит атрибуты ресурса в запись пользователя, как при PUT: отсутствующие
+// необязательные атрибуты очищаются, отсутствующий active не меняет состояние
+func (u User) ApplyTo(record *UserRecord) {
+	record.UserName = strings.TrimSpace(u.UserName)
+	record.ExternalID = u.ExternalID
+	record.FirstName, record.LastName = "", ""
+	u.applyName(record)
+	record.Email = primaryValue(u.Emails)
+	record.Phone = primaryValue(u.PhoneNumbers)
+	if u.Active != nil {
+		record.Active = *u.Active
+	}
+}
+
+// applyName берёт имя и фамилию из givenName/familyName, а если их нет — из formatted
+func (u User) applyName(record *UserRecord) {
+	if u.Name == nil {
+		return
+	}
+	record.FirstName, record.LastName = strings.TrimSpace(u.Name.GivenName), strings.TrimSpace(u.Name.FamilyName)
+	if record.FirstName == "" && record.LastName == "" && u.Name.Formatted != "" {
+		first, last, _ := strings.Cut(strings.TrimSpace(u.Name.Formatted), " ")
+		record.FirstName, record.LastName = first, strings.TrimSpace(last)
+	}
+}
+
+func primaryValue(values []MultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return strings.TrimSpace(value.Value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+// ParseRoleID разбирает id группы; нечисловой id означает, что группы нет
+func ParseRoleID(id string) (int, error) {
+	roleID, err := strconv.Atoi(id)
+	if err != nil || roleID <= 0 {
+		return 0, ErrGroupNotFound
+	}
+	return roleID, nil
+}
+
+func ParseUserID(id string) (uuid.UUID, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, ErrUserNotFound
+	}
+	return userID, nil
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/service"
+)
+
+// auditingService записывает в журнал аудита выпуск и отзыв токенов и изменения, пришедшие от IdP.
+// Автор изменений SCIM — scim:<id токена>.
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.ScimService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.ScimService) service.ScimService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, targetType, targetID, before, after))
+}
+
+func (a *auditingService) CreateToken(ctx context.Context, merchantID, description string) (*domain.Token, string, error) {
+	token, secret, err := a.next.CreateToken(ctx, merchantID, description)
+	if err != nil {
+		return nil, "", err
+	}
+	a.record(ctx, "scim_token.create", auditDomain.TargetScimToken, token.ID.String(), nil, token)
+	return token, secret, nil
+}
+
+func (a *auditingService) ListTokens(ctx context.Context, merchantID string) ([]domain.Token, error) {
+	return a.next.ListTokens(ctx, merchantID)
+}
+
+func (a *auditingService) RevokeToken(ctx context.Context, id uuid.UUID) error {
+	if err := a.next.RevokeToken(ctx, id); err != nil {
+		return err
+	}
+	a.record(ctx, "scim_token.revoke", auditDomain.TargetScimToken, id.String(), nil, nil)
+	return nil
+}
+
+func (a *auditingService) Authenticate(ctx context.Context, token string) (*domain.Token, error) {
+	return a.next.Authenticate(ctx, token)
+}
+
+func (a *auditingService) ListUsers(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.UserRecord, int, error) {
+	return a.next.ListUsers(ctx, merchantID, query)
+}
+
+func (a *auditingService) GetUser(ctx context.Context, merchantID, id string) (*domain.UserRecord, error) {
+	return a.next.GetUser(ctx, merchantID, id)
+}
+
+func (a *auditingService) CreateUser(ctx context.Context, merchantID string, user domain.User) (*domain.UserRecord, error) {
+	created, err := a.next.CreateUser(ctx, merchantID, user)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "scim.user.create", auditDomain.TargetUser, created.UserID.String(), nil, userState(merchantID, created))
+	return created, nil
+}
+
+func (a *auditingService) ReplaceUser(ctx context.Context, merchantID, id, ifMatch string, user domain.User) (*domain.UserRecord, error) {
+	before := a.userSnapshot(ctx, merchantID, id)
+	updated, err := a.next.ReplaceUser(ctx, merchantID, id, ifMatch, user)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "scim.user.update", auditDomain.TargetUser, id, before, userState(merchantID, updated))
+	return updated, nil
+}
+
+func (a *auditingService) PatchUser(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.UserRecord, error) {
+	before := a.userSnapshot(ctx, merchantID, id)
+	updated, err := a.next.PatchUser(ctx, merchantID, id, ifMatch, patch)
+	if err != nil {
+		return nil, err
+	}
+	a.record(ctx, "scim.user.update", auditDomain.TargetUser, id, before, userState(merchantID, updated))
+	return updated, nil
+}
+
+func (a *auditingService) DeleteUser(ctx context.Context, merchantID, id, ifMatch string) error {
+	before := a.userSnapshot(ctx, merchantID, id)
+	if err := a.next.DeleteUser(ctx, merchantID, id, ifMatch); err != nil {
+		return err
+	}
+	a.record(ctx, "scim.user.delete", auditDomain.TargetUser, id, before, nil)
+	return nil
+}
+
+func (a *auditingService) ListGroups(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.GroupRecord, int, error) {
+	return a.next.ListGroups(ctx, merchantID, query)
+}
+
+func (a *auditingService) GetGroup(ctx context.Context, merchantID, id string) (*domain.GroupRecord, error) {
+	return a.next.GetGroup(ctx, merchantID, id)
+}
+
+func (a *auditingService) ReplaceGroup(ctx context.Context, merchantID, id, ifMatch string, group domain.Group) (*domain.GroupRecord, error) {
+	before := a.groupSnapshot(ctx, merchantID, id)
+	updated, err := a.next.ReplaceGroup(ctx, merchantID, id, ifMatch, group)
+	if err != nil {
+		return nil, err
+	}
+	a.recordGroup(ctx, merchantID, before, updated)
+	return updated, nil
+}
+
+func (a *auditingService) PatchGroup(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.GroupRecord, error) {
+	before := a.groupSnapshot(ctx, merchantID, id)
+	updated, err := a.next.PatchGroup(ctx, merchantID, id, ifMatch, patch)
+	if err != nil {
+		return nil, err
+	}
+	a.recordGroup(ctx, merchantID, before, updated)
+	return updated, nil
+}
+
+// recordGroup пишет событие, только если состав группы действительно изменился
+func (a *auditingService) recordGroup(ctx context.Context, merchantID string, before interface{}, after *domain.GroupRecord) {
+	state := groupState(merchantID, after)
+	if previous, ok := before.(groupMembers); ok && previous.Version == state.Version {
+		return
+	}
+	a.record(ctx, "scim.group.members", auditDomain.TargetRole, strconv.Itoa(after.RoleID), before, state)
+}
+
+type scimUser struct {
+	MerchantID string `json:"merchant_id"`
+	UserName   string `json:"user_name"`
+	ExternalID string `json:"external_id,omitempty"`
+	Active     bool   `json:"active"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email,omitempty"`
+	FirstName  string `json:"first_name,omitempty"`
+	LastName   string `json:"last_name,omitempty"`
+}
+
+type groupMembers struct {
+	MerchantID string   `json:"merchant_id"`
+	Version    int      `json:"version"`
+	Members    []string `json:"members"`
+}
+
+func userState(merchantID string, r *domain.UserRecord) scimUser {
+	return scimUser{
+		MerchantID: merchantID,
+		UserName:   r.UserName,
+		ExternalID: r.ExternalID,
+		Active:     r.Active,
+		Phone:      r.Phone,
+		Email:      r.Email,
+		FirstName:  r.FirstName,
+		LastName:   r.LastName,
+	}
+}
+
+func groupState(merchantID string, g *domain.GroupRecord) groupMembers {
+	state := groupMembers{MerchantID: merchantID, Version: g.Version, Members: []string{}}
+	for _, member := range g.Members {
+		state.Members = append(state.Members, member.UserID.String())
+	}
+	return state
+}
+
+func (a *auditingService) userSnapshot(ctx context.Context, merchantID, id string) interface{} {
+	record, err := a.next.GetUser(ctx, merchantID, id)
+	if err != nil {
+		return nil
+	}
+	return userState(merchantID, record)
+}
+
+func (a *auditingService) groupSnapshot(ctx context.Context, merchantID, id string) interface{} {
+	group, err := a.next.GetGroup(ctx, merchantID, id)
+	if err != nil {
+		return nil
+	}
+	return groupState(merchantID, group)
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.ScimService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.ScimService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateToken(ctx context.Context, merchantID, description string) (token *domain.Token, secret string, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateToken"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateToken(ctx, merchantID, description)
+}
+
+func (s *instrumentingService) ListTokens(ctx context.Context, merchantID string) (tokens []domain.Token, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListTokens"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListTokens(ctx, merchantID)
+}
+
+func (s *instrumentingService) RevokeToken(ctx context.Context, id uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "RevokeToken"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.RevokeToken(ctx, id)
+}
+
+func (s *instrumentingService) Authenticate(ctx context.Context, token string) (found *domain.Token, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Authenticate"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Authenticate(ctx, token)
+}
+
+func (s *instrumentingService) ListUsers(ctx context.Context, merchantID string, query domain.ListQuery) (users []domain.UserRecord, total int, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListUsers"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListUsers(ctx, merchantID, query)
+}
+
+func (s *instrumentingService) GetUser(ctx context.Context, merchantID, id string) (user *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetUser"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetUser(ctx, merchantID, id)
+}
+
+func (s *instrumentingService) CreateUser(ctx context.Context, merchantID string, user domain.User) (created *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateUser"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateUser(ctx, merchantID, user)
+}
+
+func (s *instrumentingService) ReplaceUser(ctx context.Context, merchantID, id, ifMatch string, user domain.User) (updated *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ReplaceUser"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ReplaceUser(ctx, merchantID, id, ifMatch, user)
+}
+
+func (s *instrumentingService) PatchUser(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (updated *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "PatchUser"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.PatchUser(ctx, merchantID, id, ifMatch, patch)
+}
+
+func (s *instrumentingService) DeleteUser(ctx context.Context, merchantID, id, ifMatch string) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteUser"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteUser(ctx, merchantID, id, ifMatch)
+}
+
+func (s *instrumentingService) ListGroups(ctx context.Context, merchantID string, query domain.ListQuery) (groups []domain.GroupRecord, total int, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListGroups"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListGroups(ctx, merchantID, query)
+}
+
+func (s *instrumentingService) GetGroup(ctx context.Context, merchantID, id string) (group *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetGroup"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetGroup(ctx, merchantID, id)
+}
+
+func (s *instrumentingService) ReplaceGroup(ctx context.Context, merchantID, id, ifMatch string, group domain.Group) (updated *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ReplaceGroup"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ReplaceGroup(ctx, merchantID, id, ifMatch, group)
+}
+
+func (s *instrumentingService) PatchGroup(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (updated *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "PatchGroup"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.PatchGroup(ctx, merchantID, id, ifMatch, patch)
+}
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.ScimService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.ScimService) service.ScimService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateToken(ctx context.Context, merchantID, description string) (token *domain.Token, secret string, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateToken",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateToken(ctx, merchantID, description)
+}
+
+func (l loggingService) ListTokens(ctx context.Context, merchantID string) (tokens []domain.Token, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListTokens",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListTokens(ctx, merchantID)
+}
+
+func (l loggingService) RevokeToken(ctx context.Context, id uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "RevokeToken",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.RevokeToken(ctx, id)
+}
+
+// Authenticate логируется только при ошибке: успешная проверка токена идёт на каждый запрос SCIM
+func (l loggingService) Authenticate(ctx context.Context, token string) (found *domain.Token, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			return
+		}
+		_ = l.logger.Log(
+			"method", "Authenticate",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Authenticate(ctx, token)
+}
+
+func (l loggingService) ListUsers(ctx context.Context, merchantID string, query domain.ListQuery) (users []domain.UserRecord, total int, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListUsers",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"filter", query.Filter,
+			"total", total,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListUsers(ctx, merchantID, query)
+}
+
+func (l loggingService) GetUser(ctx context.Context, merchantID, id string) (user *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetUser",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetUser(ctx, merchantID, id)
+}
+
+func (l loggingService) CreateUser(ctx context.Context, merchantID string, user domain.User) (created *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		keyvals := []interface{}{"method", "CreateUser", "took", time.Since(begin), "merchantID", merchantID,
+			"userName", user.UserName}
+		if created != nil {
+			keyvals = append(keyvals, "id", created.UserID)
+		}
+		_ = l.logger.Log(append(keyvals, "err", err)...)
+	}(time.Now())
+
+	return l.next.CreateUser(ctx, merchantID, user)
+}
+
+func (l loggingService) ReplaceUser(ctx context.Context, merchantID, id, ifMatch string, user domain.User) (updated *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ReplaceUser",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ReplaceUser(ctx, merchantID, id, ifMatch, user)
+}
+
+func (l loggingService) PatchUser(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (updated *domain.UserRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "PatchUser",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"operations", len(patch.Operations),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.PatchUser(ctx, merchantID, id, ifMatch, patch)
+}
+
+func (l loggingService) DeleteUser(ctx context.Context, merchantID, id, ifMatch string) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteUser",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteUser(ctx, merchantID, id, ifMatch)
+}
+
+func (l loggingService) ListGroups(ctx context.Context, merchantID string, query domain.ListQuery) (groups []domain.GroupRecord, total int, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListGroups",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"filter", query.Filter,
+			"total", total,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListGroups(ctx, merchantID, query)
+}
+
+func (l loggingService) GetGroup(ctx context.Context, merchantID, id string) (group *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetGroup",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetGroup(ctx, merchantID, id)
+}
+
+func (l loggingService) ReplaceGroup(ctx context.Context, merchantID, id, ifMatch string, group domain.Group) (updated *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ReplaceGroup",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"members", len(group.Members),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ReplaceGroup(ctx, merchantID, id, ifMatch, group)
+}
+
+func (l loggingService) PatchGroup(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (updated *domain.GroupRecord, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "PatchGroup",
+			"took", time.Since(begin),
+			"merchantID", merchantID,
+			"id", id,
+			"operations", len(patch.Operations),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.PatchGroup(ctx, merchantID, id, ifMatch, patch)
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rafaceo/go-test-auth/scim/domain"
+)
+
+func compile(t *testing.T, filter string, columns map[string]filterColumn) (string, []interface{}, error) {
+	t.Helper()
+	expr, err := domain.ParseFilter(filter)
+	if err != nil {
+		t.Fatalf("%s: ParseFilter: %v", filter, err)
+	}
+	args := []interface{}{"merchant"}
+	where, err := compileFilter(expr, columns, &args)
+	return where, args[1:], err
+}
+
+func TestCompileFilter(t *testing.T) {
+	cases := []struct {
+		filter  string
+		columns map[string]filterColumn
+		where   string
+		args    []interface{}
+	}{
+		{``, userColumns, `TRUE`, []interface{}{}},
+		{`userName eq "BJensen"`, userColumns, `lower(su.user_name) = $2`, []interface{}{"bjensen"}},
+		{`name.familyName sw "100%_"`, userColumns, `u.last_name LIKE $2`, []interface{}{`100\%\_%`}},
+		{`active eq true and not (emails pr)`, userColumns,
+			`(su.active = $2 AND NOT COALESCE(COALESCE(u.email, '') <> '', FALSE))`, []interface{}{true}},
+		{`externalId eq null or displayName ne "x"`, map[string]filterColumn{
+			"externalid": userColumns["externalid"], "displayname": groupColumns["displayname"],
+		}, `(su.external_id IS NULL OR lower(r.role_name) IS DISTINCT FROM $2)`, []interface{}{"x"}},
+	}
+	for _, c := range cases {
+		where, args, err := compile(t, c.filter, c.columns)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.filter, err)
+			continue
+		}
+		if where != c.where {
+			t.Errorf("%s: where = %s, want %s", c.filter, where, c.where)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%s: args = %#v, want %#v", c.filter, args, c.args)
+		}
+	}
+}
+
+func TestCompileFilterRejectsUnsupported(t *testing.T) {
+	cases := []struct {
+		filter   string
+		columns  map[string]filterColumn
+		scimType string
+	}{
+		{`title eq "Boss"`, userColumns, domain.ScimTypeInvalidFilter},
+		{`displayName eq "cashiers"`, userColumns, domain.ScimTypeInvalidFilter},
+		{`userName eq "a" or nickName pr`, userColumns, domain.ScimTypeInvalidFilter},
+		{`active gt true`, userColumns, domain.ScimTypeInvalidFilter},
+		{`active eq "yes"`, userColumns, domain.ScimTypeInvalidFilter},
+		{`userName eq 5`, userColumns, domain.ScimTypeInvalidFilter},
+		{`meta.created gt "yesterday"`, userColumns, domain.ScimTypeInvalidValue},
+		{`members co "a"`, groupColumns, domain.ScimTypeInvalidFilter},
+		{`userName pr`, groupColumns, domain.ScimTypeInvalidFilter},
+	}
+	for _, c := range cases {
+		_, _, err := compile(t, c.filter, c.columns)
+		var scimErr *domain.Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != c.scimType {
+			t.Errorf("%s: error = %v, want %s", c.filter, err, c.scimType)
+		}
+	}
+}
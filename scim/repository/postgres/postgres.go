@@ -0,0 +1,799 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesPostgres "github.com/rafaceo/go-test-auth/identities/repository/postgres"
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/repository"
+	contextsPostgres "github.com/rafaceo/go-test-auth/user_contexts/repository/postgres"
+)
+
+const tokenColumns = `id, merchant_id, description, created_by, created_at, last_used_at, revoked_at`
+
+const userSelect = `SELECT su.user_id, su.user_name, su.external_id, su.active, su.version, u.phone,
+	       COALESCE(u.email, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), su.created_at, su.updated_at
+	FROM scim_users su
+	JOIN "users" u ON u.id = su.user_id`
+
+const groupSelect = `SELECT r.role_id, r.role_name, r.current_version, COALESCE(sg.version, 0),
+	       COALESCE(rv.created, now()::timestamp), COALESCE(GREATEST(rv.modified, sg.updated_at), now()::timestamp)
+	FROM roles r
+	LEFT JOIN scim_groups sg ON sg.merchant_id = $1 AND sg.role_id = r.role_id
+	LEFT JOIN LATERAL (
+	    SELECT MIN(created_at) AS created, MAX(created_at) AS modified FROM role_versions WHERE role_id = r.role_id
+	) rv ON TRUE`
+
+type scimRepository struct {
+	db *sqlx.DB
+}
+
+func NewScimRepository(db *sqlx.DB) repository.ScimRepository {
+	return &scimRepository{db: db}
+}
+
+func (r *scimRepository) CreateToken(ctx context.Context, token domain.Token, hash string) error {
+	query := `INSERT INTO scim_tokens (id, merchant_id, token_hash, description, created_by, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.MerchantID, hash, token.Description, token.CreatedBy, token.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return merchantsDomain.ErrMerchantNotFound
+	}
+	return err
+}
+
+func (r *scimRepository) ListTokens(ctx context.Context, merchantID string) ([]domain.Token, error) {
+	tokens := []domain.Token{}
+	query := `SELECT ` + tokenColumns + ` FROM scim_tokens
+	          WHERE $1::text = '' OR merchant_id = $1::text
+	          ORDER BY created_at, id`
+	err := r.db.SelectContext(ctx, &tokens, query, merchantID)
+	return tokens, err
+}
+
+func (r *scimRepository) RevokeToken(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE scim_tokens SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`,
+		id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate находит действующий токен по хешу и отмечает его использование.
+// Токен мерчанта, который приостановлен или закрыт, не принимается.
+func (r *scimRepository) Authenticate(ctx context.Context, hash string) (domain.Token, error) {
+	query := `UPDATE scim_tokens t SET last_used_at = $3
+	          FROM merchants m
+	          WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND m.id = t.merchant_id AND m.status = $2
+	          RETURNING t.id, t.merchant_id, t.description, t.created_by, t.created_at, t.last_used_at, t.revoked_at`
+	var token domain.Token
+	err := r.db.GetContext(ctx, &token, query, hash, merchantsDomain.StatusActive, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Token{}, domain.ErrUnauthorized
+	}
+	return token, err
+}
+
+// ListUsers возвращает страницу пользователей мерчанта в порядке создания и общее число подходящих под фильтр
+func (r *scimRepository) ListUsers(ctx context.Context, merchantID string, filter domain.Expr, startIndex, count int) ([]domain.UserRecord, int, error) {
+	args := []interface{}{merchantID}
+	where, err := compileFilter(filter, userColumns, &args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM scim_users su JOIN "users" u ON u.id = su.user_id
+	               WHERE su.merchant_id = $1 AND ` + where
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if count == 0 || total < startIndex {
+		return []domain.UserRecord{}, total, nil
+	}
+
+	query := userSelect + `
+	WHERE su.merchant_id = $1 AND ` + where + `
+	ORDER BY su.created_at, su.user_id
+	OFFSET ` + placeholder(&args, startIndex-1) + ` LIMIT ` + placeholder(&args, count)
+	users, err := r.selectUsers(ctx, merchantID, query, args...)
+	return users, total, err
+}
+
+func (r *scimRepository) GetUser(ctx context.Context, merchantID string, userID uuid.UUID) (domain.UserRecord, error) {
+	users, err := r.selectUsers(ctx, merchantID, userSelect+` WHERE su.merchant_id = $1 AND su.user_id = $2`, merchantID, userID)
+	if err != nil {
+		return domain.UserRecord{}, err
+	}
+	if len(users) == 0 {
+		return domain.UserRecord{}, domain.ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+// selectUsers читает пользователей и их группы — роли, назначенные у мерчанта
+func (r *scimRepository) selectUsers(ctx context.Context, merchantID, query string, args ...interface{}) ([]domain.UserRecord, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.UserRecord{}
+	for rows.Next() {
+		var u domain.UserRecord
+		err := rows.Scan(&u.UserID, &u.UserName, &u.ExternalID, &u.Active, &u.Version, &u.Phone, &u.Email,
+			&u.FirstName, &u.LastName, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return users, nil
+	}
+
+	byID := make(map[uuid.UUID]*domain.UserRecord, len(users))
+	ids := make([]uuid.UUID, len(users))
+	for i := range users {
+		byID[users[i].UserID] = &users[i]
+		ids[i] = users[i].UserID
+	}
+
+	groupsQuery := `SELECT ur.user_id, r.role_id, r.role_name
+	                FROM users_roles ur
+	                JOIN roles r ON r.role_id = ur.role_id
+	                WHERE ur.merchant_id = $1 AND ur.user_id = ANY($2)
+	                ORDER BY r.role_id`
+	groupRows, err := r.db.QueryContext(ctx, groupsQuery, merchantID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer groupRows.Close()
+
+	for groupRows.Next() {
+		var userID uuid.UUID
+		var group domain.GroupRef
+		if err := groupRows.Scan(&userID, &group.RoleID, &group.Name); err != nil {
+			return nil, err
+		}
+		byID[userID].Groups = append(byID[userID].Groups, group)
+	}
+	return users, groupRows.Err()
+}
+
+// CreateUser заводит пользователя системы и связывает его с мерчантом. Активный пользователь
+// сразу получает контекст мерчанта.
+func (r *scimRepository) CreateUser(ctx context.Context, merchantID string, record domain.UserRecord, passwordHash string) (domain.UserRecord, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return domain.UserRecord{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkMerchant(ctx, tx, merchantID); err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	id := uuid.New()
+	query := `INSERT INTO "users" (id, phone, password_hash, rights, email, first_name, last_name, created_at)
+	          VALUES ($1, $2, $3, '{}', NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NOW())`
+	_, err = tx.ExecContext(ctx, query, id, record.Phone, passwordHash, record.Email, record.FirstName, record.LastName)
+	if err != nil {
+		return domain.UserRecord{}, uniqueness(err)
+	}
+	if err := identitiesPostgres.AddPhoneIdentity(ctx, tx, id, record.Phone, record.Email); err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	registered := outboxDomain.UserRegisteredPayload{UserID: id.String(), Phone: record.Phone, Email: record.Email, Source: "scim"}
+	if err := appendEvent(ctx, tx, outboxDomain.UserRegistered, id, registered); err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	now := time.Now().UTC()
+	query = `INSERT INTO scim_users (merchant_id, user_id, user_name, external_id, active, version, created_at, updated_at)
+	         VALUES ($1, $2, $3, $4, $5, 1, $6, $6)`
+	_, err = tx.ExecContext(ctx, query, merchantID, id, record.UserName, record.ExternalID, record.Active, now)
+	if err != nil {
+		return domain.UserRecord{}, uniqueness(err)
+	}
+
+	if record.Active {
+		if err := addContext(ctx, tx, merchantID, id); err != nil {
+			return domain.UserRecord{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.UserRecord{}, err
+	}
+	return r.GetUser(ctx, merchantID, id)
+}
+
+// UpdateUser сохраняет запись, если её версия не изменилась с момента чтения (record.Version).
+// Смена active снимает или возвращает контекст мерчанта; роли при снятии контекста снимаются вместе с ним.
+func (r *scimRepository) UpdateUser(ctx context.Context, merchantID string, record domain.UserRecord, passwordHash string) (domain.UserRecord, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return domain.UserRecord{}, err
+	}
+	defer tx.Rollback()
+
+	wasActive, err := lockUser(ctx, tx, merchantID, record.UserID, record.Version)
+	if err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	query := `UPDATE "users"
+	          SET phone = $2, email = NULLIF($3, ''), first_name = NULLIF($4, ''), last_name = NULLIF($5, ''),
+	              password_hash = COALESCE(NULLIF($6, ''), password_hash), updated_at = NOW()
+	          WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, record.UserID, record.Phone, record.Email, record.FirstName, record.LastName, passwordHash)
+	if err != nil {
+		return domain.UserRecord{}, uniqueness(err)
+	}
+	if err := identitiesPostgres.SyncPhoneIdentity(ctx, tx, record.UserID, record.Phone); err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	query = `UPDATE scim_users
+	         SET user_name = $3, external_id = $4, active = $5, version = version + 1, updated_at = $6
+	         WHERE merchant_id = $1 AND user_id = $2`
+	_, err = tx.ExecContext(ctx, query, merchantID, record.UserID, record.UserName, record.ExternalID, record.Active, time.Now().UTC())
+	if err != nil {
+		return domain.UserRecord{}, uniqueness(err)
+	}
+
+	switch {
+	case wasActive && !record.Active:
+		err = removeContext(ctx, tx, merchantID, record.UserID)
+	case !wasActive && record.Active:
+		if err = checkMerchant(ctx, tx, merchantID); err == nil {
+			err = addContext(ctx, tx, merchantID, record.UserID)
+		}
+	}
+	if err != nil {
+		return domain.UserRecord{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.UserRecord{}, err
+	}
+	return r.GetUser(ctx, merchantID, record.UserID)
+}
+
+// DeleteUser отвязывает пользователя от мерчанта: снимает роли и контекст у мерчанта и удаляет ресурс SCIM.
+// Учётная запись остаётся — она может быть нужна в других мерчантах. version 0 — без проверки версии.
+func (r *scimRepository) DeleteUser(ctx context.Context, merchantID string, userID uuid.UUID, version int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	active, err := lockUser(ctx, tx, merchantID, userID, version)
+	if err != nil {
+		return err
+	}
+	if active {
+		if err := removeContext(ctx, tx, merchantID, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scim_users WHERE merchant_id = $1 AND user_id = $2`, merchantID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListGroups возвращает страницу ролей каталога с участниками у мерчанта и общее число подходящих под фильтр
+func (r *scimRepository) ListGroups(ctx context.Context, merchantID string, filter domain.Expr, startIndex, count int, withMembers bool) ([]domain.GroupRecord, int, error) {
+	args := []interface{}{merchantID}
+	where, err := compileFilter(filter, groupColumns, &args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM (` + groupSelect + ` WHERE ` + where + `) g`
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if count == 0 || total < startIndex {
+		return []domain.GroupRecord{}, total, nil
+	}
+
+	query := groupSelect + `
+	WHERE ` + where + `
+	ORDER BY r.role_id
+	OFFSET ` + placeholder(&args, startIndex-1) + ` LIMIT ` + placeholder(&args, count)
+	groups, err := r.selectGroups(ctx, merchantID, withMembers, query, args...)
+	return groups, total, err
+}
+
+func (r *scimRepository) GetGroup(ctx context.Context, merchantID string, roleID int) (domain.GroupRecord, error) {
+	groups, err := r.selectGroups(ctx, merchantID, true, groupSelect+` WHERE r.role_id = $2`, merchantID, roleID)
+	if err != nil {
+		return domain.GroupRecord{}, err
+	}
+	if len(groups) == 0 {
+		return domain.GroupRecord{}, domain.ErrGroupNotFound
+	}
+	return groups[0], nil
+}
+
+// selectGroups читает роли и, если нужно, их участников — пользователей SCIM мерчанта с назначением роли у мерчанта
+func (r *scimRepository) selectGroups(ctx context.Context, merchantID string, withMembers bool, query string, args ...interface{}) ([]domain.GroupRecord, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []domain.GroupRecord{}
+	for rows.Next() {
+		var g domain.GroupRecord
+		if err := rows.Scan(&g.RoleID, &g.Name, &g.RoleVersion, &g.Version, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !withMembers || len(groups) == 0 {
+		return groups, nil
+	}
+
+	byID := make(map[int]*domain.GroupRecord, len(groups))
+	ids := make([]int64, len(groups))
+	for i := range groups {
+		byID[groups[i].RoleID] = &groups[i]
+		ids[i] = int64(groups[i].RoleID)
+	}
+
+	membersQuery := `SELECT ur.role_id, su.user_id, su.user_name
+	                 FROM users_roles ur
+	                 JOIN scim_users su ON su.merchant_id = ur.merchant_id AND su.user_id = ur.user_id
+	                 WHERE ur.merchant_id = $1 AND ur.role_id = ANY($2)
+	                 ORDER BY lower(su.user_name)`
+	memberRows, err := r.db.QueryContext(ctx, membersQuery, merchantID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	for memberRows.Next() {
+		var roleID int
+		var member domain.MemberRef
+		if err := memberRows.Scan(&roleID, &member.UserID, &member.UserName); err != nil {
+			return nil, err
+		}
+		byID[roleID].Members = append(byID[roleID].Members, member)
+	}
+	return groups, memberRows.Err()
+}
+
+// UpdateGroupMembers назначает роль группы добавленным участникам у мерчанта и снимает у удалённых.
+// Добавлять можно только активных пользователей SCIM этого мерчанта. Изменение применяется,
+// если состав группы не менялся с момента чтения (group.Version).
+func (r *scimRepository) UpdateGroupMembers(ctx context.Context, merchantID string, group domain.GroupRecord, add, remove []uuid.UUID) (domain.GroupRecord, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return domain.GroupRecord{}, err
+	}
+	defer tx.Rollback()
+
+	var roleName string
+	var rightsJSON []byte
+	err = tx.QueryRowContext(ctx, `SELECT role_name, rights FROM roles WHERE role_id = $1 FOR SHARE`, group.RoleID).
+		Scan(&roleName, &rightsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.GroupRecord{}, domain.ErrGroupNotFound
+	}
+	if err != nil {
+		return domain.GroupRecord{}, err
+	}
+
+	query := `INSERT INTO scim_groups (merchant_id, role_id) VALUES ($1, $2) ON CONFLICT (merchant_id, role_id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, merchantID, group.RoleID); err != nil {
+		return domain.GroupRecord{}, err
+	}
+	var version int
+	query = `SELECT version FROM scim_groups WHERE merchant_id = $1 AND role_id = $2 FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, query, merchantID, group.RoleID).Scan(&version); err != nil {
+		return domain.GroupRecord{}, err
+	}
+	if version != group.Version {
+		return domain.GroupRecord{}, domain.ErrConflict
+	}
+
+	var changed []uuid.UUID
+	if len(add) > 0 {
+		var active []uuid.UUID
+		query := `SELECT user_id FROM scim_users WHERE merchant_id = $1 AND user_id = ANY($2) AND active FOR SHARE`
+		if err := tx.SelectContext(ctx, &active, query, merchantID, pq.Array(add)); err != nil {
+			return domain.GroupRecord{}, err
+		}
+		if missing := difference(add, active); len(missing) > 0 {
+			return domain.GroupRecord{}, domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidValue,
+				"member %s is not an active user of this merchant", missing[0])
+		}
+
+		for _, userID := range add {
+			query := `INSERT INTO users_roles (user_id, role_id, merchant_id, granted_at) VALUES ($1, $2, $3, now())
+			          ON CONFLICT (user_id, role_id, (COALESCE(merchant_id, ''))) DO NOTHING`
+			res, err := tx.ExecContext(ctx, query, userID, group.RoleID, merchantID)
+			if err != nil {
+				return domain.GroupRecord{}, err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			changed = append(changed, userID)
+			if err := appendRoleEvent(ctx, tx, outboxDomain.RoleAssigned, group.RoleID, roleName, rightsJSON, userID, merchantID); err != nil {
+				return domain.GroupRecord{}, err
+			}
+		}
+	}
+
+	if len(remove) > 0 {
+		var removed []uuid.UUID
+		query := `DELETE FROM users_roles ur
+		          USING scim_users su
+		          WHERE ur.role_id = $1 AND ur.merchant_id = $2 AND ur.user_id = ANY($3)
+		            AND su.merchant_id = ur.merchant_id AND su.user_id = ur.user_id
+		          RETURNING ur.user_id`
+		if err := tx.SelectContext(ctx, &removed, query, group.RoleID, merchantID, pq.Array(remove)); err != nil {
+			return domain.GroupRecord{}, err
+		}
+		for _, userID := range removed {
+			changed = append(changed, userID)
+			if err := appendRoleEvent(ctx, tx, outboxDomain.RoleUnassigned, group.RoleID, roleName, rightsJSON, userID, merchantID); err != nil {
+				return domain.GroupRecord{}, err
+			}
+		}
+	}
+
+	if len(changed) > 0 {
+		now := time.Now().UTC()
+		query := `UPDATE scim_users SET version = version + 1, updated_at = $3 WHERE merchant_id = $1 AND user_id = ANY($2)`
+		if _, err := tx.ExecContext(ctx, query, merchantID, pq.Array(changed), now); err != nil {
+			return domain.GroupRecord{}, err
+		}
+		if err := bumpGroups(ctx, tx, merchantID, []int64{int64(group.RoleID)}, now); err != nil {
+			return domain.GroupRecord{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.GroupRecord{}, err
+	}
+	return r.GetGroup(ctx, merchantID, group.RoleID)
+}
+
+// lockUser блокирует ресурс пользователя до конца транзакции и сверяет версию (0 — не сверять)
+func lockUser(ctx context.Context, tx *sqlx.Tx, merchantID string, userID uuid.UUID, version int) (bool, error) {
+	var active bool
+	var current int
+	query := `SELECT active, version FROM scim_users WHERE merchant_id = $1 AND user_id = $2 FOR UPDATE`
+	err := tx.QueryRowContext(ctx, query, merchantID, userID).Scan(&active, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if version != 0 && version != current {
+		return false, domain.ErrConflict
+	}
+	return active, nil
+}
+
+func addContext(ctx context.Context, tx *sqlx.Tx, merchantID string, userID uuid.UUID) error {
+	query := `INSERT INTO users_contexts (user_id, merchant_id, global, granted_by) VALUES ($1, $2, FALSE, $3)
+	          ON CONFLICT (user_id, merchant_id) DO NOTHING`
+	res, err := tx.ExecContext(ctx, query, userID, merchantID, requestinfo.Actor(ctx))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	added := outboxDomain.ContextAddedPayload{UserID: userID.String(), MerchantID: merchantID}
+	return appendEvent(ctx, tx, outboxDomain.ContextAdded, userID, added)
+}
+
+// removeContext снимает роли пользователя у мерчанта и сам контекст; версии затронутых групп растут
+func removeContext(ctx context.Context, tx *sqlx.Tx, merchantID string, userID uuid.UUID) error {
+	var roleIDs []int64
+	query := `SELECT role_id FROM users_roles WHERE user_id = $1 AND merchant_id = $2`
+	if err := tx.SelectContext(ctx, &roleIDs, query, userID, merchantID); err != nil {
+		return err
+	}
+	if err := contextsPostgres.UnassignContextRoles(ctx, tx, userID, &merchantID); err != nil {
+		return err
+	}
+	if len(roleIDs) > 0 {
+		if err := bumpGroups(ctx, tx, merchantID, roleIDs, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+
+	removed := outboxDomain.ContextRemovedPayload{UserID: userID.String(), MerchantID: merchantID}
+	query = `DELETE FROM users_contexts WHERE user_id = $1 AND merchant_id = $2 RETURNING global`
+	err := tx.QueryRowContext(ctx, query, userID, merchantID).Scan(&removed.Global)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return appendEvent(ctx, tx, outboxDomain.ContextRemoved, userID, removed)
+}
+
+func bumpGroups(ctx context.Context, tx *sqlx.Tx, merchantID string, roleIDs []int64, now time.Time) error {
+	query := `INSERT INTO scim_groups (merchant_id, role_id, version, updated_at)
+	          SELECT $1::varchar, role_id, 1, $3::timestamp FROM unnest($2::int[]) AS role_id
+	          ON CONFLICT (merchant_id, role_id)
+	          DO UPDATE SET version = scim_groups.version + 1, updated_at = EXCLUDED.updated_at`
+	_, err := tx.ExecContext(ctx, query, merchantID, pq.Array(roleIDs), now)
+	return err
+}
+
+// checkMerchant проверяет, что мерчант токена активен, и не даёт удалить его до конца транзакции
+func checkMerchant(ctx context.Context, tx *sqlx.Tx, merchantID string) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM merchants WHERE id = $1 FOR SHARE`, merchantID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && status != merchantsDomain.StatusActive) {
+		return domain.ErrUnauthorized
+	}
+	return err
+}
+
+// uniqueness переводит нарушение уникальности в ошибку SCIM: userName уникален среди пользователей SCIM
+// мерчанта, телефон и email — среди всех пользователей
+func uniqueness(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	if pqErr.Table == "scim_users" {
+		return domain.ErrUserNameTaken
+	}
+	return domain.ErrPhoneTaken
+}
+
+func difference(ids, present []uuid.UUID) []uuid.UUID {
+	found := make(map[uuid.UUID]bool, len(present))
+	for _, id := range present {
+		found[id] = true
+	}
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func appendRoleEvent(ctx context.Context, tx *sqlx.Tx, change string, roleID int, roleName string, rightsJSON []byte, userID uuid.UUID, merchantID string) error {
+	return rolesPostgres.AppendRoleEvent(ctx, tx, outboxDomain.RoleChangedPayload{
+		RoleID:     roleID,
+		RoleName:   roleName,
+		Change:     change,
+		UserID:     userID.String(),
+		MerchantID: merchantID,
+		Modules:    rolesPostgres.RightsModules(rightsJSON),
+	})
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+// Типы атрибутов фильтра
+const (
+	attrString   = iota // сравнение с учётом регистра
+	attrCaseless        // caseExact = false: userName, email, displayName
+	attrBool
+	attrTime
+	attrMember // участник группы: только eq и pr
+)
+
+type filterColumn struct {
+	expr string
+	kind int
+}
+
+var userColumns = map[string]filterColumn{
+	"id":                 {"su.user_id::text", attrString},
+	"username":           {"su.user_name", attrCaseless},
+	"externalid":         {"su.external_id", attrString},
+	"active":             {"su.active", attrBool},
+	"name.givenname":     {"u.first_name", attrString},
+	"name.familyname":    {"u.last_name", attrString},
+	"name.formatted":     {"concat_ws(' ', u.first_name, u.last_name)", attrString},
+	"emails":             {"u.email", attrCaseless},
+	"emails.value":       {"u.email", attrCaseless},
+	"phonenumbers":       {"u.phone", attrString},
+	"phonenumbers.value": {"u.phone", attrString},
+	"meta.created":       {"su.created_at", attrTime},
+	"meta.lastmodified":  {"su.updated_at", attrTime},
+}
+
+var groupColumns = map[string]filterColumn{
+	"id":            {"r.role_id::text", attrString},
+	"displayname":   {"r.role_name", attrCaseless},
+	"members":       {"", attrMember},
+	"members.value": {"", attrMember},
+}
+
+// compileFilter переводит фильтр SCIM в условие WHERE; значения добавляются в args как параметры запроса
+func compileFilter(expr domain.Expr, columns map[string]filterColumn, args *[]interface{}) (string, error) {
+	switch e := expr.(type) {
+	case nil:
+		return "TRUE", nil
+	case *domain.LogicalExpr:
+		left, err := compileFilter(e.Left, columns, args)
+		if err != nil {
+			return "", err
+		}
+		right, err := compileFilter(e.Right, columns, args)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + strings.ToUpper(e.Op) + " " + right + ")", nil
+	case *domain.NotExpr:
+		inner, err := compileFilter(e.Expr, columns, args)
+		if err != nil {
+			return "", err
+		}
+		return "NOT COALESCE(" + inner + ", FALSE)", nil
+	case *domain.AttrExpr:
+		return compileAttr(e, columns, args)
+	}
+	return "", fmt.Errorf("unknown filter expression %T", expr)
+}
+
+func compileAttr(e *domain.AttrExpr, columns map[string]filterColumn, args *[]interface{}) (string, error) {
+	column, ok := columns[e.Path]
+	if !ok {
+		return "", domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidFilter, "filtering by %q is not supported", e.Path)
+	}
+	invalid := func() (string, error) {
+		return "", domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidFilter, "operator %s is not supported for %q", e.Op, e.Path)
+	}
+
+	if column.kind == attrMember {
+		members := `EXISTS (SELECT 1 FROM users_roles ur
+		            JOIN scim_users msu ON msu.merchant_id = ur.merchant_id AND msu.user_id = ur.user_id
+		            WHERE ur.role_id = r.role_id AND ur.merchant_id = $1`
+		switch e.Op {
+		case domain.OpPr:
+			return members + ")", nil
+		case domain.OpEq:
+			value, ok := e.Value.(string)
+			if !ok {
+				return invalid()
+			}
+			return members + " AND ur.user_id::text = " + placeholder(args, strings.ToLower(value)) + ")", nil
+		}
+		return invalid()
+	}
+
+	col := column.expr
+	if e.Op == domain.OpPr {
+		if column.kind == attrBool || column.kind == attrTime {
+			return col + " IS NOT NULL", nil
+		}
+		return "COALESCE(" + col + ", '') <> ''", nil
+	}
+
+	if e.Value == nil {
+		switch e.Op {
+		case domain.OpEq:
+			return col + " IS NULL", nil
+		case domain.OpNe:
+			return col + " IS NOT NULL", nil
+		}
+		return invalid()
+	}
+
+	var value interface{}
+	switch column.kind {
+	case attrBool:
+		flag, ok := e.Value.(bool)
+		if !ok || (e.Op != domain.OpEq && e.Op != domain.OpNe) {
+			return invalid()
+		}
+		value = flag
+	case attrTime:
+		text, ok := e.Value.(string)
+		if !ok {
+			return invalid()
+		}
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return "", domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidValue, "%s must be an RFC 3339 date-time", e.Path)
+		}
+		value = t.UTC()
+	default:
+		text, ok := e.Value.(string)
+		if !ok {
+			return invalid()
+		}
+		value = text
+	}
+
+	if column.kind == attrCaseless {
+		col = "lower(" + col + ")"
+		value = strings.ToLower(value.(string))
+	}
+
+	switch e.Op {
+	case domain.OpEq:
+		return col + " = " + placeholder(args, value), nil
+	case domain.OpNe:
+		return col + " IS DISTINCT FROM " + placeholder(args, value), nil
+	case domain.OpCo, domain.OpSw, domain.OpEw:
+		text, ok := value.(string)
+		if !ok {
+			return invalid()
+		}
+		pattern := likeEscaper.Replace(text)
+		switch e.Op {
+		case domain.OpCo:
+			pattern = "%" + pattern + "%"
+		case domain.OpSw:
+			pattern += "%"
+		case domain.OpEw:
+			pattern = "%" + pattern
+		}
+		return col + " LIKE " + placeholder(args, pattern), nil
+	case domain.OpGt, domain.OpGe, domain.OpLt, domain.OpLe:
+		if column.kind == attrBool {
+			return invalid()
+		}
+		operators := map[string]string{domain.OpGt: ">", domain.OpGe: ">=", domain.OpLt: "<", domain.OpLe: "<="}
+		return col + " " + operators[e.Op] + " " + placeholder(args, value), nil
+	}
+	return invalid()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func placeholder(args *[]interface{}, value interface{}) string {
+	*args = append(*args, value)
+	return "$" + strconv.Itoa(len(*args))
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+)
+
+type ScimRepository interface {
+	CreateToken(ctx context.Context, token domain.Token, hash string) error
+	ListTokens(ctx context.Context, merchantID string) ([]domain.Token, error)
+	RevokeToken(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, hash string) (domain.Token, error)
+
+	ListUsers(ctx context.Context, merchantID string, filter domain.Expr, startIndex, count int) ([]domain.UserRecord, int, error)
+	GetUser(ctx context.Context, merchantID string, userID uuid.UUID) (domain.UserRecord, error)
+	CreateUser(ctx context.Context, merchantID string, record domain.UserRecord, passwordHash string) (domain.UserRecord, error)
+	UpdateUser(ctx context.Context, merchantID string, record domain.UserRecord, passwordHash string) (domain.UserRecord, error)
+	DeleteUser(ctx context.Context, merchantID string, userID uuid.UUID, version int) error
+
+	ListGroups(ctx context.Context, merchantID string, filter domain.Expr, startIndex, count int, withMembers bool) ([]domain.GroupRecord, int, error)
+	GetGroup(ctx context.Context, merchantID string, roleID int) (domain.GroupRecord, error)
+	UpdateGroupMembers(ctx context.Context, merchantID string, group domain.GroupRecord, add, remove []uuid.UUID) (domain.GroupRecord, error)
+}
@@ -0,0 +1,29 @@
+package scim
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	"github.com/rafaceo/go-test-auth/scim/middleware"
+	"github.com/rafaceo/go-test-auth/scim/repository/postgres"
+	"github.com/rafaceo/go-test-auth/scim/service"
+)
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateScimService(logger log.Logger, postgresClient *sqlx.DB) service.ScimService {
+	scimServ := service.NewScimService(
+		postgres.NewScimRepository(postgresClient),
+		accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)),
+	)
+	scimServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), scimServ)
+	scimServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "scim"), scimServ)
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("scim_service")
+	scimServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, scimServ)
+
+	return scimServ
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	accessDomain "github.com/rafaceo/go-test-auth/access_requests/domain"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ScimService interface {
+	CreateToken(ctx context.Context, merchantID, description string) (*domain.Token, string, error)
+	ListTokens(ctx context.Context, merchantID string) ([]domain.Token, error)
+	RevokeToken(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, token string) (*domain.Token, error)
+
+	ListUsers(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.UserRecord, int, error)
+	GetUser(ctx context.Context, merchantID, id string) (*domain.UserRecord, error)
+	CreateUser(ctx context.Context, merchantID string, user domain.User) (*domain.UserRecord, error)
+	ReplaceUser(ctx context.Context, merchantID, id, ifMatch string, user domain.User) (*domain.UserRecord, error)
+	PatchUser(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.UserRecord, error)
+	DeleteUser(ctx context.Context, merchantID, id, ifMatch string) error
+
+	ListGroups(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.GroupRecord, int, error)
+	GetGroup(ctx context.Context, merchantID, id string) (*domain.GroupRecord, error)
+	ReplaceGroup(ctx context.Context, merchantID, id, ifMatch string, group domain.Group) (*domain.GroupRecord, error)
+	PatchGroup(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.GroupRecord, error)
+}
+
+// SensitiveGuard не даёт назначить роли с правами чувствительных модулей в обход заявок на доступ
+type SensitiveGuard interface {
+	CheckRoleGrant(ctx context.Context, roleNames []string) error
+}
+
+type scimService struct {
+	repo  repository.ScimRepository
+	guard SensitiveGuard
+}
+
+func NewScimService(repo repository.ScimRepository, guard SensitiveGuard) ScimService {
+	return &scimService{repo: repo, guard: guard}
+}
+
+// CreateToken выпускает токен для IdP мерчанта; сам токен возвращается только здесь
+func (s *scimService) CreateToken(ctx context.Context, merchantID, description string) (*domain.Token, string, error) {
+	merchantID = strings.TrimSpace(merchantID)
+	if merchantID == "" {
+		return nil, "", domain.ErrMerchantMissing
+	}
+	createdBy := requestinfo.VerifiedActor(ctx)
+	if createdBy == "" {
+		return nil, "", errors.New("token author is not authenticated")
+	}
+
+	secret, hash, err := domain.NewToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := domain.Token{
+		ID:          uuid.New(),
+		MerchantID:  merchantID,
+		Description: strings.TrimSpace(description),
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := s.repo.CreateToken(ctx, token, hash); err != nil {
+		return nil, "", err
+	}
+	return &token, secret, nil
+}
+
+func (s *scimService) ListTokens(ctx context.Context, merchantID string) ([]domain.Token, error) {
+	return s.repo.ListTokens(ctx, merchantID)
+}
+
+func (s *scimService) RevokeToken(ctx context.Context, id uuid.UUID) error {
+	return s.repo.RevokeToken(ctx, id)
+}
+
+func (s *scimService) Authenticate(ctx context.Context, token string) (*domain.Token, error) {
+	if token == "" {
+		return nil, domain.ErrUnauthorized
+	}
+	found, err := s.repo.Authenticate(ctx, domain.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+func (s *scimService) ListUsers(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.UserRecord, int, error) {
+	filter, err := domain.ParseFilter(query.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	query.Normalize()
+	return s.repo.ListUsers(ctx, merchantID, filter, query.StartIndex, query.Count)
+}
+
+func (s *scimService) GetUser(ctx context.Context, merchantID, id string) (*domain.UserRecord, error) {
+	userID, err := domain.ParseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+	record, err := s.repo.GetUser(ctx, merchantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CreateUser заводит пользователя. Без пароля вход возможен только после его сброса.
+func (s *scimService) CreateUser(ctx context.Context, merchantID string, user domain.User) (*domain.UserRecord, error) {
+	record := domain.UserRecord{Active: true}
+	user.ApplyTo(&record)
+	if err := record.Validate(); err != nil {
+		return nil, err
+	}
+
+	password := user.Password
+	if password == "" {
+		random, err := randomPassword()
+		if err != nil {
+			return nil, err
+		}
+		password = random
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.repo.CreateUser(ctx, merchantID, record, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ReplaceUser заменяет атрибуты пользователя целиком (PUT)
+func (s *scimService) ReplaceUser(ctx context.Context, merchantID, id, ifMatch string, user domain.User) (*domain.UserRecord, error) {
+	return s.updateUser(ctx, merchantID, id, ifMatch, func(record *domain.UserRecord) (string, error) {
+		user.ApplyTo(record)
+		return user.Password, nil
+	})
+}
+
+func (s *scimService) PatchUser(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.UserRecord, error) {
+	return s.updateUser(ctx, merchantID, id, ifMatch, patch.ApplyToUser)
+}
+
+// updateUser читает пользователя, сверяет If-Match, применяет изменение и сохраняет запись
+// при условии, что её не изменили параллельно
+func (s *scimService) updateUser(ctx context.Context, merchantID, id, ifMatch string, apply func(*domain.UserRecord) (string, error)) (*domain.UserRecord, error) {
+	current, err := s.GetUser(ctx, merchantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != "" && !domain.MatchETag(ifMatch, current.ETag()) {
+		return nil, domain.ErrPreconditionFailed
+	}
+
+	record := *current
+	password, err := apply(&record)
+	if err != nil {
+		return nil, err
+	}
+	if err := record.Validate(); err != nil {
+		return nil, err
+	}
+
+	var passwordHash string
+	if password != "" {
+		if passwordHash, err = hashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.repo.UpdateUser(ctx, merchantID, record, passwordHash)
+	if err != nil {
+		return nil, preconditionOrConflict(err, ifMatch)
+	}
+	return &updated, nil
+}
+
+// DeleteUser отвязывает пользователя от мерчанта: снимает его роли и контекст у мерчанта
+func (s *scimService) DeleteUser(ctx context.Context, merchantID, id, ifMatch string) error {
+	current, err := s.GetUser(ctx, merchantID, id)
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	if ifMatch != "" {
+		if !domain.MatchETag(ifMatch, current.ETag()) {
+			return domain.ErrPreconditionFailed
+		}
+		version = current.Version
+	}
+	return preconditionOrConflict(s.repo.DeleteUser(ctx, merchantID, current.UserID, version), ifMatch)
+}
+
+func (s *scimService) ListGroups(ctx context.Context, merchantID string, query domain.ListQuery) ([]domain.GroupRecord, int, error) {
+	filter, err := domain.ParseFilter(query.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	query.Normalize()
+	return s.repo.ListGroups(ctx, merchantID, filter, query.StartIndex, query.Count, !query.Excludes("members"))
+}
+
+func (s *scimService) GetGroup(ctx context.Context, merchantID, id string) (*domain.GroupRecord, error) {
+	roleID, err := domain.ParseRoleID(id)
+	if err != nil {
+		return nil, err
+	}
+	group, err := s.repo.GetGroup(ctx, merchantID, roleID)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ReplaceGroup заменяет состав группы (PUT); сама роль через SCIM не меняется
+func (s *scimService) ReplaceGroup(ctx context.Context, merchantID, id, ifMatch string, group domain.Group) (*domain.GroupRecord, error) {
+	return s.updateGroup(ctx, merchantID, id, ifMatch, func(current domain.GroupRecord) ([]uuid.UUID, []uuid.UUID, error) {
+		return domain.ReplaceGroupMembers(current, group)
+	})
+}
+
+func (s *scimService) PatchGroup(ctx context.Context, merchantID, id, ifMatch string, patch domain.PatchRequest) (*domain.GroupRecord, error) {
+	return s.updateGroup(ctx, merchantID, id, ifMatch, patch.ApplyToGroup)
+}
+
+func (s *scimService) updateGroup(ctx context.Context, merchantID, id, ifMatch string, diff func(domain.GroupRecord) ([]uuid.UUID, []uuid.UUID, error)) (*domain.GroupRecord, error) {
+	current, err := s.GetGroup(ctx, merchantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != "" && !domain.MatchETag(ifMatch, current.ETag()) {
+		return nil, domain.ErrPreconditionFailed
+	}
+
+	add, remove, err := diff(*current)
+	if err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return current, nil
+	}
+	if len(add) > 0 {
+		if err := s.guard.CheckRoleGrant(ctx, []string{current.Name}); err != nil {
+			return nil, forbidden(err)
+		}
+	}
+
+	updated, err := s.repo.UpdateGroupMembers(ctx, merchantID, *current, add, remove)
+	if err != nil {
+		return nil, preconditionOrConflict(err, ifMatch)
+	}
+	return &updated, nil
+}
+
+// preconditionOrConflict: если клиент передал If-Match, параллельное изменение означает,
+// что его версия устарела
+func preconditionOrConflict(err error, ifMatch string) error {
+	if ifMatch != "" && errors.Is(err, domain.ErrConflict) {
+		return domain.ErrPreconditionFailed
+	}
+	return err
+}
+
+// forbidden отдаёт отказ по чувствительным модулям как ошибку SCIM, чтобы IdP получил 403, а не 500
+func forbidden(err error) error {
+	var sensitive *accessDomain.SensitiveRightsError
+	if errors.As(err, &sensitive) {
+		return domain.NewError(http.StatusForbidden, "", "%s", sensitive.Error())
+	}
+	return err
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
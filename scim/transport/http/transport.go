@@ -0,0 +1,589 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+	"github.com/rafaceo/go-test-auth/scim/service"
+	"github.com/rafaceo/go-test-auth/scim/transport"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentType = "application/scim+json"
+	maxBodySize = 1 << 20
+)
+
+type ctxKey int
+
+const (
+	tokenKey ctxKey = iota
+	baseURLKey
+	merchantKey
+)
+
+// GetScimHandlers возвращает маршруты протокола SCIM 2.0 под domain.BasePath и маршруты выпуска токенов.
+// В отличие от остальных API, ошибки SCIM отдаются HTTP-статусом и телом по RFC 7644, 3.12:
+// IdP ориентируются именно на статус. Токены выпускает и отзывает только владелец права
+// domain.ManageEntitlement по access_token в Authorization: Bearer.
+func GetScimHandlers(serv service.ScimService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+	scimOpts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(EncodeScimError),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext, populateScimContext),
+	}
+	auth := authenticate(serv)
+	admin := authn.RequireEntitlement(tokens, domain.ManageEntitlement)
+
+	scimServer := func(e endpoint.Endpoint, dec kithttp.DecodeRequestFunc) http.Handler {
+		return kithttp.NewServer(auth(e), dec, EncodeScimResponse, scimOpts...)
+	}
+	discoveryServer := func(e endpoint.Endpoint) http.Handler {
+		return kithttp.NewServer(e, decodeEmpty, EncodeScimResponse, scimOpts...)
+	}
+
+	createTokenHandler := kithttp.NewServer(
+		admin(MakeCreateTokenEndpoint(serv)),
+		DecodeCreateTokenRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listTokensHandler := kithttp.NewServer(
+		admin(MakeListTokensEndpoint(serv)),
+		DecodeListTokensRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	revokeTokenHandler := kithttp.NewServer(
+		admin(MakeRevokeTokenEndpoint(serv)),
+		DecodeTokenIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/scim/tokens",
+			Handler: createTokenHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/scim/tokens",
+			Handler: listTokensHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/scim/tokens/{id}",
+			Handler: revokeTokenHandler,
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    domain.BasePath + "/ServiceProviderConfig",
+			Handler: discoveryServer(MakeServiceProviderConfigEndpoint()),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/ResourceTypes",
+			Handler: discoveryServer(MakeResourceTypesEndpoint()),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/Users",
+			Handler: scimServer(MakeListUsersEndpoint(serv), DecodeListRequest),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/Users",
+			Handler: scimServer(MakeCreateUserEndpoint(serv), DecodeCreateUserRequest),
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    domain.BasePath + "/Users/{id}",
+			Handler: scimServer(MakeGetUserEndpoint(serv), DecodeResourceRequest),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/Users/{id}",
+			Handler: scimServer(MakeReplaceUserEndpoint(serv), DecodeReplaceUserRequest),
+			Methods: []string{"PUT"},
+		},
+		{
+			Path:    domain.BasePath + "/Users/{id}",
+			Handler: scimServer(MakePatchUserEndpoint(serv), DecodePatchRequest),
+			Methods: []string{"PATCH"},
+		},
+		{
+			Path:    domain.BasePath + "/Users/{id}",
+			Handler: scimServer(MakeDeleteUserEndpoint(serv), DecodeResourceRequest),
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups",
+			Handler: scimServer(MakeListGroupsEndpoint(serv), DecodeListRequest),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups",
+			Handler: scimServer(MakeGroupsReadOnlyEndpoint(), decodeEmpty),
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups/{id}",
+			Handler: scimServer(MakeGetGroupEndpoint(serv), DecodeResourceRequest),
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups/{id}",
+			Handler: scimServer(MakeReplaceGroupEndpoint(serv), DecodeReplaceGroupRequest),
+			Methods: []string{"PUT"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups/{id}",
+			Handler: scimServer(MakePatchGroupEndpoint(serv), DecodePatchRequest),
+			Methods: []string{"PATCH"},
+		},
+		{
+			Path:    domain.BasePath + "/Groups/{id}",
+			Handler: scimServer(MakeGroupsReadOnlyEndpoint(), decodeEmpty),
+			Methods: []string{"DELETE"},
+		},
+	}
+}
+
+// authenticate проверяет bearer-токен SCIM и передаёт дальше мерчанта токена;
+// автором изменений в аудите и событиях становится scim:<id токена>
+func authenticate(svc service.ScimService) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			token, _ := ctx.Value(tokenKey).(string)
+			found, err := svc.Authenticate(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			ctx = requestinfo.WithVerifiedActor(ctx, "scim:"+found.ID.String())
+			ctx = context.WithValue(ctx, merchantKey, found.MerchantID)
+			return next(ctx, request)
+		}
+	}
+}
+
+// populateScimContext сохраняет bearer-токен и внешний адрес сервера, от которого строятся location ресурсов
+func populateScimContext(ctx context.Context, r *http.Request) context.Context {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		ctx = context.WithValue(ctx, tokenKey, strings.TrimSpace(authorization[7:]))
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return context.WithValue(ctx, baseURLKey, scheme+"://"+host)
+}
+
+func merchantFrom(ctx context.Context) string {
+	merchantID, _ := ctx.Value(merchantKey).(string)
+	return merchantID
+}
+
+func baseURLFrom(ctx context.Context) string {
+	baseURL, _ := ctx.Value(baseURLKey).(string)
+	return baseURL
+}
+
+func MakeCreateTokenEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateTokenRequest)
+		token, secret, err := svc.CreateToken(ctx, req.MerchantID, req.Description)
+		if err != nil {
+			return transport.TokenResponse{Error: err.Error()}, nil
+		}
+		return transport.TokenResponse{Token: token, Secret: secret}, nil
+	}
+}
+
+func MakeListTokensEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ListTokensRequest)
+		tokens, err := svc.ListTokens(ctx, req.MerchantID)
+		if err != nil {
+			return transport.ListTokensResponse{Error: err.Error()}, nil
+		}
+		return transport.ListTokensResponse{Tokens: tokens}, nil
+	}
+}
+
+func MakeRevokeTokenEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.TokenIDRequest)
+		if err := svc.RevokeToken(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Токен отозван"}, nil
+	}
+}
+
+func MakeServiceProviderConfigEndpoint() endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return transport.ScimResponse{Status: http.StatusOK, Body: domain.ServiceProviderConfig(baseURLFrom(ctx))}, nil
+	}
+}
+
+func MakeResourceTypesEndpoint() endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		types := domain.ResourceTypes(baseURLFrom(ctx))
+		return transport.ScimResponse{Status: http.StatusOK, Body: listResponse(types, len(types), 1, len(types))}, nil
+	}
+}
+
+func MakeListUsersEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ListRequest)
+		records, total, err := svc.ListUsers(ctx, merchantFrom(ctx), req.Query)
+		if err != nil {
+			return nil, err
+		}
+
+		users := make([]*domain.User, 0, len(records))
+		for _, record := range records {
+			users = append(users, userResource(ctx, record, req.Query.ExcludedAttributes))
+		}
+		return transport.ScimResponse{Status: http.StatusOK, Body: listResponse(users, total, req.Query.StartIndex, len(users))}, nil
+	}
+}
+
+func MakeGetUserEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ResourceRequest)
+		record, err := svc.GetUser(ctx, merchantFrom(ctx), req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if req.IfNoneMatch != "" && domain.MatchETag(req.IfNoneMatch, record.ETag()) {
+			return transport.ScimResponse{Status: http.StatusNotModified, ETag: record.ETag()}, nil
+		}
+		return userResponse(ctx, http.StatusOK, record, req.ExcludedAttributes), nil
+	}
+}
+
+func MakeCreateUserEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateUserRequest)
+		record, err := svc.CreateUser(ctx, merchantFrom(ctx), req.User)
+		if err != nil {
+			return nil, err
+		}
+		return userResponse(ctx, http.StatusCreated, record, nil), nil
+	}
+}
+
+func MakeReplaceUserEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ReplaceUserRequest)
+		record, err := svc.ReplaceUser(ctx, merchantFrom(ctx), req.ID, req.IfMatch, req.User)
+		if err != nil {
+			return nil, err
+		}
+		return userResponse(ctx, http.StatusOK, record, nil), nil
+	}
+}
+
+func MakePatchUserEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.PatchRequest)
+		record, err := svc.PatchUser(ctx, merchantFrom(ctx), req.ID, req.IfMatch, req.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return userResponse(ctx, http.StatusOK, record, nil), nil
+	}
+}
+
+func MakeDeleteUserEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ResourceRequest)
+		if err := svc.DeleteUser(ctx, merchantFrom(ctx), req.ID, req.IfMatch); err != nil {
+			return nil, err
+		}
+		return transport.ScimResponse{Status: http.StatusNoContent}, nil
+	}
+}
+
+func MakeListGroupsEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ListRequest)
+		records, total, err := svc.ListGroups(ctx, merchantFrom(ctx), req.Query)
+		if err != nil {
+			return nil, err
+		}
+
+		withMembers := !req.Query.Excludes("members")
+		groups := make([]*domain.Group, 0, len(records))
+		for _, record := range records {
+			groups = append(groups, record.ToResource(baseURLFrom(ctx), withMembers))
+		}
+		return transport.ScimResponse{Status: http.StatusOK, Body: listResponse(groups, total, req.Query.StartIndex, len(groups))}, nil
+	}
+}
+
+func MakeGetGroupEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ResourceRequest)
+		record, err := svc.GetGroup(ctx, merchantFrom(ctx), req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if req.IfNoneMatch != "" && domain.MatchETag(req.IfNoneMatch, record.ETag()) {
+			return transport.ScimResponse{Status: http.StatusNotModified, ETag: record.ETag()}, nil
+		}
+		query := domain.ListQuery{ExcludedAttributes: req.ExcludedAttributes}
+		return groupResponse(ctx, record, !query.Excludes("members")), nil
+	}
+}
+
+func MakeReplaceGroupEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.ReplaceGroupRequest)
+		record, err := svc.ReplaceGroup(ctx, merchantFrom(ctx), req.ID, req.IfMatch, req.Group)
+		if err != nil {
+			return nil, err
+		}
+		return groupResponse(ctx, record, true), nil
+	}
+}
+
+func MakePatchGroupEndpoint(svc service.ScimService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.PatchRequest)
+		record, err := svc.PatchGroup(ctx, merchantFrom(ctx), req.ID, req.IfMatch, req.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return groupResponse(ctx, record, true), nil
+	}
+}
+
+// MakeGroupsReadOnlyEndpoint отвечает на создание и удаление групп: группы — это роли каталога
+func MakeGroupsReadOnlyEndpoint() endpoint.Endpoint {
+	return func(context.Context, interface{}) (interface{}, error) {
+		return nil, domain.ErrGroupsReadOnly
+	}
+}
+
+func userResource(ctx context.Context, record domain.UserRecord, excluded []string) *domain.User {
+	user := record.ToResource(baseURLFrom(ctx))
+	if (domain.ListQuery{ExcludedAttributes: excluded}).Excludes("groups") {
+		user.Groups = nil
+	}
+	return user
+}
+
+func userResponse(ctx context.Context, status int, record *domain.UserRecord, excluded []string) transport.ScimResponse {
+	user := userResource(ctx, *record, excluded)
+	return transport.ScimResponse{Status: status, ETag: record.ETag(), Location: user.Meta.Location, Body: user}
+}
+
+func groupResponse(ctx context.Context, record *domain.GroupRecord, withMembers bool) transport.ScimResponse {
+	group := record.ToResource(baseURLFrom(ctx), withMembers)
+	return transport.ScimResponse{Status: http.StatusOK, ETag: record.ETag(), Location: group.Meta.Location, Body: group}
+}
+
+func listResponse(resources interface{}, total, startIndex, items int) domain.ListResponse {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	return domain.ListResponse{
+		Schemas:      []string{domain.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: items,
+		Resources:    resources,
+	}
+}
+
+func DecodeCreateTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeListTokensRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return transport.ListTokensRequest{MerchantID: r.URL.Query().Get("merchant_id")}, nil
+}
+
+func DecodeTokenIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid token ID")
+	}
+	return transport.TokenIDRequest{ID: id}, nil
+}
+
+func decodeEmpty(context.Context, *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+// DecodeListRequest читает filter, startIndex, count и excludedAttributes (через запятую)
+func DecodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	req := transport.ListRequest{Query: domain.ListQuery{
+		Filter:             query.Get("filter"),
+		StartIndex:         1,
+		Count:              domain.DefaultCount,
+		ExcludedAttributes: splitAttributes(query.Get("excludedAttributes")),
+	}}
+
+	for name, target := range map[string]*int{"startIndex": &req.Query.StartIndex, "count": &req.Query.Count} {
+		if value := query.Get(name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidValue, "%s must be an integer", name)
+			}
+			*target = number
+		}
+	}
+	req.Query.Normalize()
+	return req, nil
+}
+
+func DecodeResourceRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return resourceRequest(r), nil
+}
+
+func DecodeCreateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.CreateUserRequest
+	if err := decodeBody(r, &req.User); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeReplaceUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := transport.ReplaceUserRequest{ResourceRequest: resourceRequest(r)}
+	if err := decodeBody(r, &req.User); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeReplaceGroupRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := transport.ReplaceGroupRequest{ResourceRequest: resourceRequest(r)}
+	if err := decodeBody(r, &req.Group); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodePatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := transport.PatchRequest{ResourceRequest: resourceRequest(r)}
+	if err := decodeBody(r, &req.Patch); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func resourceRequest(r *http.Request) transport.ResourceRequest {
+	return transport.ResourceRequest{
+		ID:                 mux.Vars(r)["id"],
+		IfMatch:            r.Header.Get("If-Match"),
+		IfNoneMatch:        r.Header.Get("If-None-Match"),
+		ExcludedAttributes: splitAttributes(r.URL.Query().Get("excludedAttributes")),
+	}
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v); err != nil {
+		return domain.NewError(http.StatusBadRequest, domain.ScimTypeInvalidSyntax, "invalid JSON: %v", err)
+	}
+	return nil
+}
+
+func splitAttributes(value string) []string {
+	var attributes []string
+	for _, attribute := range strings.Split(value, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
+
+func EncodeScimResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(transport.ScimResponse)
+	if resp.ETag != "" {
+		w.Header().Set("ETag", resp.ETag)
+	}
+	if resp.Location != "" {
+		w.Header().Set("Location", resp.Location)
+	}
+	if resp.Body == nil {
+		w.WriteHeader(resp.Status)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(resp.Status)
+	return json.NewEncoder(w).Encode(resp.Body)
+}
+
+// EncodeScimError пишет ошибку в формате SCIM; подробности внутренних ошибок остаются в логе
+func EncodeScimError(_ context.Context, err error, w http.ResponseWriter) {
+	scimErr := &domain.Error{Status: http.StatusInternalServerError, Detail: "internal server error"}
+	errors.As(err, &scimErr)
+
+	if scimErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(scimErr.Status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}{
+		Schemas:  []string{domain.SchemaError},
+		Status:   strconv.Itoa(scimErr.Status),
+		ScimType: scimErr.ScimType,
+		Detail:   scimErr.Detail,
+	})
+}
@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/scim/domain"
+)
+
+type CreateTokenRequest struct {
+	MerchantID  string `json:"merchant_id"`
+	Description string `json:"description"`
+}
+
+type ListTokensRequest struct {
+	MerchantID string `json:"-"`
+}
+
+type TokenIDRequest struct {
+	ID uuid.UUID `json:"-"`
+}
+
+// ResourceRequest — запрос к ресурсу SCIM по id с условными заголовками
+type ResourceRequest struct {
+	ID                 string
+	IfMatch            string
+	IfNoneMatch        string
+	ExcludedAttributes []string
+}
+
+type ListRequest struct {
+	Query domain.ListQuery
+}
+
+type CreateUserRequest struct {
+	User domain.User
+}
+
+type ReplaceUserRequest struct {
+	ResourceRequest
+	User domain.User
+}
+
+type PatchRequest struct {
+	ResourceRequest
+	Patch domain.PatchRequest
+}
+
+type ReplaceGroupRequest struct {
+	ResourceRequest
+	Group domain.Group
+}
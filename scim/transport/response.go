@@ -0,0 +1,29 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/scim/domain"
+
+// TokenResponse — выпущенный токен; Secret показывается только в ответе на создание
+type TokenResponse struct {
+	Token  *domain.Token `json:"token,omitempty"`
+	Secret string        `json:"secret,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type ListTokensResponse struct {
+	Tokens []domain.Token `json:"tokens"`
+	Error  string         `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ScimResponse — ответ протокола SCIM: статус, заголовки ETag и Location и тело application/scim+json.
+// Пустое тело при статусе 204 и 304 не пишется.
+type ScimResponse struct {
+	Status   int
+	ETag     string
+	Location string
+	Body     interface{}
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+const (
+	EventLoginFailed        = "login_failed"
+	EventAccountLocked      = "account_locked"
+	EventLockedLoginAttempt = "locked_login_attempt"
+	EventTokenReuse         = "token_reuse"
+)
+
+// Event — событие безопасности входа. Subject — то, чем представился клиент (телефон),
+// UserID заполняется, когда пользователь известен.
+type Event struct {
+	ID        int64                  `json:"id"`
+	Type      string                 `json:"type"`
+	Subject   string                 `json:"subject,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	SourceIP  string                 `json:"source_ip,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/security/domain"
+	"github.com/rafaceo/go-test-auth/security/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.SecurityEventService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.SecurityEventService) service.SecurityEventService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) Record(ctx context.Context, event domain.Event) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Record",
+			"took", time.Since(begin),
+			"type", event.Type,
+			"subject", event.Subject,
+			"userID", event.UserID,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Record(ctx, event)
+}
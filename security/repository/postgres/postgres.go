@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/security/domain"
+	"github.com/rafaceo/go-test-auth/security/repository"
+)
+
+type securityEventRepository struct {
+	db *sqlx.DB
+}
+
+func NewSecurityEventRepository(db *sqlx.DB) repository.SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+func (r *securityEventRepository) InsertEvent(ctx context.Context, event *domain.Event) error {
+	var details []byte
+	if len(event.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO security_events (type, subject, user_id, source_ip, request_id, details, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          RETURNING id`
+	return r.db.QueryRowContext(ctx, query, event.Type, event.Subject, event.UserID, event.SourceIP,
+		event.RequestID, details, event.CreatedAt).Scan(&event.ID)
+}
+
+func (r *securityEventRepository) GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	query := `SELECT id, type, subject, user_id, source_ip, request_id, details, created_at
+	          FROM security_events
+	          WHERE id > $1
+	          ORDER BY id
+	          LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []domain.Event{}
+	for rows.Next() {
+		var e domain.Event
+		var details []byte
+		err := rows.Scan(&e.ID, &e.Type, &e.Subject, &e.UserID, &e.SourceIP, &e.RequestID, &details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &e.Details); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	"github.com/rafaceo/go-test-auth/security/domain"
+)
+
+type SecurityEventRepository interface {
+	InsertEvent(ctx context.Context, event *domain.Event) error
+	GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error)
+}
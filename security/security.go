@@ -0,0 +1,15 @@
+package security
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/security/middleware"
+	"github.com/rafaceo/go-test-auth/security/repository/postgres"
+	"github.com/rafaceo/go-test-auth/security/service"
+)
+
+// NewRecorder создаёт сервис записи событий безопасности для AuthService
+func NewRecorder(logger log.Logger, postgresClient *sqlx.DB) service.SecurityEventService {
+	securityServ := service.NewSecurityEventService(postgres.NewSecurityEventRepository(postgresClient))
+	return middleware.NewLoggingMiddleware(log.With(logger, "component", "security_events"), securityServ)
+}
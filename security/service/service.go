@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/security/domain"
+	"github.com/rafaceo/go-test-auth/security/repository"
+	"time"
+)
+
+type SecurityEventService interface {
+	Record(ctx context.Context, event domain.Event) error
+}
+
+type securityEventService struct {
+	repo repository.SecurityEventRepository
+}
+
+func NewSecurityEventService(repo repository.SecurityEventRepository) SecurityEventService {
+	return &securityEventService{repo: repo}
+}
+
+// Record дополняет событие адресом и ID запроса из контекста
+func (s *securityEventService) Record(ctx context.Context, event domain.Event) error {
+	if event.Type == "" {
+		return errors.New("security event requires type")
+	}
+	if event.SourceIP == "" {
+		event.SourceIP = requestinfo.SourceIP(ctx)
+	}
+	if event.RequestID == "" {
+		event.RequestID = requestinfo.RequestID(ctx)
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	return s.repo.InsertEvent(ctx, &event)
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"encoding/json"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	securityDomain "github.com/rafaceo/go-test-auth/security/domain"
+	"strings"
+	"time"
+)
+
+const (
+	SourceAudit    = "audit"
+	SourceSecurity = "security"
+)
+
+// Record — событие в общем для всех форматов виде. Severity по шкале CEF: 0–10.
+type Record struct {
+	Source     string          `json:"source"`
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	Type       string          `json:"type"`
+	Severity   int             `json:"severity"`
+	Actor      string          `json:"actor,omitempty"`
+	UserID     string          `json:"user_id,omitempty"`
+	Subject    string          `json:"subject,omitempty"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	SourceIP   string          `json:"source_ip,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+}
+
+// Message — отформатированная запись; приёмнику нужна и сама запись (время, важность)
+type Message struct {
+	Record Record
+	Body   []byte
+}
+
+func FromAuditEvent(e auditDomain.Event) Record {
+	severity := 3
+	if strings.HasSuffix(e.Action, ".delete") || strings.HasSuffix(e.Action, ".revoke") || strings.Contains(e.Action, ".rights.") {
+		severity = 5
+	}
+
+	record := Record{
+		Source:     SourceAudit,
+		ID:         e.ID,
+		Time:       e.CreatedAt.UTC(),
+		Type:       e.Action,
+		Severity:   severity,
+		Actor:      e.Actor,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		SourceIP:   e.SourceIP,
+		RequestID:  e.RequestID,
+		Details:    e.Diff,
+		Hash:       e.Hash,
+	}
+	if e.TargetType == auditDomain.TargetUser || e.TargetType == auditDomain.TargetUserContext {
+		record.UserID = e.TargetID
+	}
+	return record
+}
+
+var securitySeverity = map[string]int{
+	securityDomain.EventLoginFailed:        5,
+	securityDomain.EventLockedLoginAttempt: 6,
+	securityDomain.EventAccountLocked:      7,
+	securityDomain.EventTokenReuse:         9,
+}
+
+func FromSecurityEvent(e securityDomain.Event) Record {
+	severity, ok := securitySeverity[e.Type]
+	if !ok {
+		severity = 5
+	}
+
+	var details json.RawMessage
+	if len(e.Details) > 0 {
+		details, _ = json.Marshal(e.Details)
+	}
+
+	return Record{
+		Source:    SourceSecurity,
+		ID:        e.ID,
+		Time:      e.CreatedAt.UTC(),
+		Type:      e.Type,
+		Severity:  severity,
+		UserID:    e.UserID,
+		Subject:   e.Subject,
+		SourceIP:  e.SourceIP,
+		RequestID: e.RequestID,
+		Details:   details,
+	}
+}
@@ -0,0 +1,107 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rafaceo/go-test-auth/siem/domain"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	JSON = "json"
+	CEF  = "cef"
+)
+
+type Formatter interface {
+	Format(record domain.Record) ([]byte, error)
+}
+
+func New(name string) (Formatter, error) {
+	switch name {
+	case JSON, "":
+		return jsonFormatter{}, nil
+	case CEF:
+		return cefFormatter{vendor: "rafaceo", product: "go-test-auth", version: "4"}, nil
+	default:
+		return nil, fmt.Errorf("unknown SIEM format %q", name)
+	}
+}
+
+// jsonFormatter пишет одну запись в строку (JSON Lines)
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(record domain.Record) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+type cefFormatter struct {
+	vendor, product, version string
+}
+
+// Format собирает CEF:0|vendor|product|version|signature|name|severity|extension
+func (f cefFormatter) Format(r domain.Record) ([]byte, error) {
+	header := []string{
+		"CEF:0",
+		cefHeader(f.vendor),
+		cefHeader(f.product),
+		cefHeader(f.version),
+		cefHeader(r.Type),
+		cefHeader(r.Source + " " + r.Type),
+		strconv.Itoa(r.Severity),
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(r.Time.UnixMilli(), 10),
+		"cat=" + cefValue(r.Source),
+		"externalId=" + cefValue(r.Source+"-"+strconv.FormatInt(r.ID, 10)),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValue(value))
+		}
+	}
+	add("suser", r.Actor)
+	if r.UserID != "" {
+		add("duser", r.UserID)
+	} else {
+		add("duser", r.Subject)
+	}
+	if net.ParseIP(r.SourceIP) != nil {
+		add("src", r.SourceIP)
+	}
+	if r.RequestID != "" {
+		add("cs1Label", "requestId")
+		add("cs1", r.RequestID)
+	}
+	if r.TargetType != "" {
+		add("cs2Label", "targetType")
+		add("cs2", r.TargetType)
+		add("cs3Label", "targetId")
+		add("cs3", r.TargetID)
+	}
+	if len(r.Details) > 0 {
+		add("cs4Label", "details")
+		add("cs4", string(r.Details))
+	}
+	if r.Hash != "" {
+		add("cs5Label", "hash")
+		add("cs5", r.Hash)
+	}
+
+	return []byte(strings.Join(header, "|") + "|" + strings.Join(ext, " ")), nil
+}
+
+var (
+	headerEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	valueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeader(s string) string {
+	return headerEscaper.Replace(s)
+}
+
+func cefValue(s string) string {
+	return valueEscaper.Replace(s)
+}
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/siem/repository"
+)
+
+type cursorRepository struct {
+	db *sqlx.DB
+}
+
+func NewCursorRepository(db *sqlx.DB) repository.CursorRepository {
+	return &cursorRepository{db: db}
+}
+
+func (r *cursorRepository) GetCursor(ctx context.Context, exporter, source string) (int64, error) {
+	var lastID int64
+	query := `SELECT last_id FROM siem_cursors WHERE exporter = $1 AND source = $2`
+	err := r.db.QueryRowContext(ctx, query, exporter, source).Scan(&lastID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return lastID, err
+}
+
+func (r *cursorRepository) SaveCursor(ctx context.Context, exporter, source string, lastID int64) error {
+	query := `INSERT INTO siem_cursors (exporter, source, last_id, updated_at) VALUES ($1, $2, $3, NOW())
+	          ON CONFLICT (exporter, source) DO UPDATE SET last_id = EXCLUDED.last_id, updated_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, exporter, source, lastID)
+	return err
+}
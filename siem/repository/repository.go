@@ -0,0 +1,8 @@
+package repository
+
+import "context"
+
+type CursorRepository interface {
+	GetCursor(ctx context.Context, exporter, source string) (int64, error)
+	SaveCursor(ctx context.Context, exporter, source string, lastID int64) error
+}
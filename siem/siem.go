@@ -0,0 +1,152 @@
+package siem
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	auditPostgres "github.com/rafaceo/go-test-auth/audit/repository/postgres"
+	securityPostgres "github.com/rafaceo/go-test-auth/security/repository/postgres"
+	"github.com/rafaceo/go-test-auth/siem/domain"
+	"github.com/rafaceo/go-test-auth/siem/format"
+	"github.com/rafaceo/go-test-auth/siem/repository"
+	"github.com/rafaceo/go-test-auth/siem/repository/postgres"
+	"github.com/rafaceo/go-test-auth/siem/sink"
+)
+
+const defaultBatchSize = 500
+
+type Config struct {
+	// Name различает курсоры экспортёров, например сервиса и разовой выгрузки из authctl
+	Name      string
+	Sink      string
+	Format    string
+	Target    string
+	Interval  time.Duration
+	BatchSize int
+}
+
+// Exporter выгружает события аудита и безопасности в SIEM с доставкой «хотя бы один раз»:
+// курсор сдвигается только после успешной записи пачки в приёмник
+type Exporter struct {
+	name      string
+	sources   []Source
+	formatter format.Formatter
+	sink      sink.Sink
+	cursors   repository.CursorRepository
+	batchSize int
+	interval  time.Duration
+	logger    log.Logger
+}
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateExporter(logger log.Logger, postgresClient *sqlx.DB, cfg Config) (*Exporter, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("SIEM exporter name is required")
+	}
+	formatter, err := format.New(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	out, err := sink.New(cfg.Sink, cfg.Target, "go-test-auth")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	return &Exporter{
+		name: cfg.Name,
+		sources: []Source{
+			auditSource{repo: auditPostgres.NewAuditRepository(postgresClient)},
+			securitySource{repo: securityPostgres.NewSecurityEventRepository(postgresClient)},
+		},
+		formatter: formatter,
+		sink:      out,
+		cursors:   postgres.NewCursorRepository(postgresClient),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.Interval,
+		logger:    log.With(logger, "component", "siem_exporter", "exporter", cfg.Name),
+	}, nil
+}
+
+// ExportOnce выгружает всё накопленное и возвращает число отправленных записей
+func (e *Exporter) ExportOnce(ctx context.Context) (int, error) {
+	total := 0
+	for _, source := range e.sources {
+		n, err := e.exportSource(ctx, source)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (e *Exporter) exportSource(ctx context.Context, source Source) (int, error) {
+	cursor, err := e.cursors.GetCursor(ctx, e.name, source.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for {
+		records, err := source.Fetch(ctx, cursor, e.batchSize)
+		if err != nil {
+			return sent, err
+		}
+		if len(records) == 0 {
+			return sent, nil
+		}
+
+		messages := make([]domain.Message, 0, len(records))
+		for _, r := range records {
+			body, err := e.formatter.Format(r)
+			if err != nil {
+				return sent, err
+			}
+			messages = append(messages, domain.Message{Record: r, Body: body})
+		}
+
+		if err := e.sink.Write(ctx, messages); err != nil {
+			return sent, err
+		}
+
+		cursor = records[len(records)-1].ID
+		if err := e.cursors.SaveCursor(ctx, e.name, source.Name(), cursor); err != nil {
+			return sent, err
+		}
+		sent += len(records)
+
+		if len(records) < e.batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// Run блокируется до отмены ctx
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	defer e.sink.Close()
+
+	for {
+		if n, err := e.ExportOnce(ctx); err != nil || n > 0 {
+			_ = e.logger.Log("method", "ExportOnce", "exported", n, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) Close() error {
+	return e.sink.Close()
+}
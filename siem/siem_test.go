@@ -0,0 +1,174 @@
+package siem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/rafaceo/go-test-auth/siem/domain"
+	"github.com/rafaceo/go-test-auth/siem/format"
+)
+
+type memorySource struct {
+	name    string
+	records []domain.Record
+}
+
+func (s *memorySource) Name() string {
+	return s.name
+}
+
+func (s *memorySource) Fetch(_ context.Context, afterID int64, limit int) ([]domain.Record, error) {
+	records := []domain.Record{}
+	for _, r := range s.records {
+		if r.ID > afterID && len(records) < limit {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func newMemorySource(name string, n int) *memorySource {
+	s := &memorySource{name: name}
+	for id := int64(1); id <= int64(n); id++ {
+		s.records = append(s.records, domain.Record{Source: name, ID: id, Time: time.Unix(id, 0).UTC(), Type: "test"})
+	}
+	return s
+}
+
+type memoryCursors map[string]int64
+
+func (c memoryCursors) GetCursor(_ context.Context, exporter, source string) (int64, error) {
+	return c[exporter+"/"+source], nil
+}
+
+func (c memoryCursors) SaveCursor(_ context.Context, exporter, source string, lastID int64) error {
+	c[exporter+"/"+source] = lastID
+	return nil
+}
+
+// recordingSink запоминает доставленные записи и отказывает на пачке с номером failOn (с единицы)
+type recordingSink struct {
+	delivered []domain.Record
+	writes    int
+	failOn    int
+}
+
+var errSinkDown = errors.New("sink unavailable")
+
+func (s *recordingSink) Write(_ context.Context, messages []domain.Message) error {
+	s.writes++
+	if s.writes == s.failOn {
+		return errSinkDown
+	}
+	for _, m := range messages {
+		s.delivered = append(s.delivered, m.Record)
+	}
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func newTestExporter(name string, cursors memoryCursors, out *recordingSink, batchSize int, sources ...Source) *Exporter {
+	formatter, _ := format.New(format.JSON)
+	return &Exporter{
+		name:      name,
+		sources:   sources,
+		formatter: formatter,
+		sink:      out,
+		cursors:   cursors,
+		batchSize: batchSize,
+		logger:    log.NewNopLogger(),
+	}
+}
+
+func deliveredIDs(records []domain.Record, source string) []int64 {
+	ids := []int64{}
+	for _, r := range records {
+		if r.Source == source {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExportOnceDeliversAllSourcesAndSavesCursors(t *testing.T) {
+	cursors := memoryCursors{}
+	out := &recordingSink{}
+	exporter := newTestExporter("service", cursors, out, 2,
+		newMemorySource(domain.SourceAudit, 5), newMemorySource(domain.SourceSecurity, 2))
+
+	n, err := exporter.ExportOnce(context.Background())
+	if err != nil {
+		t.Fatalf("ExportOnce: %v", err)
+	}
+	if n != 7 {
+		t.Fatalf("exported %d records, want 7", n)
+	}
+	if got := deliveredIDs(out.delivered, domain.SourceAudit); !equalIDs(got, []int64{1, 2, 3, 4, 5}) {
+		t.Fatalf("audit records delivered %v", got)
+	}
+	if cursors["service/audit"] != 5 || cursors["service/security"] != 2 {
+		t.Fatalf("cursors = %v", cursors)
+	}
+
+	if n, err := exporter.ExportOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("second ExportOnce = %d, %v; want nothing to export", n, err)
+	}
+}
+
+func TestExportOnceResumesFromCursorAfterSinkFailure(t *testing.T) {
+	cursors := memoryCursors{}
+	source := newMemorySource(domain.SourceAudit, 5)
+
+	// Вторая пачка не доставлена: курсор остаётся на последней доставленной записи
+	failing := &recordingSink{failOn: 2}
+	n, err := newTestExporter("service", cursors, failing, 2, source).ExportOnce(context.Background())
+	if !errors.Is(err, errSinkDown) {
+		t.Fatalf("ExportOnce error = %v, want %v", err, errSinkDown)
+	}
+	if n != 2 {
+		t.Fatalf("exported %d records before the failure, want 2", n)
+	}
+	if cursors["service/audit"] != 2 {
+		t.Fatalf("cursor = %d after failure, want 2", cursors["service/audit"])
+	}
+
+	// Новый экспортёр с тем же именем продолжает с сохранённого курсора, без пропусков и повторов
+	out := &recordingSink{}
+	n, err = newTestExporter("service", cursors, out, 2, source).ExportOnce(context.Background())
+	if err != nil {
+		t.Fatalf("resumed ExportOnce: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("resumed export sent %d records, want 3", n)
+	}
+	if got := deliveredIDs(out.delivered, domain.SourceAudit); !equalIDs(got, []int64{3, 4, 5}) {
+		t.Fatalf("resumed export delivered %v, want [3 4 5]", got)
+	}
+	if cursors["service/audit"] != 5 {
+		t.Fatalf("cursor = %d, want 5", cursors["service/audit"])
+	}
+
+	// Курсоры разных экспортёров независимы: разовая выгрузка начинает с начала
+	oneOff := &recordingSink{}
+	if n, err := newTestExporter("authctl", cursors, oneOff, 10, source).ExportOnce(context.Background()); err != nil || n != 5 {
+		t.Fatalf("one-off export = %d, %v; want 5 records", n, err)
+	}
+}
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/rafaceo/go-test-auth/siem/domain"
+	"io"
+	"os"
+)
+
+const (
+	Stdout = "stdout"
+	File   = "file"
+	Syslog = "syslog"
+)
+
+// Sink доставляет пачку сообщений. Ошибка означает, что пачку нужно отправить повторно.
+type Sink interface {
+	Write(ctx context.Context, messages []domain.Message) error
+	Close() error
+}
+
+// New создаёт приёмник: для file target — путь к файлу, для syslog — адрес вида udp://host:514 или tcp://host:514
+func New(kind, target, appName string) (Sink, error) {
+	switch kind {
+	case Stdout:
+		return &lineSink{w: os.Stdout}, nil
+	case File:
+		if target == "" {
+			return nil, fmt.Errorf("file sink requires a path")
+		}
+		f, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		return &lineSink{w: f, sync: f.Sync, close: f.Close}, nil
+	case Syslog:
+		return NewSyslogSink(target, appName)
+	default:
+		return nil, fmt.Errorf("unknown SIEM sink %q", kind)
+	}
+}
+
+// lineSink пишет по сообщению в строку; для файла пачка считается доставленной после fsync
+type lineSink struct {
+	w     io.Writer
+	sync  func() error
+	close func() error
+}
+
+func (s *lineSink) Write(_ context.Context, messages []domain.Message) error {
+	buf := bufio.NewWriter(s.w)
+	for _, m := range messages {
+		if _, err := buf.Write(m.Body); err != nil {
+			return err
+		}
+		if err := buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if s.sync != nil {
+		return s.sync()
+	}
+	return nil
+}
+
+func (s *lineSink) Close() error {
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
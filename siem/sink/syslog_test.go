@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaceo/go-test-auth/siem/domain"
+)
+
+func testMessage(id int64, severity int, body string) domain.Message {
+	return domain.Message{
+		Record: domain.Record{
+			Source:   domain.SourceSecurity,
+			ID:       id,
+			Time:     time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC),
+			Severity: severity,
+		},
+		Body: []byte(body),
+	}
+}
+
+// readOctetCounted читает один кадр RFC 6587: длина, пробел, сообщение
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid frame length %q", prefix)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return "", err
+	}
+	return string(frame), nil
+}
+
+func TestSyslogSinkTCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	frames := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			frame, err := readOctetCounted(r)
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- frame
+		}
+	}()
+
+	s, err := NewSyslogSink("tcp://"+ln.Addr().String(), "go-test-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []domain.Message{testMessage(1, 9, `{"id":1}`), testMessage(2, 3, "line with spaces")}
+	if err := s.Write(context.Background(), messages); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// authpriv (10): CEF 9 → critical (2), CEF 3 → informational (6)
+	hostname, _ := os.Hostname()
+	want := []string{
+		fmt.Sprintf(`<82>1 2024-03-01T12:30:00.123456Z %s go-test-auth %d security - {"id":1}`, hostname, os.Getpid()),
+		fmt.Sprintf(`<86>1 2024-03-01T12:30:00.123456Z %s go-test-auth %d security - line with spaces`, hostname, os.Getpid()),
+	}
+	for i, w := range want {
+		select {
+		case got := <-frames:
+			if got != w {
+				t.Errorf("frame %d:\n got %q\nwant %q", i, got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("frame %d was not received", i)
+		}
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := NewSyslogSink("udp://"+pc.LocalAddr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Write(context.Background(), []domain.Message{testMessage(7, 5, "CEF:0|x")}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("datagram was not received: %v", err)
+	}
+	got := string(buf[:n])
+	// По UDP длина кадра не добавляется, пустое имя приложения заменяется на -
+	if !strings.HasPrefix(got, "<84>1 2024-03-01T12:30:00.123456Z ") {
+		t.Errorf("unexpected header: %q", got)
+	}
+	if !strings.Contains(got, " - "+strconv.Itoa(os.Getpid())+" security - CEF:0|x") {
+		t.Errorf("unexpected frame: %q", got)
+	}
+}
+
+func TestSyslogSinkReconnectsAfterFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	s, err := NewSyslogSink("tcp://"+addr, "go-test-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Приёмник недоступен: пачка не доставлена и должна быть отправлена повторно
+	ln.Close()
+	if err := s.Write(context.Background(), []domain.Message{testMessage(1, 3, "first")}); err == nil {
+		t.Fatal("Write to a closed listener succeeded")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		frame, err := readOctetCounted(bufio.NewReader(conn))
+		if err == nil {
+			received <- frame
+		}
+	}()
+
+	if err := s.Write(context.Background(), []domain.Message{testMessage(1, 3, "first")}); err != nil {
+		t.Fatalf("retry Write: %v", err)
+	}
+	select {
+	case frame := <-received:
+		if !strings.HasSuffix(frame, " first") {
+			t.Errorf("unexpected frame: %q", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retried message was not received")
+	}
+}
+
+func TestNewSyslogSinkRejectsInvalidTarget(t *testing.T) {
+	for _, target := range []string{"", "localhost:514", "http://localhost:514"} {
+		if _, err := NewSyslogSink(target, "go-test-auth"); err == nil {
+			t.Errorf("NewSyslogSink(%q) succeeded", target)
+		}
+	}
+}
+
+func TestFileSinkAppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "siem.log")
+
+	for _, body := range []string{"first", "second"} {
+		s, err := New(File, path, "go-test-auth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(context.Background(), []domain.Message{testMessage(1, 3, body)}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "first\nsecond\n"; got != want {
+		t.Fatalf("file content %q, want %q", got, want)
+	}
+}
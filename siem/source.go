@@ -0,0 +1,54 @@
+package siem
+
+import (
+	"context"
+	auditRepository "github.com/rafaceo/go-test-auth/audit/repository"
+	securityRepository "github.com/rafaceo/go-test-auth/security/repository"
+	"github.com/rafaceo/go-test-auth/siem/domain"
+)
+
+// Source отдаёт записи в порядке возрастания ID, начиная со следующей за afterID
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context, afterID int64, limit int) ([]domain.Record, error)
+}
+
+type auditSource struct {
+	repo auditRepository.AuditRepository
+}
+
+func (s auditSource) Name() string {
+	return domain.SourceAudit
+}
+
+func (s auditSource) Fetch(ctx context.Context, afterID int64, limit int) ([]domain.Record, error) {
+	events, err := s.repo.GetEventsAfter(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]domain.Record, 0, len(events))
+	for _, e := range events {
+		records = append(records, domain.FromAuditEvent(e))
+	}
+	return records, nil
+}
+
+type securitySource struct {
+	repo securityRepository.SecurityEventRepository
+}
+
+func (s securitySource) Name() string {
+	return domain.SourceSecurity
+}
+
+func (s securitySource) Fetch(ctx context.Context, afterID int64, limit int) ([]domain.Record, error) {
+	events, err := s.repo.GetEventsAfter(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]domain.Record, 0, len(events))
+	for _, e := range events {
+		records = append(records, domain.FromSecurityEvent(e))
+	}
+	return records, nil
+}
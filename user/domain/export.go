@@ -0,0 +1,231 @@
+package domain
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+	ExportXLSX  = "xlsx"
+
+	// maxXLSXRows — предел строк листа Excel без заголовка
+	maxXLSXRows = 1<<20 - 1
+)
+
+var (
+	ErrInvalidExportFormat = errors.New("invalid format: use csv, jsonl or xlsx")
+	ErrTooManyXLSXRows     = errors.New("too many users for xlsx: use csv or jsonl")
+)
+
+// RightGrant — прямое право пользователя со сроком действия, если он задан
+type RightGrant struct {
+	Module     string     `json:"module"`
+	Action     string     `json:"action"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// RoleGrant — назначение роли; пустой MerchantID означает назначение у любого мерчанта
+type RoleGrant struct {
+	Role       string     `json:"role"`
+	MerchantID string     `json:"merchant_id,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// ExportRecord — пользователь в выгрузке доступа: прямые права, роли и контексты мерчантов
+type ExportRecord struct {
+	ID        uuid.UUID    `json:"id"`
+	Phone     string       `json:"phone"`
+	Email     string       `json:"email,omitempty"`
+	FirstName string       `json:"first_name,omitempty"`
+	LastName  string       `json:"last_name,omitempty"`
+	Status    string       `json:"status"`
+	Global    bool         `json:"global"`
+	Merchants []string     `json:"merchants"`
+	Rights    []RightGrant `json:"rights"`
+	Roles     []RoleGrant  `json:"roles"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// ExportWriter пишет записи выгрузки по одной; Close дописывает файл и должен вызываться всегда
+type ExportWriter interface {
+	Write(record ExportRecord) error
+	Close() error
+}
+
+func ValidExportFormat(format string) bool {
+	return format == ExportCSV || format == ExportJSONL || format == ExportXLSX
+}
+
+// ExportContentType — MIME-тип файла выгрузки
+func ExportContentType(format string) string {
+	switch format {
+	case ExportJSONL:
+		return "application/x-ndjson"
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func NewExportWriter(format string, w io.Writer) (ExportWriter, error) {
+	switch format {
+	case ExportCSV:
+		writer := &csvExportWriter{w: csv.NewWriter(w)}
+		return writer, writer.w.Write(exportHeader)
+	case ExportJSONL:
+		return &jsonlExportWriter{enc: json.NewEncoder(w)}, nil
+	case ExportXLSX:
+		return newXLSXExportWriter(w)
+	}
+	return nil, ErrInvalidExportFormat
+}
+
+var exportHeader = []string{"id", "phone", "email", "first_name", "last_name", "status", "global", "merchants",
+	"rights", "roles", "created_at", "updated_at"}
+
+// exportCells раскладывает запись по столбцам exportHeader. Списки разделяются «; »,
+// срок действия записывается интервалом ISO 8601 в квадратных скобках, «..» — открытая граница.
+func exportCells(r ExportRecord) []string {
+	rights := make([]string, 0, len(r.Rights))
+	for _, grant := range r.Rights {
+		rights = append(rights, grant.Module+":"+grant.Action+validity(grant.ValidFrom, grant.ValidUntil))
+	}
+
+	roles := make([]string, 0, len(r.Roles))
+	for _, grant := range r.Roles {
+		role := grant.Role
+		if grant.MerchantID != "" {
+			role += "@" + grant.MerchantID
+		}
+		roles = append(roles, role+validity(grant.ValidFrom, grant.ValidUntil))
+	}
+
+	return []string{
+		r.ID.String(),
+		r.Phone,
+		r.Email,
+		r.FirstName,
+		r.LastName,
+		r.Status,
+		strconv.FormatBool(r.Global),
+		strings.Join(r.Merchants, "; "),
+		strings.Join(rights, "; "),
+		strings.Join(roles, "; "),
+		r.CreatedAt.UTC().Format(time.RFC3339),
+		r.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func validity(from, until *time.Time) string {
+	if from == nil && until == nil {
+		return ""
+	}
+	bound := func(t *time.Time) string {
+		if t == nil {
+			return ".."
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return " [" + bound(from) + "/" + bound(until) + "]"
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+// Write экранирует свободный текст (email и имена), чтобы табличный редактор не принял его за формулу;
+// xlsx пишет ячейки строками, и там это не нужно
+func (c *csvExportWriter) Write(record ExportRecord) error {
+	cells := exportCells(record)
+	for _, i := range []int{2, 3, 4} {
+		if cells[i] != "" && strings.ContainsRune("=+-@", rune(cells[i][0])) {
+			cells[i] = "'" + cells[i]
+		}
+	}
+	return c.w.Write(cells)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlExportWriter) Write(record ExportRecord) error {
+	return j.enc.Encode(record)
+}
+
+func (j *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// xlsxExportWriter пишет лист потоково: excelize держит в памяти только буфер строк,
+// остальное уходит во временный файл; книга целиком выдаётся в w при Close
+type xlsxExportWriter struct {
+	out    io.Writer
+	book   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXExportWriter(w io.Writer) (*xlsxExportWriter, error) {
+	book := excelize.NewFile()
+	stream, err := book.NewStreamWriter(book.GetSheetName(0))
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+
+	writer := &xlsxExportWriter{out: w, book: book, stream: stream, row: 1}
+	if err := writer.writeRow(exportHeader); err != nil {
+		book.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (x *xlsxExportWriter) Write(record ExportRecord) error {
+	if x.row > maxXLSXRows+1 {
+		return ErrTooManyXLSXRows
+	}
+	return x.writeRow(exportCells(record))
+}
+
+func (x *xlsxExportWriter) writeRow(cells []string) error {
+	values := make([]interface{}, len(cells))
+	for i, cell := range cells {
+		values[i] = cell
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	x.row++
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxExportWriter) Close() error {
+	defer x.book.Close()
+
+	if err := x.stream.Flush(); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	return x.book.Write(x.out)
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Статусы учётной записи. Войти и получить токены может только active. suspended — временное
+// отстранение (отпуск, служебная проверка), locked — блокировка по соображениям безопасности,
+// deactivated — отключение уволенного сотрудника с сохранением данных, deleted — окончательное
+// удаление: данные остаются для истории, вернуть учётную запись нельзя.
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusLocked      = "locked"
+	StatusDeactivated = "deactivated"
+	StatusDeleted     = "deleted"
+)
+
+// maxStatusReasonLength — ограничение причины смены статуса
+const maxStatusReasonLength = 500
+
+var (
+	ErrInvalidStatus      = errors.New("invalid status: use active, suspended, locked, deactivated or deleted")
+	ErrInvalidTransition  = errors.New("status transition is not allowed")
+	ErrStatusReason       = errors.New("reason is required when a user leaves active")
+	ErrStatusReasonLength = errors.New("reason must be at most 500 characters")
+)
+
+// transitions — допустимые переходы; из deleted выхода нет
+var transitions = map[string][]string{
+	StatusActive:      {StatusSuspended, StatusLocked, StatusDeactivated, StatusDeleted},
+	StatusSuspended:   {StatusActive, StatusLocked, StatusDeactivated, StatusDeleted},
+	StatusLocked:      {StatusActive, StatusSuspended, StatusDeactivated, StatusDeleted},
+	StatusDeactivated: {StatusActive, StatusDeleted},
+}
+
+// StatusActions — действия администратора и статусы, в которые они переводят пользователя
+var StatusActions = map[string]string{
+	"suspend":    StatusSuspended,
+	"lock":       StatusLocked,
+	"reactivate": StatusActive,
+	"deactivate": StatusDeactivated,
+	"delete":     StatusDeleted,
+}
+
+// StatusChange — смена статуса пользователя. SessionRevoked — при уходе из active
+// завершена действовавшая сессия.
+type StatusChange struct {
+	UserID         uuid.UUID `json:"user_id"`
+	From           string    `json:"from"`
+	To             string    `json:"to"`
+	Reason         string    `json:"reason,omitempty"`
+	ChangedBy      string    `json:"changed_by,omitempty"`
+	ChangedAt      time.Time `json:"changed_at"`
+	SessionRevoked bool      `json:"session_revoked"`
+}
+
+func ValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok || status == StatusDeleted
+}
+
+// ValidateStatusReason: причина обязательна для всех статусов, кроме active
+func ValidateStatusReason(status, reason string) error {
+	if status != StatusActive && reason == "" {
+		return ErrStatusReason
+	}
+	if len([]rune(reason)) > maxStatusReasonLength {
+		return ErrStatusReasonLength
+	}
+	return nil
+}
+
+func CheckTransition(from, to string) error {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+// Active сообщает, может ли пользователь входить и пользоваться выданными токенами
+func (u User) Active() bool {
+	return u.Status == StatusActive
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+	SortPhoneAsc    = "phone"
+	SortPhoneDesc   = "-phone"
+
+	// timestampKey сохраняет микросекунды created_at без часового пояса, как в столбце
+	timestampKey = "2006-01-02T15:04:05.999999"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort: use created_at, -created_at, phone or -phone")
+	ErrInvalidRight  = errors.New("invalid right: use module:action")
+)
+
+// Profile — пользователь в ответах API, без хеша пароля. Roles — имена назначенных ролей,
+// Merchants — мерчанты из контекстов пользователя; StatusReason и StatusChangedAt — причина
+// и время последней смены статуса.
+type Profile struct {
+	ID              uuid.UUID  `json:"id"`
+	Phone           string     `json:"phone"`
+	Email           string     `json:"email,omitempty"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	Roles           []string   `json:"roles"`
+	Merchants       []string   `json:"merchants"`
+	Global          bool       `json:"global"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Filter — поиск пользователей. Пустые поля не ограничивают выборку; Right задаётся как
+// «модуль:действие» и учитывает прямые права и права назначенных ролей.
+type Filter struct {
+	PhonePrefix  string
+	EmailPrefix  string
+	Role         string
+	Right        string
+	MerchantID   string
+	Status       string
+	CreatedFrom  *time.Time
+	CreatedUntil *time.Time
+	Sort         string
+	Limit        int
+	Cursor       string
+}
+
+type Page struct {
+	Users      []Profile `json:"users"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Cursor — позиция последнего выданного пользователя: ключ сортировки и ID
+type Cursor struct {
+	Sort string    `json:"s"`
+	Key  string    `json:"k"`
+	ID   uuid.UUID `json:"id"`
+}
+
+// CursorAfter запоминает позицию пользователя для продолжения выборки в сортировке sort
+func CursorAfter(sort string, p Profile) Cursor {
+	key := p.CreatedAt.Format(timestampKey)
+	if sort == SortPhoneAsc || sort == SortPhoneDesc {
+		key = p.Phone
+	}
+	return Cursor{Sort: sort, Key: key, ID: p.ID}
+}
+
+// EncodeCursor скрывает от клиента устройство курсора
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor проверяет, что курсор выдан для той же сортировки
+func DecodeCursor(cursor, sort string) (*Cursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortCreatedAsc, SortCreatedDesc, SortPhoneAsc, SortPhoneDesc:
+		return true
+	}
+	return false
+}
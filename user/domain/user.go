@@ -1,11 +1,98 @@
 package domain
 
 import (
+	"errors"
 	"github.com/google/uuid"
+	"net/mail"
+	"regexp"
+	"time"
 )
 
+var (
+	ErrNoMerchantContext = errors.New("у пользователя нет контекста этого мерчанта")
+	ErrUserExists        = errors.New("пользователь с таким номером или email уже существует")
+)
+
+// User — учётная запись из users, общая для входа (AuthService) и администрирования (UserService).
+// Пустые Email, FirstName и LastName хранятся как NULL.
 type User struct {
-	ID       uuid.UUID
-	Phone    string
-	Password string
+	ID           uuid.UUID
+	Phone        string
+	PasswordHash string
+	Email        string
+	FirstName    string
+	LastName     string
+	Status       string
+	CreatedAt    time.Time
+}
+
+// MergeConflict — запись отчёта об объединении users_profiles с users (миграция 000035):
+// что не удалось объединить без потерь и как это было решено
+type MergeConflict struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	ProfileID  uuid.UUID  `json:"profile_id"`
+	UserID     *uuid.UUID `json:"user_id,omitempty"`
+	Phone      string     `json:"phone"`
+	Email      string     `json:"email,omitempty"`
+	Resolution string     `json:"resolution"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const (
+	GrantKindRight = "right"
+	GrantKindRole  = "role"
+)
+
+// TimedGrant — право из users.rights или назначение роли с ограниченным сроком действия
+type TimedGrant struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	Kind       string     `json:"kind"`
+	Module     string     `json:"module,omitempty"`
+	Action     string     `json:"action,omitempty"`
+	RoleID     int        `json:"role_id,omitempty"`
+	RoleName   string     `json:"role_name,omitempty"`
+	MerchantID string     `json:"merchant_id,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// Access — действующие права пользователя по мерчантам. Rights действуют у любого мерчанта,
+// Merchants — полные права у каждого мерчанта из контекстов пользователя.
+// Global означает глобальный контекст: у мерчантов не из Merchants действуют Rights.
+type Access struct {
+	Rights    map[string][]string
+	Merchants map[string]map[string][]string
+	Global    bool
+}
+
+// MerchantAccess — права пользователя, действующие у одного мерчанта
+type MerchantAccess struct {
+	MerchantID string
+	Rights     map[string][]string
+	Global     bool
+}
+
+var (
+	phonePattern = regexp.MustCompile(`^\+?\d{10,}$`)
+
+	ErrInvalidPhone = errors.New("invalid phone number: must contain only digits, optionally start with '+', and have at least 10 digits")
+	ErrInvalidEmail = errors.New("invalid email")
+)
+
+// ValidatePhone — правило номера телефона для всех способов создания пользователя
+func ValidatePhone(phone string) error {
+	if !phonePattern.MatchString(phone) {
+		return ErrInvalidPhone
+	}
+	return nil
+}
+
+// ValidateEmail допускает только адрес без имени: «user@example.com»
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 128 {
+		return ErrInvalidEmail
+	}
+	return nil
 }
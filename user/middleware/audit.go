@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
+	"github.com/rafaceo/go-test-auth/user/service"
+)
+
+// auditingService записывает в журнал аудита каждое успешное изменение пользователей и их прав.
+// Ошибка записи не отменяет изменение — её логирует middleware сервиса аудита.
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.UserService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.UserService) service.UserService {
+	return &auditingService{audit: audit, next: s}
+}
+
+type userState struct {
+	Phone string `json:"phone"`
+}
+
+type statusState struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type rightsState struct {
+	Rights map[string][]string `json:"rights"`
+	rightsDomain.Validity
+}
+
+func (a *auditingService) record(ctx context.Context, action, targetID string, before, after interface{}) {
+	_ = a.audit.Record(ctx, auditDomain.NewEvent(action, auditDomain.TargetUser, targetID, before, after))
+}
+
+func (a *auditingService) rightsSnapshot(ctx context.Context, id uuid.UUID) interface{} {
+	rights, err := a.next.GetUserRights(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return rightsState{Rights: rights}
+}
+
+func (a *auditingService) CreateUser(ctx context.Context, phone string, passwordHash string) (uuid.UUID, error) {
+	id, err := a.next.CreateUser(ctx, phone, passwordHash)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	a.record(ctx, "user.create", id.String(), nil, userState{Phone: phone})
+	return id, nil
+}
+
+func (a *auditingService) EditUser(ctx context.Context, id uuid.UUID, phone, password string) error {
+	var before interface{}
+	if old, err := a.next.GetUser(ctx, id); err == nil {
+		before = userState{Phone: old.Phone}
+	}
+	if err := a.next.EditUser(ctx, id, phone, password); err != nil {
+		return err
+	}
+	a.record(ctx, "user.edit", id.String(), before, userState{Phone: phone})
+	return nil
+}
+
+func (a *auditingService) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error) {
+	change, err := a.next.ChangeStatus(ctx, id, status, reason)
+	if err != nil {
+		return change, err
+	}
+	a.record(ctx, "user.status.change", id.String(), statusState{Status: change.From}, statusState{Status: change.To, Reason: change.Reason})
+	return change, nil
+}
+
+func (a *auditingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error {
+	before := a.rightsSnapshot(ctx, id)
+	if err := a.next.GrantRightsToUser(ctx, id, rights, validity); err != nil {
+		return err
+	}
+
+	// Отложенная выдача ещё не видна в действующих правах, поэтому after строится из запроса
+	var current map[string][]string
+	if state, ok := before.(rightsState); ok {
+		current = state.Rights
+	}
+	after := rightsState{Rights: rightsDomain.MergeRights(current, rights), Validity: validity}
+	a.record(ctx, "user.rights.grant", id.String(), before, after)
+	return nil
+}
+
+func (a *auditingService) EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
+	before := a.rightsSnapshot(ctx, id)
+	if err := a.next.EditRightsToUser(ctx, id, rights); err != nil {
+		return err
+	}
+	a.record(ctx, "user.rights.edit", id.String(), before, a.rightsSnapshot(ctx, id))
+	return nil
+}
+
+func (a *auditingService) RevokeRightsFromUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
+	before := a.rightsSnapshot(ctx, id)
+	if err := a.next.RevokeRightsFromUser(ctx, id, rights); err != nil {
+		return err
+	}
+	a.record(ctx, "user.rights.revoke", id.String(), before, a.rightsSnapshot(ctx, id))
+	return nil
+}
+
+func (a *auditingService) GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error) {
+	return a.next.GetUser(ctx, id)
+}
+
+func (a *auditingService) ListUsers(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return a.next.ListUsers(ctx, filter)
+}
+
+func (a *auditingService) ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) error {
+	return a.next.ExportUsers(ctx, filter, write)
+}
+
+func (a *auditingService) GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error) {
+	return a.next.GetUserRights(ctx, id)
+}
+
+func (a *auditingService) GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (map[string][]string, error) {
+	return a.next.GetEffectiveRights(ctx, id, merchantID)
+}
+
+func (a *auditingService) GetAccess(ctx context.Context, id uuid.UUID) (domain.Access, error) {
+	return a.next.GetAccess(ctx, id)
+}
+
+func (a *auditingService) GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (domain.MerchantAccess, error) {
+	return a.next.GetMerchantAccess(ctx, id, merchantID)
+}
+
+func (a *auditingService) GetUpcomingExpiries(ctx context.Context, id uuid.UUID) ([]domain.TimedGrant, error) {
+	return a.next.GetUpcomingExpiries(ctx, id)
+}
+
+// SweepExpiredGrants пишет отдельное событие на каждую снятую выдачу
+func (a *auditingService) SweepExpiredGrants(ctx context.Context) ([]domain.TimedGrant, error) {
+	expired, err := a.next.SweepExpiredGrants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range expired {
+		a.record(ctx, "user.grant.expire", grant.UserID.String(), grant, nil)
+	}
+	return expired, nil
+}
+
+func (a *auditingService) ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error) {
+	return a.next.ListMergeConflicts(ctx)
+}
@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
 	"time"
 
 	"github.com/go-kit/kit/metrics"
@@ -25,7 +27,7 @@ func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogr
 	}
 }
 
-func (s *instrumentingService) CreateUser(ctx context.Context, phone string, passwordHash string) (err error) {
+func (s *instrumentingService) CreateUser(ctx context.Context, phone string, passwordHash string) (id uuid.UUID, err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "CreateUser"}
 		s.requestCount.With(labels...).Add(1)
@@ -51,7 +53,21 @@ func (s *instrumentingService) EditUser(ctx context.Context, id uuid.UUID, phone
 	return s.next.EditUser(ctx, id, phone, password)
 }
 
-func (s *instrumentingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) (err error) {
+func (s *instrumentingService) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (change domain.StatusChange, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ChangeStatus"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	change, err = s.next.ChangeStatus(ctx, id, status, reason)
+	return
+}
+
+func (s *instrumentingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) (err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "GrantRightsToUser"}
 		s.requestCount.With(labels...).Add(1)
@@ -61,7 +77,7 @@ func (s *instrumentingService) GrantRightsToUser(ctx context.Context, id uuid.UU
 		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.GrantRightsToUser(ctx, id, rights)
+	return s.next.GrantRightsToUser(ctx, id, rights, validity)
 }
 
 func (s *instrumentingService) EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) (err error) {
@@ -90,7 +106,7 @@ func (s *instrumentingService) RevokeRightsFromUser(ctx context.Context, id uuid
 	return s.next.RevokeRightsFromUser(ctx, id, rights)
 }
 
-func (s *instrumentingService) GetUser(ctx context.Context, id uuid.UUID) (phone string, password string, created_at string, updated_at string, err error) {
+func (s *instrumentingService) GetUser(ctx context.Context, id uuid.UUID) (profile domain.Profile, err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "GetUser"}
 		s.requestCount.With(labels...).Add(1)
@@ -100,7 +116,35 @@ func (s *instrumentingService) GetUser(ctx context.Context, id uuid.UUID) (phone
 		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	phone, password, created_at, updated_at, err = s.next.GetUser(ctx, id)
+	profile, err = s.next.GetUser(ctx, id)
+	return
+}
+
+func (s *instrumentingService) ListUsers(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListUsers"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	page, err = s.next.ListUsers(ctx, filter)
+	return
+}
+
+func (s *instrumentingService) ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ExportUsers"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = s.next.ExportUsers(ctx, filter, write)
 	return
 }
 
@@ -117,3 +161,87 @@ func (s *instrumentingService) GetUserRights(ctx context.Context, id uuid.UUID)
 	rights, err = s.next.GetUserRights(ctx, id)
 	return
 }
+
+func (s *instrumentingService) GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (rights map[string][]string, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetEffectiveRights"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	rights, err = s.next.GetEffectiveRights(ctx, id, merchantID)
+	return
+}
+
+func (s *instrumentingService) GetAccess(ctx context.Context, id uuid.UUID) (access domain.Access, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetAccess"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	access, err = s.next.GetAccess(ctx, id)
+	return
+}
+
+func (s *instrumentingService) GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (access domain.MerchantAccess, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetMerchantAccess"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	access, err = s.next.GetMerchantAccess(ctx, id, merchantID)
+	return
+}
+
+func (s *instrumentingService) GetUpcomingExpiries(ctx context.Context, id uuid.UUID) (grants []domain.TimedGrant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetUpcomingExpiries"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	grants, err = s.next.GetUpcomingExpiries(ctx, id)
+	return
+}
+
+func (s *instrumentingService) SweepExpiredGrants(ctx context.Context) (expired []domain.TimedGrant, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "SweepExpiredGrants"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	expired, err = s.next.SweepExpiredGrants(ctx)
+	return
+}
+
+func (s *instrumentingService) ListMergeConflicts(ctx context.Context) (conflicts []domain.MergeConflict, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListMergeConflicts"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	conflicts, err = s.next.ListMergeConflicts(ctx)
+	return
+}
@@ -3,6 +3,9 @@ package middleware
 import (
 	"context"
 	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
 	"github.com/rafaceo/go-test-auth/user/service"
 	"time"
 
@@ -18,7 +21,7 @@ func NewLoggingMiddleware(logger log.Logger, next service.UserService) service.U
 	return &loggingService{logger: logger, next: next}
 }
 
-func (l *loggingService) CreateUser(ctx context.Context, phone string, passwordHash string) (err error) {
+func (l *loggingService) CreateUser(ctx context.Context, phone string, passwordHash string) (id uuid.UUID, err error) {
 	defer func(begin time.Time) {
 		if err != nil {
 			_ = l.logger.Log(
@@ -51,7 +54,24 @@ func (l *loggingService) EditUser(ctx context.Context, id uuid.UUID, phone, pass
 
 	return l.next.EditUser(ctx, id, phone, password)
 }
-func (l *loggingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) (err error) {
+
+func (l *loggingService) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (change domain.StatusChange, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "ChangeStatus",
+				"id", id,
+				"status", status,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	change, err = l.next.ChangeStatus(ctx, id, status, reason)
+	return
+}
+
+func (l *loggingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) (err error) {
 	defer func(begin time.Time) {
 		if err != nil {
 			_ = l.logger.Log(
@@ -60,12 +80,13 @@ func (l *loggingService) GrantRightsToUser(ctx context.Context, id uuid.UUID, ri
 				"context", ctx,
 				"id", id,
 				"rights", rights,
+				"validity", validity,
 				"err", err,
 			)
 		}
 
 	}(time.Now())
-	return l.next.GrantRightsToUser(ctx, id, rights)
+	return l.next.GrantRightsToUser(ctx, id, rights, validity)
 }
 
 func (l *loggingService) EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) (err error) {
@@ -100,23 +121,63 @@ func (l *loggingService) RevokeRightsFromUser(ctx context.Context, id uuid.UUID,
 	return l.next.RevokeRightsFromUser(ctx, id, rights)
 }
 
-func (l *loggingService) GetUser(ctx context.Context, id uuid.UUID) (phone string, password string, created_at string, updated_at string, err error) {
+func (l *loggingService) GetUser(ctx context.Context, id uuid.UUID) (profile domain.Profile, err error) {
 	defer func(begin time.Time) {
 		if err != nil {
 			_ = l.logger.Log(
 				"method", "GetUser",
 				"id", id,
-				"phone", phone,
-				"password", password,
-				"createdAt", created_at,
-				"updatedAt", updated_at,
 				"took", time.Since(begin),
 				"err", err,
 			)
 		}
 	}(time.Now())
 
-	phone, password, created_at, updated_at, err = l.next.GetUser(ctx, id)
+	profile, err = l.next.GetUser(ctx, id)
+	return
+}
+
+func (l *loggingService) ListUsers(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "ListUsers",
+				"role", filter.Role,
+				"right", filter.Right,
+				"merchantID", filter.MerchantID,
+				"status", filter.Status,
+				"sort", filter.Sort,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+
+	page, err = l.next.ListUsers(ctx, filter)
+	return
+}
+
+// ExportUsers логируется всегда: выгрузка доступа должна оставлять след, кто и сколько выгрузил
+func (l *loggingService) ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) (err error) {
+	exported := 0
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ExportUsers",
+			"actor", requestinfo.Actor(ctx),
+			"role", filter.Role,
+			"right", filter.Right,
+			"merchantID", filter.MerchantID,
+			"status", filter.Status,
+			"exported", exported,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	err = l.next.ExportUsers(ctx, filter, func(record domain.ExportRecord) error {
+		exported++
+		return write(record)
+	})
 	return
 }
 
@@ -135,3 +196,94 @@ func (l *loggingService) GetUserRights(ctx context.Context, id uuid.UUID) (right
 	rights, err = l.next.GetUserRights(ctx, id)
 	return
 }
+
+func (l *loggingService) GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (rights map[string][]string, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "GetEffectiveRights",
+				"id", id,
+				"merchant_id", merchantID,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	rights, err = l.next.GetEffectiveRights(ctx, id, merchantID)
+	return
+}
+
+func (l *loggingService) GetAccess(ctx context.Context, id uuid.UUID) (access domain.Access, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "GetAccess",
+				"id", id,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	access, err = l.next.GetAccess(ctx, id)
+	return
+}
+
+func (l *loggingService) GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (access domain.MerchantAccess, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "GetMerchantAccess",
+				"id", id,
+				"merchant_id", merchantID,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	access, err = l.next.GetMerchantAccess(ctx, id, merchantID)
+	return
+}
+
+func (l *loggingService) GetUpcomingExpiries(ctx context.Context, id uuid.UUID) (grants []domain.TimedGrant, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "GetUpcomingExpiries",
+				"id", id,
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	grants, err = l.next.GetUpcomingExpiries(ctx, id)
+	return
+}
+
+func (l *loggingService) SweepExpiredGrants(ctx context.Context) (expired []domain.TimedGrant, err error) {
+	defer func(begin time.Time) {
+		if err != nil || len(expired) > 0 {
+			_ = l.logger.Log(
+				"method", "SweepExpiredGrants",
+				"expired", len(expired),
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	expired, err = l.next.SweepExpiredGrants(ctx)
+	return
+}
+
+func (l *loggingService) ListMergeConflicts(ctx context.Context) (conflicts []domain.MergeConflict, err error) {
+	defer func(begin time.Time) {
+		if err != nil {
+			_ = l.logger.Log(
+				"method", "ListMergeConflicts",
+				"took", time.Since(begin),
+				"err", err,
+			)
+		}
+	}(time.Now())
+	conflicts, err = l.next.ListMergeConflicts(ctx)
+	return
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
+	"github.com/rafaceo/go-test-auth/user/service"
+)
+
+// SensitiveGuard проверяет, что выдаваемые права не относятся к чувствительным модулям
+type SensitiveGuard interface {
+	CheckDirectGrant(ctx context.Context, rights map[string][]string) error
+}
+
+// sensitiveGuardService отказывает в прямой выдаче прав чувствительных модулей:
+// их получают только через заявку на доступ
+type sensitiveGuardService struct {
+	guard SensitiveGuard
+	next  service.UserService
+}
+
+func NewSensitiveGuardMiddleware(guard SensitiveGuard, s service.UserService) service.UserService {
+	return &sensitiveGuardService{guard: guard, next: s}
+}
+
+func (g *sensitiveGuardService) CreateUser(ctx context.Context, phone string, passwordHash string) (uuid.UUID, error) {
+	return g.next.CreateUser(ctx, phone, passwordHash)
+}
+
+func (g *sensitiveGuardService) EditUser(ctx context.Context, id uuid.UUID, phone, password string) error {
+	return g.next.EditUser(ctx, id, phone, password)
+}
+
+func (g *sensitiveGuardService) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error) {
+	return g.next.ChangeStatus(ctx, id, status, reason)
+}
+
+func (g *sensitiveGuardService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error {
+	if err := g.guard.CheckDirectGrant(ctx, rights); err != nil {
+		return err
+	}
+	return g.next.GrantRightsToUser(ctx, id, rights, validity)
+}
+
+func (g *sensitiveGuardService) EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
+	if err := g.guard.CheckDirectGrant(ctx, rights); err != nil {
+		return err
+	}
+	return g.next.EditRightsToUser(ctx, id, rights)
+}
+
+func (g *sensitiveGuardService) RevokeRightsFromUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
+	return g.next.RevokeRightsFromUser(ctx, id, rights)
+}
+
+func (g *sensitiveGuardService) GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error) {
+	return g.next.GetUser(ctx, id)
+}
+
+func (g *sensitiveGuardService) ListUsers(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return g.next.ListUsers(ctx, filter)
+}
+
+func (g *sensitiveGuardService) ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) error {
+	return g.next.ExportUsers(ctx, filter, write)
+}
+
+func (g *sensitiveGuardService) GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error) {
+	return g.next.GetUserRights(ctx, id)
+}
+
+func (g *sensitiveGuardService) GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (map[string][]string, error) {
+	return g.next.GetEffectiveRights(ctx, id, merchantID)
+}
+
+func (g *sensitiveGuardService) GetAccess(ctx context.Context, id uuid.UUID) (domain.Access, error) {
+	return g.next.GetAccess(ctx, id)
+}
+
+func (g *sensitiveGuardService) GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (domain.MerchantAccess, error) {
+	return g.next.GetMerchantAccess(ctx, id, merchantID)
+}
+
+func (g *sensitiveGuardService) GetUpcomingExpiries(ctx context.Context, id uuid.UUID) ([]domain.TimedGrant, error) {
+	return g.next.GetUpcomingExpiries(ctx, id)
+}
+
+func (g *sensitiveGuardService) SweepExpiredGrants(ctx context.Context) ([]domain.TimedGrant, error) {
+	return g.next.SweepExpiredGrants(ctx)
+}
+
+func (g *sensitiveGuardService) ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error) {
+	return g.next.ListMergeConflicts(ctx)
+}
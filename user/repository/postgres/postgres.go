@@ -8,7 +8,19 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	identitiesDomain "github.com/rafaceo/go-test-auth/identities/domain"
+	identitiesPostgres "github.com/rafaceo/go-test-auth/identities/repository/postgres"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
+	"github.com/rafaceo/go-test-auth/user/domain"
 	repo "github.com/rafaceo/go-test-auth/user/repository"
+	"sort"
+	"strings"
+	"time"
 )
 
 type userRepository struct {
@@ -19,65 +31,252 @@ func NewUserRepository(db *sqlx.DB) repo.UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) CreateUser(ctx context.Context, phone string, passwordHash string) error {
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM "users" WHERE phone = $1)`
-	err := r.db.GetContext(ctx, &exists, checkQuery, phone)
+// CreateUser заводит пользователя со входом по телефону; source попадает в событие UserRegistered
+func (r *userRepository) CreateUser(ctx context.Context, user domain.User, source string) (uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return err
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	query := `INSERT INTO "users" (id, phone, password_hash, rights, email, first_name, last_name, created_at)
+	          VALUES ($1, $2, $3, '{}', NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NOW())`
+	_, err = tx.ExecContext(ctx, query, id, user.Phone, user.PasswordHash, user.Email, user.FirstName, user.LastName)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return uuid.Nil, domain.ErrUserExists
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := identitiesPostgres.AddPhoneIdentity(ctx, tx, id, user.Phone, user.Email); err != nil {
+		return uuid.Nil, err
 	}
 
-	if exists {
-		return fmt.Errorf("пользователь с таким номером уже существует")
+	payload := outboxDomain.UserRegisteredPayload{UserID: id.String(), Phone: user.Phone, Email: user.Email, Source: source}
+	if err := appendEvent(ctx, tx, outboxDomain.UserRegistered, id, payload); err != nil {
+		return uuid.Nil, err
 	}
 
-	query := `INSERT INTO "users" (id, phone, password_hash, rights, created_at) 
-	          VALUES ($1, $2, $3, $4, NOW())`
-	_, err = r.db.ExecContext(ctx, query, uuid.New(), phone, passwordHash, `{}`)
-	return err
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
 }
 
-func (r *userRepository) EditUser(ctx context.Context, id uuid.UUID, phone, password string) error {
+func (r *userRepository) UserExists(ctx context.Context, phone, email string) (bool, error) {
 	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM "users" WHERE id = $1)`
-	err := r.db.QueryRowContext(ctx, checkQuery, id).Scan(&exists)
+	query := `SELECT EXISTS(SELECT 1 FROM "users" WHERE phone = $1 OR ($2 <> '' AND lower(email) = lower($2)))`
+	err := r.db.GetContext(ctx, &exists, query, phone, email)
+	return exists, err
+}
+
+// GetUserByPhone находит пользователя для входа по паролю: вход по телефону должен быть привязан
+func (r *userRepository) GetUserByPhone(ctx context.Context, phone string) (domain.User, error) {
+	query := userSelect + ` JOIN user_identities i ON i.user_id = u.id AND i.provider = $2 AND i.subject = u.phone
+	          WHERE u.phone = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, phone, identitiesDomain.ProviderPhone))
+}
+
+// GetUserByID — учётная запись для выпуска токенов; профиль для API отдаёт GetUser
+func (r *userRepository) GetUserByID(ctx context.Context, id uuid.UUID) (domain.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, userSelect+` WHERE u.id = $1`, id))
+}
+
+const userSelect = `SELECT u.id, u.phone, u.password_hash, COALESCE(u.email, ''), COALESCE(u.first_name, ''),
+	       COALESCE(u.last_name, ''), u.status, u.created_at FROM "users" u`
+
+func scanUser(row *sql.Row) (domain.User, error) {
+	var user domain.User
+	err := row.Scan(&user.ID, &user.Phone, &user.PasswordHash, &user.Email, &user.FirstName, &user.LastName,
+		&user.Status, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+// EditUser меняет телефон и пароль; вход по телефону переходит на новый телефон
+func (r *userRepository) EditUser(ctx context.Context, id uuid.UUID, phone, password string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if !exists {
+	defer tx.Rollback()
+
+	query := `UPDATE "users" SET phone = $1, password_hash = $2, updated_at = NOW() WHERE id = $3`
+	res, err := tx.ExecContext(ctx, query, phone, password, id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
 		return errors.New("user with given id not found")
 	}
+	if err := identitiesPostgres.SyncPhoneIdentity(ctx, tx, id, phone); err != nil {
+		return err
+	}
 
-	query := `UPDATE "users" SET phone = $1, password_hash = $2 WHERE id = $3`
-	_, err = r.db.ExecContext(ctx, query, phone, password, id)
-	return err
+	return tx.Commit()
 }
-func (r *userRepository) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
-	rightsJSON, err := json.Marshal(rights)
+
+// ChangeStatus переводит пользователя в status, если переход допустим из текущего статуса.
+// При уходе из active сессия завершается в той же транзакции. Автор смены — подтверждённый
+// инициатор (requestinfo.VerifiedActor).
+func (r *userRepository) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return err
+		return domain.StatusChange{}, err
+	}
+	defer tx.Rollback()
+
+	changedBy := requestinfo.VerifiedActor(ctx)
+	if changedBy == "" {
+		return domain.StatusChange{}, errors.New("status change author is not authenticated")
+	}
+
+	change := domain.StatusChange{UserID: id, To: status, Reason: reason, ChangedBy: changedBy, ChangedAt: time.Now().UTC()}
+	var refreshToken sql.NullString
+	query := `SELECT status, refresh_token FROM "users" WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&change.From, &refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.StatusChange{}, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return domain.StatusChange{}, err
+	}
+	if err := domain.CheckTransition(change.From, status); err != nil {
+		return domain.StatusChange{}, err
+	}
+	change.SessionRevoked = status != domain.StatusActive && refreshToken.String != ""
+
+	query = `UPDATE "users"
+	         SET status = $2, status_reason = $3, status_changed_at = $4, status_changed_by = $5, updated_at = $4,
+	             refresh_token = CASE WHEN $2 = $6 THEN refresh_token END
+	         WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, id, status, reason, change.ChangedAt, change.ChangedBy, domain.StatusActive)
+	if err != nil {
+		return domain.StatusChange{}, err
+	}
+
+	changed := outboxDomain.UserStatusChangedPayload{UserID: id.String(), From: change.From, To: status, Reason: reason}
+	if err := appendEvent(ctx, tx, outboxDomain.UserStatusChanged, id, changed); err != nil {
+		return domain.StatusChange{}, err
+	}
+	if change.SessionRevoked {
+		revoked := outboxDomain.SessionRevokedPayload{UserID: id.String(), Reason: status}
+		if err := appendEvent(ctx, tx, outboxDomain.SessionRevoked, id, revoked); err != nil {
+			return domain.StatusChange{}, err
+		}
 	}
 
-	// Запрос обновления прав, если текущие права NULL или пустые
-	query := `
-		UPDATE "users" 
-		SET rights = $1 
-		WHERE id = $2 AND (rights IS NULL OR rights::text = '{}')`
+	if err := tx.Commit(); err != nil {
+		return domain.StatusChange{}, err
+	}
+	return change, nil
+}
 
-	res, err := r.db.ExecContext(ctx, query, rightsJSON, id)
+// GrantRightsToUser добавляет права к уже выданным. При заданном сроке действия он сохраняется
+// для каждой пары module/action, бессрочная выдача снимает ранее установленный срок.
+func (r *userRepository) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
+	var currentRightsJSON []byte
+	err = tx.QueryRowContext(ctx, `SELECT rights FROM "users" WHERE id = $1 FOR UPDATE`, id).Scan(&currentRightsJSON)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("user not found")
+		}
 		return err
 	}
-	if rowsAffected == 0 {
-		return errors.New("user already has rights, update denied")
+
+	currentRights := make(map[string][]string)
+	if len(currentRightsJSON) > 0 {
+		if err := json.Unmarshal(currentRightsJSON, &currentRights); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	// Срок пишется только для новых действий и действий, уже выданных на срок: бессрочное
+	// действие срочная выдача сократила бы
+	bounded := make(map[string]bool)
+	if validity.Bounded() {
+		var rows []struct {
+			Module string `db:"module"`
+			Action string `db:"action"`
+		}
+		query := `SELECT module, action FROM users_rights_validity WHERE user_id = $1`
+		if err := tx.SelectContext(ctx, &rows, query, id); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			bounded[row.Module+":"+row.Action] = true
+		}
+
+		var permanent []string
+		for section, perms := range rights {
+			for _, perm := range perms {
+				if contains(currentRights[section], perm) && !bounded[section+":"+perm] {
+					permanent = append(permanent, section+":"+perm)
+				}
+			}
+		}
+		if len(permanent) > 0 {
+			sort.Strings(permanent)
+			return fmt.Errorf("%w: %s", rightsDomain.ErrPermanentGrant, strings.Join(permanent, ", "))
+		}
+	}
+
+	for section, perms := range rights {
+		for _, perm := range perms {
+			if !contains(currentRights[section], perm) {
+				currentRights[section] = append(currentRights[section], perm)
+			}
+
+			if validity.Bounded() {
+				query := `INSERT INTO users_rights_validity (user_id, module, action, valid_from, valid_until)
+				          VALUES ($1, $2, $3, $4, $5)
+				          ON CONFLICT (user_id, module, action)
+				          DO UPDATE SET valid_from = EXCLUDED.valid_from, valid_until = EXCLUDED.valid_until`
+				_, err = tx.ExecContext(ctx, query, id, section, perm, validity.ValidFrom, validity.ValidUntil)
+			} else {
+				query := `DELETE FROM users_rights_validity WHERE user_id = $1 AND module = $2 AND action = $3`
+				_, err = tx.ExecContext(ctx, query, id, section, perm)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	rightsJSON, err := json.Marshal(currentRights)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE "users" SET rights = $1 WHERE id = $2`, rightsJSON, id); err != nil {
+		return err
+	}
+
+	payload := outboxDomain.RightsGrantedPayload{
+		UserID:     id.String(),
+		Rights:     rights,
+		ValidFrom:  validity.ValidFrom,
+		ValidUntil: validity.ValidUntil,
+	}
+	if err := appendEvent(ctx, tx, outboxDomain.RightsGranted, id, payload); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userRepository) EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
@@ -86,29 +285,59 @@ func (r *userRepository) EditRightsToUser(ctx context.Context, id uuid.UUID, rig
 		return err
 	}
 
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM "users" WHERE id = $1)`
-	err = r.db.QueryRowContext(ctx, checkQuery, id).Scan(&exists)
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.New("user rights with given id not found")
+	defer tx.Rollback()
+
+	currentRights, err := getRightsForUpdate(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("user rights with given id not found")
+		}
+		return err
 	}
 
 	query := `UPDATE "users" SET rights = $1 WHERE id = $2`
-	_, err = r.db.ExecContext(ctx, query, rightsJSON, id)
+	_, err = tx.ExecContext(ctx, query, rightsJSON, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Сроки действия остаются только у прав, которые сохранились после замены
+	query = `DELETE FROM users_rights_validity
+	         WHERE user_id = $1
+	           AND NOT COALESCE(($2::jsonb -> module) ? action, false)`
+	if _, err := tx.ExecContext(ctx, query, id, rightsJSON); err != nil {
+		return err
+	}
+
+	diff := rightsDomain.DiffRights(currentRights, rights)
+	if len(diff.Added) > 0 {
+		payload := outboxDomain.RightsGrantedPayload{UserID: id.String(), Rights: diff.Added}
+		if err := appendEvent(ctx, tx, outboxDomain.RightsGranted, id, payload); err != nil {
+			return err
+		}
+	}
+	if len(diff.Removed) > 0 {
+		payload := outboxDomain.RightsRevokedPayload{UserID: id.String(), Rights: diff.Removed, Reason: outboxDomain.RevokeReasonReplaced}
+		if err := appendEvent(ctx, tx, outboxDomain.RightsRevoked, id, payload); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (r *userRepository) RevokeRightsFromUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
-	var currentRightsJSON []byte
-	query := `SELECT rights FROM "users" WHERE id = $1`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&currentRightsJSON)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	currentRights, err := getRightsForUpdate(ctx, tx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return errors.New("user rights with given id not found")
@@ -116,21 +345,19 @@ func (r *userRepository) RevokeRightsFromUser(ctx context.Context, id uuid.UUID,
 		return err
 	}
 
-	currentRights := make(map[string][]string)
-	if len(currentRightsJSON) > 0 {
-		if err := json.Unmarshal(currentRightsJSON, &currentRights); err != nil {
-			return err
-		}
+	updatedRights := make(map[string][]string, len(currentRights))
+	for section, perms := range currentRights {
+		updatedRights[section] = perms
 	}
 
 	for section, perms := range rights {
-		existingPerms, exists := currentRights[section]
+		existingPerms, exists := updatedRights[section]
 		if !exists {
 			return fmt.Errorf("section %s does not exist", section) // Ошибка, если секции нет
 		}
 
 		if len(perms) == 0 {
-			delete(currentRights, section)
+			delete(updatedRights, section)
 			continue
 		}
 
@@ -149,43 +376,246 @@ func (r *userRepository) RevokeRightsFromUser(ctx context.Context, id uuid.UUID,
 		}
 
 		if len(newPerms) == 0 {
-			delete(currentRights, section)
+			delete(updatedRights, section)
 		} else {
-			currentRights[section] = newPerms
+			updatedRights[section] = newPerms
 		}
 	}
 
-	updatedRightsJSON, err := json.Marshal(currentRights)
+	updatedRightsJSON, err := json.Marshal(updatedRights)
 	if err != nil {
 		return err
 	}
 
 	updateQuery := `UPDATE "users" SET rights = $1 WHERE id = $2`
-	_, err = r.db.ExecContext(ctx, updateQuery, updatedRightsJSON, id)
-	return err
+	if _, err := tx.ExecContext(ctx, updateQuery, updatedRightsJSON, id); err != nil {
+		return err
+	}
+
+	validityQuery := `DELETE FROM users_rights_validity
+	                  WHERE user_id = $1
+	                    AND NOT COALESCE(($2::jsonb -> module) ? action, false)`
+	if _, err := tx.ExecContext(ctx, validityQuery, id, updatedRightsJSON); err != nil {
+		return err
+	}
+
+	if removed := rightsDomain.DiffRights(currentRights, updatedRights).Removed; len(removed) > 0 {
+		payload := outboxDomain.RightsRevokedPayload{UserID: id.String(), Rights: removed, Reason: outboxDomain.RevokeReasonRevoked}
+		if err := appendEvent(ctx, tx, outboxDomain.RightsRevoked, id, payload); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (r *userRepository) GetUser(ctx context.Context, id uuid.UUID) (string, string, string, string, error) {
-	// Проверяем, что переданный UUID корректный
-	if id == uuid.Nil {
-		return "", "", "", "", fmt.Errorf("invalid UUID: cannot be empty")
+// profileSelect читает пользователя вместе с именами назначенных ролей и мерчантами контекстов
+const profileSelect = `SELECT u.id, u.phone, COALESCE(u.email, ''), u.status, u.status_reason, u.status_changed_at,
+	       u.created_at, u.updated_at,
+	       ARRAY(SELECT DISTINCT r.role_name FROM users_roles ur JOIN roles r ON r.role_id = ur.role_id
+	             WHERE ur.user_id = u.id ORDER BY r.role_name),
+	       ARRAY(SELECT uc.merchant_id FROM users_contexts uc
+	             WHERE uc.user_id = u.id AND uc.merchant_id <> '' ORDER BY uc.merchant_id),
+	       EXISTS(SELECT 1 FROM users_contexts uc WHERE uc.user_id = u.id AND uc.global)
+	FROM "users" u`
+
+// userSorts — допустимые сортировки: столбец ключа и условие продолжения после курсора
+var userSorts = map[string]struct{ order, after string }{
+	domain.SortCreatedAsc:  {"u.created_at, u.id", "(u.created_at, u.id) > ($11::timestamp, $12::uuid)"},
+	domain.SortCreatedDesc: {"u.created_at DESC, u.id DESC", "(u.created_at, u.id) < ($11::timestamp, $12::uuid)"},
+	domain.SortPhoneAsc:    {"u.phone, u.id", "(u.phone, u.id) > ($11::text, $12::uuid)"},
+	domain.SortPhoneDesc:   {"u.phone DESC, u.id DESC", "(u.phone, u.id) < ($11::text, $12::uuid)"},
+}
+
+func (r *userRepository) GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error) {
+	rows, err := r.db.QueryContext(ctx, profileSelect+` WHERE u.id = $1`, id)
+	if err != nil {
+		return domain.Profile{}, fmt.Errorf("database error: %w", err)
+	}
+	profiles, err := scanProfiles(rows)
+	if err != nil {
+		return domain.Profile{}, fmt.Errorf("database error: %w", err)
 	}
+	if len(profiles) == 0 {
+		return domain.Profile{}, domain.ErrUserNotFound
+	}
+	return profiles[0], nil
+}
 
-	query := `SELECT phone, password_hash, created_at, updated_at FROM "users" WHERE id = $1`
+// ListUsers ищет пользователей по фильтру в порядке filter.Sort; after продолжает выборку после курсора.
+// Право учитывается, если оно действует сейчас напрямую или через действующее назначение роли.
+func (r *userRepository) ListUsers(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Profile, error) {
+	sort, ok := userSorts[filter.Sort]
+	if !ok {
+		return nil, domain.ErrInvalidSort
+	}
 
-	var phone, passwordHash, createdAt, updatedAt string
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&phone, &passwordHash, &createdAt, &updatedAt)
+	var module, action string
+	if filter.Right != "" {
+		module, action, _ = strings.Cut(filter.Right, ":")
+	}
+
+	query := profileSelect + `
+	WHERE ($1::text = '' OR u.phone LIKE $1::text)
+	  AND ($2::text = '' OR lower(u.email) LIKE lower($2::text))
+	  AND ($3::text = '' OR EXISTS(
+	          SELECT 1 FROM users_roles ur JOIN roles r ON r.role_id = ur.role_id
+	          WHERE ur.user_id = u.id AND r.role_name = $3::text))
+	  AND ($4::text = '' OR (u.rights -> $4::text) @> to_jsonb($5::text) AND NOT EXISTS(
+	              SELECT 1 FROM users_rights_validity v
+	              WHERE v.user_id = u.id AND v.module = $4::text AND v.action = $5::text
+	                AND (v.valid_from > $10::timestamp OR v.valid_until <= $10::timestamp))
+	       OR EXISTS(
+	              SELECT 1 FROM users_roles ur JOIN roles r ON r.role_id = ur.role_id
+	              WHERE ur.user_id = u.id AND (r.rights -> $4::text) @> to_jsonb($5::text)
+	                AND (ur.valid_from IS NULL OR ur.valid_from <= $10::timestamp)
+	                AND (ur.valid_until IS NULL OR ur.valid_until > $10::timestamp)))
+	  AND ($6::text = '' OR EXISTS(
+	          SELECT 1 FROM users_contexts uc WHERE uc.user_id = u.id AND uc.merchant_id = $6::text))
+	  AND ($7::text = '' OR u.status = $7::text)
+	  AND ($8::timestamp IS NULL OR u.created_at >= $8::timestamp)
+	  AND ($9::timestamp IS NULL OR u.created_at < $9::timestamp)
+	  AND ($12::uuid IS NULL OR ` + sort.after + `)
+	ORDER BY ` + sort.order + `
+	LIMIT $13`
+
+	var afterKey *string
+	var afterID *uuid.UUID
+	if after != nil {
+		afterKey, afterID = &after.Key, &after.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, likePrefix(filter.PhonePrefix), likePrefix(filter.EmailPrefix),
+		filter.Role, module, action, filter.MerchantID, filter.Status, filter.CreatedFrom, filter.CreatedUntil,
+		time.Now().UTC(), afterKey, afterID, limit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", "", "", "", fmt.Errorf("user not found")
+		return nil, err
+	}
+	return scanProfiles(rows)
+}
+
+func scanProfiles(rows *sql.Rows) ([]domain.Profile, error) {
+	defer rows.Close()
+
+	profiles := []domain.Profile{}
+	for rows.Next() {
+		var p domain.Profile
+		err := rows.Scan(&p.ID, &p.Phone, &p.Email, &p.Status, &p.StatusReason, &p.StatusChangedAt,
+			&p.CreatedAt, &p.UpdatedAt, pq.Array(&p.Roles), pq.Array(&p.Merchants), &p.Global)
+		if err != nil {
+			return nil, err
 		}
-		return "", "", "", "", fmt.Errorf("database error: %w", err)
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// GetExportDetails дополняет страницу поиска данными для выгрузки доступа: именами, прямыми правами
+// со сроками действия и назначениями ролей. Порядок записей совпадает с порядком profiles.
+func (r *userRepository) GetExportDetails(ctx context.Context, profiles []domain.Profile) ([]domain.ExportRecord, error) {
+	records := make([]domain.ExportRecord, len(profiles))
+	byID := make(map[uuid.UUID]*domain.ExportRecord, len(profiles))
+	ids := make([]uuid.UUID, len(profiles))
+	for i, p := range profiles {
+		records[i] = domain.ExportRecord{
+			ID:        p.ID,
+			Phone:     p.Phone,
+			Email:     p.Email,
+			Status:    p.Status,
+			Global:    p.Global,
+			Merchants: p.Merchants,
+			Rights:    []domain.RightGrant{},
+			Roles:     []domain.RoleGrant{},
+			CreatedAt: p.CreatedAt,
+			UpdatedAt: p.UpdatedAt,
+		}
+		byID[p.ID] = &records[i]
+		ids[i] = p.ID
+	}
+	if len(ids) == 0 {
+		return records, nil
 	}
 
-	return phone, passwordHash, createdAt, updatedAt, nil
+	namesQuery := `SELECT id, COALESCE(first_name, ''), COALESCE(last_name, '') FROM "users" WHERE id = ANY($1)`
+	err := r.scanEach(ctx, namesQuery, ids, func(rows *sql.Rows) error {
+		var id uuid.UUID
+		var first, last string
+		if err := rows.Scan(&id, &first, &last); err != nil {
+			return err
+		}
+		byID[id].FirstName, byID[id].LastName = first, last
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rightsQuery := `SELECT u.id, m.module, a.action, v.valid_from, v.valid_until
+	                FROM "users" u
+	                CROSS JOIN LATERAL jsonb_each(u.rights) m(module, actions)
+	                CROSS JOIN LATERAL jsonb_array_elements_text(
+	                    CASE WHEN jsonb_typeof(m.actions) = 'array' THEN m.actions ELSE '[]'::jsonb END) a(action)
+	                LEFT JOIN users_rights_validity v ON v.user_id = u.id AND v.module = m.module AND v.action = a.action
+	                WHERE u.id = ANY($1) AND jsonb_typeof(u.rights) = 'object'
+	                ORDER BY u.id, m.module, a.action`
+	err = r.scanEach(ctx, rightsQuery, ids, func(rows *sql.Rows) error {
+		var id uuid.UUID
+		var grant domain.RightGrant
+		if err := rows.Scan(&id, &grant.Module, &grant.Action, &grant.ValidFrom, &grant.ValidUntil); err != nil {
+			return err
+		}
+		byID[id].Rights = append(byID[id].Rights, grant)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rolesQuery := `SELECT ur.user_id, r.role_name, COALESCE(ur.merchant_id, ''), ur.valid_from, ur.valid_until
+	               FROM users_roles ur JOIN roles r ON r.role_id = ur.role_id
+	               WHERE ur.user_id = ANY($1)
+	               ORDER BY ur.user_id, r.role_name, ur.merchant_id NULLS FIRST`
+	err = r.scanEach(ctx, rolesQuery, ids, func(rows *sql.Rows) error {
+		var id uuid.UUID
+		var grant domain.RoleGrant
+		if err := rows.Scan(&id, &grant.Role, &grant.MerchantID, &grant.ValidFrom, &grant.ValidUntil); err != nil {
+			return err
+		}
+		byID[id].Roles = append(byID[id].Roles, grant)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r *userRepository) scanEach(ctx context.Context, query string, ids []uuid.UUID, scan func(rows *sql.Rows) error) error {
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// likePrefix превращает префикс в шаблон LIKE, экранируя его спецсимволы; пустой префикс остаётся пустым
+func likePrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
 }
 
-func (r *userRepository) GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error) {
+// GetUserRights возвращает прямые права пользователя, действующие на момент at
+func (r *userRepository) GetUserRights(ctx context.Context, id uuid.UUID, at time.Time) (map[string][]string, error) {
 	query := `SELECT rights FROM "users" WHERE id = $1`
 
 	var rightsJSON []byte
@@ -207,5 +637,321 @@ func (r *userRepository) GetUserRights(ctx context.Context, id uuid.UUID) (map[s
 		rights = make(map[string][]string) // Если пусто, возвращаем пустую мапу
 	}
 
+	// Убираем права, срок действия которых ещё не начался или уже истёк
+	inactiveQuery := `SELECT module, action FROM users_rights_validity
+	                  WHERE user_id = $1
+	                    AND ((valid_from IS NOT NULL AND valid_from > $2)
+	                      OR (valid_until IS NOT NULL AND valid_until <= $2))`
+	rows, err := r.db.QueryContext(ctx, inactiveQuery, id, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var module, action string
+		if err := rows.Scan(&module, &action); err != nil {
+			return nil, err
+		}
+		rights[module] = remove(rights[module], action)
+		if len(rights[module]) == 0 {
+			delete(rights, module)
+		}
+	}
+
+	return rights, rows.Err()
+}
+
+// GetUserRoleRights возвращает права ролей, назначение которых действует на момент at у мерчанта merchantID.
+// Назначение у мерчанта действует и у его потомков; назначения без мерчанта и в глобальном контексте
+// действуют у любого мерчанта, пустой merchantID — только они.
+func (r *userRepository) GetUserRoleRights(ctx context.Context, id uuid.UUID, merchantID string, at time.Time) ([]map[string][]string, error) {
+	query := `SELECT r.rights
+	          FROM users_roles ur
+	          JOIN roles r ON r.role_id = ur.role_id
+	          LEFT JOIN users_contexts uc ON uc.user_id = ur.user_id AND uc.merchant_id = ur.merchant_id
+	          WHERE ur.user_id = $1
+	            AND (ur.merchant_id IS NULL OR uc.global OR ur.merchant_id IN (
+	                    SELECT ancestor_id FROM merchant_access_paths WHERE merchant_id = $3::text))
+	            AND (ur.valid_from IS NULL OR ur.valid_from <= $2)
+	            AND (ur.valid_until IS NULL OR ur.valid_until > $2)`
+
+	rows, err := r.db.QueryContext(ctx, query, id, at, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []map[string][]string
+	for rows.Next() {
+		var rightsJSON []byte
+		if err := rows.Scan(&rightsJSON); err != nil {
+			return nil, err
+		}
+
+		var rights map[string][]string
+		if err := json.Unmarshal(rightsJSON, &rights); err != nil {
+			return nil, fmt.Errorf("failed to parse role rights JSON: %v", err)
+		}
+		result = append(result, rights)
+	}
+
+	return result, rows.Err()
+}
+
+// GetUserMerchants возвращает мерчантов, доступных через контексты пользователя вместе с их потомками,
+// и признак глобального контекста. Приостановленные поддеревья не возвращаются.
+func (r *userRepository) GetUserMerchants(ctx context.Context, id uuid.UUID) ([]string, bool, error) {
+	var global bool
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(bool_or(global), FALSE) FROM users_contexts WHERE user_id = $1`, id).
+		Scan(&global)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `SELECT DISTINCT p.merchant_id
+	          FROM users_contexts uc
+	          JOIN merchant_access_paths p ON p.ancestor_id = uc.merchant_id
+	          WHERE uc.user_id = $1
+	          ORDER BY p.merchant_id`
+
+	var merchants []string
+	if err := r.db.SelectContext(ctx, &merchants, query, id); err != nil {
+		return nil, false, err
+	}
+
+	return merchants, global, nil
+}
+
+// HasMerchantAccess проверяет, доступен ли мерчант пользователю: через контекст этого мерчанта или
+// его предка либо через глобальный контекст. Второе значение — признак глобального контекста.
+// Мерчант в приостановленном поддереве недоступен никому.
+func (r *userRepository) HasMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (bool, bool, error) {
+	query := `SELECT EXISTS(
+	                 SELECT 1 FROM merchant_access_paths p
+	                 WHERE p.merchant_id = $2
+	                   AND EXISTS(SELECT 1 FROM users_contexts uc
+	                              WHERE uc.user_id = $1 AND (uc.global OR uc.merchant_id = p.ancestor_id))),
+	                 COALESCE((SELECT bool_or(global) FROM users_contexts WHERE user_id = $1), FALSE)`
+
+	var ok, global bool
+	if err := r.db.QueryRowContext(ctx, query, id, merchantID).Scan(&ok, &global); err != nil {
+		return false, false, err
+	}
+	return ok, global, nil
+}
+
+// GetTimedGrants возвращает права и назначения ролей пользователя, срок которых истекает позже after
+func (r *userRepository) GetTimedGrants(ctx context.Context, id uuid.UUID, after time.Time) ([]domain.TimedGrant, error) {
+	query := `SELECT user_id, 'right', module, action, 0, '', '', valid_from, valid_until
+	          FROM users_rights_validity
+	          WHERE user_id = $1 AND valid_until > $2
+	          UNION ALL
+	          SELECT ur.user_id, 'role', '', '', ur.role_id, r.role_name, COALESCE(ur.merchant_id, ''), ur.valid_from, ur.valid_until
+	          FROM users_roles ur
+	          JOIN roles r ON r.role_id = ur.role_id
+	          WHERE ur.user_id = $1 AND ur.valid_until > $2
+	          ORDER BY 9`
+
+	rows, err := r.db.QueryContext(ctx, query, id, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTimedGrants(rows)
+}
+
+// DeleteExpiredGrants удаляет из users.rights и users_roles всё, что истекло к моменту at
+func (r *userRepository) DeleteExpiredGrants(ctx context.Context, at time.Time) ([]domain.TimedGrant, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM users_rights_validity
+		WHERE valid_until <= $1
+		RETURNING user_id, 'right', module, action, 0, '', '', valid_from, valid_until`, at)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := scanTimedGrants(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, grant := range expired {
+		// Удаляем действие из массива модуля, а опустевший модуль — целиком
+		query := `UPDATE "users"
+		          SET rights = CASE
+		              WHEN jsonb_array_length(COALESCE(rights -> $2::text, '[]'::jsonb) - $3::text) = 0 THEN rights - $2::text
+		              ELSE jsonb_set(rights, ARRAY[$2::text], (rights -> $2::text) - $3::text)
+		          END
+		          WHERE id = $1 AND rights ? $2::text`
+		if _, err := tx.ExecContext(ctx, query, grant.UserID, grant.Module, grant.Action); err != nil {
+			return nil, err
+		}
+	}
+
+	roleRows, err := tx.QueryContext(ctx, `
+		WITH deleted AS (
+			DELETE FROM users_roles
+			WHERE valid_until <= $1
+			RETURNING user_id, role_id, merchant_id, valid_from, valid_until
+		)
+		SELECT d.user_id, 'role', '', '', d.role_id, COALESCE(r.role_name, ''), COALESCE(d.merchant_id, ''), d.valid_from, d.valid_until
+		FROM deleted d
+		LEFT JOIN roles r ON r.role_id = d.role_id`, at)
+	if err != nil {
+		return nil, err
+	}
+	expiredRoles, err := scanTimedGrants(roleRows)
+	roleRows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := appendExpiryEvents(ctx, tx, expired, expiredRoles); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return append(expired, expiredRoles...), nil
+}
+
+// ListMergeConflicts возвращает отчёт об объединении users_profiles с users
+func (r *userRepository) ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error) {
+	query := `SELECT id, kind, profile_id, user_id, phone, email, resolution, created_at
+	          FROM users_merge_conflicts ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []domain.MergeConflict{}
+	for rows.Next() {
+		var c domain.MergeConflict
+		if err := rows.Scan(&c.ID, &c.Kind, &c.ProfileID, &c.UserID, &c.Phone, &c.Email, &c.Resolution, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// appendExpiryEvents пишет один RightsRevoked на пользователя и RoleChanged на каждое истёкшее назначение роли
+func appendExpiryEvents(ctx context.Context, tx *sqlx.Tx, expiredRights, expiredRoles []domain.TimedGrant) error {
+	var userIDs []uuid.UUID
+	revoked := make(map[uuid.UUID]map[string][]string)
+	for _, grant := range expiredRights {
+		if revoked[grant.UserID] == nil {
+			revoked[grant.UserID] = make(map[string][]string)
+			userIDs = append(userIDs, grant.UserID)
+		}
+		revoked[grant.UserID][grant.Module] = append(revoked[grant.UserID][grant.Module], grant.Action)
+	}
+
+	for _, userID := range userIDs {
+		payload := outboxDomain.RightsRevokedPayload{UserID: userID.String(), Rights: revoked[userID], Reason: outboxDomain.RevokeReasonExpired}
+		if err := appendEvent(ctx, tx, outboxDomain.RightsRevoked, userID, payload); err != nil {
+			return err
+		}
+	}
+
+	for _, grant := range expiredRoles {
+		var rightsJSON []byte
+		err := tx.QueryRowContext(ctx, `SELECT rights FROM roles WHERE role_id = $1`, grant.RoleID).Scan(&rightsJSON)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		payload := outboxDomain.RoleChangedPayload{
+			RoleID:     grant.RoleID,
+			RoleName:   grant.RoleName,
+			Change:     outboxDomain.RoleAssignmentExpired,
+			UserID:     grant.UserID.String(),
+			MerchantID: grant.MerchantID,
+			ValidFrom:  grant.ValidFrom,
+			ValidUntil: grant.ValidUntil,
+			Modules:    rolesPostgres.RightsModules(rightsJSON),
+		}
+		if err := rolesPostgres.AppendRoleEvent(ctx, tx, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
+}
+
+func getRightsForUpdate(ctx context.Context, tx *sqlx.Tx, id uuid.UUID) (map[string][]string, error) {
+	var rightsJSON []byte
+	if err := tx.QueryRowContext(ctx, `SELECT rights FROM "users" WHERE id = $1 FOR UPDATE`, id).Scan(&rightsJSON); err != nil {
+		return nil, err
+	}
+
+	rights := make(map[string][]string)
+	if len(rightsJSON) > 0 {
+		if err := json.Unmarshal(rightsJSON, &rights); err != nil {
+			return nil, err
+		}
+	}
 	return rights, nil
 }
+
+func scanTimedGrants(rows *sql.Rows) ([]domain.TimedGrant, error) {
+	var grants []domain.TimedGrant
+	for rows.Next() {
+		var grant domain.TimedGrant
+		var validFrom, validUntil sql.NullTime
+
+		err := rows.Scan(&grant.UserID, &grant.Kind, &grant.Module, &grant.Action, &grant.RoleID, &grant.RoleName,
+			&grant.MerchantID, &validFrom, &validUntil)
+		if err != nil {
+			return nil, err
+		}
+		if validFrom.Valid {
+			grant.ValidFrom = &validFrom.Time
+		}
+		if validUntil.Valid {
+			grant.ValidUntil = &validUntil.Time
+		}
+
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
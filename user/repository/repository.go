@@ -3,14 +3,29 @@ package repository
 import (
 	"context"
 	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
+	"time"
 )
 
 type UserRepository interface {
-	CreateUser(ctx context.Context, phone string, passwordHash string) error
+	CreateUser(ctx context.Context, user domain.User, source string) (uuid.UUID, error)
+	UserExists(ctx context.Context, phone, email string) (bool, error)
+	GetUserByPhone(ctx context.Context, phone string) (domain.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (domain.User, error)
 	EditUser(ctx context.Context, id uuid.UUID, phone, password string) error
-	GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
+	ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error)
+	GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error
 	EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
 	RevokeRightsFromUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
-	GetUser(ctx context.Context, id uuid.UUID) (string, string, string, string, error)
-	GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error)
+	GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error)
+	ListUsers(ctx context.Context, filter domain.Filter, after *domain.Cursor, limit int) ([]domain.Profile, error)
+	GetExportDetails(ctx context.Context, profiles []domain.Profile) ([]domain.ExportRecord, error)
+	GetUserRights(ctx context.Context, id uuid.UUID, at time.Time) (map[string][]string, error)
+	GetUserRoleRights(ctx context.Context, id uuid.UUID, merchantID string, at time.Time) ([]map[string][]string, error)
+	GetUserMerchants(ctx context.Context, id uuid.UUID) ([]string, bool, error)
+	HasMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (bool, bool, error)
+	GetTimedGrants(ctx context.Context, id uuid.UUID, after time.Time) ([]domain.TimedGrant, error)
+	DeleteExpiredGrants(ctx context.Context, at time.Time) ([]domain.TimedGrant, error)
+	ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error)
 }
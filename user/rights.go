@@ -3,7 +3,12 @@ package user
 import (
 	"github.com/go-kit/kit/log"
 	"github.com/jmoiron/sqlx"
+	accessPostgres "github.com/rafaceo/go-test-auth/access_requests/repository/postgres"
+	accessService "github.com/rafaceo/go-test-auth/access_requests/service"
+	"github.com/rafaceo/go-test-auth/audit"
 	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	rightsPostgres "github.com/rafaceo/go-test-auth/rights/repository/postgres"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
 	"github.com/rafaceo/go-test-auth/user/middleware"
 	"github.com/rafaceo/go-test-auth/user/repository/postgres"
 	"github.com/rafaceo/go-test-auth/user/service"
@@ -14,7 +19,11 @@ type ServiceFactory struct{}
 func (sf *ServiceFactory) CreateUserService(logger log.Logger, postgresClient *sqlx.DB) service.UserService {
 	userRepo := postgres.NewUserRepository(postgresClient)
 
-	userServ := service.NewUserService(userRepo)
+	rightsServ := rightsService.NewRightsService(rightsPostgres.NewPostgresRightsRepository(postgresClient))
+
+	userServ := service.NewUserService(userRepo, rightsServ)
+	userServ = middleware.NewSensitiveGuardMiddleware(accessService.NewSensitiveGuard(accessPostgres.NewAccessRequestRepository(postgresClient)), userServ)
+	userServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), userServ)
 	userServ = middleware.NewLoggingMiddleware(log.With(logger, "component", "users"), userServ)
 
 	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("user_service")
@@ -22,3 +31,11 @@ func (sf *ServiceFactory) CreateUserService(logger log.Logger, postgresClient *s
 
 	return userServ
 }
+
+// CreateAccessResolver собирает сервис для расчёта прав в клеймах токенов. Метрики user_service
+// уже зарегистрированы CreateUserService, поэтому здесь только логирование.
+func (sf *ServiceFactory) CreateAccessResolver(logger log.Logger, postgresClient *sqlx.DB) service.UserService {
+	rightsServ := rightsService.NewRightsService(rightsPostgres.NewPostgresRightsRepository(postgresClient))
+	userServ := service.NewUserService(postgres.NewUserRepository(postgresClient), rightsServ)
+	return middleware.NewLoggingMiddleware(log.With(logger, "component", "access_resolver"), userServ)
+}
@@ -4,49 +4,62 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
+	"github.com/rafaceo/go-test-auth/user/domain"
 	"github.com/rafaceo/go-test-auth/user/repository"
 	"golang.org/x/crypto/bcrypt"
 	"log"
-	"regexp"
 	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+	// exportBatchSize — сколько пользователей выгрузки читается из базы за раз
+	exportBatchSize = 500
 )
 
 type UserService interface {
-	CreateUser(ctx context.Context, phone string, passwordHash string) error
+	CreateUser(ctx context.Context, phone string, passwordHash string) (uuid.UUID, error)
 	EditUser(ctx context.Context, id uuid.UUID, phone, password string) error
-	GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
+	ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error)
+	GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error
 	EditRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
 	RevokeRightsFromUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error
-	GetUser(ctx context.Context, id uuid.UUID) (string, string, string, string, error)
+	GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error)
+	ListUsers(ctx context.Context, filter domain.Filter) (domain.Page, error)
+	ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) error
 	GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error)
+	GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (map[string][]string, error)
+	GetAccess(ctx context.Context, id uuid.UUID) (domain.Access, error)
+	GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (domain.MerchantAccess, error)
+	GetUpcomingExpiries(ctx context.Context, id uuid.UUID) ([]domain.TimedGrant, error)
+	SweepExpiredGrants(ctx context.Context) ([]domain.TimedGrant, error)
+	ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error)
 }
 
 type userService struct {
 	repo      repository.UserRepository
+	rights    rightsService.RightsService
 	jwtSecret string
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
-	return &userService{repo: repo}
+func NewUserService(repo repository.UserRepository, rights rightsService.RightsService) UserService {
+	return &userService{repo: repo, rights: rights}
 }
 
-func (s *userService) CreateUser(ctx context.Context, phone string, passwordHash string) error {
-	re := regexp.MustCompile(`^\+?\d{10,}$`)
-	if !re.MatchString(phone) {
-		return errors.New("invalid phone number: must contain only digits, optionally start with '+', and have at least 10 digits")
+func (s *userService) CreateUser(ctx context.Context, phone string, passwordHash string) (uuid.UUID, error) {
+	if err := domain.ValidatePhone(phone); err != nil {
+		return uuid.Nil, err
 	}
-	strings.ReplaceAll(phone, " ", "")
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordHash), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return uuid.Nil, err
 	}
 
-	err = s.repo.CreateUser(ctx, phone, string(hashedPassword))
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s.repo.CreateUser(ctx, domain.User{Phone: phone, PasswordHash: string(hashedPassword)}, "admin")
 }
 
 func (s *userService) EditUser(ctx context.Context, id uuid.UUID, phone, password string) error {
@@ -55,11 +68,9 @@ func (s *userService) EditUser(ctx context.Context, id uuid.UUID, phone, passwor
 		return errors.New("phone and password cannot be empty")
 	}
 
-	re := regexp.MustCompile(`^\+?\d{10,}$`)
-	if !re.MatchString(phone) {
-		return errors.New("invalid phone number: must contain only digits, optionally start with '+', and have at least 10 digits")
+	if err := domain.ValidatePhone(phone); err != nil {
+		return err
 	}
-	strings.ReplaceAll(phone, " ", "")
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -76,12 +87,32 @@ func (s *userService) EditUser(ctx context.Context, id uuid.UUID, phone, passwor
 	return nil
 }
 
-func (s *userService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string) error {
+func (s *userService) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason string) (domain.StatusChange, error) {
+	if !domain.ValidStatus(status) {
+		return domain.StatusChange{}, domain.ErrInvalidStatus
+	}
+	reason = strings.TrimSpace(reason)
+	if err := domain.ValidateStatusReason(status, reason); err != nil {
+		return domain.StatusChange{}, err
+	}
+	return s.repo.ChangeStatus(ctx, id, status, reason)
+}
+
+// GrantRightsToUser добавляет права к уже выданным. Срочная выдача не сокращает бессрочные права.
+func (s *userService) GrantRightsToUser(ctx context.Context, id uuid.UUID, rights map[string][]string, validity rightsDomain.Validity) error {
 	if len(rights) == 0 {
 		return errors.New("rights cannot be empty")
 	}
+	if err := validity.Validate(time.Now().UTC()); err != nil {
+		return err
+	}
 
-	err := s.repo.GrantRightsToUser(ctx, id, rights)
+	rights = rightsDomain.NormalizeRights(rights)
+	if err := s.rights.ValidateRights(ctx, rights); err != nil {
+		return err
+	}
+
+	err := s.repo.GrantRightsToUser(ctx, id, rights, validity)
 	if err != nil {
 		log.Printf("Error granting rights to user: %v", err)
 		return err
@@ -95,6 +126,11 @@ func (s *userService) EditRightsToUser(ctx context.Context, id uuid.UUID, rights
 		return errors.New("rights cannot be empty")
 	}
 
+	rights = rightsDomain.NormalizeRights(rights)
+	if err := s.rights.ValidateRights(ctx, rights); err != nil {
+		return err
+	}
+
 	err := s.repo.EditRightsToUser(ctx, id, rights)
 	if err != nil {
 		log.Printf("Error granting rights to user: %v", err)
@@ -118,20 +154,182 @@ func (s *userService) RevokeRightsFromUser(ctx context.Context, id uuid.UUID, ri
 	return nil
 }
 
-func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (string, string, string, string, error) {
-	phone, passwordHash, createdAt, updatedAt, err := s.repo.GetUser(ctx, id)
+func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (domain.Profile, error) {
+	if id == uuid.Nil {
+		return domain.Profile{}, errors.New("invalid UUID: cannot be empty")
+	}
+	profile, err := s.repo.GetUser(ctx, id)
 	if err != nil {
 		log.Printf("Error retrieving user: %v", err)
-		return "", "", "", "", err
+		return domain.Profile{}, err
 	}
-	return phone, passwordHash, createdAt, updatedAt, nil
+	return profile, nil
+}
+
+// ListUsers ищет пользователей постранично; по умолчанию новые идут первыми
+func (s *userService) ListUsers(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	if err := normalizeFilter(&filter); err != nil {
+		return domain.Page{}, err
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+
+	after, err := domain.DecodeCursor(filter.Cursor, filter.Sort)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	users, err := s.repo.ListUsers(ctx, filter, after, filter.Limit+1)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	page := domain.Page{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.NextCursor = domain.EncodeCursor(domain.CursorAfter(filter.Sort, page.Users[filter.Limit-1]))
+	}
+	return page, nil
+}
+
+// ExportUsers передаёт в write всех пользователей, подходящих под фильтр поиска, вместе с правами,
+// ролями и контекстами. Пользователи читаются пачками, поэтому память не растёт с размером выгрузки;
+// Limit и Cursor фильтра не учитываются.
+func (s *userService) ExportUsers(ctx context.Context, filter domain.Filter, write func(domain.ExportRecord) error) error {
+	if err := normalizeFilter(&filter); err != nil {
+		return err
+	}
+
+	var after *domain.Cursor
+	for {
+		users, err := s.repo.ListUsers(ctx, filter, after, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		records, err := s.repo.GetExportDetails(ctx, users)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := write(record); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < exportBatchSize {
+			return nil
+		}
+		cursor := domain.CursorAfter(filter.Sort, users[len(users)-1])
+		after = &cursor
+	}
+}
+
+// normalizeFilter подставляет сортировку по умолчанию и проверяет сортировку и право
+func normalizeFilter(filter *domain.Filter) error {
+	if filter.Sort == "" {
+		filter.Sort = domain.SortCreatedDesc
+	}
+	if !domain.ValidSort(filter.Sort) {
+		return domain.ErrInvalidSort
+	}
+	if filter.Status != "" && !domain.ValidStatus(filter.Status) {
+		return domain.ErrInvalidStatus
+	}
+	if filter.Right != "" {
+		module, action, ok := strings.Cut(filter.Right, ":")
+		if !ok || module == "" || action == "" {
+			return domain.ErrInvalidRight
+		}
+	}
+	return nil
 }
 
 func (s *userService) GetUserRights(ctx context.Context, id uuid.UUID) (map[string][]string, error) {
-	rights, err := s.repo.GetUserRights(ctx, id)
+	rights, err := s.repo.GetUserRights(ctx, id, time.Now().UTC())
 	if err != nil {
 		log.Printf("Error retrieving user rights: %v", err)
 		return nil, err
 	}
 	return rights, nil
 }
+
+// GetEffectiveRights объединяет действующие прямые права и права действующих назначений ролей
+// у мерчанта merchantID. Пустой merchantID — права, действующие у любого мерчанта.
+func (s *userService) GetEffectiveRights(ctx context.Context, id uuid.UUID, merchantID string) (map[string][]string, error) {
+	now := time.Now().UTC()
+
+	direct, err := s.repo.GetUserRights(ctx, id, now)
+	if err != nil {
+		log.Printf("Error retrieving user rights: %v", err)
+		return nil, err
+	}
+
+	roleRights, err := s.repo.GetUserRoleRights(ctx, id, merchantID, now)
+	if err != nil {
+		log.Printf("Error retrieving user role rights: %v", err)
+		return nil, err
+	}
+
+	return rightsDomain.MergeRights(append([]map[string][]string{direct}, roleRights...)...), nil
+}
+
+// GetAccess собирает действующие права пользователя у каждого мерчанта из его контекстов
+func (s *userService) GetAccess(ctx context.Context, id uuid.UUID) (domain.Access, error) {
+	merchants, global, err := s.repo.GetUserMerchants(ctx, id)
+	if err != nil {
+		return domain.Access{}, err
+	}
+
+	rights, err := s.GetEffectiveRights(ctx, id, "")
+	if err != nil {
+		return domain.Access{}, err
+	}
+
+	access := domain.Access{Rights: rights, Global: global}
+	if len(merchants) > 0 {
+		access.Merchants = make(map[string]map[string][]string, len(merchants))
+	}
+	for _, merchantID := range merchants {
+		merchantRights, err := s.GetEffectiveRights(ctx, id, merchantID)
+		if err != nil {
+			return domain.Access{}, err
+		}
+		access.Merchants[merchantID] = merchantRights
+	}
+
+	return access, nil
+}
+
+// GetMerchantAccess возвращает права пользователя у мерчанта, доступного ему по контекстам
+func (s *userService) GetMerchantAccess(ctx context.Context, id uuid.UUID, merchantID string) (domain.MerchantAccess, error) {
+	ok, global, err := s.repo.HasMerchantAccess(ctx, id, merchantID)
+	if err != nil {
+		return domain.MerchantAccess{}, err
+	}
+	if !ok {
+		return domain.MerchantAccess{}, domain.ErrNoMerchantContext
+	}
+
+	rights, err := s.GetEffectiveRights(ctx, id, merchantID)
+	if err != nil {
+		return domain.MerchantAccess{}, err
+	}
+
+	return domain.MerchantAccess{MerchantID: merchantID, Rights: rights, Global: global}, nil
+}
+
+func (s *userService) GetUpcomingExpiries(ctx context.Context, id uuid.UUID) ([]domain.TimedGrant, error) {
+	return s.repo.GetTimedGrants(ctx, id, time.Now().UTC())
+}
+
+func (s *userService) SweepExpiredGrants(ctx context.Context) ([]domain.TimedGrant, error) {
+	return s.repo.DeleteExpiredGrants(ctx, time.Now().UTC())
+}
+
+func (s *userService) ListMergeConflicts(ctx context.Context) ([]domain.MergeConflict, error) {
+	return s.repo.ListMergeConflicts(ctx)
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/audit"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsPostgres "github.com/rafaceo/go-test-auth/rights/repository/postgres"
+	rightsService "github.com/rafaceo/go-test-auth/rights/service"
+	"github.com/rafaceo/go-test-auth/user/middleware"
+	"github.com/rafaceo/go-test-auth/user/repository/postgres"
+	"github.com/rafaceo/go-test-auth/user/service"
+)
+
+// GrantSweeper периодически удаляет истёкшие права и назначения ролей
+type GrantSweeper struct {
+	service  service.UserService
+	logger   log.Logger
+	interval time.Duration
+}
+
+func (sf *ServiceFactory) CreateGrantSweeper(logger log.Logger, postgresClient *sqlx.DB, interval time.Duration) *GrantSweeper {
+	rightsServ := rightsService.NewRightsService(rightsPostgres.NewPostgresRightsRepository(postgresClient))
+	userServ := service.NewUserService(postgres.NewUserRepository(postgresClient), rightsServ)
+	userServ = middleware.NewAuditMiddleware(audit.NewRecorder(logger, postgresClient), userServ)
+
+	logger = log.With(logger, "component", "grant_sweeper")
+	return &GrantSweeper{
+		service:  middleware.NewLoggingMiddleware(logger, userServ),
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run блокируется до отмены ctx
+func (s *GrantSweeper) Run(ctx context.Context) {
+	ctx = requestinfo.WithVerifiedActor(ctx, "system:grant_sweeper")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *GrantSweeper) sweep(ctx context.Context) {
+	expired, err := s.service.SweepExpiredGrants(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, grant := range expired {
+		_ = s.logger.Log(
+			"event", "GrantExpired",
+			"user_id", grant.UserID,
+			"kind", grant.Kind,
+			"module", grant.Module,
+			"action", grant.Action,
+			"role_id", grant.RoleID,
+			"valid_until", grant.ValidUntil,
+		)
+	}
+}
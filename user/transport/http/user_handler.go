@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-kit/kit/endpoint"
 	kitlog "github.com/go-kit/kit/log"
@@ -11,47 +12,65 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
 	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	rightsDomain "github.com/rafaceo/go-test-auth/rights/domain"
+	"github.com/rafaceo/go-test-auth/user/domain"
 	"github.com/rafaceo/go-test-auth/user/service"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+// GetUserHandler: изменения пользователей попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetUserHandler(serv service.UserService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
 	opts := []kithttp.ServerOption{
 		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
 	}
+	authenticated := authn.Middleware(tokens)
 
 	createUser := kithttp.NewServer(
-		MakeCreateEndpoint(serv),
+		authenticated(MakeCreateEndpoint(serv)),
 		DecodeCreateRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	editUser := kithttp.NewServer(
-		MakeEditUserEndpoint(serv),
+		authenticated(MakeEditUserEndpoint(serv)),
 		DecodeEditUserRequest,
 		EncodeResponse,
 		opts...,
 	)
 
+	changeStatus := kithttp.NewServer(
+		authenticated(MakeChangeStatusEndpoint(serv)),
+		DecodeChangeStatusRequest,
+		EncodeResponse,
+		opts...,
+	)
+
 	grantRights := kithttp.NewServer(
-		MakeGrantRightsToUserEndpoint(serv),
+		authenticated(MakeGrantRightsToUserEndpoint(serv)),
 		DecodeGrantRightsToUserRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	editRights := kithttp.NewServer(
-		MakeEditRightsToUserEndpoint(serv),
+		authenticated(MakeEditRightsToUserEndpoint(serv)),
 		DecodeEditRightsToUserRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	revokeRights := kithttp.NewServer(
-		MakeRevokeRightsFromUserEndpoint(serv),
+		authenticated(MakeRevokeRightsFromUserEndpoint(serv)),
 		DecodeRevokeRightsFromUserRequest,
 		EncodeResponse,
 		opts...,
@@ -64,6 +83,20 @@ func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandl
 		opts...,
 	)
 
+	listUsers := kithttp.NewServer(
+		MakeListUsersEndpoint(serv),
+		DecodeListUsersRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	exportUsers := kithttp.NewServer(
+		MakeExportUsersEndpoint(serv),
+		DecodeExportUsersRequest,
+		EncodeExportUsersResponse,
+		opts...,
+	)
+
 	getUserRights := kithttp.NewServer(
 		MakeGetUserRightsEndpoint(serv),
 		DecodeGetUserRightsRequest,
@@ -71,6 +104,20 @@ func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandl
 		opts...,
 	)
 
+	getEffectiveRights := kithttp.NewServer(
+		MakeGetEffectiveRightsEndpoint(serv),
+		DecodeGetEffectiveRightsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getUpcomingExpiries := kithttp.NewServer(
+		MakeGetUpcomingExpiriesEndpoint(serv),
+		DecodeGetUpcomingExpiriesRequest,
+		EncodeResponse,
+		opts...,
+	)
+
 	return []*httphandlers.HTTPHandler{
 		{
 			Path:    "/api/v4/userss",
@@ -82,6 +129,11 @@ func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandl
 			Handler: editUser,
 			Methods: []string{"PUT"},
 		},
+		{
+			Path:    "/api/v4/users/{id}/{action:suspend|lock|reactivate|deactivate|delete}",
+			Handler: changeStatus,
+			Methods: []string{"POST"},
+		},
 		{
 			Path:    "/api/v4/users/{id}/rights",
 			Handler: grantRights,
@@ -97,6 +149,23 @@ func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandl
 			Handler: revokeRights,
 			Methods: []string{"DELETE"},
 		},
+		{
+			Path:    "/api/v4/users",
+			Handler: listUsers,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/users/export",
+			Handler: exportUsers,
+			Methods: []string{"GET"},
+		},
+		// id ограничен UUID, чтобы не перекрывать другие пути под /api/v4/users
+		{
+			Path:    "/api/v4/users/{id:[0-9a-fA-F-]{36}}",
+			Handler: getUser,
+			Methods: []string{"GET"},
+		},
+		// Старый путь оставлен для существующих клиентов
 		{
 			Path:    "/api/v4/userss/{id}",
 			Handler: getUser,
@@ -107,6 +176,16 @@ func GetUserHandler(serv service.UserService, logger kitlog.Logger) []*httphandl
 			Handler: getUserRights,
 			Methods: []string{"GET"},
 		},
+		{
+			Path:    "/api/v4/users/{id}/effective-rights",
+			Handler: getEffectiveRights,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/users/{id}/expiries",
+			Handler: getUpcomingExpiries,
+			Methods: []string{"GET"},
+		},
 	}
 }
 
@@ -116,8 +195,9 @@ type CreateRequest struct {
 }
 
 type CreateResponse struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	ID      *uuid.UUID `json:"id,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Error   string     `json:"error,omitempty"`
 }
 
 type EditUserRequest struct {
@@ -131,14 +211,29 @@ type EditUserResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// ChangeStatusRequest — действие администратора над учётной записью; Status выводится из действия в пути
+type ChangeStatusRequest struct {
+	ID     uuid.UUID `json:"-"`
+	Status string    `json:"-"`
+	Reason string    `json:"reason"`
+}
+
+type ChangeStatusResponse struct {
+	*domain.StatusChange
+	Error string `json:"error,omitempty"`
+}
+
 type GrantRightsRequest struct {
-	Rights map[string][]string `json:"rights"`
-	ID     uuid.UUID           `json:"id"`
+	Rights     map[string][]string `json:"rights"`
+	ID         uuid.UUID           `json:"id"`
+	ValidFrom  *time.Time          `json:"valid_from,omitempty"`
+	ValidUntil *time.Time          `json:"valid_until,omitempty"`
 }
 
 type GrantRightsResponse struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Message       string                           `json:"message,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
 }
 
 type EditRightsRequest struct {
@@ -147,8 +242,9 @@ type EditRightsRequest struct {
 }
 
 type EditRightsResponse struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Message       string                           `json:"message,omitempty"`
+	Error         string                           `json:"error,omitempty"`
+	UnknownRights *rightsDomain.UnknownRightsError `json:"unknown_rights,omitempty"`
 }
 
 type RevokeRightsRequest struct {
@@ -166,11 +262,26 @@ type GetUserRequest struct {
 }
 
 type GetUserResponse struct {
-	Phone     string `json:"phone,omitempty"`
-	Password  string `json:"password,omitempty"`
-	CreatedAt string `json:"created_at,omitempty"`
-	UpdatedAt string `json:"updated_at,omitempty"`
-	Error     string `json:"error,omitempty"`
+	*domain.Profile
+	Error string `json:"error,omitempty"`
+}
+
+type ListUsersResponse struct {
+	domain.Page
+	Error string `json:"error,omitempty"`
+}
+
+type ExportUsersRequest struct {
+	Format string
+	Filter domain.Filter
+}
+
+// ExportUsersResponse несёт не данные, а запуск выгрузки: записи пишутся прямо в ответ
+// в EncodeExportUsersResponse
+type ExportUsersResponse struct {
+	Format string                                            `json:"-"`
+	Export func(write func(domain.ExportRecord) error) error `json:"-"`
+	Error  string                                            `json:"error,omitempty"`
 }
 
 type GetUserRightsRequest struct {
@@ -182,6 +293,20 @@ type GetUserRightsResponse struct {
 	Error  string              `json:"error,omitempty"`
 }
 
+type GetEffectiveRightsRequest struct {
+	ID         uuid.UUID `json:"id"`
+	MerchantID string    `json:"merchant_id,omitempty"`
+}
+
+type GetUpcomingExpiriesRequest struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type GetUpcomingExpiriesResponse struct {
+	Expiries []domain.TimedGrant `json:"expiries"`
+	Error    string              `json:"error,omitempty"`
+}
+
 func MakeCreateEndpoint(svc service.UserService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req, ok := request.(CreateRequest)
@@ -189,11 +314,11 @@ func MakeCreateEndpoint(svc service.UserService) endpoint.Endpoint {
 			return CreateResponse{Error: "invalid request"}, nil
 		}
 
-		err := svc.CreateUser(ctx, req.Phone, req.Password)
+		id, err := svc.CreateUser(ctx, req.Phone, req.Password)
 		if err != nil {
 			return CreateResponse{Error: err.Error()}, nil
 		}
-		return CreateResponse{Message: "Пользователь успешно зарегистрирован"}, nil
+		return CreateResponse{ID: &id, Message: "Пользователь успешно зарегистрирован"}, nil
 	}
 }
 
@@ -213,6 +338,20 @@ func MakeEditUserEndpoint(svc service.UserService) endpoint.Endpoint {
 	}
 }
 
+func MakeChangeStatusEndpoint(svc service.UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ChangeStatusRequest)
+		change, err := svc.ChangeStatus(ctx, req.ID, req.Status, req.Reason)
+		if err != nil {
+			return ChangeStatusResponse{Error: err.Error()}, nil
+		}
+		return ChangeStatusResponse{StatusChange: &change}, nil
+	}
+}
+
+// MakeGrantRightsToUserEndpoint — POST /api/v4/users/{id}/rights. Права добавляются к уже
+// выданным; PUT того же пути заменяет их целиком. Раньше выдача пользователю, у которого
+// уже были права, отклонялась ("user already has rights, update denied").
 func MakeGrantRightsToUserEndpoint(svc service.UserService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req, ok := request.(GrantRightsRequest)
@@ -220,9 +359,12 @@ func MakeGrantRightsToUserEndpoint(svc service.UserService) endpoint.Endpoint {
 			return GrantRightsResponse{Error: "invalid request"}, nil
 		}
 
-		err := svc.GrantRightsToUser(ctx, req.ID, req.Rights)
+		validity := rightsDomain.Validity{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil}
+		err := svc.GrantRightsToUser(ctx, req.ID, req.Rights, validity)
 		if err != nil {
-			return GrantRightsResponse{Error: err.Error()}, nil
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return GrantRightsResponse{Error: err.Error(), UnknownRights: unknown}, nil
 		}
 		return GrantRightsResponse{Message: "Rights granted successfully"}, nil
 	}
@@ -237,7 +379,9 @@ func MakeEditRightsToUserEndpoint(svc service.UserService) endpoint.Endpoint {
 
 		err := svc.EditRightsToUser(ctx, req.ID, req.Rights)
 		if err != nil {
-			return EditRightsResponse{Error: err.Error()}, nil
+			var unknown *rightsDomain.UnknownRightsError
+			errors.As(err, &unknown)
+			return EditRightsResponse{Error: err.Error(), UnknownRights: unknown}, nil
 		}
 		return EditRightsResponse{Message: "Rights changed successfully"}, nil
 	}
@@ -265,16 +409,46 @@ func MakeGetUserEndpoint(svc service.UserService) endpoint.Endpoint {
 			return GetUserResponse{Error: "invalid request"}, nil
 		}
 
-		phone, passwordHash, createdAt, updatedAt, err := svc.GetUser(ctx, req.ID)
+		profile, err := svc.GetUser(ctx, req.ID)
 		if err != nil {
 			return GetUserResponse{Error: err.Error()}, nil
 		}
 
-		return GetUserResponse{
-			Phone:     phone,
-			Password:  passwordHash,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
+		return GetUserResponse{Profile: &profile}, nil
+	}
+}
+
+func MakeListUsersEndpoint(svc service.UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter, ok := request.(domain.Filter)
+		if !ok {
+			return ListUsersResponse{Error: "invalid request"}, nil
+		}
+
+		page, err := svc.ListUsers(ctx, filter)
+		if err != nil {
+			return ListUsersResponse{Error: err.Error()}, nil
+		}
+
+		return ListUsersResponse{Page: page}, nil
+	}
+}
+
+func MakeExportUsersEndpoint(svc service.UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(ExportUsersRequest)
+		if !ok {
+			return ExportUsersResponse{Error: "invalid request"}, nil
+		}
+		if !domain.ValidExportFormat(req.Format) {
+			return ExportUsersResponse{Error: domain.ErrInvalidExportFormat.Error()}, nil
+		}
+
+		return ExportUsersResponse{
+			Format: req.Format,
+			Export: func(write func(domain.ExportRecord) error) error {
+				return svc.ExportUsers(ctx, req.Filter, write)
+			},
 		}, nil
 	}
 }
@@ -295,6 +469,38 @@ func MakeGetUserRightsEndpoint(svc service.UserService) endpoint.Endpoint {
 	}
 }
 
+func MakeGetEffectiveRightsEndpoint(svc service.UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(GetEffectiveRightsRequest)
+		if !ok {
+			return GetUserRightsResponse{Error: "invalid request"}, nil
+		}
+
+		rights, err := svc.GetEffectiveRights(ctx, req.ID, req.MerchantID)
+		if err != nil {
+			return GetUserRightsResponse{Error: err.Error()}, nil
+		}
+
+		return GetUserRightsResponse{Rights: rights}, nil
+	}
+}
+
+func MakeGetUpcomingExpiriesEndpoint(svc service.UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(GetUpcomingExpiriesRequest)
+		if !ok {
+			return GetUpcomingExpiriesResponse{Error: "invalid request"}, nil
+		}
+
+		expiries, err := svc.GetUpcomingExpiries(ctx, req.ID)
+		if err != nil {
+			return GetUpcomingExpiriesResponse{Error: err.Error()}, nil
+		}
+
+		return GetUpcomingExpiriesResponse{Expiries: expiries}, nil
+	}
+}
+
 func DecodeCreateRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req CreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -321,6 +527,20 @@ func DecodeEditUserRequest(_ context.Context, r *http.Request) (interface{}, err
 	return req, nil
 }
 
+// DecodeChangeStatusRequest: тело с причиной необязательно при возврате в active
+func DecodeChangeStatusRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID: %v", err)
+	}
+	req := ChangeStatusRequest{ID: id, Status: domain.StatusActions[vars["action"]]}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	return req, nil
+}
+
 func DecodeGrantRightsToUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req GrantRightsRequest
 
@@ -393,6 +613,57 @@ func DecodeGetUserRequest(_ context.Context, r *http.Request) (interface{}, erro
 	return req, nil
 }
 
+// DecodeListUsersRequest собирает фильтр из query: phone и email — префиксы, right — «модуль:действие»,
+// created_from и created_until — время в RFC 3339
+func DecodeListUsersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	filter := domain.Filter{
+		PhonePrefix: query.Get("phone"),
+		EmailPrefix: query.Get("email"),
+		Role:        query.Get("role"),
+		Right:       query.Get("right"),
+		MerchantID:  query.Get("merchant_id"),
+		Status:      query.Get("status"),
+		Sort:        query.Get("sort"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	for name, dst := range map[string]**time.Time{"created_from": &filter.CreatedFrom, "created_until": &filter.CreatedUntil} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New("invalid " + name + ": expected RFC 3339 time")
+			}
+			t = t.UTC()
+			*dst = &t
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// DecodeExportUsersRequest принимает те же фильтры, что и поиск, и format: csv (по умолчанию), jsonl или xlsx
+func DecodeExportUsersRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	filter, err := DecodeListUsersRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = domain.ExportCSV
+	}
+	return ExportUsersRequest{Format: format, Filter: filter.(domain.Filter)}, nil
+}
+
 func DecodeGetUserRightsRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req GetUserRightsRequest
 
@@ -411,6 +682,23 @@ func DecodeGetUserRightsRequest(_ context.Context, r *http.Request) (interface{}
 	return req, nil
 }
 
+// DecodeGetEffectiveRightsRequest берёт мерчанта из query merchant_id; без него — права у любого мерчанта
+func DecodeGetEffectiveRightsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID: %v", err)
+	}
+	return GetEffectiveRightsRequest{ID: id, MerchantID: r.URL.Query().Get("merchant_id")}, nil
+}
+
+func DecodeGetUpcomingExpiriesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID: %v", err)
+	}
+	return GetUpcomingExpiriesRequest{ID: id}, nil
+}
+
 func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -423,3 +711,52 @@ func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface
 	_, err = w.Write(prettyJSON)
 	return err
 }
+
+// EncodeExportUsersResponse пишет выгрузку в ответ по мере чтения из базы. Заголовки отправляются
+// с первой записью, поэтому ошибка до неё возвращается обычным JSON. Ошибка посреди выгрузки
+// обрывает соединение, чтобы клиент не принял неполный файл за целый.
+func EncodeExportUsersResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(ExportUsersResponse)
+	if resp.Error != "" {
+		return EncodeResponse(ctx, w, resp)
+	}
+
+	var out domain.ExportWriter
+	started := false
+	start := func() error {
+		started = true
+		fileName := "users-" + time.Now().UTC().Format("20060102T150405Z") + "." + resp.Format
+		w.Header().Set("Content-Type", domain.ExportContentType(resp.Format))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		var err error
+		out, err = domain.NewExportWriter(resp.Format, w)
+		return err
+	}
+
+	err := resp.Export(func(record domain.ExportRecord) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return out.Write(record)
+	})
+	if err != nil && !started {
+		return EncodeResponse(ctx, w, ExportUsersResponse{Error: err.Error()})
+	}
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = out.Close()
+	} else if out != nil {
+		// освобождает временные файлы xlsx; сам ответ всё равно обрывается
+		_ = out.Close()
+	}
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
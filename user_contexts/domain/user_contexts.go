@@ -1,9 +1,58 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
+)
+
+var (
+	ErrContextNotFound    = errors.New("user context not found")
+	ErrMerchantIDRequired = errors.New("merchant_id cannot be empty")
+)
+
+// UserContext — членство пользователя в мерчанте. Global открывает доступ ко всем мерчантам;
+// у глобального контекста merchant_id может быть пустым.
 type UserContext struct {
-	UserID     uuid.UUID `json:"user_id"`
-	MerchantID string    `json:"merchant_id"`
-	Global     bool      `json:"global"`
+	ID         int64     `json:"-" db:"id"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	MerchantID string    `json:"merchant_id" db:"merchant_id"`
+	Global     bool      `json:"global" db:"global"`
+	GrantedAt  time.Time `json:"granted_at" db:"granted_at"`
+	GrantedBy  string    `json:"granted_by,omitempty" db:"granted_by"`
+}
+
+// Filter — выборка контекстов пользователя постранично
+type Filter struct {
+	UserID uuid.UUID
+	Limit  int
+	Cursor string
+}
+
+type Page struct {
+	Contexts   []UserContext `json:"contexts"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor скрывает от клиента, что курсор — это ID последнего выданного контекста
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
 }
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	auditDomain "github.com/rafaceo/go-test-auth/audit/domain"
+	auditService "github.com/rafaceo/go-test-auth/audit/service"
+	"github.com/rafaceo/go-test-auth/user_contexts/domain"
+	"github.com/rafaceo/go-test-auth/user_contexts/service"
+)
+
+// auditingService записывает в журнал аудита изменения контекстов пользователя
+type auditingService struct {
+	audit auditService.AuditService
+	next  service.UserContextService
+}
+
+func NewAuditMiddleware(audit auditService.AuditService, s service.UserContextService) service.UserContextService {
+	return &auditingService{audit: audit, next: s}
+}
+
+func (a *auditingService) snapshot(ctx context.Context, userID uuid.UUID) interface{} {
+	contexts, err := a.next.GetUserContexts(ctx, userID)
+	if err != nil {
+		return nil
+	}
+	return contexts
+}
+
+func (a *auditingService) mutate(ctx context.Context, action string, userID uuid.UUID, change func() error) error {
+	before := a.snapshot(ctx, userID)
+	if err := change(); err != nil {
+		return err
+	}
+	event := auditDomain.NewEvent(action, auditDomain.TargetUserContext, userID.String(), before, a.snapshot(ctx, userID))
+	_ = a.audit.Record(ctx, event)
+	return nil
+}
+
+func (a *auditingService) AddUserContext(ctx context.Context, userID uuid.UUID, merchantID string, global bool) error {
+	return a.mutate(ctx, "user_context.add", userID, func() error {
+		return a.next.AddUserContext(ctx, userID, merchantID, global)
+	})
+}
+
+func (a *auditingService) EditUserContext(ctx context.Context, userID uuid.UUID, global bool) error {
+	return a.mutate(ctx, "user_context.edit", userID, func() error {
+		return a.next.EditUserContext(ctx, userID, global)
+	})
+}
+
+func (a *auditingService) GetUserContexts(ctx context.Context, userID uuid.UUID) ([]domain.UserContext, error) {
+	return a.next.GetUserContexts(ctx, userID)
+}
+
+func (a *auditingService) ListUserContexts(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	return a.next.ListUserContexts(ctx, filter)
+}
+
+func (a *auditingService) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) error {
+	return a.mutate(ctx, "user_context.delete", userID, func() error {
+		return a.next.DeleteUserContext(ctx, userID, merchantID)
+	})
+}
+
+func (a *auditingService) DeleteAllUserContexts(ctx context.Context, userID uuid.UUID) error {
+	return a.mutate(ctx, "user_context.delete_all", userID, func() error {
+		return a.next.DeleteAllUserContexts(ctx, userID)
+	})
+}
@@ -26,7 +26,7 @@ func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogr
 	}
 }
 
-func (s *instrumentingService) AddUserContext(ctx context.Context, userID, merchantID uuid.UUID, global bool) (err error) {
+func (s *instrumentingService) AddUserContext(ctx context.Context, userID uuid.UUID, merchantID string, global bool) (err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "AddUserContext"}
 		s.requestCount.With(labels...).Add(1)
@@ -65,7 +65,20 @@ func (s *instrumentingService) GetUserContexts(ctx context.Context, userID uuid.
 	return s.next.GetUserContexts(ctx, userID)
 }
 
-func (s *instrumentingService) DeleteUserContext(ctx context.Context, userID, merchantID uuid.UUID) (err error) {
+func (s *instrumentingService) ListUserContexts(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListUserContexts"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListUserContexts(ctx, filter)
+}
+
+func (s *instrumentingService) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) (err error) {
 	defer func(begin time.Time) {
 		labels := []string{"method", "DeleteUserContext"}
 		s.requestCount.With(labels...).Add(1)
@@ -19,7 +19,7 @@ func NewLoggingMiddleware(logger log.Logger, s service.UserContextService) servi
 	return &loggingService{logger, s}
 }
 
-func (l *loggingService) AddUserContext(ctx context.Context, userID uuid.UUID, merchantID uuid.UUID, global bool) (err error) {
+func (l *loggingService) AddUserContext(ctx context.Context, userID uuid.UUID, merchantID string, global bool) (err error) {
 	defer func(begin time.Time) {
 		_ = l.logger.Log(
 			"method", "AddUserContext",
@@ -62,7 +62,22 @@ func (l *loggingService) GetUserContexts(ctx context.Context, userID uuid.UUID)
 	return l.next.GetUserContexts(ctx, userID)
 }
 
-func (l *loggingService) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID uuid.UUID) (err error) {
+func (l *loggingService) ListUserContexts(ctx context.Context, filter domain.Filter) (page domain.Page, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListUserContexts",
+			"user_id", filter.UserID,
+			"limit", filter.Limit,
+			"count", len(page.Contexts),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListUserContexts(ctx, filter)
+}
+
+func (l *loggingService) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) (err error) {
 	defer func(begin time.Time) {
 		_ = l.logger.Log(
 			"method", "DeleteUserContext",
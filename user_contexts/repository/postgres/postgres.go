@@ -2,12 +2,21 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	merchantsDomain "github.com/rafaceo/go-test-auth/merchants/domain"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	outboxPostgres "github.com/rafaceo/go-test-auth/outbox/repository/postgres"
+	rolesPostgres "github.com/rafaceo/go-test-auth/roles/repository/postgres"
 	"github.com/rafaceo/go-test-auth/user_contexts/domain"
 	"github.com/rafaceo/go-test-auth/user_contexts/repository"
 )
 
+const contextColumns = `id, user_id, merchant_id, global, granted_at, granted_by`
+
 type userContextRepo struct {
 	db *sqlx.DB
 }
@@ -16,14 +25,41 @@ func NewUserContextRepository(db *sqlx.DB) repository.UserContextRepository {
 	return &userContextRepo{db: db}
 }
 
+// AddUserContext выдаёт членство в мерчанте из реестра; повторная выдача меняет только флаг global,
+// время и автор первой выдачи сохраняются
 func (r *userContextRepo) AddUserContext(ctx context.Context, userCtx domain.UserContext) error {
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO users_contexts (user_id, merchant_id, global) 
-		VALUES ($1, $2, $3)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if userCtx.MerchantID != "" {
+		if err := checkMerchant(ctx, tx, userCtx.MerchantID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users_contexts (user_id, merchant_id, global, granted_by) 
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (user_id, merchant_id) 
 		DO UPDATE SET global = EXCLUDED.global
-	`, userCtx.UserID, userCtx.MerchantID, userCtx.Global)
-	return err
+	`, userCtx.UserID, userCtx.MerchantID, userCtx.Global, requestinfo.Actor(ctx))
+	if err != nil {
+		return err
+	}
+
+	payload := outboxDomain.ContextAddedPayload{
+		UserID:     userCtx.UserID.String(),
+		MerchantID: userCtx.MerchantID,
+		Global:     userCtx.Global,
+	}
+	if err := appendEvent(ctx, tx, outboxDomain.ContextAdded, userCtx.UserID, payload); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userContextRepo) EditUserContext(ctx context.Context, userID uuid.UUID, global bool) error {
@@ -35,42 +71,153 @@ func (r *userContextRepo) EditUserContext(ctx context.Context, userID uuid.UUID,
 	return err
 }
 
-func (r *userContextRepo) GetUserContexts(ctx context.Context, userID uuid.UUID) (domain.UserContext, error) {
-	var userCtx domain.UserContext
-
-	err := r.db.QueryRowContext(ctx, `
-		SELECT user_id, COALESCE(string_agg(merchant_id, ','), ''), global
+func (r *userContextRepo) GetUserContexts(ctx context.Context, userID uuid.UUID) ([]domain.UserContext, error) {
+	contexts := []domain.UserContext{}
+	err := r.db.SelectContext(ctx, &contexts, `
+		SELECT `+contextColumns+`
 		FROM users_contexts
 		WHERE user_id = $1
-		GROUP BY user_id, global
-	`, userID).Scan(&userCtx.UserID, &userCtx.MerchantID, &userCtx.Global)
-
+		ORDER BY id
+	`, userID)
 	if err != nil {
-		return domain.UserContext{}, err
+		return nil, err
 	}
+	return contexts, nil
+}
 
-	return userCtx, nil
+func (r *userContextRepo) ListUserContexts(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]domain.UserContext, error) {
+	contexts := []domain.UserContext{}
+	err := r.db.SelectContext(ctx, &contexts, `
+		SELECT `+contextColumns+`
+		FROM users_contexts
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return contexts, nil
 }
 
 func (r *userContextRepo) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE users_contexts 
-		SET merchant_id = CASE 
-			WHEN merchant_id = $2 THEN '' 
-			ELSE merchant_id 
-		END
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := UnassignContextRoles(ctx, tx, userID, &merchantID); err != nil {
+		return err
+	}
+
+	payload := outboxDomain.ContextRemovedPayload{UserID: userID.String(), MerchantID: merchantID}
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM users_contexts
 		WHERE user_id = $1 AND merchant_id = $2
-	`, userID, merchantID)
+		RETURNING global
+	`, userID, merchantID).Scan(&payload.Global)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrContextNotFound
+	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	if err := appendEvent(ctx, tx, outboxDomain.ContextRemoved, userID, payload); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userContextRepo) DeleteAllUserContexts(ctx context.Context, userID uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE users_contexts 
-		SET merchant_id = '' 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := UnassignContextRoles(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+
+	var removed []domain.UserContext
+	err = sqlx.SelectContext(ctx, tx, &removed, `
+		DELETE FROM users_contexts
 		WHERE user_id = $1
-	`, userID)
+		RETURNING `+contextColumns, userID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	for _, userCtx := range removed {
+		payload := outboxDomain.ContextRemovedPayload{
+			UserID:     userID.String(),
+			MerchantID: userCtx.MerchantID,
+			Global:     userCtx.Global,
+		}
+		if err := appendEvent(ctx, tx, outboxDomain.ContextRemoved, userID, payload); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkMerchant проверяет мерчанта по реестру и не даёт удалить его до конца транзакции
+func checkMerchant(ctx context.Context, tx *sqlx.Tx, merchantID string) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM merchants WHERE id = $1 FOR SHARE`, merchantID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return merchantsDomain.ErrMerchantNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != merchantsDomain.StatusActive {
+		return merchantsDomain.ErrMerchantSuspended
+	}
+	return nil
+}
+
+// UnassignContextRoles снимает роли, назначенные в контексте merchantID (nil — во всех контекстах),
+// до удаления самого контекста, чтобы по каждой роли ушёл RoleChanged
+func UnassignContextRoles(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, merchantID *string) error {
+	var unassigned []struct {
+		RoleID     int    `db:"role_id"`
+		MerchantID string `db:"merchant_id"`
+		Rights     []byte `db:"rights"`
+	}
+	query := `DELETE FROM users_roles ur
+	          USING roles r
+	          WHERE ur.user_id = $1 AND ur.merchant_id IS NOT NULL
+	            AND ($2::text IS NULL OR ur.merchant_id = $2::text)
+	            AND r.role_id = ur.role_id
+	          RETURNING ur.role_id, ur.merchant_id, r.rights`
+	if err := tx.SelectContext(ctx, &unassigned, query, userID, merchantID); err != nil {
+		return err
+	}
+
+	for _, role := range unassigned {
+		payload := outboxDomain.RoleChangedPayload{
+			RoleID:     role.RoleID,
+			Change:     outboxDomain.RoleUnassigned,
+			UserID:     userID.String(),
+			MerchantID: role.MerchantID,
+			Modules:    rolesPostgres.RightsModules(role.Rights),
+		}
+		if err := rolesPostgres.AppendRoleEvent(ctx, tx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendEvent(ctx context.Context, tx *sqlx.Tx, eventType string, userID uuid.UUID, payload interface{}) error {
+	event, err := outboxDomain.NewEvent(eventType, outboxDomain.AggregateUser, userID.String(), payload)
+	if err != nil {
+		return err
+	}
+	return outboxPostgres.Append(ctx, tx, event)
 }
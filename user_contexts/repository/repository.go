@@ -9,7 +9,8 @@ import (
 type UserContextRepository interface {
 	AddUserContext(ctx context.Context, userCtx domain.UserContext) error
 	EditUserContext(ctx context.Context, userID uuid.UUID, global bool) error
-	GetUserContexts(ctx context.Context, userID uuid.UUID) (domain.UserContext, error)
+	GetUserContexts(ctx context.Context, userID uuid.UUID) ([]domain.UserContext, error)
+	ListUserContexts(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]domain.UserContext, error)
 	DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) error
 	DeleteAllUserContexts(ctx context.Context, userID uuid.UUID) error
 }
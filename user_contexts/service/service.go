@@ -7,10 +7,16 @@ import (
 	"github.com/rafaceo/go-test-auth/user_contexts/repository"
 )
 
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
 type UserContextService interface {
 	AddUserContext(ctx context.Context, userID uuid.UUID, merchantID string, global bool) error
 	EditUserContext(ctx context.Context, userID uuid.UUID, global bool) error
-	GetUserContexts(ctx context.Context, userID uuid.UUID) (domain.UserContext, error)
+	GetUserContexts(ctx context.Context, userID uuid.UUID) ([]domain.UserContext, error)
+	ListUserContexts(ctx context.Context, filter domain.Filter) (domain.Page, error)
 	DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) error
 	DeleteAllUserContexts(ctx context.Context, userID uuid.UUID) error
 }
@@ -24,13 +30,13 @@ func NewUserContextService(repo repository.UserContextRepository) UserContextSer
 }
 
 func (s *userContextService) AddUserContext(ctx context.Context, userID uuid.UUID, merchantID string, global bool) error {
-	if global {
-		return s.repo.EditUserContext(ctx, userID, global)
+	if merchantID == "" && !global {
+		return domain.ErrMerchantIDRequired
 	}
 	return s.repo.AddUserContext(ctx, domain.UserContext{
 		UserID:     userID,
-		MerchantID: merchantID, // Конвертируем в строку
-		Global:     global,     // Передаём глобальный флаг
+		MerchantID: merchantID,
+		Global:     global,
 	})
 }
 
@@ -38,10 +44,37 @@ func (s *userContextService) EditUserContext(ctx context.Context, userID uuid.UU
 	return s.repo.EditUserContext(ctx, userID, global)
 }
 
-func (s *userContextService) GetUserContexts(ctx context.Context, userID uuid.UUID) (domain.UserContext, error) {
+// GetUserContexts возвращает все членства пользователя без пагинации
+func (s *userContextService) GetUserContexts(ctx context.Context, userID uuid.UUID) ([]domain.UserContext, error) {
 	return s.repo.GetUserContexts(ctx, userID)
 }
 
+func (s *userContextService) ListUserContexts(ctx context.Context, filter domain.Filter) (domain.Page, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+
+	afterID, err := domain.DecodeCursor(filter.Cursor)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	contexts, err := s.repo.ListUserContexts(ctx, filter.UserID, afterID, filter.Limit+1)
+	if err != nil {
+		return domain.Page{}, err
+	}
+
+	page := domain.Page{Contexts: contexts}
+	if len(contexts) > filter.Limit {
+		page.Contexts = contexts[:filter.Limit]
+		page.NextCursor = domain.EncodeCursor(page.Contexts[filter.Limit-1].ID)
+	}
+	return page, nil
+}
+
 func (s *userContextService) DeleteUserContext(ctx context.Context, userID uuid.UUID, merchantID string) error {
 	return s.repo.DeleteUserContext(ctx, userID, merchantID)
 }
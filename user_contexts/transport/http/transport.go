@@ -11,28 +11,36 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strconv"
 
 	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/authn"
 	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/user_contexts/domain"
 	"github.com/rafaceo/go-test-auth/user_contexts/service"
 	"github.com/rafaceo/go-test-auth/user_contexts/transport"
 )
 
-func GetUserContextHandlers(serv service.UserContextService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+// GetUserContextHandlers: изменения контекстов пользователя попадают в журнал аудита с автором, поэтому требуют
+// access_token в Authorization: Bearer
+func GetUserContextHandlers(serv service.UserContextService, tokens authn.TokenVerifier, logger kitlog.Logger) []*httphandlers.HTTPHandler {
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		httptransport.ServerBefore(requestinfo.PopulateRequestContext),
 	}
+	authenticated := authn.Middleware(tokens)
 
 	addUserContextHandler := httptransport.NewServer(
-		MakeAddUserContextEndpoint(serv),
+		authenticated(MakeAddUserContextEndpoint(serv)),
 		DecodeAddUserContextRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	editUserContextHandler := httptransport.NewServer(
-		MakeEditUserContextEndpoint(serv),
+		authenticated(MakeEditUserContextEndpoint(serv)),
 		DecodeEditUserContextRequest,
 		EncodeResponse,
 		opts...,
@@ -46,14 +54,14 @@ func GetUserContextHandlers(serv service.UserContextService, logger kitlog.Logge
 	)
 
 	deleteUserContextHandler := httptransport.NewServer(
-		MakeDeleteUserContextEndpoint(serv),
+		authenticated(MakeDeleteUserContextEndpoint(serv)),
 		DecodeDeleteUserContextRequest,
 		EncodeResponse,
 		opts...,
 	)
 
 	deleteAllUserContextsHandler := httptransport.NewServer(
-		MakeDeleteAllUserContextsEndpoint(serv),
+		authenticated(MakeDeleteAllUserContextsEndpoint(serv)),
 		DecodeDeleteAllUserContextsRequest,
 		EncodeResponse,
 		opts...,
@@ -119,12 +127,12 @@ func MakeGetUserContextsEndpoint(svc service.UserContextService) endpoint.Endpoi
 			return transport.GetUserContextResponse{Error: "invalid request format"}, nil
 		}
 
-		contexts, err := svc.GetUserContexts(ctx, req.UserID)
+		page, err := svc.ListUserContexts(ctx, domain.Filter{UserID: req.UserID, Limit: req.Limit, Cursor: req.Cursor})
 		if err != nil {
 			return transport.GetUserContextResponse{Error: err.Error()}, nil
 		}
 
-		return transport.GetUserContextResponse{UserContext: contexts}, nil
+		return transport.GetUserContextResponse{Page: page}, nil
 	}
 }
 
@@ -178,9 +186,9 @@ func DecodeAddUserContextRequest(_ context.Context, r *http.Request) (interface{
 	// Заполняем user_id в req
 	req.UserID = userID
 
-	// Проверяем, что merchant_id не пустой
-	if req.MerchantID == "" {
-		return nil, errors.New("merchant_id cannot be empty")
+	// merchant_id можно не указывать только для глобального контекста
+	if req.MerchantID == "" && !req.Global {
+		return nil, domain.ErrMerchantIDRequired
 	}
 
 	return req, nil
@@ -215,7 +223,7 @@ func DecodeEditUserContextRequest(_ context.Context, r *http.Request) (interface
 	return req, nil
 }
 
-// Декодирование запроса на получение контекстов пользователя
+// Декодирование запроса на получение контекстов пользователя; limit и cursor берутся из query
 func DecodeGetUserContextsRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["user_id"]
@@ -228,7 +236,17 @@ func DecodeGetUserContextsRequest(_ context.Context, r *http.Request) (interface
 		return nil, errors.New("invalid user_id format")
 	}
 
-	return transport.GetUserContextRequest{UserID: userID}, nil
+	query := r.URL.Query()
+	req := transport.GetUserContextRequest{UserID: userID, Cursor: query.Get("cursor")}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		req.Limit = limit
+	}
+
+	return req, nil
 }
 
 // Декодирование запроса на удаление одного контекста пользователя
@@ -17,6 +17,8 @@ type EditUserContextRequest struct {
 
 type GetUserContextRequest struct {
 	UserID uuid.UUID `json:"user_id"`
+	Limit  int       `json:"limit,omitempty"`
+	Cursor string    `json:"cursor,omitempty"`
 }
 
 type DeleteUserContextRequest struct {
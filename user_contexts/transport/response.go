@@ -15,10 +15,10 @@ type EditUserContextResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
-// структура ответа GetRoles
+// структура ответа GetUserContexts: страница членств пользователя
 type GetUserContextResponse struct {
-	UserContext domain.UserContext `json:"user_context,omitempty"`
-	Error       string             `json:"error,omitempty"`
+	domain.Page
+	Error string `json:"error,omitempty"`
 }
 
 // структура ответа DeleteRole
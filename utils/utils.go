@@ -4,23 +4,55 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
+	accessServiceFactory "github.com/rafaceo/go-test-auth/access_requests"
+	accessHttp "github.com/rafaceo/go-test-auth/access_requests/transport/http"
+	auditServiceFactory "github.com/rafaceo/go-test-auth/audit"
+	auditHttp "github.com/rafaceo/go-test-auth/audit/transport/http"
+	"github.com/rafaceo/go-test-auth/changefeed"
+	changefeedHttp "github.com/rafaceo/go-test-auth/changefeed/transport/http"
 	authServicePkg "github.com/rafaceo/go-test-auth/cmd/service"
 	authHttp "github.com/rafaceo/go-test-auth/cmd/transport/https"
+	federationServiceFactory "github.com/rafaceo/go-test-auth/federation"
+	federationHttp "github.com/rafaceo/go-test-auth/federation/transport/http"
+	identityServiceFactory "github.com/rafaceo/go-test-auth/identities"
+	identityHttp "github.com/rafaceo/go-test-auth/identities/transport/http"
+	importServiceFactory "github.com/rafaceo/go-test-auth/imports"
+	importHttp "github.com/rafaceo/go-test-auth/imports/transport/http"
+	manifestServiceFactory "github.com/rafaceo/go-test-auth/manifest"
+	manifestHttp "github.com/rafaceo/go-test-auth/manifest/transport/http"
+	merchantServiceFactory "github.com/rafaceo/go-test-auth/merchants"
+	merchantHttp "github.com/rafaceo/go-test-auth/merchants/transport/http"
 	rightsServicePkg "github.com/rafaceo/go-test-auth/rights/service"
 	rightsHttp "github.com/rafaceo/go-test-auth/rights/transport/http"
 	rolesServiceFactory "github.com/rafaceo/go-test-auth/roles"
 	rolesHttp "github.com/rafaceo/go-test-auth/roles/transport/http"
+	samlServiceFactory "github.com/rafaceo/go-test-auth/saml"
+	samlHttp "github.com/rafaceo/go-test-auth/saml/transport/http"
+	scimServiceFactory "github.com/rafaceo/go-test-auth/scim"
+	scimHttp "github.com/rafaceo/go-test-auth/scim/transport/http"
 	userServiceFactory "github.com/rafaceo/go-test-auth/user"
 	userHttp "github.com/rafaceo/go-test-auth/user/transport/http"
 	contextServicePkg "github.com/rafaceo/go-test-auth/user_contexts/service"
 	contextHttp "github.com/rafaceo/go-test-auth/user_contexts/transport/http"
+	webhookServiceFactory "github.com/rafaceo/go-test-auth/webhooks"
+	webhookHttp "github.com/rafaceo/go-test-auth/webhooks/transport/http"
 )
 
-func CreateHTTPRouting(authService authServicePkg.AuthService, rightsService rightsServicePkg.RightsService, contextService contextServicePkg.UserContextService, logger log.Logger, postgres *sqlx.DB) *mux.Router {
+func CreateHTTPRouting(authService authServicePkg.AuthService, rightsService rightsServicePkg.RightsService, contextService contextServicePkg.UserContextService, changefeedHub *changefeed.Hub, samlBaseURL string, logger log.Logger, postgres *sqlx.DB) *mux.Router {
 	userServiceFac := new(userServiceFactory.ServiceFactory).CreateUserService(logger, postgres)
 	rolesServiceFac := new(rolesServiceFactory.ServiceFactory).CreateRolesService(logger, postgres)
+	manifestServiceFac := new(manifestServiceFactory.ServiceFactory).CreateManifestService(logger, postgres)
+	accessServiceFac := new(accessServiceFactory.ServiceFactory).CreateAccessRequestService(logger, postgres, authService)
+	auditServiceFac := new(auditServiceFactory.ServiceFactory).CreateAuditService(logger, postgres)
+	webhookServiceFac := new(webhookServiceFactory.ServiceFactory).CreateWebhookService(logger, postgres)
+	merchantServiceFac := new(merchantServiceFactory.ServiceFactory).CreateMerchantService(logger, postgres)
+	importServiceFac := new(importServiceFactory.ServiceFactory).CreateImportService(logger, postgres)
+	scimServiceFac := new(scimServiceFactory.ServiceFactory).CreateScimService(logger, postgres)
+	federationServiceFac := new(federationServiceFactory.ServiceFactory).CreateFederationService(logger, postgres, authService)
+	samlServiceFac := new(samlServiceFactory.ServiceFactory).CreateSamlService(logger, postgres, authService, samlBaseURL)
+	identityServiceFac := new(identityServiceFactory.ServiceFactory).CreateIdentityService(logger, postgres, authService, federationServiceFac, samlServiceFac)
 	r := mux.NewRouter()
-	userHTTPHandlers := userHttp.GetUserHandler(userServiceFac, logger)
+	userHTTPHandlers := userHttp.GetUserHandler(userServiceFac, authService, logger)
 	if len(userHTTPHandlers) > 0 {
 		for _, userHTTPHandler := range userHTTPHandlers {
 			r.Handle(userHTTPHandler.Path, userHTTPHandler.Handler).Methods(userHTTPHandler.Methods...)
@@ -34,26 +66,103 @@ func CreateHTTPRouting(authService authServicePkg.AuthService, rightsService rig
 		}
 	}
 
-	rolesHTTPHandlers := rolesHttp.GetRoleHandlers(rolesServiceFac, logger)
+	rolesHTTPHandlers := rolesHttp.GetRoleHandlers(rolesServiceFac, authService, logger)
 	if len(rolesHTTPHandlers) > 0 {
 		for _, rolesHTTPHandler := range rolesHTTPHandlers {
 			r.Handle(rolesHTTPHandler.Path, rolesHTTPHandler.Handler).Methods(rolesHTTPHandler.Methods...)
 		}
 	}
 
-	rightsHTTPHandlers := rightsHttp.GetRightHandlers(rightsService, logger)
+	rightsHTTPHandlers := rightsHttp.GetRightHandlers(rightsService, authService, logger)
 	if len(rightsHTTPHandlers) > 0 {
 		for _, rightsHTTPHandler := range rightsHTTPHandlers {
 			r.Handle(rightsHTTPHandler.Path, rightsHTTPHandler.Handler).Methods(rightsHTTPHandler.Methods...)
 		}
 	}
 
-	contextHTTPHandlers := contextHttp.GetUserContextHandlers(contextService, logger)
+	contextHTTPHandlers := contextHttp.GetUserContextHandlers(contextService, authService, logger)
 	if len(contextHTTPHandlers) > 0 {
 		for _, contextHTTPHandler := range contextHTTPHandlers {
 			r.Handle(contextHTTPHandler.Path, contextHTTPHandler.Handler).Methods(contextHTTPHandler.Methods...)
 		}
 	}
 
+	manifestHTTPHandlers := manifestHttp.GetManifestHandlers(manifestServiceFac, authService, logger)
+	if len(manifestHTTPHandlers) > 0 {
+		for _, manifestHTTPHandler := range manifestHTTPHandlers {
+			r.Handle(manifestHTTPHandler.Path, manifestHTTPHandler.Handler).Methods(manifestHTTPHandler.Methods...)
+		}
+	}
+
+	accessHTTPHandlers := accessHttp.GetAccessRequestHandlers(accessServiceFac, logger)
+	if len(accessHTTPHandlers) > 0 {
+		for _, accessHTTPHandler := range accessHTTPHandlers {
+			r.Handle(accessHTTPHandler.Path, accessHTTPHandler.Handler).Methods(accessHTTPHandler.Methods...)
+		}
+	}
+
+	auditHTTPHandlers := auditHttp.GetAuditHandlers(auditServiceFac, logger)
+	if len(auditHTTPHandlers) > 0 {
+		for _, auditHTTPHandler := range auditHTTPHandlers {
+			r.Handle(auditHTTPHandler.Path, auditHTTPHandler.Handler).Methods(auditHTTPHandler.Methods...)
+		}
+	}
+
+	webhookHTTPHandlers := webhookHttp.GetWebhookHandlers(webhookServiceFac, logger)
+	if len(webhookHTTPHandlers) > 0 {
+		for _, webhookHTTPHandler := range webhookHTTPHandlers {
+			r.Handle(webhookHTTPHandler.Path, webhookHTTPHandler.Handler).Methods(webhookHTTPHandler.Methods...)
+		}
+	}
+
+	merchantHTTPHandlers := merchantHttp.GetMerchantHandlers(merchantServiceFac, authService, logger)
+	if len(merchantHTTPHandlers) > 0 {
+		for _, merchantHTTPHandler := range merchantHTTPHandlers {
+			r.Handle(merchantHTTPHandler.Path, merchantHTTPHandler.Handler).Methods(merchantHTTPHandler.Methods...)
+		}
+	}
+
+	importHTTPHandlers := importHttp.GetImportHandlers(importServiceFac, authService, logger)
+	if len(importHTTPHandlers) > 0 {
+		for _, importHTTPHandler := range importHTTPHandlers {
+			r.Handle(importHTTPHandler.Path, importHTTPHandler.Handler).Methods(importHTTPHandler.Methods...)
+		}
+	}
+
+	scimHTTPHandlers := scimHttp.GetScimHandlers(scimServiceFac, authService, logger)
+	if len(scimHTTPHandlers) > 0 {
+		for _, scimHTTPHandler := range scimHTTPHandlers {
+			r.Handle(scimHTTPHandler.Path, scimHTTPHandler.Handler).Methods(scimHTTPHandler.Methods...)
+		}
+	}
+
+	federationHTTPHandlers := federationHttp.GetFederationHandlers(federationServiceFac, authService, logger)
+	if len(federationHTTPHandlers) > 0 {
+		for _, federationHTTPHandler := range federationHTTPHandlers {
+			r.Handle(federationHTTPHandler.Path, federationHTTPHandler.Handler).Methods(federationHTTPHandler.Methods...)
+		}
+	}
+
+	samlHTTPHandlers := samlHttp.GetSamlHandlers(samlServiceFac, authService, logger)
+	if len(samlHTTPHandlers) > 0 {
+		for _, samlHTTPHandler := range samlHTTPHandlers {
+			r.Handle(samlHTTPHandler.Path, samlHTTPHandler.Handler).Methods(samlHTTPHandler.Methods...)
+		}
+	}
+
+	identityHTTPHandlers := identityHttp.GetIdentityHandlers(identityServiceFac, authService, logger)
+	if len(identityHTTPHandlers) > 0 {
+		for _, identityHTTPHandler := range identityHTTPHandlers {
+			r.Handle(identityHTTPHandler.Path, identityHTTPHandler.Handler).Methods(identityHTTPHandler.Methods...)
+		}
+	}
+
+	changefeedHTTPHandlers := changefeedHttp.GetChangefeedHandlers(changefeedHub, authService, logger)
+	if len(changefeedHTTPHandlers) > 0 {
+		for _, changefeedHTTPHandler := range changefeedHTTPHandlers {
+			r.Handle(changefeedHTTPHandler.Path, changefeedHTTPHandler.Handler).Methods(changefeedHTTPHandler.Methods...)
+		}
+	}
+
 	return r
 }
@@ -0,0 +1,190 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead — попытки исчерпаны; доставка повторяется только вручную
+	DeliveryDead = "dead"
+)
+
+// Заголовки запроса доставки
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// MaxAttempts — после стольких неудачных попыток доставка переходит в DeliveryDead
+const MaxAttempts = 8
+
+// Subscription — подписка внешней системы на события. Secret возвращается только при создании.
+// Подписка получает события мерчанта MerchantID и его потомков в реестре: см. EventScope.
+type Subscription struct {
+	ID          uuid.UUID `json:"id"`
+	MerchantID  string    `json:"merchant_id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Secret      string    `json:"secret,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (s Subscription) Validate() error {
+	if strings.TrimSpace(s.MerchantID) == "" {
+		return errors.New("merchant_id is required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	if len(s.EventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, t := range s.EventTypes {
+		if !outboxDomain.KnownEventType(t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// EventScope возвращает мерчанта и пользователя, к которым относится событие. Событие с мерчантом
+// получают подписки этого мерчанта и его предков, событие о пользователе без мерчанта — подписки
+// мерчантов, где у пользователя есть контекст. Событие без того и другого (изменение роли в каталоге)
+// получают все подписки на его тип.
+func EventScope(event outboxDomain.Event) (merchantID, userID string) {
+	var scope struct {
+		MerchantID string `json:"merchant_id"`
+		UserID     string `json:"user_id"`
+	}
+	_ = json.Unmarshal(event.Payload, &scope)
+	return scope.MerchantID, scope.UserID
+}
+
+// Delivery — доставка одного события одной подписке
+type Delivery struct {
+	ID             int64             `json:"id"`
+	SubscriptionID uuid.UUID         `json:"subscription_id"`
+	EventID        int64             `json:"event_id"`
+	EventType      string            `json:"event_type"`
+	Payload        []byte            `json:"-"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  *time.Time        `json:"next_attempt_at,omitempty"`
+	LastStatusCode int               `json:"last_status_code,omitempty"`
+	LastError      string            `json:"last_error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	DeliveredAt    *time.Time        `json:"delivered_at,omitempty"`
+	Log            []DeliveryAttempt `json:"log,omitempty"`
+}
+
+// DeliveryAttempt — запись журнала доставки об одной попытке
+type DeliveryAttempt struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Manual     bool      `json:"manual,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PendingDelivery — доставка вместе с адресом и секретом подписки, как её видит отправитель
+type PendingDelivery struct {
+	Delivery
+	URL    string
+	Secret string
+}
+
+// SubscriptionPatch — изменение подписки; nil и пустой Secret оставляют значение без изменений
+type SubscriptionPatch struct {
+	MerchantID  *string
+	URL         *string
+	EventTypes  []string
+	Description *string
+	Active      *bool
+	Secret      string
+}
+
+type DeliveryFilter struct {
+	SubscriptionID uuid.UUID
+	Status         string
+	Limit          int
+	Cursor         string
+}
+
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor скрывает от клиента, что курсор — это ID последней выданной доставки
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature: t=<unix>,v1=<hex HMAC-SHA256(secret, "<unix>.<body>")>.
+// Время входит в подпись, чтобы получатель мог отбросить перехваченный и повторённый запрос.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff — задержка перед следующей попыткой после attempts неудачных: 30s, 1m, 2m, ... не больше 6 часов
+func Backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
+
+// NewSecret генерирует секрет подписи, если клиент не передал свой
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
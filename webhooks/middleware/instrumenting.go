@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/google/uuid"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/service"
+	"time"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestError   metrics.Counter
+	next           service.WebhookService
+}
+
+func NewInstrumentingMiddleware(counter metrics.Counter, latency metrics.Histogram, counterE metrics.Counter, s service.WebhookService) *instrumentingService {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		requestError:   counterE,
+		next:           s,
+	}
+}
+
+func (s *instrumentingService) CreateSubscription(ctx context.Context, sub domain.Subscription) (created *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "CreateSubscription"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.CreateSubscription(ctx, sub)
+}
+
+func (s *instrumentingService) GetSubscription(ctx context.Context, id uuid.UUID) (sub *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetSubscription"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetSubscription(ctx, id)
+}
+
+func (s *instrumentingService) ListSubscriptions(ctx context.Context) (subs []domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListSubscriptions"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListSubscriptions(ctx)
+}
+
+func (s *instrumentingService) UpdateSubscription(ctx context.Context, id uuid.UUID, patch domain.SubscriptionPatch) (sub *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "UpdateSubscription"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.UpdateSubscription(ctx, id, patch)
+}
+
+func (s *instrumentingService) DeleteSubscription(ctx context.Context, id uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DeleteSubscription"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DeleteSubscription(ctx, id)
+}
+
+func (s *instrumentingService) ListDeliveries(ctx context.Context, filter domain.DeliveryFilter) (page *domain.DeliveryPage, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "ListDeliveries"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListDeliveries(ctx, filter)
+}
+
+func (s *instrumentingService) GetDelivery(ctx context.Context, id int64) (delivery *domain.Delivery, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "GetDelivery"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GetDelivery(ctx, id)
+}
+
+func (s *instrumentingService) Redeliver(ctx context.Context, id int64) (delivery *domain.Delivery, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "Redeliver"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Redeliver(ctx, id)
+}
+
+func (s *instrumentingService) EnqueueEvent(ctx context.Context, event outboxDomain.Event) (enqueued int, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "EnqueueEvent"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.EnqueueEvent(ctx, event)
+}
+
+func (s *instrumentingService) DispatchDue(ctx context.Context) (succeeded int, err error) {
+	defer func(begin time.Time) {
+		labels := []string{"method", "DispatchDue"}
+		s.requestCount.With(labels...).Add(1)
+		if err != nil {
+			s.requestError.With(labels...).Add(1)
+		}
+		s.requestLatency.With(labels...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.DispatchDue(ctx)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/service"
+	"time"
+)
+
+type loggingService struct {
+	logger log.Logger
+	next   service.WebhookService
+}
+
+func NewLoggingMiddleware(logger log.Logger, s service.WebhookService) service.WebhookService {
+	return &loggingService{logger, s}
+}
+
+func (l loggingService) CreateSubscription(ctx context.Context, sub domain.Subscription) (created *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "CreateSubscription",
+			"took", time.Since(begin),
+			"url", sub.URL,
+			"eventTypes", sub.EventTypes,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.CreateSubscription(ctx, sub)
+}
+
+func (l loggingService) GetSubscription(ctx context.Context, id uuid.UUID) (sub *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetSubscription",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetSubscription(ctx, id)
+}
+
+func (l loggingService) ListSubscriptions(ctx context.Context) (subs []domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListSubscriptions",
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListSubscriptions(ctx)
+}
+
+func (l loggingService) UpdateSubscription(ctx context.Context, id uuid.UUID, patch domain.SubscriptionPatch) (sub *domain.Subscription, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "UpdateSubscription",
+			"took", time.Since(begin),
+			"id", id,
+			"active", patch.Active,
+			"secretRotated", patch.Secret != "",
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.UpdateSubscription(ctx, id, patch)
+}
+
+func (l loggingService) DeleteSubscription(ctx context.Context, id uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DeleteSubscription",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DeleteSubscription(ctx, id)
+}
+
+func (l loggingService) ListDeliveries(ctx context.Context, filter domain.DeliveryFilter) (page *domain.DeliveryPage, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "ListDeliveries",
+			"took", time.Since(begin),
+			"subscriptionID", filter.SubscriptionID,
+			"status", filter.Status,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.ListDeliveries(ctx, filter)
+}
+
+func (l loggingService) GetDelivery(ctx context.Context, id int64) (delivery *domain.Delivery, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "GetDelivery",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.GetDelivery(ctx, id)
+}
+
+func (l loggingService) Redeliver(ctx context.Context, id int64) (delivery *domain.Delivery, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "Redeliver",
+			"took", time.Since(begin),
+			"id", id,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.Redeliver(ctx, id)
+}
+
+func (l loggingService) EnqueueEvent(ctx context.Context, event outboxDomain.Event) (enqueued int, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "EnqueueEvent",
+			"took", time.Since(begin),
+			"eventID", event.ID,
+			"type", event.Type,
+			"enqueued", enqueued,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.EnqueueEvent(ctx, event)
+}
+
+func (l loggingService) DispatchDue(ctx context.Context) (succeeded int, err error) {
+	defer func(begin time.Time) {
+		_ = l.logger.Log(
+			"method", "DispatchDue",
+			"took", time.Since(begin),
+			"succeeded", succeeded,
+			"err", err,
+		)
+	}(time.Now())
+
+	return l.next.DispatchDue(ctx)
+}
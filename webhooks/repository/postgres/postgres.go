@@ -0,0 +1,307 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/repository"
+	"time"
+)
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) repository.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, sub *domain.Subscription) error {
+	query := `INSERT INTO webhook_subscriptions (id, merchant_id, url, event_types, secret, description, active, created_by, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.db.ExecContext(ctx, query, sub.ID, sub.MerchantID, sub.URL, pq.Array(sub.EventTypes), sub.Secret, sub.Description,
+		sub.Active, sub.CreatedBy, sub.CreatedAt)
+	return err
+}
+
+func (r *webhookRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
+	query := `SELECT id, COALESCE(merchant_id, ''), url, event_types, secret, description, active, created_by, created_at
+	          FROM webhook_subscriptions WHERE id = $1`
+
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("подписка не найдена")
+		}
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context) ([]domain.Subscription, error) {
+	query := `SELECT id, COALESCE(merchant_id, ''), url, event_types, secret, description, active, created_by, created_at
+	          FROM webhook_subscriptions ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []domain.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *webhookRepository) UpdateSubscription(ctx context.Context, sub domain.Subscription) error {
+	query := `UPDATE webhook_subscriptions
+	          SET merchant_id = $2, url = $3, event_types = $4, secret = $5, description = $6, active = $7
+	          WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, sub.ID, sub.MerchantID, sub.URL, pq.Array(sub.EventTypes), sub.Secret,
+		sub.Description, sub.Active)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, "подписка не найдена")
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, "подписка не найдена")
+}
+
+func (r *webhookRepository) EnqueueEvent(ctx context.Context, event outboxDomain.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	// scope — мерчант события или мерчанты контекстов пользователя вместе с их предками
+	merchantID, userID := domain.EventScope(event)
+	query := `WITH RECURSIVE scope AS (
+	              SELECT id, parent_id FROM merchants
+	              WHERE id = $5::text
+	                 OR ($5::text = '' AND id IN (SELECT merchant_id FROM users_contexts WHERE user_id::text = $6::text))
+	              UNION
+	              SELECT m.id, m.parent_id FROM merchants m JOIN scope s ON m.id = s.parent_id
+	          )
+	          INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+	          SELECT id, $1::bigint, $2::text, $3::jsonb, $4::text, now(), now()
+	          FROM webhook_subscriptions
+	          WHERE active AND $2::text = ANY(event_types)
+	            AND (($5::text = '' AND $6::text = '') OR merchant_id IN (SELECT id FROM scope))
+	          ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, event.ID, event.Type, payload, domain.DeliveryPending, merchantID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *webhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error) {
+	query := `WITH claimed AS (
+	              UPDATE webhook_deliveries
+	              SET next_attempt_at = $3
+	              WHERE id IN (
+	                  SELECT d.id FROM webhook_deliveries d
+	                  JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	                  WHERE d.status = $1 AND d.next_attempt_at <= now() AND s.active
+	                  ORDER BY d.id
+	                  LIMIT $2
+	                  FOR UPDATE OF d SKIP LOCKED
+	              )
+	              RETURNING id, subscription_id, event_id, event_type, payload, status, attempts, created_at
+	          )
+	          SELECT c.id, c.subscription_id, c.event_id, c.event_type, c.payload, c.status, c.attempts, c.created_at,
+	                 s.url, s.secret
+	          FROM claimed c
+	          JOIN webhook_subscriptions s ON s.id = c.subscription_id
+	          ORDER BY c.id`
+
+	rows, err := r.db.QueryContext(ctx, query, domain.DeliveryPending, limit, time.Now().UTC().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.PendingDelivery
+	for rows.Next() {
+		var d domain.PendingDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) GetPendingDelivery(ctx context.Context, id int64) (*domain.PendingDelivery, error) {
+	query := `SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.created_at,
+	                 s.url, s.secret
+	          FROM webhook_deliveries d
+	          JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	          WHERE d.id = $1`
+
+	var d domain.PendingDelivery
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload,
+		&d.Status, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("доставка не найдена")
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *webhookRepository) RecordAttempt(ctx context.Context, deliveryID int64, attempt domain.DeliveryAttempt, status string, nextAttemptAt *time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, manual, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.ExecContext(ctx, query, deliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs,
+		attempt.Manual, attempt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE webhook_deliveries
+	         SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6,
+	             delivered_at = CASE WHEN $2::text = $7::text THEN $8 ELSE delivered_at END
+	         WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, deliveryID, status, attempt.Attempt, nextAttemptAt, attempt.StatusCode, attempt.Error,
+		domain.DeliverySucceeded, attempt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, afterID int64, limit int) ([]domain.Delivery, error) {
+	query := `SELECT id, subscription_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code,
+	                 last_error, created_at, delivered_at
+	          FROM webhook_deliveries
+	          WHERE subscription_id = $1
+	            AND ($2::text = '' OR status = $2::text)
+	            AND id > $3
+	          ORDER BY id
+	          LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, status, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []domain.Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) GetDelivery(ctx context.Context, id int64) (*domain.Delivery, error) {
+	query := `SELECT id, subscription_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code,
+	                 last_error, created_at, delivered_at
+	          FROM webhook_deliveries
+	          WHERE id = $1`
+
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("доставка не найдена")
+		}
+		return nil, err
+	}
+
+	logQuery := `SELECT attempt, status_code, error, duration_ms, manual, created_at
+	             FROM webhook_delivery_attempts
+	             WHERE delivery_id = $1
+	             ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, logQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.DeliveryAttempt
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.Manual, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		delivery.Log = append(delivery.Log, a)
+	}
+
+	return delivery, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row rowScanner) (*domain.Subscription, error) {
+	var sub domain.Subscription
+	var eventTypes pq.StringArray
+	err := row.Scan(&sub.ID, &sub.MerchantID, &sub.URL, &eventTypes, &sub.Secret, &sub.Description, &sub.Active, &sub.CreatedBy, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.EventTypes = eventTypes
+	return &sub, nil
+}
+
+func scanDelivery(row rowScanner) (*domain.Delivery, error) {
+	var d domain.Delivery
+	var nextAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &nextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if nextAttemptAt.Valid && d.Status == domain.DeliveryPending {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func expectOneRow(result sql.Result, notFound string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New(notFound)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"time"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *domain.Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*domain.Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.Subscription, error)
+	UpdateSubscription(ctx context.Context, sub domain.Subscription) error
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+
+	// EnqueueEvent создаёт доставки события активным подпискам на его тип в границах мерчанта
+	// (domain.EventScope). Повторный вызов для того же события ничего не добавляет.
+	EnqueueEvent(ctx context.Context, event outboxDomain.Event) (int, error)
+	// ClaimDue забирает до limit доставок, время которых подошло, и скрывает их от других отправителей на lease
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error)
+	GetPendingDelivery(ctx context.Context, id int64) (*domain.PendingDelivery, error)
+	// RecordAttempt пишет попытку в журнал и обновляет состояние доставки
+	RecordAttempt(ctx context.Context, deliveryID int64, attempt domain.DeliveryAttempt, status string, nextAttemptAt *time.Time) error
+
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, afterID int64, limit int) ([]domain.Delivery, error)
+	GetDelivery(ctx context.Context, id int64) (*domain.Delivery, error)
+}
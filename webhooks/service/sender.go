@@ -0,0 +1,86 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+)
+
+// ErrForbiddenTarget — адрес получателя указывает во внутреннюю сеть
+var ErrForbiddenTarget = errors.New("webhook target resolves to a loopback, private or link-local address")
+
+// Sender отправляет подписанный запрос доставки и возвращает HTTP-статус ответа.
+// Ошибка означает, что получатель событие не принял.
+type Sender interface {
+	Send(ctx context.Context, delivery domain.PendingDelivery) (int, error)
+}
+
+type httpSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender отправляет доставки только на публичные адреса. Адрес проверяется при соединении,
+// уже после разрешения имени, поэтому смена DNS-записи после создания подписки не открывает внутреннюю сеть.
+// Перенаправления не выполняются: ответ 3xx считается отказом получателя.
+func NewHTTPSender(timeout time.Duration) Sender {
+	dialer := &net.Dialer{Timeout: timeout, Control: denyInternal}
+	return &httpSender{client: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// denyInternal вызывается для каждого разрешённого адреса перед соединением
+func denyInternal(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
+
+func (s *httpSender) Send(ctx context.Context, delivery domain.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-test-auth-webhooks")
+	req.Header.Set(domain.EventHeader, delivery.EventType)
+	req.Header.Set(domain.DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(domain.SignatureHeader, domain.Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+)
+
+func TestDenyInternal(t *testing.T) {
+	cases := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.5:80", false},
+		{"172.16.3.4:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, c := range cases {
+		err := denyInternal("tcp", c.address, nil)
+		if c.allowed && err != nil {
+			t.Errorf("%s: unexpected error %v", c.address, err)
+		}
+		if !c.allowed && !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: error = %v, want %v", c.address, err, ErrForbiddenTarget)
+		}
+	}
+}
+
+func TestHTTPSenderRefusesLoopbackTarget(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	sender := NewHTTPSender(5 * time.Second)
+	_, err := sender.Send(context.Background(), domain.PendingDelivery{URL: srv.URL, Secret: "secret"})
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("Send error = %v, want %v", err, ErrForbiddenTarget)
+	}
+	if called {
+		t.Fatal("loopback target received the delivery")
+	}
+}
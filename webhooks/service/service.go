@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/repository"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+	dispatchBatchSize      = 20
+	// dispatchLease должен перекрывать отправку всей пачки с таймаутом отправителя
+	dispatchLease = 5 * time.Minute
+)
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, sub domain.Subscription) (*domain.Subscription, error)
+	GetSubscription(ctx context.Context, id uuid.UUID) (*domain.Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.Subscription, error)
+	UpdateSubscription(ctx context.Context, id uuid.UUID, patch domain.SubscriptionPatch) (*domain.Subscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	ListDeliveries(ctx context.Context, filter domain.DeliveryFilter) (*domain.DeliveryPage, error)
+	GetDelivery(ctx context.Context, id int64) (*domain.Delivery, error)
+	Redeliver(ctx context.Context, id int64) (*domain.Delivery, error)
+	EnqueueEvent(ctx context.Context, event outboxDomain.Event) (int, error)
+	DispatchDue(ctx context.Context) (int, error)
+}
+
+type webhookService struct {
+	repo   repository.WebhookRepository
+	sender Sender
+}
+
+func NewWebhookService(repo repository.WebhookRepository, sender Sender) WebhookService {
+	return &webhookService{repo: repo, sender: sender}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, sub domain.Subscription) (*domain.Subscription, error) {
+	if err := sub.Validate(); err != nil {
+		return nil, err
+	}
+	if sub.Secret == "" {
+		secret, err := domain.NewSecret()
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+
+	sub.ID = uuid.New()
+	sub.Active = true
+	sub.CreatedBy = requestinfo.Actor(ctx)
+	sub.CreatedAt = time.Now().UTC()
+
+	if err := s.repo.CreateSubscription(ctx, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *webhookService) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]domain.Subscription, error) {
+	subs, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+// UpdateSubscription возвращает секрет в ответе, только если он был заменён
+func (s *webhookService) UpdateSubscription(ctx context.Context, id uuid.UUID, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.MerchantID != nil {
+		sub.MerchantID = *patch.MerchantID
+	}
+	if patch.URL != nil {
+		sub.URL = *patch.URL
+	}
+	if patch.EventTypes != nil {
+		sub.EventTypes = patch.EventTypes
+	}
+	if patch.Description != nil {
+		sub.Description = *patch.Description
+	}
+	if patch.Active != nil {
+		sub.Active = *patch.Active
+	}
+	if patch.Secret != "" {
+		sub.Secret = patch.Secret
+	}
+	if err := sub.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateSubscription(ctx, *sub); err != nil {
+		return nil, err
+	}
+	if patch.Secret == "" {
+		sub.Secret = ""
+	}
+	return sub, nil
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, filter domain.DeliveryFilter) (*domain.DeliveryPage, error) {
+	switch filter.Status {
+	case "", domain.DeliveryPending, domain.DeliverySucceeded, domain.DeliveryDead:
+	default:
+		return nil, errors.New("invalid delivery status")
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultDeliveriesLimit
+	}
+	if filter.Limit > maxDeliveriesLimit {
+		filter.Limit = maxDeliveriesLimit
+	}
+	afterID, err := domain.DecodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+	deliveries, err := s.repo.ListDeliveries(ctx, filter.SubscriptionID, filter.Status, afterID, filter.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.DeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > filter.Limit {
+		page.Deliveries = deliveries[:filter.Limit]
+		page.NextCursor = domain.EncodeCursor(page.Deliveries[filter.Limit-1].ID)
+	}
+	return page, nil
+}
+
+func (s *webhookService) GetDelivery(ctx context.Context, id int64) (*domain.Delivery, error) {
+	return s.repo.GetDelivery(ctx, id)
+}
+
+// Redeliver сразу отправляет доставку повторно, в том числе уже успешную или исчерпавшую попытки.
+// Неудачная ручная попытка не меняет статус dead и succeeded.
+func (s *webhookService) Redeliver(ctx context.Context, id int64) (*domain.Delivery, error) {
+	delivery, err := s.repo.GetPendingDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.deliver(ctx, *delivery, true); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDelivery(ctx, id)
+}
+
+func (s *webhookService) EnqueueEvent(ctx context.Context, event outboxDomain.Event) (int, error) {
+	return s.repo.EnqueueEvent(ctx, event)
+}
+
+// DispatchDue отправляет доставки, время которых подошло, и возвращает число успешных
+func (s *webhookService) DispatchDue(ctx context.Context) (int, error) {
+	succeeded := 0
+	for {
+		deliveries, err := s.repo.ClaimDue(ctx, dispatchBatchSize, dispatchLease)
+		if err != nil {
+			return succeeded, err
+		}
+
+		for _, delivery := range deliveries {
+			status, err := s.deliver(ctx, delivery, false)
+			if err != nil {
+				return succeeded, err
+			}
+			if status == domain.DeliverySucceeded {
+				succeeded++
+			}
+		}
+
+		if len(deliveries) < dispatchBatchSize {
+			return succeeded, nil
+		}
+	}
+}
+
+// deliver делает одну попытку, сохраняет её в журнал и возвращает новый статус доставки.
+// Ошибка получателя не возвращается: она попадает в журнал и определяет следующее состояние.
+func (s *webhookService) deliver(ctx context.Context, delivery domain.PendingDelivery, manual bool) (string, error) {
+	started := time.Now()
+	statusCode, sendErr := s.sender.Send(ctx, delivery)
+
+	attempt := domain.DeliveryAttempt{
+		Attempt:    delivery.Attempts + 1,
+		StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds(),
+		Manual:     manual,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	status := delivery.Status
+	var nextAttemptAt *time.Time
+	switch {
+	case sendErr == nil:
+		status = domain.DeliverySucceeded
+	case manual && status != domain.DeliveryPending:
+		attempt.Error = sendErr.Error()
+	case attempt.Attempt >= domain.MaxAttempts:
+		attempt.Error = sendErr.Error()
+		status = domain.DeliveryDead
+	default:
+		attempt.Error = sendErr.Error()
+		next := attempt.CreatedAt.Add(domain.Backoff(attempt.Attempt))
+		nextAttemptAt = &next
+	}
+
+	if err := s.repo.RecordAttempt(ctx, delivery.ID, attempt, status, nextAttemptAt); err != nil {
+		return "", err
+	}
+	return status, nil
+}
@@ -0,0 +1,303 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rafaceo/go-test-auth/cmd/errors_auth/encoders"
+	"github.com/rafaceo/go-test-auth/common-libs/httphandlers"
+	"github.com/rafaceo/go-test-auth/common-libs/requestinfo"
+	"github.com/rafaceo/go-test-auth/webhooks/domain"
+	"github.com/rafaceo/go-test-auth/webhooks/service"
+	"github.com/rafaceo/go-test-auth/webhooks/transport"
+	"net/http"
+	"strconv"
+)
+
+func GetWebhookHandlers(serv service.WebhookService, logger kitlog.Logger) []*httphandlers.HTTPHandler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encoders.EncodeErrorAUTH),
+		kithttp.ServerBefore(requestinfo.PopulateRequestContext),
+	}
+
+	createHandler := kithttp.NewServer(
+		MakeCreateSubscriptionEndpoint(serv),
+		DecodeCreateSubscriptionRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listHandler := kithttp.NewServer(
+		MakeListSubscriptionsEndpoint(serv),
+		DecodeListSubscriptionsRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getHandler := kithttp.NewServer(
+		MakeGetSubscriptionEndpoint(serv),
+		DecodeSubscriptionIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	updateHandler := kithttp.NewServer(
+		MakeUpdateSubscriptionEndpoint(serv),
+		DecodeUpdateSubscriptionRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	deleteHandler := kithttp.NewServer(
+		MakeDeleteSubscriptionEndpoint(serv),
+		DecodeSubscriptionIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	listDeliveriesHandler := kithttp.NewServer(
+		MakeListDeliveriesEndpoint(serv),
+		DecodeListDeliveriesRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	getDeliveryHandler := kithttp.NewServer(
+		MakeGetDeliveryEndpoint(serv),
+		DecodeDeliveryIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	redeliverHandler := kithttp.NewServer(
+		MakeRedeliverEndpoint(serv),
+		DecodeDeliveryIDRequest,
+		EncodeResponse,
+		opts...,
+	)
+
+	return []*httphandlers.HTTPHandler{
+		{
+			Path:    "/api/v4/webhooks",
+			Handler: createHandler,
+			Methods: []string{"POST"},
+		},
+		{
+			Path:    "/api/v4/webhooks",
+			Handler: listHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/webhooks/{id}",
+			Handler: getHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/webhooks/{id}",
+			Handler: updateHandler,
+			Methods: []string{"PATCH"},
+		},
+		{
+			Path:    "/api/v4/webhooks/{id}",
+			Handler: deleteHandler,
+			Methods: []string{"DELETE"},
+		},
+		{
+			Path:    "/api/v4/webhooks/{id}/deliveries",
+			Handler: listDeliveriesHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/webhook-deliveries/{id}",
+			Handler: getDeliveryHandler,
+			Methods: []string{"GET"},
+		},
+		{
+			Path:    "/api/v4/webhook-deliveries/{id}/redeliver",
+			Handler: redeliverHandler,
+			Methods: []string{"POST"},
+		},
+	}
+}
+
+func MakeCreateSubscriptionEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.CreateSubscriptionRequest)
+		sub, err := svc.CreateSubscription(ctx, domain.Subscription{
+			MerchantID:  req.MerchantID,
+			URL:         req.URL,
+			EventTypes:  req.EventTypes,
+			Secret:      req.Secret,
+			Description: req.Description,
+		})
+		if err != nil {
+			return transport.SubscriptionResponse{Error: err.Error()}, nil
+		}
+		return transport.SubscriptionResponse{Subscription: sub}, nil
+	}
+}
+
+func MakeListSubscriptionsEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		subs, err := svc.ListSubscriptions(ctx)
+		if err != nil {
+			return transport.ListSubscriptionsResponse{Error: err.Error()}, nil
+		}
+		return transport.ListSubscriptionsResponse{Subscriptions: subs}, nil
+	}
+}
+
+func MakeGetSubscriptionEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.SubscriptionIDRequest)
+		sub, err := svc.GetSubscription(ctx, req.ID)
+		if err != nil {
+			return transport.SubscriptionResponse{Error: err.Error()}, nil
+		}
+		return transport.SubscriptionResponse{Subscription: sub}, nil
+	}
+}
+
+func MakeUpdateSubscriptionEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.UpdateSubscriptionRequest)
+		sub, err := svc.UpdateSubscription(ctx, req.ID, domain.SubscriptionPatch{
+			MerchantID:  req.MerchantID,
+			URL:         req.URL,
+			EventTypes:  req.EventTypes,
+			Description: req.Description,
+			Active:      req.Active,
+			Secret:      req.Secret,
+		})
+		if err != nil {
+			return transport.SubscriptionResponse{Error: err.Error()}, nil
+		}
+		return transport.SubscriptionResponse{Subscription: sub}, nil
+	}
+}
+
+func MakeDeleteSubscriptionEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.SubscriptionIDRequest)
+		if err := svc.DeleteSubscription(ctx, req.ID); err != nil {
+			return transport.MessageResponse{Error: err.Error()}, nil
+		}
+		return transport.MessageResponse{Message: "Подписка удалена"}, nil
+	}
+}
+
+func MakeListDeliveriesEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		filter := request.(domain.DeliveryFilter)
+		page, err := svc.ListDeliveries(ctx, filter)
+		if err != nil {
+			return transport.ListDeliveriesResponse{Error: err.Error()}, nil
+		}
+		return transport.ListDeliveriesResponse{DeliveryPage: *page}, nil
+	}
+}
+
+func MakeGetDeliveryEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DeliveryIDRequest)
+		delivery, err := svc.GetDelivery(ctx, req.ID)
+		if err != nil {
+			return transport.DeliveryResponse{Error: err.Error()}, nil
+		}
+		return transport.DeliveryResponse{Delivery: delivery}, nil
+	}
+}
+
+func MakeRedeliverEndpoint(svc service.WebhookService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transport.DeliveryIDRequest)
+		delivery, err := svc.Redeliver(ctx, req.ID)
+		if err != nil {
+			return transport.DeliveryResponse{Error: err.Error()}, nil
+		}
+		return transport.DeliveryResponse{Delivery: delivery}, nil
+	}
+}
+
+func DecodeCreateSubscriptionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transport.CreateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeListSubscriptionsRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return transport.ListSubscriptionsRequest{}, nil
+}
+
+func DecodeSubscriptionIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid subscription ID")
+	}
+	return transport.SubscriptionIDRequest{ID: id}, nil
+}
+
+func DecodeUpdateSubscriptionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid subscription ID")
+	}
+
+	var req transport.UpdateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.ID = id
+
+	return req, nil
+}
+
+// DecodeListDeliveriesRequest читает из query status, limit и cursor из next_cursor предыдущей страницы
+func DecodeListDeliveriesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errors.New("invalid subscription ID")
+	}
+
+	query := r.URL.Query()
+	filter := domain.DeliveryFilter{
+		SubscriptionID: id,
+		Status:         query.Get("status"),
+		Cursor:         query.Get("cursor"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func DecodeDeliveryIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid delivery ID")
+	}
+	return transport.DeliveryIDRequest{ID: id}, nil
+}
+
+func EncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
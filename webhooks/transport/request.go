@@ -0,0 +1,32 @@
+package transport
+
+import "github.com/google/uuid"
+
+type CreateSubscriptionRequest struct {
+	MerchantID  string   `json:"merchant_id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Secret      string   `json:"secret,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type SubscriptionIDRequest struct {
+	ID uuid.UUID `json:"-"`
+}
+
+type ListSubscriptionsRequest struct{}
+
+// UpdateSubscriptionRequest — поля, которых нет в теле, не меняются; непустой secret заменяет секрет
+type UpdateSubscriptionRequest struct {
+	ID          uuid.UUID `json:"-"`
+	MerchantID  *string   `json:"merchant_id,omitempty"`
+	URL         *string   `json:"url,omitempty"`
+	EventTypes  []string  `json:"event_types,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Active      *bool     `json:"active,omitempty"`
+	Secret      string    `json:"secret,omitempty"`
+}
+
+type DeliveryIDRequest struct {
+	ID int64 `json:"-"`
+}
@@ -0,0 +1,28 @@
+package transport
+
+import "github.com/rafaceo/go-test-auth/webhooks/domain"
+
+type SubscriptionResponse struct {
+	Subscription *domain.Subscription `json:"subscription,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+type ListSubscriptionsResponse struct {
+	Subscriptions []domain.Subscription `json:"subscriptions"`
+	Error         string                `json:"error,omitempty"`
+}
+
+type ListDeliveriesResponse struct {
+	domain.DeliveryPage
+	Error string `json:"error,omitempty"`
+}
+
+type DeliveryResponse struct {
+	Delivery *domain.Delivery `json:"delivery,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
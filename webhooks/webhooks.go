@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaceo/go-test-auth/common-libs/instrumenting"
+	outboxDomain "github.com/rafaceo/go-test-auth/outbox/domain"
+	"github.com/rafaceo/go-test-auth/outbox/publisher"
+	"github.com/rafaceo/go-test-auth/webhooks/middleware"
+	"github.com/rafaceo/go-test-auth/webhooks/repository/postgres"
+	"github.com/rafaceo/go-test-auth/webhooks/service"
+)
+
+// sendTimeout ограничивает ожидание ответа получателя на одну попытку
+const sendTimeout = 10 * time.Second
+
+type ServiceFactory struct{}
+
+func (sf *ServiceFactory) CreateWebhookService(logger log.Logger, postgresClient *sqlx.DB) service.WebhookService {
+	webhookServ := newService(logger, postgresClient, "webhooks")
+
+	counter, duration, counterError := instrumenting.GetMetricsBySubsystem("webhook_service")
+	webhookServ = middleware.NewInstrumentingMiddleware(counter, duration, counterError, webhookServ)
+
+	return webhookServ
+}
+
+// CreatePublisher возвращает publisher для ретранслятора outbox: событие превращается
+// в доставки подписчикам, а отправляет их Dispatcher
+func (sf *ServiceFactory) CreatePublisher(logger log.Logger, postgresClient *sqlx.DB) publisher.Publisher {
+	return eventPublisher{service: newService(logger, postgresClient, "webhook_publisher")}
+}
+
+func (sf *ServiceFactory) CreateDispatcher(logger log.Logger, postgresClient *sqlx.DB, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		service:  newService(logger, postgresClient, "webhook_dispatcher"),
+		interval: interval,
+	}
+}
+
+func newService(logger log.Logger, postgresClient *sqlx.DB, component string) service.WebhookService {
+	webhookServ := service.NewWebhookService(postgres.NewWebhookRepository(postgresClient), service.NewHTTPSender(sendTimeout))
+	return middleware.NewLoggingMiddleware(log.With(logger, "component", component), webhookServ)
+}
+
+type eventPublisher struct {
+	service service.WebhookService
+}
+
+func (p eventPublisher) Publish(ctx context.Context, event outboxDomain.Event) error {
+	_, err := p.service.EnqueueEvent(ctx, event)
+	return err
+}
+
+func (p eventPublisher) Close() error {
+	return nil
+}
+
+// Dispatcher периодически отправляет доставки, время которых подошло
+type Dispatcher struct {
+	service  service.WebhookService
+	interval time.Duration
+}
+
+// Run блокируется до отмены ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = d.service.DispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}